@@ -0,0 +1,85 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"context"
+	"go/types"
+	"maps"
+
+	cpb "github.com/google/capslock/proto"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/packages"
+)
+
+// Analysis holds the call graph of a set of packages and the capabilities
+// of the functions in it, so that several outputs can be produced from one
+// analysis.  Building the call graph and classifying its functions is most
+// of the work of GetCapabilityInfo, GetCapabilityStats and
+// GetCapabilityCounts, and an Analysis does it only once, in NewAnalysis.
+type Analysis struct {
+	pkgs            []*packages.Package
+	queriedPackages map[*types.Package]struct{}
+	config          *Config
+}
+
+// classifiedGraph holds the results of getPackageNodesWithCapability, so that
+// they can be reused by later analyses with the same Config.
+type classifiedGraph struct {
+	graph                  *callgraph.Graph
+	safe                   nodeset
+	nodesByCapability      nodesetPerCapability
+	extraNodesByCapability nodesetPerCapability
+	callCapabilities       edgeCapabilities
+	sites                  capabilitySites
+}
+
+// NewAnalysis builds the call graph of pkgs and classifies the functions in
+// it using config.  The methods of the returned Analysis report the
+// capabilities of the functions in queriedPackages, using the same config.
+// config should not be modified afterwards.
+//
+// NewAnalysis may modify pkgs.
+func NewAnalysis(pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config) (*Analysis, error) {
+	c := *config
+	var (
+		cg  classifiedGraph
+		err error
+	)
+	cg.graph, cg.safe, cg.nodesByCapability, cg.extraNodesByCapability, cg.callCapabilities, cg.sites, err = getPackageNodesWithCapability(pkgs, &c)
+	if err != nil {
+		return nil, err
+	}
+	c.classified = &cg
+	return &Analysis{pkgs: pkgs, queriedPackages: queriedPackages, config: &c}, nil
+}
+
+// get returns the results of getPackageNodesWithCapability held by cg.  The
+// sets of nodes with each capability are copied, since mergeCapabilities
+// adds to them.
+func (cg *classifiedGraph) get() (*callgraph.Graph, nodeset, nodesetPerCapability, nodesetPerCapability, edgeCapabilities, capabilitySites) {
+	nodesByCapability := make(nodesetPerCapability, len(cg.nodesByCapability))
+	for c, ns := range cg.nodesByCapability {
+		nodesByCapability[c] = maps.Clone(ns)
+	}
+	return cg.graph, cg.safe, nodesByCapability, cg.extraNodesByCapability, cg.callCapabilities, cg.sites
+}
+
+// Info returns the result of GetCapabilityInfo for the packages of a.
+func (a *Analysis) Info(ctx context.Context) (*cpb.CapabilityInfoList, error) {
+	return GetCapabilityInfo(ctx, a.pkgs, a.queriedPackages, a.config)
+}
+
+// Stats returns the result of GetCapabilityStats for the packages of a.
+func (a *Analysis) Stats(ctx context.Context) (*cpb.CapabilityStatList, error) {
+	return GetCapabilityStats(ctx, a.pkgs, a.queriedPackages, a.config)
+}
+
+// Counts returns the result of GetCapabilityCounts for the packages of a.
+func (a *Analysis) Counts(ctx context.Context) (*cpb.CapabilityCountList, error) {
+	return GetCapabilityCounts(ctx, a.pkgs, a.queriedPackages, a.config)
+}
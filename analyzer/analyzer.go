@@ -7,8 +7,13 @@
 package analyzer
 
 import (
+	"context"
+	"fmt"
 	"go/ast"
+	"go/token"
 	"go/types"
+	"maps"
+	"regexp"
 	"slices"
 	"sort"
 	"strings"
@@ -28,14 +33,145 @@ type Config struct {
 	// DisableBuiltin disables some additional source-code analyses that find
 	// more capabilities in functions.
 	DisableBuiltin bool
-	// Granularity determines whether capability sets are examined per-package
-	// or per-function when doing comparisons.
+	// Granularity determines whether capability sets are examined per-package,
+	// per-module, or per-function when doing comparisons.
 	Granularity Granularity
-	// CapabilitySet is the set of capabilities to use for graph output mode.
+	// CapabilitySet is the set of capabilities to use for the graph and
+	// graphml output modes, intermediate granularity and GetCapabilityStats.
 	// If CapabilitySet is nil, all capabilities are used.
 	CapabilitySet *CapabilitySet
 	// OmitPaths disables output of example call paths.
 	OmitPaths bool
+	// Baseline, if non-nil, is a set of accepted capabilities which are
+	// omitted from the output of GetCapabilityInfo.  It is not used when
+	// comparing against a previous output, which is itself the baseline.
+	Baseline *Baseline
+	// CallGraphAlgorithm selects the algorithm used to construct the call
+	// graph.  The zero value selects the default algorithm.
+	CallGraphAlgorithm CallGraphAlgorithm
+	// PruneDynamicDispatch ignores calls of interface methods whose callee is
+	// outside the modules of the analyzed packages.  With a call graph
+	// algorithm such as CHA, an interface method call can reach every
+	// implementation of the method in the program, which produces many
+	// spurious capabilities in interface-heavy code.  This option is unsound:
+	// capabilities which really are reachable through such calls are missed.
+	PruneDynamicDispatch bool
+	// MaxPathLength, if positive, is the maximum number of functions in the
+	// example paths output by GetCapabilityInfo.  Longer paths are cut short
+	// and marked as truncated; the capability is still reported.  Only the
+	// part of each path which is output is followed to build it, so this
+	// bounds the cost of building paths.  The search for capabilities still
+	// visits every function which can reach one, so that none are missed, and
+	// the type and ID of each path are those of the whole path.
+	MaxPathLength int
+	// PrunePackageInfo restricts the ModuleInfo and PackageInfo output by
+	// GetCapabilityInfo to the modules and packages which appear on the path
+	// to at least one reported capability.  By default, they include every
+	// dependency of the analyzed packages.
+	PrunePackageInfo bool
+	// ProgressFn, if non-nil, is called at milestones during the analysis,
+	// such as when the call graph has been built.  It can be used to show the
+	// progress of long-running analyses.
+	ProgressFn func(ProgressEvent)
+	// ExcludePackages is a list of import path patterns, such as
+	// "example.com/generated/...".  Functions in matching packages are not
+	// reported as the starting point of paths to capabilities, but paths
+	// through them from other packages are still followed and reported.
+	ExcludePackages []string
+	// CollapseStdlib replaces each run of consecutive standard library
+	// functions in the example paths output by GetCapabilityInfo with a single
+	// entry naming the first and last package in the run.  The first and last
+	// functions in a path, including the function with the capability, are
+	// always kept.
+	CollapseStdlib bool
+	// Program, if non-nil, holds the packages being analyzed and keeps their
+	// call graph for reuse by later analyses.  See Program.
+	Program *Program
+	// OnlyReachableFromMain restricts the reported capabilities to functions
+	// which can be reached in the call graph from an entry point of the
+	// program: the main function of a main package, or the initializer of any
+	// package.  Capabilities of dead code are then not reported.  The paths
+	// from the reported functions to their capabilities are found as usual.
+	OnlyReachableFromMain bool
+	// ExportedEntryPoints, when OnlyReachableFromMain is set, also treats the
+	// exported functions and methods of the queried packages as entry points,
+	// so that the API of a library is not treated as dead code.
+	ExportedEntryPoints bool
+	// UseDirectives classifies the functions and methods declared in the
+	// analyzed packages, but not their dependencies, according to directive
+	// comments in their doc comments, in place of Classifier.  A function
+	// documented with "//capslock:safe" is treated as safe, and one documented
+	// with "//capslock:capability NETWORK" has CAPABILITY_NETWORK.  Functions
+	// with conflicting directives are an error.  Since directives let the
+	// analyzed code hide its own capabilities, they should only be used for
+	// code the user trusts.
+	UseDirectives bool
+	// IncludeWrappers keeps the synthetic wrappers of methods, such as bound
+	// method values and the pointer-receiver wrappers of value methods, in the
+	// example paths output by GetCapabilityInfo and GetCapabilityStats, with
+	// Function.Wrapper describing each.  By default they are omitted for
+	// readability, and the call to each omitted wrapper is shown as a call to
+	// the function it wraps.
+	IncludeWrappers bool
+	// OnlyTransitive restricts the output of GetCapabilityInfo to entries
+	// whose path is transitive, that is, which reach the capability through a
+	// package other than the one the path starts in.  Direct paths are
+	// skipped as they are found, so no example path is built for them.
+	OnlyTransitive bool
+	// OnlyDirect restricts the output of GetCapabilityInfo to entries whose
+	// path is direct.  OnlyTransitive and OnlyDirect cannot both be set, and
+	// neither is supported with intermediate granularity.
+	OnlyDirect bool
+	// MergeMajorVersions treats packages and modules whose paths differ only
+	// in major version elements, such as math/rand and math/rand/v2, or
+	// example.com/m and example.com/m/v2, as the same package or module when
+	// keeping one entry for each with package or module granularity.  The
+	// entries kept still report their exact paths.
+	MergeMajorVersions bool
+	// ReportReplacedAsLocal attributes the packages of modules which are
+	// replaced by a replace directive in the main module's go.mod file to the
+	// replacement, such as a local fork, rather than to the module they
+	// replace.  CapabilityInfo.ModulePath and CapabilityModule, and the
+	// modules used with module granularity, are then those of the
+	// replacement.  The ModuleInfo list always notes each replacement.
+	ReportReplacedAsLocal bool
+	// ExcludeReplaced treats the packages of replaced modules as if they
+	// matched ExcludePackages, so that functions in them are not reported as
+	// the starting point of paths to capabilities.
+	ExcludeReplaced bool
+	// MaxSSAConcurrency, if positive, limits the number of packages whose SSA
+	// code is built at the same time.  By default every package is built
+	// concurrently, which is fastest, but the memory used while building all
+	// of them at once can exceed what a small machine has.  Setting it to 1
+	// builds one package at a time, trading time for a lower peak memory use.
+	MaxSSAConcurrency int
+	// IgnoreLoadErrors proceeds with the analysis when some packages had
+	// errors when they were loaded, such as packages which do not compile.
+	// Packages which could not be type-checked are then not analyzed, so
+	// their capabilities are not reported.  By default the analysis functions
+	// return a *LoadError instead, so that this is not silent.
+	IgnoreLoadErrors bool
+	// ExcludeInitFunctions does not follow the calls made by init functions,
+	// including the initializers of package-level variables, so that only
+	// the capabilities used through a package's API are reported.  By
+	// default, paths from a package's initialization to capabilities are
+	// reported like any other.  Capabilities of the init functions' own code,
+	// such as converting an unsafe.Pointer in the initializer of a variable,
+	// are still reported.
+	ExcludeInitFunctions bool
+	// MaxPathCount limits the number of distinct paths to each capability
+	// counted by GetCapabilityStats.  If it is zero, DefaultMaxPathCount is
+	// used.
+	MaxPathCount int
+	// AnnotateInstantiations records, in the Instantiations of each
+	// CapabilityInfo, the type arguments of the instantiations of generic
+	// functions in its full path, to show which instantiations a capability
+	// depends on.  It has no effect with GranularityIntermediate.
+	AnnotateInstantiations bool
+
+	// classified, if non-nil, holds the call graph and classification
+	// computed by NewAnalysis, which are used instead of computing them again.
+	classified *classifiedGraph
 }
 
 // Classifier is an interface for types that help map code features to
@@ -57,6 +193,302 @@ type Classifier interface {
 	IncludeCall(edge *callgraph.Edge) bool
 }
 
+// CallClassifier is an optional interface for Classifiers which can
+// categorize individual calls, for functions whose capability depends on the
+// arguments they are passed.
+type CallClassifier interface {
+	Classifier
+
+	// CallCategory returns a Category for the call represented by edge.  If
+	// the return value is Unspecified, the call has the category of its
+	// callee.  If it is a combined capability, such as CAPABILITY_FILES, the
+	// call has each of the capabilities it contains.  Individual calls cannot
+	// be categorized as Safe.
+	CallCategory(edge *callgraph.Edge) cpb.Capability
+}
+
+// ArgAwareClassifier is an optional interface for Classifiers which can
+// categorize a call to a function using the values of its arguments, for
+// example to distinguish reads from writes by the flag passed to os.OpenFile.
+// It is consulted for each call whose SSA arguments are available, unless the
+// Classifier is also a CallClassifier, whose CallCategory is used instead;
+// other calls have the category returned by FunctionCategory.
+type ArgAwareClassifier interface {
+	Classifier
+
+	// FunctionCategoryWithArgs returns a Category for a call to the function
+	// specified by pkg and name, which are as in FunctionCategory, with the
+	// arguments args.  For a call of an interface method, args does not
+	// include the receiver; for other method calls it does.  If the return
+	// value is Unspecified, the call has the category returned by
+	// FunctionCategory.  As for CallCategory, a call categorized as a combined
+	// capability has each of the capabilities it contains, and individual
+	// calls cannot be categorized as Safe.
+	FunctionCategoryWithArgs(pkg string, name string, args []ssa.Value) cpb.Capability
+}
+
+// SeverityClassifier is an optional interface for Classifiers which assign
+// a severity to each capability, such as *interesting.Classifier.  The
+// severity is reported in CapabilityInfo and CapabilityStats.  For other
+// Classifiers, the default severity from interesting.Severity is used.
+type SeverityClassifier interface {
+	Classifier
+
+	// Severity returns the severity of the capability c, from
+	// interesting.SeverityNone to interesting.SeverityCritical.
+	Severity(c cpb.Capability) int
+}
+
+// capabilitySeverity returns the severity of the capability c given by
+// classifier, if it is a SeverityClassifier, or its default severity
+// otherwise.
+func capabilitySeverity(classifier Classifier, c cpb.Capability) int {
+	if sc, ok := classifier.(SeverityClassifier); ok {
+		return sc.Severity(c)
+	}
+	return interesting.Severity(c)
+}
+
+// CWEClassifier is an optional interface for Classifiers which relate each
+// capability to entries of the Common Weakness Enumeration, such as
+// *interesting.Classifier.  The identifiers are reported in CapabilityInfo.
+// For other Classifiers, the defaults from interesting.CWE are used.
+type CWEClassifier interface {
+	Classifier
+
+	// CWE returns the identifiers, such as "CWE-78", of the CWE entries
+	// related to the capability c.
+	CWE(c cpb.Capability) []string
+}
+
+// capabilityCWE returns the CWE identifiers for the capability c given by
+// classifier, if it is a CWEClassifier, or the default ones otherwise.
+func capabilityCWE(classifier Classifier, c cpb.Capability) []string {
+	if cc, ok := classifier.(CWEClassifier); ok {
+		return cc.CWE(c)
+	}
+	return interesting.CWE(c)
+}
+
+// callCategory returns the category of the call represented by edge given by
+// classifier, if it is a CallClassifier or an ArgAwareClassifier.  If it is
+// both, only CallCategory is used, so a classifier whose CallCategory looks at
+// the arguments of the call, like *interesting.Classifier, does not examine
+// them twice.  It returns Unspecified if the classifier gives no category.
+func callCategory(classifier Classifier, edge *callgraph.Edge) cpb.Capability {
+	if cc, ok := classifier.(CallClassifier); ok {
+		return cc.CallCategory(edge)
+	}
+	ac, ok := classifier.(ArgAwareClassifier)
+	if !ok || edge.Site == nil || edge.Callee == nil || edge.Callee.Func == nil {
+		return cpb.Capability_CAPABILITY_UNSPECIFIED
+	}
+	pkg, name, ok := functionName(edge.Callee.Func)
+	if !ok {
+		return cpb.Capability_CAPABILITY_UNSPECIFIED
+	}
+	return ac.FunctionCategoryWithArgs(pkg, name, edge.Site.Common().Args)
+}
+
+// categorizesCalls returns true if classifier can categorize individual
+// calls, because it is a CallClassifier or an ArgAwareClassifier.
+func categorizesCalls(classifier Classifier) bool {
+	switch classifier.(type) {
+	case CallClassifier, ArgAwareClassifier:
+		return true
+	}
+	return false
+}
+
+// EdgeEndpoints returns the paths of the packages containing the caller and
+// callee of edge.  ok is false if either function has no package, as is the
+// case for some synthetic functions.
+func EdgeEndpoints(edge *callgraph.Edge) (callerPkg, calleePkg string, ok bool) {
+	if edge == nil || edge.Caller == nil || edge.Callee == nil || edge.Caller.Func == nil || edge.Callee.Func == nil {
+		return "", "", false
+	}
+	callerPkg, calleePkg = packagePath(edge.Caller.Func), packagePath(edge.Callee.Func)
+	if callerPkg == "" || calleePkg == "" {
+		return "", "", false
+	}
+	return callerPkg, calleePkg, true
+}
+
+// IncludeCallByPackage returns a Classifier which is the same as c, except
+// that calls are excluded when prune returns true for the packages of the
+// caller and callee.  prune is not called for edges whose endpoints have no
+// package; those are included or excluded by c.
+func IncludeCallByPackage(c Classifier, prune func(callerPkg, calleePkg string) bool) Classifier {
+	return forwardCallCategory(pruningClassifier{wrappedClassifier{c}, prune}, c)
+}
+
+// wrappedClassifier is embedded in Classifiers which wrap another Classifier
+// to change some of its methods.  It forwards the severities and CWE
+// identifiers given by the wrapped Classifier.
+type wrappedClassifier struct {
+	Classifier
+}
+
+func (w wrappedClassifier) Severity(c cpb.Capability) int {
+	return capabilitySeverity(w.Classifier, c)
+}
+
+func (w wrappedClassifier) CWE(c cpb.Capability) []string {
+	return capabilityCWE(w.Classifier, c)
+}
+
+// forwardCallCategory returns w, a Classifier wrapping inner, as a
+// CallClassifier which categorizes calls as inner does, if inner can
+// categorize individual calls, and w itself otherwise.
+func forwardCallCategory(w, inner Classifier) Classifier {
+	return withCallCategory(w, inner, func(edge *callgraph.Edge) cpb.Capability {
+		return callCategory(inner, edge)
+	})
+}
+
+// withCallCategory returns w, a Classifier wrapping inner, as a
+// CallClassifier whose CallCategory is category, if inner can categorize
+// individual calls, and w itself otherwise.
+func withCallCategory(w, inner Classifier, category func(edge *callgraph.Edge) cpb.Capability) Classifier {
+	if !categorizesCalls(inner) {
+		return w
+	}
+	return callCategoryClassifier{wrappedClassifier{w}, category}
+}
+
+type callCategoryClassifier struct {
+	wrappedClassifier
+	category func(edge *callgraph.Edge) cpb.Capability
+}
+
+func (c callCategoryClassifier) CallCategory(edge *callgraph.Edge) cpb.Capability {
+	return c.category(edge)
+}
+
+type pruningClassifier struct {
+	wrappedClassifier
+	prune func(callerPkg, calleePkg string) bool
+}
+
+func (p pruningClassifier) IncludeCall(edge *callgraph.Edge) bool {
+	if callerPkg, calleePkg, ok := EdgeEndpoints(edge); ok && p.prune(callerPkg, calleePkg) {
+		return false
+	}
+	return p.Classifier.IncludeCall(edge)
+}
+
+// pruneCalls returns config, or if config.PruneDynamicDispatch or
+// config.ExcludeInitFunctions is set, a copy of config whose Classifier also
+// excludes the calls they prune.  With PruneDynamicDispatch, these are calls
+// of interface methods whose callee is not in one of the modules containing
+// pkgs.  Packages with no module are treated as modules of their own.  With
+// ExcludeInitFunctions, they are the calls made by init functions.
+func pruneCalls(pkgs []*packages.Package, config *Config) *Config {
+	if config.ExcludeInitFunctions {
+		c := *config
+		c.Classifier = forwardCallCategory(initPruningClassifier{wrappedClassifier{config.Classifier}}, config.Classifier)
+		config = &c
+	}
+	if !config.PruneDynamicDispatch {
+		return config
+	}
+	modules := modulePaths(pkgs, config.ReportReplacedAsLocal)
+	queried := make(map[string]struct{})
+	for _, pkg := range pkgs {
+		queried[modules[pkg.PkgPath]] = struct{}{}
+	}
+	c := *config
+	c.Classifier = forwardCallCategory(dispatchPruningClassifier{wrappedClassifier{config.Classifier}, func(callee *types.Package) bool {
+		if callee == nil {
+			return false
+		}
+		_, ok := queried[modules[callee.Path()]]
+		return ok
+	}}, config.Classifier)
+	return &c
+}
+
+type dispatchPruningClassifier struct {
+	wrappedClassifier
+	keep func(callee *types.Package) bool
+}
+
+func (p dispatchPruningClassifier) IncludeCall(edge *callgraph.Edge) bool {
+	if edge.Site != nil && edge.Site.Common().IsInvoke() && !p.keep(nodeToPackage(edge.Callee)) {
+		return false
+	}
+	return p.Classifier.IncludeCall(edge)
+}
+
+type initPruningClassifier struct {
+	wrappedClassifier
+}
+
+func (p initPruningClassifier) IncludeCall(edge *callgraph.Edge) bool {
+	if edge.Caller != nil && isInitFunction(edge.Caller.Func) {
+		return false
+	}
+	return p.Classifier.IncludeCall(edge)
+}
+
+// ChainClassifiers returns a Classifier which combines the classifiers in cs.
+// Its FunctionCategory and CallCategory return the first result from cs,
+// in order, which is not Unspecified, so earlier classifiers take precedence
+// over later ones.  Its IncludeCall returns false if any classifier in cs
+// returns false.  Severities are given by the first classifier in cs which is
+// a SeverityClassifier, and CWE identifiers by the first which is a
+// CWEClassifier.
+func ChainClassifiers(cs ...Classifier) Classifier {
+	return chainClassifier(cs)
+}
+
+type chainClassifier []Classifier
+
+func (cs chainClassifier) FunctionCategory(pkg string, name string) cpb.Capability {
+	for _, c := range cs {
+		if cat := c.FunctionCategory(pkg, name); cat != cpb.Capability_CAPABILITY_UNSPECIFIED {
+			return cat
+		}
+	}
+	return cpb.Capability_CAPABILITY_UNSPECIFIED
+}
+
+func (cs chainClassifier) IncludeCall(edge *callgraph.Edge) bool {
+	for _, c := range cs {
+		if !c.IncludeCall(edge) {
+			return false
+		}
+	}
+	return true
+}
+
+func (cs chainClassifier) CallCategory(edge *callgraph.Edge) cpb.Capability {
+	for _, c := range cs {
+		if cat := callCategory(c, edge); cat != cpb.Capability_CAPABILITY_UNSPECIFIED {
+			return cat
+		}
+	}
+	return cpb.Capability_CAPABILITY_UNSPECIFIED
+}
+
+func (cs chainClassifier) Severity(cat cpb.Capability) int {
+	for _, c := range cs {
+		if sc, ok := c.(SeverityClassifier); ok {
+			return sc.Severity(cat)
+		}
+	}
+	return interesting.Severity(cat)
+}
+
+func (cs chainClassifier) CWE(cat cpb.Capability) []string {
+	for _, c := range cs {
+		if cc, ok := c.(CWEClassifier); ok {
+			return cc.CWE(cat)
+		}
+	}
+	return interesting.CWE(cat)
+}
+
 // GetClassifier returns a classifier for mapping packages and functions to the
 // appropriate capability.
 // If excludedUnanalyzed is true, the UNANALYZED capability is never returned.
@@ -82,56 +514,126 @@ func GetClassifier(excludeUnanalyzed bool) *interesting.Classifier {
 //   - For "intermediate" granularity, one CapabilityInfo is returned for each
 //     combination of capability and package that is in a path from a function
 //     in pkgs to a function with a capability.
-func GetCapabilityInfo(pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config) *cpb.CapabilityInfoList {
+//   - For "module" granularity, one CapabilityInfo is returned for each
+//     combination of capability and module in pkgs, using the shortest example
+//     path found for that module.  Standard library packages are treated as
+//     belonging to a single module named "std".
+//
+// If config.Baseline is non-nil, entries whose capability and package match
+// the baseline are omitted, and the returned list records how many were
+// omitted and which baseline entries matched nothing.
+//
+// If ctx is cancelled before the analysis is complete, GetCapabilityInfo
+// returns ctx.Err() and no results.
+func GetCapabilityInfo(ctx context.Context, pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config) (*cpb.CapabilityInfoList, error) {
 	if config.Granularity == GranularityUnset {
 		config.Granularity = GranularityFunction
 	}
+	if err := config.checkPathType(); err != nil {
+		return nil, err
+	}
+	if config.Granularity == GranularityIntermediate {
+		cil, err := intermediatePackages(ctx, pkgs, queriedPackages, config)
+		if err == nil && config.Baseline != nil {
+			config.Baseline.apply(cil)
+		}
+		if err == nil && config.PrunePackageInfo {
+			prunePackageInfo(cil, nil)
+		}
+		return cil, err
+	}
+	return capabilityInfoList(ctx, pkgs, inPackages(queriedPackagesToReport(pkgs, queriedPackages, config)), config)
+}
+
+// GetCapabilityInfoForFunctions is like GetCapabilityInfo, but reports the
+// capabilities of the functions in pkgs and their dependencies whose names
+// match one of the given patterns, rather than of every function in a set of
+// packages.  This can be used to examine a particular API, such as the entry
+// points of a plugin.
+//
+// Function names are in the form used in CapabilityInfo paths, e.g.
+// "example.com/pkg.Foo" or "(*example.com/pkg.T).Bar".  In a pattern, "*"
+// matches any sequence of characters, except in a leading "(*", so
+// "example.com/pkg.*" matches the functions, but not the methods, of
+// example.com/pkg, and "(*example.com/pkg.T).*" matches the methods declared
+// with receiver type *T.
+//
+// Synthetic functions without a package, such as the wrapper (*T).M for a
+// method declared as (T).M, are not matched.  Intermediate granularity is not
+// supported, and config.ExcludePackages is not used.
+func GetCapabilityInfoForFunctions(ctx context.Context, pkgs []*packages.Package, functions []string, config *Config) (*cpb.CapabilityInfoList, error) {
+	if config.Granularity == GranularityUnset {
+		// Don't modify the caller's Config.
+		c := *config
+		c.Granularity = GranularityFunction
+		config = &c
+	}
 	if config.Granularity == GranularityIntermediate {
-		return intermediatePackages(pkgs, queriedPackages, config)
+		return nil, fmt.Errorf("intermediate granularity is not supported when querying functions")
+	}
+	if err := config.checkPathType(); err != nil {
+		return nil, err
 	}
+	var res []*regexp.Regexp
+	for _, p := range functions {
+		// A leading "(*" is a pointer receiver, not a wildcard.
+		prefix := ""
+		if strings.HasPrefix(p, "(*") {
+			prefix, p = `\(\*`, p[2:]
+		}
+		re := strings.ReplaceAll(regexp.QuoteMeta(p), `\*`, `.*`)
+		res = append(res, regexp.MustCompile(`^`+prefix+re+`$`))
+	}
+	queried := func(f *ssa.Function) bool {
+		if f.Package() == nil {
+			// Synthetic functions such as method wrappers have no package, but
+			// can have the same name as a declared method.
+			return false
+		}
+		name := f.String()
+		for _, re := range res {
+			if re.MatchString(name) {
+				return true
+			}
+		}
+		return false
+	}
+	return capabilityInfoList(ctx, pkgs, queried, config)
+}
+
+// capabilityInfoList returns the CapabilityInfoList for GetCapabilityInfo or
+// GetCapabilityInfoForFunctions, for any granularity except intermediate.
+func capabilityInfoList(ctx context.Context, pkgs []*packages.Package, queried func(*ssa.Function) bool, config *Config) (*cpb.CapabilityInfoList, error) {
+	config = pruneCalls(pkgs, config)
 	type output struct {
 		*cpb.CapabilityInfo
 		*ssa.Function // used for sorting
+		pathLen       int
 	}
 	var caps []output
-	forEachPath(pkgs, queriedPackages,
-		func(cap cpb.Capability, nodes bfsStateMap, v *callgraph.Node) {
-			i := 0
-			c := cpb.CapabilityInfo{}
-			fn := v.Func
-			var n string
-			var ctype cpb.CapabilityType
-			var incomingEdge *callgraph.Edge
-			for v != nil {
-				if !config.OmitPaths || (i == 0 && config.Granularity == GranularityFunction) {
-					addFunction(&c.Path, v, incomingEdge)
-				}
-				if i == 0 {
-					n = v.Func.Package().Pkg.Path()
-					ctype = cpb.CapabilityType_CAPABILITY_TYPE_DIRECT
-					c.Capability = cap.Enum()
-					c.PackageDir = proto.String(v.Func.Package().Pkg.Path())
-					c.PackageName = proto.String(v.Func.Package().Pkg.Name())
-				}
-				i++
-				if pName := packagePath(v.Func); n != pName && !isStdLib(pName) {
-					ctype = cpb.CapabilityType_CAPABILITY_TYPE_TRANSITIVE
-				}
-				incomingEdge, v = nodes[v].edge, nodes[v].next()
-			}
-			c.CapabilityType = &ctype
-			if !config.OmitPaths {
-				var b strings.Builder
-				for i, p := range c.Path {
-					if i != 0 {
-						b.WriteByte(' ')
-					}
-					b.WriteString(p.GetName())
+	// pathPackages records the packages on the full path for each
+	// CapabilityInfo, which may be omitted or truncated in its Path.
+	var pathPackages map[*cpb.CapabilityInfo][]string
+	if config.PrunePackageInfo {
+		pathPackages = make(map[*cpb.CapabilityInfo][]string)
+	}
+	modules := packageModules(pkgs, config.ReportReplacedAsLocal)
+	err := forEachPathFrom(ctx, pkgs, queried,
+		func(cap cpb.Capability, nodes *bfsStateMap, v *callgraph.Node) {
+			if !config.includesPathType(pathType(nodes, v)) {
+				return
+			}
+			c, pathLen := capabilityInfo(cap, nodes, v, modules, config)
+			caps = append(caps, output{c, v.Func, pathLen})
+			if pathPackages != nil {
+				for w := v; w != nil; w = nodes.state(w).next() {
+					pathPackages[c] = append(pathPackages[c], packagePath(w.Func))
 				}
-				c.DepPath = proto.String(b.String())
 			}
-			caps = append(caps, output{&c, fn})
-		}, config)
+		}, nil, config)
+	if err != nil {
+		return nil, err
+	}
 	sort.Slice(caps, func(i, j int) bool {
 		if x, y := caps[i].CapabilityInfo.GetCapability(), caps[j].CapabilityInfo.GetCapability(); x != y {
 			return x < y
@@ -139,36 +641,219 @@ func GetCapabilityInfo(pkgs []*packages.Package, queriedPackages map[*types.Pack
 		return funcCompare(caps[i].Function, caps[j].Function) < 0
 	})
 	if config.Granularity == GranularityPackage {
-		// Keep only the first entry in the sorted list for each (capability, package) pair.
+		// Keep one entry for each (capability, package) pair.  Paths starting
+		// at an exported function are preferred, as they show how users of the
+		// package reach the capability, and among those the shortest is chosen.
+		// If there are none, the first entry in the sorted list is kept.  Ties
+		// are broken by the existing sort order.
 		type cp struct {
 			cpb.Capability
 			*ssa.Package
+			merged string // used instead of Package with MergeMajorVersions
 		}
-		seen := make(map[cp]struct{})
-		// del returns true if the capability and package of o have been seen before.
-		del := func(o output) bool {
+		best := make(map[cp]int)
+		var keep []output
+		for _, o := range caps {
 			var pkg *ssa.Package
 			if o.Function != nil {
 				pkg = o.Function.Package()
 			}
-			cp := cp{o.CapabilityInfo.GetCapability(), pkg}
-			if _, ok := seen[cp]; ok {
-				return true
+			k := cp{o.CapabilityInfo.GetCapability(), pkg, ""}
+			if config.MergeMajorVersions && pkg != nil {
+				k = cp{o.CapabilityInfo.GetCapability(), nil, trimMajorVersions(pkg.Pkg.Path())}
+			}
+			i, ok := best[k]
+			if !ok {
+				best[k] = len(keep)
+				keep = append(keep, o)
+				continue
+			}
+			if !isExported(o.Function) {
+				continue
+			}
+			if !isExported(keep[i].Function) || o.pathLen < keep[i].pathLen {
+				keep[i] = o
 			}
-			seen[cp] = struct{}{}
-			return false
 		}
-		caps = slices.DeleteFunc(caps, del)
+		caps = keep
+	}
+	if config.Granularity == GranularityModule {
+		// Keep one entry for each (capability, module) pair, choosing the one
+		// with the shortest path.  Ties are broken by the existing sort order.
+		type cm struct {
+			cpb.Capability
+			module string
+		}
+		modules := modulePaths(pkgs, config.ReportReplacedAsLocal)
+		best := make(map[cm]int)
+		var keep []output
+		for _, o := range caps {
+			var module string
+			if o.Function != nil && o.Function.Package() != nil {
+				module = modules[o.Function.Package().Pkg.Path()]
+			}
+			if config.MergeMajorVersions {
+				module = trimMajorVersions(module)
+			}
+			k := cm{o.CapabilityInfo.GetCapability(), module}
+			if i, ok := best[k]; !ok {
+				best[k] = len(keep)
+				keep = append(keep, o)
+			} else if o.pathLen < keep[i].pathLen {
+				keep[i] = o
+			}
+		}
+		caps = keep
 	}
 	cil := &cpb.CapabilityInfoList{
-		CapabilityInfo: make([]*cpb.CapabilityInfo, len(caps)),
-		ModuleInfo:     collectModuleInfo(pkgs),
-		PackageInfo:    collectPackageInfo(pkgs),
+		CapabilityInfo:   make([]*cpb.CapabilityInfo, len(caps)),
+		ModuleInfo:       collectModuleInfo(pkgs),
+		PackageInfo:      collectPackageInfo(pkgs),
+		AnalyzedPackages: proto.Int64(analyzedPackages(pkgs)),
 	}
 	for i := range caps {
 		cil.CapabilityInfo[i] = caps[i].CapabilityInfo
 	}
-	return cil
+	if config.Baseline != nil {
+		config.Baseline.apply(cil)
+	}
+	if config.PrunePackageInfo {
+		prunePackageInfo(cil, pathPackages)
+	}
+	return cil, nil
+}
+
+// checkPathType returns an error if config.OnlyTransitive and
+// config.OnlyDirect are both set, or either is set with intermediate
+// granularity, whose entries have no path type.
+func (config *Config) checkPathType() error {
+	if !config.OnlyTransitive && !config.OnlyDirect {
+		return nil
+	}
+	if config.OnlyTransitive && config.OnlyDirect {
+		return fmt.Errorf("OnlyTransitive and OnlyDirect cannot both be set")
+	}
+	if config.Granularity == GranularityIntermediate {
+		return fmt.Errorf("OnlyTransitive and OnlyDirect are not supported with intermediate granularity")
+	}
+	return nil
+}
+
+// includesPathType returns false if paths of type t are excluded by
+// config.OnlyTransitive or config.OnlyDirect.
+func (config *Config) includesPathType(t cpb.CapabilityType) bool {
+	switch {
+	case config.OnlyTransitive:
+		return t == cpb.CapabilityType_CAPABILITY_TYPE_TRANSITIVE
+	case config.OnlyDirect:
+		return t == cpb.CapabilityType_CAPABILITY_TYPE_DIRECT
+	}
+	return true
+}
+
+// pathType returns whether the path from v found by a search backwards from
+// capabilities is direct or transitive.  The path is transitive if it has a
+// function in a package other than v's, not counting the standard library.
+// v must be in a package.
+func pathType(nodes *bfsStateMap, v *callgraph.Node) cpb.CapabilityType {
+	if next := nodes.state(v).next(); next != nil {
+		if rest := nodes.summary(next); rest.mixed || (rest.pkg != "" && rest.pkg != v.Func.Package().Pkg.Path()) {
+			return cpb.CapabilityType_CAPABILITY_TYPE_TRANSITIVE
+		}
+	}
+	return cpb.CapabilityType_CAPABILITY_TYPE_DIRECT
+}
+
+// capabilityInfo returns a CapabilityInfo for the path found by forEachPath
+// from v to a function with capability cap, and the length of the path.  Its
+// ModulePath and CapabilityModule are looked up in modules, as returned by
+// packageModules.  If config.CollapseStdlib is set, runs of standard library
+// functions in the path are collapsed.  If the path is then longer than
+// config.MaxPathLength, only its beginning is included in the
+// CapabilityInfo, and only that part of the path is followed; the type, ID
+// and capability module of the path are found from the summaries recorded in
+// nodes.
+func capabilityInfo(cap cpb.Capability, nodes *bfsStateMap, v *callgraph.Node, modules map[string]*cpb.ModuleInfo, config *Config) (*cpb.CapabilityInfo, int) {
+	pkg := v.Func.Package().Pkg
+	c := cpb.CapabilityInfo{
+		Capability:  cap.Enum(),
+		PackageDir:  proto.String(pkg.Path()),
+		PackageName: proto.String(pkg.Name()),
+		Severity:    proto.Int32(int32(capabilitySeverity(config.Classifier, cap))),
+		Cwe:         capabilityCWE(config.Classifier, cap),
+	}
+	if m, ok := modules[pkg.Path()]; ok {
+		c.ModulePath = proto.String(m.GetPath())
+	}
+	if m, ok := modules[nodes.summary(v).last]; ok {
+		c.CapabilityModule = proto.Clone(m).(*cpb.ModuleInfo)
+	}
+	if isTestFunction(v.Func) {
+		c.FromTest = proto.Bool(true)
+	}
+	s := nodes.state(v)
+	ctype := pathType(nodes, v)
+	c.CapabilityType = &ctype
+	c.PathId = proto.String(nodes.pathID(v, config.pathOptions()))
+	pathLen := s.depth + 1
+	if config.AnnotateInstantiations {
+		c.Instantiations = pathInstantiations(nodes, v)
+	}
+	if config.OmitPaths {
+		if config.Granularity == GranularityFunction {
+			addFunction(&c.Path, v, nil)
+			if s.next() == nil {
+				c.Path[0].CapabilitySite = nodes.capabilitySite(v)
+			}
+		}
+		return &c, pathLen
+	}
+	// Follow the path until it is known to have more than MaxPathLength
+	// functions after collapsing.  n is the number of functions the path
+	// followed so far will have when collapsed.
+	var (
+		incomingEdge *callgraph.Edge
+		n            int
+		prevStd      bool
+	)
+	for w, i := v, 0; w != nil; i++ {
+		if config.MaxPathLength > 0 && n > config.MaxPathLength {
+			break
+		}
+		addFunction(&c.Path, w, incomingEdge)
+		fn := c.Path[i]
+		ws := nodes.state(w)
+		if ws.next() == nil {
+			fn.CapabilitySite = nodes.capabilitySite(w)
+		}
+		if fn.Wrapper == nil || config.IncludeWrappers {
+			std := fn.Package != nil && isStdLib(fn.GetPackage())
+			if !config.CollapseStdlib || i <= 1 || !std || !prevStd {
+				n++
+			}
+			prevStd = std
+		}
+		incomingEdge, w = ws.edge, ws.next()
+	}
+	if !config.IncludeWrappers {
+		c.Path = omitWrappers(c.Path)
+	}
+	if config.CollapseStdlib {
+		c.Path = collapseStdlib(c.Path)
+	}
+	if config.MaxPathLength > 0 && len(c.Path) > config.MaxPathLength {
+		c.Path = c.Path[:config.MaxPathLength]
+		c.Truncated = proto.Bool(true)
+	}
+	var b strings.Builder
+	for i, p := range c.Path {
+		if i != 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(p.GetName())
+	}
+	c.DepPath = proto.String(b.String())
+	return &c, pathLen
 }
 
 type CapabilityCounter struct {
@@ -176,23 +861,50 @@ type CapabilityCounter struct {
 	count            int64
 	direct_count     int64
 	transitive_count int64
+	path_count       int64
 	example          []*cpb.Function
 }
 
+// DefaultMaxPathCount is the number of distinct paths to a capability at
+// which GetCapabilityStats stops counting, if Config.MaxPathCount is zero.
+const DefaultMaxPathCount = 1000
+
+// maxPathCount returns the limit on the number of paths to a capability to
+// count.
+func (c *Config) maxPathCount() int {
+	if c.MaxPathCount > 0 {
+		return c.MaxPathCount
+	}
+	return DefaultMaxPathCount
+}
+
 // GetCapabilityStats analyzes the packages in pkgs.  For each function in
 // those packages which have a path in the callgraph to an "interesting"
 // function (see the "interesting" package), we give aggregated statistics
 // about the capability usage.
-func GetCapabilityStats(pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config) *cpb.CapabilityStatList {
+//
+// If config.CapabilitySet is non-nil, only capabilities in the set are
+// searched for and counted.
+//
+// The PathCount of each capability is the number of distinct shortest paths
+// to it from the functions in the queried packages, where paths using
+// different calls between the same functions are distinct.  Counting stops
+// at config.MaxPathCount, or DefaultMaxPathCount if that is zero, and
+// PathCountAtLeast is set if the limit was reached.
+//
+// If ctx is cancelled before the analysis is complete, GetCapabilityStats
+// returns ctx.Err() and no results.
+func GetCapabilityStats(ctx context.Context, pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config) (*cpb.CapabilityStatList, error) {
 	var cs []*cpb.CapabilityStats
 	cm := make(map[string]*CapabilityCounter)
-	forEachPath(pkgs, queriedPackages,
-		func(cap cpb.Capability, nodes bfsStateMap, v *callgraph.Node) {
+	err := forEachPath(ctx, pkgs, queriedPackages,
+		func(cap cpb.Capability, nodes *bfsStateMap, v *callgraph.Node) {
 			if _, ok := cm[cap.String()]; !ok {
 				cm[cap.String()] = &CapabilityCounter{count: 1, capability: cap}
 			} else {
 				cm[cap.String()].count += 1
 			}
+			cm[cap.String()].path_count = min(cm[cap.String()].path_count+int64(nodes.state(v).paths), int64(config.maxPathCount()))
 			i := 0
 			var n string
 			var incomingEdge *callgraph.Edge
@@ -209,7 +921,11 @@ func GetCapabilityStats(pkgs []*packages.Package, queriedPackages map[*types.Pac
 				if pName := packagePath(v.Func); n != pName && !isStdLib(pName) {
 					isDirect = false
 				}
-				incomingEdge, v = nodes[v].edge, nodes[v].next()
+				s := nodes.state(v)
+				incomingEdge, v = s.edge, s.next()
+			}
+			if !config.IncludeWrappers {
+				e = omitWrappers(e)
 			}
 			if isDirect {
 				if _, ok := cm[cap.String()]; !ok {
@@ -229,14 +945,20 @@ func GetCapabilityStats(pkgs []*packages.Package, queriedPackages map[*types.Pac
 			} else {
 				cm[cap.String()].example = e
 			}
-		}, config)
+		}, config.CapabilitySet.Has, config)
+	if err != nil {
+		return nil, err
+	}
 	for _, counts := range cm {
 		cs = append(cs, &cpb.CapabilityStats{
-			Capability:      &counts.capability,
-			Count:           &counts.count,
-			DirectCount:     &counts.direct_count,
-			TransitiveCount: &counts.transitive_count,
-			ExampleCallpath: counts.example,
+			Capability:       &counts.capability,
+			Count:            &counts.count,
+			DirectCount:      &counts.direct_count,
+			TransitiveCount:  &counts.transitive_count,
+			ExampleCallpath:  counts.example,
+			Severity:         proto.Int32(int32(capabilitySeverity(config.Classifier, counts.capability))),
+			PathCount:        &counts.path_count,
+			PathCountAtLeast: proto.Bool(counts.path_count >= int64(config.maxPathCount())),
 		})
 	}
 	sort.Slice(cs, func(i, j int) bool {
@@ -245,35 +967,43 @@ func GetCapabilityStats(pkgs []*packages.Package, queriedPackages map[*types.Pac
 	return &cpb.CapabilityStatList{
 		CapabilityStats: cs,
 		ModuleInfo:      collectModuleInfo(pkgs),
-	}
+	}, nil
 }
 
 // GetCapabilityCount analyzes the packages in pkgs.  For each function in
 // those packages which have a path in the callgraph to an "interesting"
 // function (see the "interesting" package), we give an aggregate count of the
 // capability usage.
-func GetCapabilityCounts(pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config) *cpb.CapabilityCountList {
+//
+// If ctx is cancelled before the analysis is complete, GetCapabilityCounts
+// returns ctx.Err() and no results.
+func GetCapabilityCounts(ctx context.Context, pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config) (*cpb.CapabilityCountList, error) {
 	cm := make(map[string]int64)
-	forEachPath(pkgs, queriedPackages,
-		func(cap cpb.Capability, nodes bfsStateMap, v *callgraph.Node) {
+	err := forEachPath(ctx, pkgs, queriedPackages,
+		func(cap cpb.Capability, nodes *bfsStateMap, v *callgraph.Node) {
 			if _, ok := cm[cap.String()]; !ok {
 				cm[cap.String()] = 1
 			} else {
 				cm[cap.String()] += 1
 			}
-		}, config)
+		}, nil, config)
+	if err != nil {
+		return nil, err
+	}
 	return &cpb.CapabilityCountList{
 		CapabilityCounts: cm,
 		ModuleInfo:       collectModuleInfo(pkgs),
-	}
+	}, nil
 }
 
 // searchBackwardsFromCapabilities returns the set of all function nodes that
 // have a path in the call graph to a function in nodesByCapability.
-// It ignores edges whose caller is in allNodesWithExplicitCapability.
-func searchBackwardsFromCapabilities(nodesByCapability nodesetPerCapability, safe, allNodesWithExplicitCapability nodeset, classifier Classifier) bfsStateMap {
+// It ignores edges whose caller is in allNodesWithExplicitCapability, and
+// calls whose category in callCapabilities is not being searched for.
+// If ctx is cancelled during the search, it returns ctx.Err().
+func searchBackwardsFromCapabilities(ctx context.Context, nodesByCapability nodesetPerCapability, callCapabilities edgeCapabilities, safe, allNodesWithExplicitCapability nodeset, classifier Classifier) (*bfsStateMap, error) {
 	var (
-		visited = make(bfsStateMap)
+		visited = newBFSStateMap()
 		q       []*callgraph.Node
 	)
 	// Initialize the queue to contain the nodes with a capability.
@@ -283,13 +1013,16 @@ func searchBackwardsFromCapabilities(nodesByCapability nodesetPerCapability, saf
 				continue
 			}
 			q = append(q, v)
-			visited[v] = bfsState{}
+			visited.visit(v, nil)
 		}
 	}
 	sort.Sort(byFunction(q)) // make the search order deterministic
 	// Perform a BFS backwards through the call graph from the interesting
 	// nodes.
 	for len(q) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		v := q[0]
 		q = q[1:]
 		var incomingEdges []*callgraph.Edge
@@ -297,6 +1030,9 @@ func searchBackwardsFromCapabilities(nodesByCapability nodesetPerCapability, saf
 			if !classifier.IncludeCall(edge) {
 				continue
 			}
+			if !callCapabilities.includes(edge, nodesByCapability) {
+				continue
+			}
 			if _, ok := safe[edge.Caller]; ok {
 				continue
 			}
@@ -310,15 +1046,15 @@ func searchBackwardsFromCapabilities(nodesByCapability nodesetPerCapability, saf
 		sort.Sort(byCaller(incomingEdges)) // make the search order deterministic
 		for _, edge := range incomingEdges {
 			w := edge.Caller
-			if _, ok := visited[w]; ok {
+			if _, ok := visited.get(w); ok {
 				// We have already visited w.
 				continue
 			}
-			visited[w] = bfsState{edge: edge}
+			visited.visit(w, edge)
 			q = append(q, w)
 		}
 	}
-	return visited
+	return visited, nil
 }
 
 // searchForwardsFromQueriedFunctions searches from a set of function nodes to
@@ -329,38 +1065,46 @@ func searchBackwardsFromCapabilities(nodesByCapability nodesetPerCapability, saf
 // outputCall is called for each edge between two such nodes.
 // outputCapability is called for each node reached in the graph that has some
 // direct capability.
+//
+// If ctx is cancelled during the search, it returns ctx.Err().
 func searchForwardsFromQueriedFunctions(
+	ctx context.Context,
 	nodes nodeset,
 	nodesByCapability nodesetPerCapability,
+	callCapabilities edgeCapabilities,
 	allNodesWithExplicitCapability nodeset,
-	bfsFromCapabilities bfsStateMap,
+	bfsFromCapabilities *bfsStateMap,
 	classifier Classifier,
 	outputNode GraphOutputNodeFn,
 	outputCall GraphOutputCallFn,
 	outputCapability GraphOutputCapabilityFn,
-) {
+) error {
 	var (
 		q              []*callgraph.Node
-		bfsFromQueries = make(bfsStateMap)
+		bfsFromQueries = newBFSStateMap()
+		capabilities   = slices.Sorted(maps.Keys(nodesByCapability))
 	)
 	for v := range nodes {
-		if _, ok := bfsFromCapabilities[v]; !ok {
+		if _, ok := bfsFromCapabilities.get(v); !ok {
 			// This node cannot reach a capability.
 			continue
 		}
 		q = append(q, v)
-		bfsFromQueries[v] = bfsState{}
+		bfsFromQueries.visit(v, nil)
 	}
 	sort.Sort(byFunction(q)) // make the search order deterministic
 	for len(q) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		v := q[0]
 		q = q[1:]
 		if outputNode != nil {
 			outputNode(bfsFromQueries, v, bfsFromCapabilities)
 		}
 		if outputCapability != nil {
-			for c, nodes := range nodesByCapability {
-				if _, ok := nodes[v]; ok {
+			for _, c := range capabilities {
+				if _, ok := nodesByCapability[c][v]; ok {
 					outputCapability(v, c)
 				}
 			}
@@ -373,7 +1117,10 @@ func searchForwardsFromQueriedFunctions(
 			if !classifier.IncludeCall(edge) {
 				continue
 			}
-			if _, ok := bfsFromCapabilities[edge.Callee]; !ok {
+			if !callCapabilities.includes(edge, nodesByCapability) {
+				continue
+			}
+			if _, ok := bfsFromCapabilities.get(edge.Callee); !ok {
 				continue
 			}
 			outgoingEdges = append(outgoingEdges, edge)
@@ -388,19 +1135,20 @@ func searchForwardsFromQueriedFunctions(
 				outputCall(edge)
 			}
 			w := edge.Callee
-			if _, ok := bfsFromQueries[w]; ok {
+			if _, ok := bfsFromQueries.get(w); ok {
 				// We have already visited w.
 				continue
 			}
-			bfsFromQueries[w] = bfsState{edge}
+			bfsFromQueries.visit(w, edge)
 			q = append(q, w)
 		}
 	}
+	return nil
 }
 
 // GraphOutputNodeFn represents a function which is called by CapabilityGraph
 // for each node.
-type GraphOutputNodeFn func(fromQuery bfsStateMap, node *callgraph.Node, toCapability bfsStateMap)
+type GraphOutputNodeFn func(fromQuery *bfsStateMap, node *callgraph.Node, toCapability *bfsStateMap)
 
 // GraphOutputCallFn represents a function which is called by CapabilityGraph
 // for each edge.
@@ -426,39 +1174,52 @@ type GraphOutputCapabilityFn func(fn *callgraph.Node, c cpb.Capability)
 // outputCapability is called for each node in the graph that has some
 // capability.
 //
-// If filter is non-nil, it is called once for each capability.  If it returns
-// true, then CapabilityGraph generates a call graph for that individual
-// capability and calls the relevant output functions, before proceeding to
-// the next capability.  If filter is nil, a single graph is generated
+// If filter is non-nil, it is called once for each capability, in order.  If
+// it returns true, then CapabilityGraph generates a call graph for that
+// individual capability and calls the relevant output functions, before
+// proceeding to the next capability.  If filter is nil, a single graph is generated
 // including paths for all capabilities.
-func CapabilityGraph(pkgs []*packages.Package,
+//
+// If ctx is cancelled before the graph is complete, CapabilityGraph stops
+// calling the output functions and returns ctx.Err().
+func CapabilityGraph(ctx context.Context,
+	pkgs []*packages.Package,
 	queriedPackages map[*types.Package]struct{},
 	config *Config,
 	outputNode GraphOutputNodeFn,
 	outputCall GraphOutputCallFn,
 	outputCapability GraphOutputCapabilityFn,
 	filter func(capability cpb.Capability) bool,
-) {
-	safe, nodesByCapability, extraNodesByCapability := getPackageNodesWithCapability(pkgs, config)
+) error {
+	config = pruneCalls(pkgs, config)
+	queriedPackages = queriedPackagesToReport(pkgs, queriedPackages, config)
+	graph, safe, nodesByCapability, extraNodesByCapability, callCapabilities, _, err := getPackageNodesWithCapability(pkgs, config)
+	if err != nil {
+		return err
+	}
 	nodesByCapability, allNodesWithExplicitCapability := mergeCapabilities(nodesByCapability, extraNodesByCapability)
 	extraNodesByCapability = nil
+	queried := onlyReachable(graph, inPackages(queriedPackages), config)
 
-	search := func(nodesByCapability nodesetPerCapability) {
-		bfsFromCapabilities := searchBackwardsFromCapabilities(nodesByCapability, safe, allNodesWithExplicitCapability, config.Classifier)
+	search := func(nodesByCapability nodesetPerCapability) error {
+		config.searchStarted(nodesByCapability)
+		bfsFromCapabilities, err := searchBackwardsFromCapabilities(ctx, nodesByCapability, callCapabilities, safe, allNodesWithExplicitCapability, config.Classifier)
+		if err != nil {
+			return err
+		}
 
 		canBeReachedFromQuery := make(nodeset)
-		for v := range bfsFromCapabilities {
-			if v.Func.Package() == nil {
-				continue
-			}
-			if _, ok := queriedPackages[v.Func.Package().Pkg]; ok {
+		for _, v := range bfsFromCapabilities.nodes {
+			if queried(v.Func) {
 				canBeReachedFromQuery[v] = struct{}{}
 			}
 		}
 
-		searchForwardsFromQueriedFunctions(
+		return searchForwardsFromQueriedFunctions(
+			ctx,
 			canBeReachedFromQuery,
 			nodesByCapability,
+			callCapabilities,
 			allNodesWithExplicitCapability,
 			bfsFromCapabilities,
 			config.Classifier,
@@ -467,20 +1228,32 @@ func CapabilityGraph(pkgs []*packages.Package,
 			outputCapability)
 	}
 	if filter != nil {
-		// Consider each capability individually.
-		for c, ns := range nodesByCapability {
+		// Consider each capability individually, in order, so that the
+		// output is deterministic.
+		n := 0
+		for _, c := range slices.Sorted(maps.Keys(nodesByCapability)) {
 			if filter(c) {
-				search(nodesetPerCapability{c: ns})
+				n++
+				if err := search(nodesetPerCapability{c: nodesByCapability[c]}); err != nil {
+					return err
+				}
 			}
 		}
-	} else {
-		// Generate a single graph.
-		search(nodesByCapability)
+		config.progress(ProgressEvent{Stage: ProgressComplete, Count: n})
+		return nil
+	}
+	// Generate a single graph.
+	if err := search(nodesByCapability); err != nil {
+		return err
 	}
+	config.progress(ProgressEvent{Stage: ProgressComplete, Count: len(nodesByCapability)})
+	return nil
 }
 
 // getPackageNodesWithCapability analyzes all the functions in pkgs and their
-// transitive dependencies, and returns three sets of callgraph nodes.
+// transitive dependencies, and returns their call graph, three sets of
+// callgraph nodes, and the categories of calls which differ from their
+// callee's category.
 //
 // safe contains the set of nodes for functions that have been explicitly
 // classified as safe.
@@ -489,25 +1262,53 @@ func CapabilityGraph(pkgs []*packages.Package,
 // to a set of nodes.
 // extraNodesByCapability contains nodes for functions that use unsafe pointers
 // or the reflect package in a way that we want to report to the user.
+// callCapabilities contains the category of each call to a function whose
+// calls are categorized individually; see getNodeCapabilities.
+// sites contains the positions of the operations which give some of the nodes
+// in extraNodesByCapability their capability.
+//
+// If config.UseDirectives is set, the directive comments in pkgs take
+// precedence over config.Classifier, and an error is returned if they are
+// invalid.
 func getPackageNodesWithCapability(pkgs []*packages.Package,
 	config *Config,
-) (safe nodeset, nodesByCapability, extraNodesByCapability nodesetPerCapability) {
-	graph, ssaProg, allFunctions := buildGraph(pkgs, true)
+) (graph *callgraph.Graph, safe nodeset, nodesByCapability, extraNodesByCapability nodesetPerCapability, callCapabilities edgeCapabilities, sites capabilitySites, err error) {
+	if config.classified != nil {
+		graph, safe, nodesByCapability, extraNodesByCapability, callCapabilities, sites = config.classified.get()
+		return graph, safe, nodesByCapability, extraNodesByCapability, callCapabilities, sites, nil
+	}
+	if err := checkPackages(pkgs, config); err != nil {
+		return nil, nil, nil, nil, nil, nil, err
+	}
+	classifier := config.Classifier
+	if config.UseDirectives {
+		directives, err := functionDirectives(pkgs)
+		if err != nil {
+			return nil, nil, nil, nil, nil, nil, err
+		}
+		d := directiveClassifier{wrappedClassifier{classifier}, directives}
+		classifier = withCallCategory(d, classifier, d.callCategory)
+	}
+	graph, ssaProg, allFunctions := buildGraph(pkgs, true, config)
 	unsafePointerFunctions := findUnsafePointerConversions(pkgs, ssaProg, allFunctions)
+	cgoGeneratedFiles := findCgoGeneratedFiles(pkgs)
 	ssaProg = nil // possibly save memory; we don't use ssaProg again
-	safe, nodesByCapability = getNodeCapabilities(graph, config.Classifier)
+	safe, nodesByCapability, callCapabilities = getNodeCapabilities(graph, classifier)
 
 	if !config.DisableBuiltin {
-		extraNodesByCapability = getExtraNodesByCapability(graph, allFunctions, unsafePointerFunctions)
+		extraNodesByCapability, sites = getExtraNodesByCapability(graph, allFunctions, unsafePointerFunctions, cgoGeneratedFiles, classifier)
 	}
-	return safe, nodesByCapability, extraNodesByCapability
+	return graph, safe, nodesByCapability, extraNodesByCapability, callCapabilities, sites, nil
 }
 
-func getExtraNodesByCapability(graph *callgraph.Graph, allFunctions map[*ssa.Function]bool, unsafePointerFunctions map[*ssa.Function]struct{}) nodesetPerCapability {
+func getExtraNodesByCapability(graph *callgraph.Graph, allFunctions map[*ssa.Function]bool, unsafePointerFunctions map[*ssa.Function]token.Pos, cgoGeneratedFiles map[string]struct{}, classifier Classifier) (nodesetPerCapability, capabilitySites) {
 	// Find functions that copy reflect.Value objects in a way that could
 	// possibly cause a data race, and add their nodes to
-	// extraNodesByCapability[Capability_CAPABILITY_REFLECT].
+	// extraNodesByCapability[Capability_CAPABILITY_REFLECT].  Also find
+	// functions that contain go statements, and add their nodes to
+	// extraNodesByCapability[Capability_CAPABILITY_GOROUTINE].
 	extraNodesByCapability := make(nodesetPerCapability)
+	sites := make(capabilitySites)
 	for f := range allFunctions {
 		// Find the function variables that do not escape.
 		locals := map[ssa.Value]struct{}{}
@@ -518,6 +1319,13 @@ func getExtraNodesByCapability(graph *callgraph.Graph, allFunctions map[*ssa.Fun
 		}
 		for _, b := range f.Blocks {
 			for _, i := range b.Instrs {
+				// A Go instruction starts a goroutine.
+				if _, ok := i.(*ssa.Go); ok {
+					if node, ok := graph.Nodes[f]; ok {
+						extraNodesByCapability.add(cpb.Capability_CAPABILITY_GOROUTINE, node)
+					}
+					continue
+				}
 				// An IndexAddr instruction creates an SSA value which refers to an
 				// element of an array.  An element of a local array is also local.
 				if ia, ok := i.(*ssa.IndexAddr); ok {
@@ -549,8 +1357,10 @@ func getExtraNodesByCapability(graph *callgraph.Graph, allFunctions map[*ssa.Fun
 					}
 					if node, ok := graph.Nodes[f]; ok {
 						// This is a store to a non-local reflect.Value, or to a non-local
-						// object that contains a reflect.Value.
+						// object that contains a reflect.Value.  Record the first such
+						// store in the source, whatever the order of the blocks.
 						extraNodesByCapability.add(cpb.Capability_CAPABILITY_REFLECT, node)
+						sites.add(cpb.Capability_CAPABILITY_REFLECT, node, s.Pos())
 					}
 				}
 			}
@@ -563,7 +1373,12 @@ func getExtraNodesByCapability(graph *callgraph.Graph, allFunctions map[*ssa.Fun
 			extraNodesByCapability.add(cpb.Capability_CAPABILITY_UNSAFE_POINTER, node)
 		}
 	}
-	// Add the arbitrary-execution capability to asm function nodes.
+	// Add the arbitrary-execution capability to asm function nodes, and the
+	// cgo capability to the function declarations without bodies that cgo
+	// generates, which are implemented in the runtime or in C.  Functions
+	// without bodies which the classifier categorizes by name, such as those
+	// in standard library packages compiled without source, are left to that
+	// categorization instead.
 	for f, node := range graph.Nodes {
 		if f.Blocks == nil {
 			// No source code for this function.
@@ -571,32 +1386,98 @@ func getExtraNodesByCapability(graph *callgraph.Graph, allFunctions map[*ssa.Fun
 				// Exclude synthetic functions, such as those loaded from object files.
 				continue
 			}
+			if isCgoGenerated(f, cgoGeneratedFiles) {
+				extraNodesByCapability.add(cpb.Capability_CAPABILITY_CGO, node)
+				continue
+			}
+			if functionCategory(classifier, f) != cpb.Capability_CAPABILITY_UNSPECIFIED {
+				continue
+			}
 			extraNodesByCapability.add(cpb.Capability_CAPABILITY_ARBITRARY_EXECUTION, node)
 		}
 	}
-	return extraNodesByCapability
+	return extraNodesByCapability, sites
+}
+
+// findCgoGeneratedFiles returns the names of the files generated by cgo for
+// the packages in pkgs and their dependencies which import "C".  These are the
+// files which are compiled in place of the package's Go files.
+func findCgoGeneratedFiles(pkgs []*packages.Package) map[string]struct{} {
+	files := make(map[string]struct{})
+	forEachPackageIncludingDependencies(pkgs, func(p *packages.Package) {
+		if _, ok := p.Imports["runtime/cgo"]; !ok {
+			// Packages which import "C" import runtime/cgo after cgo processing.
+			return
+		}
+		goFiles := make(map[string]struct{}, len(p.GoFiles))
+		for _, f := range p.GoFiles {
+			goFiles[f] = struct{}{}
+		}
+		for _, f := range p.CompiledGoFiles {
+			if _, ok := goFiles[f]; !ok {
+				files[f] = struct{}{}
+			}
+		}
+	})
+	return files
+}
+
+// isCgoGenerated returns true if f was generated by cgo: that is, it is
+// declared in one of cgoGeneratedFiles, or has one of the name prefixes that
+// cgo uses and is in a package which imports "C".
+func isCgoGenerated(f *ssa.Function, cgoGeneratedFiles map[string]struct{}) bool {
+	if f.Prog == nil || !f.Pos().IsValid() {
+		return false
+	}
+	filename := f.Prog.Fset.Position(f.Pos()).Filename
+	if _, ok := cgoGeneratedFiles[filename]; ok {
+		return true
+	}
+	if f.Pkg == nil || !importsCgo(f.Pkg.Pkg) {
+		return false
+	}
+	for _, prefix := range []string{"_cgo_", "_Cgo_", "_cgoCheck", "_Cfunc_"} {
+		if strings.HasPrefix(f.Name(), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// importsCgo returns true if pkg imports runtime/cgo, as packages which import
+// "C" do after cgo processing.
+func importsCgo(pkg *types.Package) bool {
+	for _, imp := range pkg.Imports() {
+		if imp.Path() == "runtime/cgo" {
+			return true
+		}
+	}
+	return false
 }
 
 // findUnsafePointerConversions uses analysis of the syntax tree to find
-// functions which convert unsafe.Pointer values to another type.
-func findUnsafePointerConversions(pkgs []*packages.Package, ssaProg *ssa.Program, allFunctions map[*ssa.Function]bool) (unsafePointer map[*ssa.Function]struct{}) {
+// functions which convert unsafe.Pointer values to another type.  Each
+// function is mapped to its position, except for package init functions,
+// which are mapped to the position of the first conversion in the
+// initialization of a package-scoped variable.
+func findUnsafePointerConversions(pkgs []*packages.Package, ssaProg *ssa.Program, allFunctions map[*ssa.Function]bool) (unsafePointer map[*ssa.Function]token.Pos) {
 	// AST nodes corresponding to functions which convert unsafe.Pointer values.
 	unsafeFunctionNodes := make(map[ast.Node]struct{})
 	// Packages which contain variables that are initialized using
 	// unsafe.Pointer conversions.  We will later find the function nodes
 	// corresponding to the init functions for these packages.
-	packagesWithUnsafePointerUseInInitialization := make(map[*types.Package]struct{})
+	packagesWithUnsafePointerUseInInitialization := make(map[*types.Package]token.Pos)
 	forEachPackageIncludingDependencies(pkgs, func(pkg *packages.Package) {
-		seenUnsafePointerUseInInitialization := false
+		unsafePointerUseInInitialization := token.NoPos
 		for _, file := range pkg.Syntax {
 			vis := visitor{
-				unsafeFunctionNodes:                  unsafeFunctionNodes,
-				seenUnsafePointerUseInInitialization: &seenUnsafePointerUseInInitialization,
-				pkg:                                  pkg,
+				unsafeFunctionNodes:              unsafeFunctionNodes,
+				unsafePointerUseInInitialization: &unsafePointerUseInInitialization,
+				pkg:                              pkg,
 			}
 			ast.Walk(&vis, file)
 		}
-		if seenUnsafePointerUseInInitialization {
+		if unsafePointerUseInInitialization.IsValid() {
 			// One of the files in this package contained an unsafe.Pointer
 			// conversion in the initialization expression for a package-scoped
 			// variable.
@@ -604,19 +1485,19 @@ func findUnsafePointerConversions(pkgs []*packages.Package, ssaProg *ssa.Program
 			// *packages.Package object we have now.  There is no direct pointer
 			// between the two, but each has a pointer to the corresponding
 			// *types.Package object, so we store that here.
-			packagesWithUnsafePointerUseInInitialization[pkg.Types] = struct{}{}
+			packagesWithUnsafePointerUseInInitialization[pkg.Types] = unsafePointerUseInInitialization
 		}
 	})
 	// Find the *ssa.Function pointers corresponding to the syntax nodes found
 	// above.
-	unsafePointerFunctions := make(map[*ssa.Function]struct{})
+	unsafePointerFunctions := make(map[*ssa.Function]token.Pos)
 	for f := range allFunctions {
 		if _, ok := unsafeFunctionNodes[f.Syntax()]; ok {
-			unsafePointerFunctions[f] = struct{}{}
+			unsafePointerFunctions[f] = f.Pos()
 		}
 	}
 	for _, pkg := range ssaProg.AllPackages() {
-		if _, ok := packagesWithUnsafePointerUseInInitialization[pkg.Pkg]; ok {
+		if pos, ok := packagesWithUnsafePointerUseInInitialization[pkg.Pkg]; ok {
 			// This package had an unsafe.Pointer conversion in the initialization
 			// expression for a package-scoped variable, so we add the package's
 			// "init" function to unsafePointerFunctions.
@@ -624,47 +1505,105 @@ func findUnsafePointerConversions(pkgs []*packages.Package, ssaProg *ssa.Program
 			// didn't exist in the source, a synthetic one will have been
 			// created.
 			if f := pkg.Func("init"); f != nil {
-				unsafePointerFunctions[f] = struct{}{}
+				unsafePointerFunctions[f] = pos
 			}
 		}
 	}
 	return unsafePointerFunctions
 }
 
+// getNodeCapabilities categorizes the functions in graph using classifier.
+//
+// If classifier is a CallClassifier or an ArgAwareClassifier, calls to a
+// function can have a different category than the function itself.  The
+// function is then added to nodesByCapability for each category of its calls,
+// and callCapabilities records the category of each call to it, so that a
+// search for paths to one capability can skip the calls with another.
 func getNodeCapabilities(graph *callgraph.Graph,
 	classifier Classifier,
-) (safe nodeset, nodesByCapability nodesetPerCapability) {
+) (safe nodeset, nodesByCapability nodesetPerCapability, callCapabilities edgeCapabilities) {
 	safe = make(nodeset)
 	nodesByCapability = make(nodesetPerCapability)
+	callCapabilities = make(edgeCapabilities)
+	refine := categorizesCalls(classifier)
 	for _, v := range graph.Nodes {
 		if v.Func == nil {
 			continue
 		}
-		var c cpb.Capability
-		if v.Func.Package() != nil && v.Func.Package().Pkg != nil {
-			// Categorize v.Func.
-			pkg := v.Func.Package().Pkg.Path()
-			name := v.Func.String()
-			c = classifier.FunctionCategory(pkg, name)
-		} else {
-			origin := v.Func.Origin()
-			if origin == nil || origin.Package() == nil || origin.Package().Pkg == nil {
-				continue
-			}
-			// v.Func is an instantiation of a generic function.  Get the package
-			// name and function name of the generic function, and categorize that
-			// instead.
-			pkg := origin.Package().Pkg.Path()
-			name := origin.String()
-			c = classifier.FunctionCategory(pkg, name)
-		}
+		c := functionCategory(classifier, v.Func)
 		if c == cpb.Capability_CAPABILITY_SAFE {
 			safe[v] = struct{}{}
 		} else if c != cpb.Capability_CAPABILITY_UNSPECIFIED {
-			nodesByCapability.add(c, v)
+			if !refine || !addCallCapabilities(classifier, v, c, nodesByCapability, callCapabilities) {
+				nodesByCapability.add(c, v)
+			}
 		}
 	}
-	return safe, nodesByCapability
+	return safe, nodesByCapability, callCapabilities
+}
+
+// functionCategory returns the category of f given by classifier.  For an
+// instantiation of a generic function, it returns the category of the generic
+// function.
+func functionCategory(classifier Classifier, f *ssa.Function) cpb.Capability {
+	pkg, name, ok := functionName(f)
+	if !ok {
+		return cpb.Capability_CAPABILITY_UNSPECIFIED
+	}
+	return classifier.FunctionCategory(pkg, name)
+}
+
+// functionName returns the package path and name by which f is categorized.
+// For an instantiation of a generic function, these are the package path and
+// name of the generic function.  ok is false if f has no package.
+func functionName(f *ssa.Function) (pkg, name string, ok bool) {
+	if f.Package() != nil && f.Package().Pkg != nil {
+		return f.Package().Pkg.Path(), f.String(), true
+	}
+	origin := f.Origin()
+	if origin == nil || origin.Package() == nil || origin.Package().Pkg == nil {
+		return "", "", false
+	}
+	// f is an instantiation of a generic function.  Get the package name and
+	// function name of the generic function, and categorize that instead.
+	return origin.Package().Pkg.Path(), origin.String(), true
+}
+
+// addCallCapabilities categorizes each call to v, which has capability c,
+// using classifier.  A call which the classifier categorizes as a combined
+// capability, such as CAPABILITY_FILES, has each of the capabilities it
+// contains.  If any call has a category other than c, it adds v to
+// nodesByCapability for each category of its calls, records the categories in
+// callCapabilities, and returns true.  Otherwise it returns false.
+func addCallCapabilities(classifier Classifier, v *callgraph.Node, c cpb.Capability,
+	nodesByCapability nodesetPerCapability, callCapabilities edgeCapabilities,
+) bool {
+	refined := false
+	categories := make(map[*callgraph.Edge][]cpb.Capability, len(v.In))
+	for _, edge := range v.In {
+		ec := callCategory(classifier, edge)
+		cs, ok := subCapabilities[ec]
+		switch {
+		case ec == cpb.Capability_CAPABILITY_UNSPECIFIED || ec == cpb.Capability_CAPABILITY_SAFE:
+			cs = []cpb.Capability{c}
+		case !ok:
+			cs = []cpb.Capability{ec}
+		}
+		if len(cs) != 1 || cs[0] != c {
+			refined = true
+		}
+		categories[edge] = cs
+	}
+	if !refined {
+		return false
+	}
+	for edge, cs := range categories {
+		callCapabilities[edge] = cs
+		for _, ec := range cs {
+			nodesByCapability.add(ec, v)
+		}
+	}
+	return true
 }
 
 func mergeCapabilities(nodesByCapability, extraNodesByCapability nodesetPerCapability) (nodesetPerCapability, nodeset) {
@@ -702,102 +1641,224 @@ func mergeCapabilities(nodesByCapability, extraNodesByCapability nodesetPerCapab
 //
 // For each capability, a BFS is run to find all functions in queriedPackages
 // which have a path in the callgraph to a function with that capability.
+// Packages matching config.ExcludePackages, and with config.ExcludeReplaced
+// those in replaced modules, are not included.
 //
 // fn is called for each of these (capability, function) pairs.  fn is passed
 // the capability, a map describing the current state of the BFS, and the node
 // in the callgraph representing the function.  fn can use this information
-// to reconstruct the path.
+// to reconstruct the path, which is a shortest path from the function to the
+// capability.  The state of the BFS is only valid during the call to fn.
 //
-// forEachPath may modify pkgs.
-func forEachPath(pkgs []*packages.Package, queriedPackages map[*types.Package]struct{},
-	fn func(cpb.Capability, bfsStateMap, *callgraph.Node), config *Config,
-) {
-	safe, nodesByCapability, extraNodesByCapability := getPackageNodesWithCapability(pkgs, config)
+// If filter is non-nil, only capabilities for which it returns true are
+// searched for.
+//
+// forEachPath may modify pkgs.  If ctx is cancelled before the search is
+// complete, forEachPath returns ctx.Err().
+func forEachPath(ctx context.Context, pkgs []*packages.Package, queriedPackages map[*types.Package]struct{},
+	fn func(cpb.Capability, *bfsStateMap, *callgraph.Node), filter func(cpb.Capability) bool, config *Config,
+) error {
+	config = pruneCalls(pkgs, config)
+	return forEachPathFrom(ctx, pkgs, inPackages(queriedPackagesToReport(pkgs, queriedPackages, config)), fn, filter, config)
+}
+
+// inPackages returns a function which reports whether a function is in one
+// of the packages in queriedPackages.
+func inPackages(queriedPackages map[*types.Package]struct{}) func(*ssa.Function) bool {
+	return func(f *ssa.Function) bool {
+		if f.Package() == nil {
+			return false
+		}
+		_, ok := queriedPackages[f.Package().Pkg]
+		return ok
+	}
+}
+
+// onlyReachable returns queried, or if config.OnlyReachableFromMain is set, a
+// function which also requires that the function is reachable in graph from
+// an entry point.  The entry points are each main.main and package
+// initializer in graph, and if config.ExportedEntryPoints is set, the
+// exported functions and methods for which queried returns true.  Calls
+// excluded by config.Classifier are not followed.
+func onlyReachable(graph *callgraph.Graph, queried func(*ssa.Function) bool, config *Config) func(*ssa.Function) bool {
+	if !config.OnlyReachableFromMain {
+		return queried
+	}
+	isEntryPoint := func(f *ssa.Function) bool {
+		if f.Package() == nil || f.Parent() != nil {
+			return false
+		}
+		if f.Synthetic == "package initializer" {
+			return true
+		}
+		if f.Name() == "main" && f.Package().Pkg.Name() == "main" && f.Signature.Recv() == nil {
+			return true
+		}
+		return config.ExportedEntryPoints && token.IsExported(f.Name()) && queried(f)
+	}
+	reachable := make(map[*ssa.Function]struct{})
+	var q []*callgraph.Node
+	for f, v := range graph.Nodes {
+		if f != nil && isEntryPoint(f) {
+			reachable[f] = struct{}{}
+			q = append(q, v)
+		}
+	}
+	for len(q) > 0 {
+		v := q[len(q)-1]
+		q = q[:len(q)-1]
+		for _, edge := range v.Out {
+			w := edge.Callee
+			if w.Func == nil || !config.Classifier.IncludeCall(edge) {
+				continue
+			}
+			if _, ok := reachable[w.Func]; ok {
+				continue
+			}
+			reachable[w.Func] = struct{}{}
+			q = append(q, w)
+		}
+	}
+	return func(f *ssa.Function) bool {
+		_, ok := reachable[f]
+		return ok && queried(f)
+	}
+}
+
+// forEachPathFrom is like forEachPath, but searches for paths from the
+// functions for which queried returns true.
+func forEachPathFrom(ctx context.Context, pkgs []*packages.Package, queried func(*ssa.Function) bool,
+	fn func(cpb.Capability, *bfsStateMap, *callgraph.Node), filter func(cpb.Capability) bool, config *Config,
+) error {
+	graph, safe, nodesByCapability, extraNodesByCapability, callCapabilities, sites, err := getPackageNodesWithCapability(pkgs, config)
+	if err != nil {
+		return err
+	}
 	nodesByCapability, allNodesWithExplicitCapability := mergeCapabilities(nodesByCapability, extraNodesByCapability)
 	extraNodesByCapability = nil // we don't use extraNodesByCapability again.
+	queried = onlyReachable(graph, queried, config)
 	var caps []cpb.Capability
 	for cap := range nodesByCapability {
-		caps = append(caps, cap)
+		if filter == nil || filter(cap) {
+			caps = append(caps, cap)
+		}
 	}
 	sort.Slice(caps, func(i, j int) bool { return caps[i] < caps[j] })
+	// The state of the search is reused for each capability.
+	visited := newBFSStateMap()
+	maxPaths := config.maxPathCount()
 	for _, cap := range caps {
 		nodes := nodesByCapability[cap]
-		var (
-			visited = make(bfsStateMap)
-			q       []*callgraph.Node // queue for the BFS
-		)
+		searched := nodesetPerCapability{cap: nodes}
+		config.searchStarted(searched)
+		visited.reset()
+		visited.sites = sites[cap]
+		var q []*callgraph.Node // the current level of the BFS
 		// Initialize the queue to contain the nodes with the capability.
 		for v := range nodes {
 			if _, ok := safe[v]; ok {
 				continue
 			}
 			q = append(q, v)
-			visited[v] = bfsState{}
+			visited.visit(v, nil)
+			visited.addPaths(v, 1, maxPaths)
 		}
 		sort.Sort(byFunction(q))
 		for _, v := range q {
-			// Skipping cases where v.Func.Package() doesn't exist.
-			if v.Func.Package() == nil {
-				continue
-			}
-			if _, ok := queriedPackages[v.Func.Package().Pkg]; ok {
-				// v itself is in one of the queried packages.  Call fn here because
+			if queried(v.Func) {
+				// v itself is one of the queried functions.  Call fn here because
 				// the BFS below will only call fn for functions that call v
 				// directly or transitively.
 				fn(cap, visited, v)
 			}
 		}
 		// Perform a BFS backwards through the call graph from the interesting
-		// nodes.
+		// nodes, one level at a time, so that the path recorded for each node
+		// is a shortest path to the capability.  When a node has calls to
+		// several nodes in the previous level, we choose the call whose callee
+		// comes first in the order of byCallee, so that the choice does not
+		// depend on the order in which the nodes were visited.
 		for len(q) > 0 {
-			v := q[0]
-			q = q[1:]
-			var incomingEdges []*callgraph.Edge
-			for _, edge := range v.In {
-				if config.Classifier.IncludeCall(edge) {
-					incomingEdges = append(incomingEdges, edge)
-				}
+			if err := ctx.Err(); err != nil {
+				return err
 			}
-			sort.Sort(byCaller(incomingEdges))
-			for _, edge := range incomingEdges {
-				w := edge.Caller
-				if w.Func == nil {
-					// Synthetic nodes may not have this information.
-					continue
-				}
-				if _, ok := safe[w]; ok {
-					continue
-				}
-				if _, ok := visited[w]; ok {
-					// We have already visited w.
-					continue
-				}
-				if _, ok := allNodesWithExplicitCapability[w]; ok {
-					// w already has an explicit categorization.
-					continue
+			best := make(map[*callgraph.Node]*callgraph.Edge)
+			paths := make(map[*callgraph.Node]int)
+			for _, v := range q {
+				for _, edge := range v.In {
+					if !config.Classifier.IncludeCall(edge) || !callCapabilities.includes(edge, searched) {
+						continue
+					}
+					w := edge.Caller
+					if w.Func == nil {
+						// Synthetic nodes may not have this information.
+						continue
+					}
+					if _, ok := safe[w]; ok {
+						continue
+					}
+					if _, ok := visited.get(w); ok {
+						// We have already visited w.
+						continue
+					}
+					if _, ok := allNodesWithExplicitCapability[w]; ok {
+						// w already has an explicit categorization.
+						continue
+					}
+					if e, ok := best[w]; !ok || calleeLess(edge, e) {
+						best[w] = edge
+					}
+					// Each shortest path from v gives a shortest path from w.
+					paths[w] = min(paths[w]+visited.state(v).paths, maxPaths)
 				}
-				visited[w] = bfsState{edge: edge}
+			}
+			q = q[:0]
+			for w := range best {
 				q = append(q, w)
-				if w.Func.Package() != nil {
-					if _, ok := queriedPackages[w.Func.Package().Pkg]; ok {
-						fn(cap, visited, w)
-					}
+			}
+			sort.Sort(byFunction(q))
+			for _, w := range q {
+				visited.visit(w, best[w])
+				visited.addPaths(w, paths[w], maxPaths)
+			}
+			for _, w := range q {
+				if queried(w.Func) {
+					fn(cap, visited, w)
 				}
 			}
 		}
 	}
+	config.progress(ProgressEvent{Stage: ProgressComplete, Count: len(caps)})
+	return nil
+}
+
+// lastModulePackage returns the path of the last package outside the
+// standard library with a function in the path through node constructed by
+// intermediatePackages, or "" if there is none.  The part of the path after
+// node is in capabilityBFS, and the part before it in queryBFS.
+func lastModulePackage(queryBFS *bfsStateMap, node *callgraph.Node, capabilityBFS *bfsStateMap) string {
+	if last := capabilityBFS.summary(node).last; last != "" {
+		return last
+	}
+	for e := queryBFS.state(node).edge; e != nil; e = queryBFS.state(e.Caller).edge {
+		if pkg := packagePath(e.Caller.Func); pkg != "" && !isStdLib(pkg) {
+			return pkg
+		}
+	}
+	return ""
 }
 
 // intermediatePackages returns a CapabilityInfo for each unique (P, C) pair
 // where there is a call path from a function in one of the queried packages
 // to a function with capability C, and the call path includes a function in
 // package P.
-func intermediatePackages(pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config) *cpb.CapabilityInfoList {
+func intermediatePackages(ctx context.Context, pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config) (*cpb.CapabilityInfoList, error) {
 	type packageAndCapability struct {
 		pkg *types.Package
 		cpb.Capability
 	}
 	seen := make(map[packageAndCapability]*cpb.CapabilityInfo)
+	modules := packageModules(pkgs, config.ReportReplacedAsLocal)
 
 	// The function CapabilityGraph will call filter for each capability, and
 	// then generate the graph for that capability, calling nodeCallback for
@@ -809,7 +1870,7 @@ func intermediatePackages(pkgs []*packages.Package, queriedPackages map[*types.P
 		return config.CapabilitySet.Has(c)
 	}
 
-	nodeCallback := func(queryBFS bfsStateMap, node *callgraph.Node, capabilityBFS bfsStateMap) {
+	nodeCallback := func(queryBFS *bfsStateMap, node *callgraph.Node, capabilityBFS *bfsStateMap) {
 		// We have found node in a BFS of the callgraph starting from functions in
 		// pkgs, and in a BFS of the callgraph searching backwards from functions
 		// with capabilities.  So we can construct a path from one to the other
@@ -829,12 +1890,20 @@ func intermediatePackages(pkgs []*packages.Package, queriedPackages map[*types.P
 			Capability:  capability.Enum(),
 			PackageDir:  proto.String(pkg.Path()),
 			PackageName: proto.String(pkg.Name()),
+			Severity:    proto.Int32(int32(capabilitySeverity(config.Classifier, capability))),
+			Cwe:         capabilityCWE(config.Classifier, capability),
+		}
+		if m, ok := modules[pkg.Path()]; ok {
+			ci.ModulePath = proto.String(m.GetPath())
+		}
+		if m, ok := modules[lastModulePackage(queryBFS, node, capabilityBFS)]; ok {
+			ci.CapabilityModule = proto.Clone(m).(*cpb.ModuleInfo)
 		}
 		if !config.OmitPaths {
 			// Add ci.Path entries for the part of the path leading from a function in
 			// pkgs to node, including node itself.
 			for v := node; v != nil; {
-				e := queryBFS[v].edge
+				e := queryBFS.state(v).edge
 				addFunction(&ci.Path, v, e)
 				if e == nil {
 					break
@@ -847,17 +1916,23 @@ func intermediatePackages(pkgs []*packages.Package, queriedPackages map[*types.P
 			// Add ci.Path entries for the part of the path leading from node to a
 			// function with a capability.
 			for v := node; v != nil; {
-				e := capabilityBFS[v].edge
+				e := capabilityBFS.state(v).edge
 				if e == nil {
 					break
 				}
 				v = e.Callee
 				addFunction(&ci.Path, v, e)
 			}
+			if !config.IncludeWrappers {
+				ci.Path = omitWrappers(ci.Path)
+			}
+			ci.PathId = proto.String(pathID(ci.Path))
 		}
 		seen[pc] = &ci
 	}
-	CapabilityGraph(pkgs, queriedPackages, config, nodeCallback, nil, nil, filter)
+	if err := CapabilityGraph(ctx, pkgs, queriedPackages, config, nodeCallback, nil, nil, filter); err != nil {
+		return nil, err
+	}
 	cis := make([]*cpb.CapabilityInfo, 0, len(seen))
 	for _, ci := range seen {
 		cis = append(cis, ci)
@@ -868,5 +1943,10 @@ func intermediatePackages(pkgs []*packages.Package, queriedPackages map[*types.P
 		}
 		return strings.Compare(a.GetPackageDir(), b.GetPackageDir())
 	})
-	return &cpb.CapabilityInfoList{CapabilityInfo: cis}
+	return &cpb.CapabilityInfoList{
+		CapabilityInfo:   cis,
+		ModuleInfo:       collectModuleInfo(pkgs),
+		PackageInfo:      collectPackageInfo(pkgs),
+		AnalyzedPackages: proto.Int64(analyzedPackages(pkgs)),
+	}, nil
 }
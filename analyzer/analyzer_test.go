@@ -7,10 +7,24 @@
 package analyzer
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/importer"
+	"go/parser"
+	"go/token"
 	"go/types"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/google/capslock/interesting"
@@ -19,8 +33,14 @@ import (
 	"golang.org/x/tools/go/analysis/analysistest"
 	"golang.org/x/tools/go/callgraph"
 	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
 )
 
 var filemap = map[string]string{"testlib/foo.go": `package testlib
@@ -67,15 +87,21 @@ func testAnalysis(t *testing.T, omitPaths bool) {
 	if err != nil {
 		t.Fatalf("setup: %v", err)
 	}
-	cil := GetCapabilityInfo(pkgs, queriedPackages, &Config{
+	cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
 		Classifier:     interesting.DefaultClassifier(),
 		DisableBuiltin: false,
 		OmitPaths:      omitPaths,
 	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
 	expected := &cpb.CapabilityInfoList{
+		AnalyzedPackages: proto.Int64(1),
 		CapabilityInfo: []*cpb.CapabilityInfo{{
 			PackageName: proto.String("testlib"),
 			Capability:  cpb.Capability_CAPABILITY_READ_SYSTEM_STATE.Enum(),
+			Severity:    proto.Int32(2),
+			Cwe:         []string{"CWE-497"},
 			DepPath:     proto.String("testlib.Bar os.Getpid"),
 			Path: []*cpb.Function{
 				&cpb.Function{Name: proto.String("testlib.Bar"), Package: proto.String("testlib")},
@@ -86,6 +112,8 @@ func testAnalysis(t *testing.T, omitPaths bool) {
 		}, {
 			PackageName: proto.String("testlib"),
 			Capability:  cpb.Capability_CAPABILITY_READ_SYSTEM_STATE.Enum(),
+			Severity:    proto.Int32(2),
+			Cwe:         []string{"CWE-497"},
 			DepPath:     proto.String("testlib.Foo os.Getpid"),
 			Path: []*cpb.Function{
 				&cpb.Function{Name: proto.String("testlib.Foo"), Package: proto.String("testlib")},
@@ -104,7 +132,8 @@ func testAnalysis(t *testing.T, omitPaths bool) {
 	opts := []cmp.Option{
 		protocmp.Transform(),
 		protocmp.IgnoreFields(&cpb.CapabilityInfoList{}, "package_info"),
-		protocmp.IgnoreFields(&cpb.Function{}, "site"),
+		protocmp.IgnoreFields(&cpb.Function{}, "site", "declaration"),
+		protocmp.IgnoreFields(&cpb.CapabilityInfo{}, "path_id"),
 		protocmp.IgnoreFields(&cpb.Function_Site{}, "filename"),
 		protocmp.IgnoreFields(&cpb.Function_Site{}, "line"),
 		protocmp.IgnoreFields(&cpb.Function_Site{}, "column"),
@@ -115,6 +144,32 @@ func testAnalysis(t *testing.T, omitPaths bool) {
 	}
 }
 
+func TestAnalysisCancelled(t *testing.T) {
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	config := &Config{Classifier: interesting.DefaultClassifier()}
+	if cil, err := GetCapabilityInfo(ctx, pkgs, queriedPackages, config); cil != nil || !errors.Is(err, context.Canceled) {
+		t.Errorf("GetCapabilityInfo with cancelled context: got (%v, %v), want (nil, %v)", cil, err, context.Canceled)
+	}
+	if cc, err := GetCapabilityCounts(ctx, pkgs, queriedPackages, config); cc != nil || !errors.Is(err, context.Canceled) {
+		t.Errorf("GetCapabilityCounts with cancelled context: got (%v, %v), want (nil, %v)", cc, err, context.Canceled)
+	}
+	err = CapabilityGraph(ctx, pkgs, queriedPackages, config,
+		func(*bfsStateMap, *callgraph.Node, *bfsStateMap) {
+			t.Errorf("CapabilityGraph with cancelled context: unexpected call to outputNode")
+		}, nil, nil, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("CapabilityGraph with cancelled context: got error %v, want %v", err, context.Canceled)
+	}
+}
+
 func TestGraph(t *testing.T) {
 	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
 	if cleanup != nil {
@@ -126,12 +181,12 @@ func TestGraph(t *testing.T) {
 	nodes := make(map[string]struct{})
 	calls := make(map[[2]string]struct{})
 	caps := make(map[string][]cpb.Capability)
-	CapabilityGraph(pkgs, queriedPackages,
+	err = CapabilityGraph(context.Background(), pkgs, queriedPackages,
 		&Config{
 			Classifier:     interesting.DefaultClassifier(),
 			DisableBuiltin: false,
 		},
-		func(_ bfsStateMap, node *callgraph.Node, _ bfsStateMap) {
+		func(_ *bfsStateMap, node *callgraph.Node, _ *bfsStateMap) {
 			nodes[node.Func.String()] = struct{}{}
 		},
 		func(edge *callgraph.Edge) {
@@ -142,6 +197,9 @@ func TestGraph(t *testing.T) {
 			caps[f] = append(caps[f], c)
 		},
 		nil)
+	if err != nil {
+		t.Fatalf("CapabilityGraph: %v", err)
+	}
 	expectedNodes := map[string]struct{}{
 		"testlib.Foo": {},
 		"testlib.Bar": {},
@@ -168,6 +226,134 @@ func TestGraph(t *testing.T) {
 	}
 }
 
+func TestWriteDOTWithCapabilitySet(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import "os"
+
+func Foo() { os.Getpid() }
+
+func Bar() { os.Getenv("A") }
+
+func Baz() { os.Hostname() }
+`,
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	cs, err := NewCapabilitySet("READ_SYSTEM_STATE,READ_ENVIRONMENT,SYSTEM_CALLS")
+	if err != nil {
+		t.Fatalf("NewCapabilitySet: %v", err)
+	}
+	var first string
+	for i := 0; i < 5; i++ {
+		var b bytes.Buffer
+		err := WriteDOT(context.Background(), &b, pkgs, queriedPackages, &Config{
+			Classifier:    interesting.DefaultClassifier(),
+			CapabilitySet: cs,
+		})
+		if err != nil {
+			t.Fatalf("WriteDOT: %v", err)
+		}
+		if i == 0 {
+			first = b.String()
+		} else if b.String() != first {
+			t.Fatalf("WriteDOT: output differs between runs:\n%s\n%s", first, b.String())
+		}
+	}
+	// The capabilities are written in the order of their values.
+	state := strings.Index(first, `-> "CAPABILITY_READ_SYSTEM_STATE"`)
+	env := strings.Index(first, `-> "CAPABILITY_READ_ENVIRONMENT"`)
+	if state < 0 || env < 0 || state > env {
+		t.Errorf("WriteDOT: got capabilities out of order in\n%s", first)
+	}
+}
+
+func TestWriteGraphML(t *testing.T) {
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	var b bytes.Buffer
+	err = WriteGraphML(context.Background(), &b, pkgs, queriedPackages, &Config{
+		Classifier: interesting.DefaultClassifier(),
+	})
+	if err != nil {
+		t.Fatalf("WriteGraphML: %v", err)
+	}
+	var doc struct {
+		Nodes []struct {
+			ID   string `xml:"id,attr"`
+			Data []struct {
+				Key   string `xml:"key,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"data"`
+		} `xml:"graph>node"`
+		Edges []struct {
+			Source string `xml:"source,attr"`
+			Target string `xml:"target,attr"`
+		} `xml:"graph>edge"`
+	}
+	if err := xml.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatalf("WriteGraphML: invalid XML: %v\n%s", err, b.String())
+	}
+	nodes := make(map[string]map[string]string)
+	for _, n := range doc.Nodes {
+		nodes[n.ID] = make(map[string]string)
+		for _, d := range n.Data {
+			nodes[n.ID][d.Key] = d.Value
+		}
+	}
+	var edges [][2]string
+	for _, e := range doc.Edges {
+		edges = append(edges, [2]string{e.Source, e.Target})
+	}
+	wantNodes := map[string]map[string]string{
+		"CAPABILITY_READ_SYSTEM_STATE": {
+			"capability":    "CAPABILITY_READ_SYSTEM_STATE",
+			"is_capability": "true",
+			"is_query_root": "false",
+		},
+		"os.Getpid": {
+			"package":       "os",
+			"function":      "os.Getpid",
+			"is_capability": "false",
+			"is_query_root": "false",
+		},
+		"testlib.Bar": {
+			"package":       "testlib",
+			"function":      "testlib.Bar",
+			"is_capability": "false",
+			"is_query_root": "true",
+		},
+		"testlib.Foo": {
+			"package":       "testlib",
+			"function":      "testlib.Foo",
+			"is_capability": "false",
+			"is_query_root": "true",
+		},
+	}
+	wantEdges := [][2]string{
+		{"os.Getpid", "CAPABILITY_READ_SYSTEM_STATE"},
+		{"testlib.Bar", "os.Getpid"},
+		{"testlib.Foo", "os.Getpid"},
+	}
+	if diff := cmp.Diff(wantNodes, nodes); diff != "" {
+		t.Errorf("WriteGraphML: got nodes diff (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(wantEdges, edges); diff != "" {
+		t.Errorf("WriteGraphML: got edges diff (-want +got):\n%s", diff)
+	}
+}
+
 // testClassifier is used for testing that non-default classifiers work
 // correctly.
 type testClassifier struct {
@@ -209,14 +395,20 @@ func TestAnalysisWithClassifier(t *testing.T) {
 	if err != nil {
 		t.Fatalf("setup: %v", err)
 	}
-	cil := GetCapabilityInfo(pkgs, queriedPackages, &Config{
+	cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
 		Classifier:     &testClassifier1,
 		DisableBuiltin: true,
 	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
 	expected := &cpb.CapabilityInfoList{
+		AnalyzedPackages: proto.Int64(1),
 		CapabilityInfo: []*cpb.CapabilityInfo{{
 			PackageName: proto.String("testlib"),
 			Capability:  cpb.Capability_CAPABILITY_FILES.Enum(),
+			Severity:    proto.Int32(3),
+			Cwe:         []string{"CWE-73"},
 			Path: []*cpb.Function{
 				&cpb.Function{Name: proto.String("testlib.A"), Package: proto.String("testlib")},
 				&cpb.Function{Name: proto.String("testlib.B"), Package: proto.String("testlib")},
@@ -228,6 +420,8 @@ func TestAnalysisWithClassifier(t *testing.T) {
 		}, {
 			PackageName: proto.String("testlib"),
 			Capability:  cpb.Capability_CAPABILITY_FILES.Enum(),
+			Severity:    proto.Int32(3),
+			Cwe:         []string{"CWE-73"},
 			Path: []*cpb.Function{
 				&cpb.Function{Name: proto.String("testlib.B"), Package: proto.String("testlib")},
 				&cpb.Function{Name: proto.String("testlib.C"), Package: proto.String("testlib")},
@@ -238,6 +432,8 @@ func TestAnalysisWithClassifier(t *testing.T) {
 		}, {
 			PackageName: proto.String("testlib"),
 			Capability:  cpb.Capability_CAPABILITY_FILES.Enum(),
+			Severity:    proto.Int32(3),
+			Cwe:         []string{"CWE-73"},
 			Path: []*cpb.Function{
 				&cpb.Function{Name: proto.String("testlib.C"), Package: proto.String("testlib")},
 				&cpb.Function{Name: proto.String("os.IsExist"), Package: proto.String("os")},
@@ -253,7 +449,8 @@ func TestAnalysisWithClassifier(t *testing.T) {
 		}),
 		protocmp.IgnoreFields(&cpb.CapabilityInfoList{}, "package_info"),
 		protocmp.IgnoreFields(&cpb.CapabilityInfo{}, "dep_path"),
-		protocmp.IgnoreFields(&cpb.Function{}, "site"),
+		protocmp.IgnoreFields(&cpb.Function{}, "site", "declaration"),
+		protocmp.IgnoreFields(&cpb.CapabilityInfo{}, "path_id"),
 		protocmp.IgnoreFields(&cpb.Function_Site{}, "filename"),
 		protocmp.IgnoreFields(&cpb.Function_Site{}, "line"),
 		protocmp.IgnoreFields(&cpb.Function_Site{}, "column"),
@@ -275,12 +472,12 @@ func TestGraphWithClassifier(t *testing.T) {
 	nodes := make(map[string]struct{})
 	calls := make(map[[2]string]struct{})
 	caps := make(map[string][]cpb.Capability)
-	CapabilityGraph(pkgs, queriedPackages,
+	err = CapabilityGraph(context.Background(), pkgs, queriedPackages,
 		&Config{
 			Classifier:     &testClassifier1,
 			DisableBuiltin: true,
 		},
-		func(_ bfsStateMap, node *callgraph.Node, _ bfsStateMap) {
+		func(_ *bfsStateMap, node *callgraph.Node, _ *bfsStateMap) {
 			nodes[node.Func.String()] = struct{}{}
 		},
 		func(edge *callgraph.Edge) {
@@ -291,6 +488,9 @@ func TestGraphWithClassifier(t *testing.T) {
 			caps[f] = append(caps[f], c)
 		},
 		nil)
+	if err != nil {
+		t.Fatalf("CapabilityGraph: %v", err)
+	}
 	expectedNodes := map[string]struct{}{
 		"testlib.A":  {},
 		"testlib.B":  {},
@@ -327,15 +527,21 @@ func TestAnalysisPackageGranularity(t *testing.T) {
 	if err != nil {
 		t.Fatalf("setup: %v", err)
 	}
-	cil := GetCapabilityInfo(pkgs, queriedPackages, &Config{
+	cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
 		Classifier:     interesting.DefaultClassifier(),
 		DisableBuiltin: false,
 		Granularity:    GranularityPackage,
 	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
 	expected := &cpb.CapabilityInfoList{
+		AnalyzedPackages: proto.Int64(1),
 		CapabilityInfo: []*cpb.CapabilityInfo{{
 			PackageName: proto.String("testlib"),
 			Capability:  cpb.Capability_CAPABILITY_READ_SYSTEM_STATE.Enum(),
+			Severity:    proto.Int32(2),
+			Cwe:         []string{"CWE-497"},
 			Path: []*cpb.Function{
 				&cpb.Function{Name: proto.String("testlib.Bar"), Package: proto.String("testlib")},
 				&cpb.Function{Name: proto.String("os.Getpid"), Package: proto.String("os")},
@@ -348,7 +554,8 @@ func TestAnalysisPackageGranularity(t *testing.T) {
 		protocmp.Transform(),
 		protocmp.IgnoreFields(&cpb.CapabilityInfoList{}, "package_info"),
 		protocmp.IgnoreFields(&cpb.CapabilityInfo{}, "dep_path"),
-		protocmp.IgnoreFields(&cpb.Function{}, "site"),
+		protocmp.IgnoreFields(&cpb.Function{}, "site", "declaration"),
+		protocmp.IgnoreFields(&cpb.CapabilityInfo{}, "path_id"),
 		protocmp.IgnoreFields(&cpb.Function_Site{}, "filename"),
 		protocmp.IgnoreFields(&cpb.Function_Site{}, "line"),
 		protocmp.IgnoreFields(&cpb.Function_Site{}, "column"),
@@ -359,330 +566,4624 @@ func TestAnalysisPackageGranularity(t *testing.T) {
 	}
 }
 
-func TestNewCapabilitySet(t *testing.T) {
+func TestPackageGranularityPrefersExported(t *testing.T) {
+	filemap := map[string]string{"testlib/foo.go": `package testlib
+
+import "os"
+
+type t struct{}
+
+func (t) Pid() { println(os.Getpid()) }
+
+func Long()   { mid() }
+func mid()    { Short() }
+func Short()  { helper() }
+func helper() { println(os.Getpid()) }
+`}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier:  interesting.DefaultClassifier(),
+		Granularity: GranularityPackage,
+	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
+	// The method of the unexported type t has a shorter path, but the
+	// shortest path from an exported function is chosen.
+	var got []string
+	for _, ci := range cil.GetCapabilityInfo() {
+		got = append(got, ci.GetDepPath())
+	}
+	want := []string{"testlib.Short testlib.helper os.Getpid"}
+	if !slices.Equal(got, want) {
+		t.Errorf("GetCapabilityInfo: got paths %q, want %q", got, want)
+	}
+}
+
+func TestAnalysisModuleGranularity(t *testing.T) {
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"m/go.mod": "module example.com/m\n\ngo 1.21\n",
+		"m/a/a.go": `package a
+
+import (
+	"os"
+
+	"example.com/m/b"
+)
+
+func F() { b.G() }
+func H() { println(os.Getpid()) }
+`,
+		"m/b/b.go": `package b
+
+import "os"
+
+func G() { println(os.Getpid()) }
+`,
+	})
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("analysistest.WriteFiles: %v", err)
+	}
+	cfg := &packages.Config{
+		Mode: PackagesLoadModeNeeded,
+		Dir:  filepath.Join(dir, "src", "m"),
+		Env:  append(os.Environ(), "GO111MODULE=on", "GOPROXY=off", "GOFLAGS=-mod=mod"),
+	}
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		t.Fatalf("packages.Load: %v", err)
+	}
+	cil, err := GetCapabilityInfo(context.Background(), pkgs, GetQueriedPackages(pkgs), &Config{
+		Classifier:     interesting.DefaultClassifier(),
+		DisableBuiltin: false,
+		Granularity:    GranularityModule,
+	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
+	// All three functions are in the same module, so there is one entry, and
+	// it has the shortest of the paths.
+	expected := &cpb.CapabilityInfoList{
+		AnalyzedPackages: proto.Int64(2),
+		CapabilityInfo: []*cpb.CapabilityInfo{{
+			PackageName: proto.String("a"),
+			Capability:  cpb.Capability_CAPABILITY_READ_SYSTEM_STATE.Enum(),
+			Severity:    proto.Int32(2),
+			Cwe:         []string{"CWE-497"},
+			Path: []*cpb.Function{
+				&cpb.Function{Name: proto.String("example.com/m/a.H"), Package: proto.String("example.com/m/a")},
+				&cpb.Function{Name: proto.String("os.Getpid"), Package: proto.String("os")},
+			},
+			PackageDir:     proto.String("example.com/m/a"),
+			CapabilityType: cpb.CapabilityType_CAPABILITY_TYPE_DIRECT.Enum(),
+			ModulePath:     proto.String("example.com/m"),
+			// The main module has no version.
+			CapabilityModule: &cpb.ModuleInfo{Path: proto.String("example.com/m")},
+		}},
+		// The main module is listed, with no version.
+		ModuleInfo: []*cpb.ModuleInfo{{Path: proto.String("example.com/m")}},
+	}
+	opts := []cmp.Option{
+		protocmp.Transform(),
+		protocmp.IgnoreFields(&cpb.CapabilityInfoList{}, "package_info"),
+		protocmp.IgnoreFields(&cpb.CapabilityInfo{}, "dep_path"),
+		protocmp.IgnoreFields(&cpb.Function{}, "site", "declaration"),
+		protocmp.IgnoreFields(&cpb.CapabilityInfo{}, "path_id"),
+	}
+	if diff := cmp.Diff(expected, cil, opts...); diff != "" {
+		t.Errorf("GetCapabilityInfo: got %v, want %v; diff %s", cil, expected, diff)
+	}
+	// Comparing at module granularity uses the same key, so removing the
+	// entry reports the main module rather than the package directory.
+	d := DiffCapabilityInfo(cil, &cpb.CapabilityInfoList{ModuleInfo: cil.ModuleInfo}, GranularityModule)
+	if got := d.GetRemoved(); len(got) != 1 || got[0].GetKey() != "example.com/m" {
+		t.Errorf("DiffCapabilityInfo: got removed entries %v, want one with key example.com/m", got)
+	}
+}
+
+func TestCapabilityModule(t *testing.T) {
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"m/go.mod": "module example.com/m\n\ngo 1.21\n\nrequire example.com/dep v1.2.3\n\nreplace example.com/dep => ../dep\n",
+		"m/m.go": `package m
+
+import (
+	"os"
+
+	"example.com/dep"
+)
+
+func Direct() int { return os.Getpid() }
+
+func ThroughDep() int { return dep.Getpid() }
+`,
+		"dep/go.mod": "module example.com/dep\n\ngo 1.21\n",
+		"dep/dep.go": `package dep
+
+import "os"
+
+func Getpid() int { return os.Getpid() }
+`,
+	})
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("analysistest.WriteFiles: %v", err)
+	}
+	cfg := &packages.Config{
+		Mode: PackagesLoadModeNeeded,
+		Dir:  filepath.Join(dir, "src", "m"),
+		Env:  append(os.Environ(), "GO111MODULE=on", "GOPROXY=off", "GOFLAGS=-mod=mod"),
+	}
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		t.Fatalf("packages.Load: %v", err)
+	}
+	cil, err := GetCapabilityInfo(context.Background(), pkgs, GetQueriedPackages(pkgs), &Config{
+		Classifier: interesting.DefaultClassifier(),
+		OmitPaths:  true,
+	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
+	got := make(map[string]*cpb.ModuleInfo)
+	for _, ci := range cil.GetCapabilityInfo() {
+		got[ci.GetPath()[0].GetName()] = ci.GetCapabilityModule()
+	}
+	want := map[string]*cpb.ModuleInfo{
+		"example.com/m.Direct":     {Path: proto.String("example.com/m")},
+		"example.com/m.ThroughDep": {Path: proto.String("example.com/dep"), Version: proto.String("v1.2.3"), Replace: &cpb.ModuleInfo{Path: proto.String("../dep")}},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("GetCapabilityInfo: capability modules diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestReportReplacedAsLocal(t *testing.T) {
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"m/go.mod": "module example.com/m\n\ngo 1.21\n\nrequire example.com/dep v1.2.3\n\nreplace example.com/dep => ../dep\n",
+		"m/m.go": `package m
+
+import "example.com/dep"
+
+func ThroughDep() int { return dep.Getpid() }
+`,
+		"dep/go.mod": "module example.com/dep\n\ngo 1.21\n",
+		"dep/dep.go": `package dep
+
+import "os"
+
+func Getpid() int { return os.Getpid() }
+`,
+	})
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("analysistest.WriteFiles: %v", err)
+	}
+	cfg := &packages.Config{
+		Mode: PackagesLoadModeNeeded,
+		Dir:  filepath.Join(dir, "src", "m"),
+		Env:  append(os.Environ(), "GO111MODULE=on", "GOPROXY=off", "GOFLAGS=-mod=mod"),
+	}
+	pkgs, err := packages.Load(cfg, "./...", "example.com/dep")
+	if err != nil {
+		t.Fatalf("packages.Load: %v", err)
+	}
 	for _, test := range []struct {
-		list             string
-		wantCapabilities map[cpb.Capability]struct{}
-		wantNegated      bool
+		name   string
+		config Config
+		want   []string
 	}{
 		{
-			list: "NETWORK",
-			wantCapabilities: map[cpb.Capability]struct{}{
-				cpb.Capability_CAPABILITY_NETWORK: struct{}{},
-			},
-			wantNegated: false,
-		},
-		{
-			list:             "",
-			wantCapabilities: nil,
-			wantNegated:      true,
-		},
-		{
-			list: "-NETWORK",
-			wantCapabilities: map[cpb.Capability]struct{}{
-				cpb.Capability_CAPABILITY_NETWORK: struct{}{},
-			},
-			wantNegated: true,
-		},
-		{
-			list: "CAPABILITY_NETWORK",
-			wantCapabilities: map[cpb.Capability]struct{}{
-				cpb.Capability_CAPABILITY_NETWORK: struct{}{},
-			},
-			wantNegated: false,
-		},
-		{
-			list: "NETWORK,FILES",
-			wantCapabilities: map[cpb.Capability]struct{}{
-				cpb.Capability_CAPABILITY_NETWORK: struct{}{},
-				cpb.Capability_CAPABILITY_FILES:   struct{}{},
+			name: "default",
+			want: []string{
+				"example.com/dep.Getpid example.com/dep example.com/dep",
+				"example.com/m.ThroughDep example.com/m example.com/dep",
 			},
-			wantNegated: false,
 		},
 		{
-			list: "-NETWORK,-CAPABILITY_FILES",
-			wantCapabilities: map[cpb.Capability]struct{}{
-				cpb.Capability_CAPABILITY_NETWORK: struct{}{},
-				cpb.Capability_CAPABILITY_FILES:   struct{}{},
+			name:   "ReportReplacedAsLocal",
+			config: Config{ReportReplacedAsLocal: true},
+			want: []string{
+				"example.com/dep.Getpid ../dep ../dep",
+				"example.com/m.ThroughDep example.com/m ../dep",
 			},
-			wantNegated: true,
 		},
 		{
-			list: "CAPABILITY_FILES,CAPABILITY_NETWORK,CAPABILITY_RUNTIME,CAPABILITY_READ_SYSTEM_STATE,CAPABILITY_MODIFY_SYSTEM_STATE,CAPABILITY_OPERATING_SYSTEM,CAPABILITY_SYSTEM_CALLS,CAPABILITY_ARBITRARY_EXECUTION,CAPABILITY_CGO,CAPABILITY_UNANALYZED,CAPABILITY_UNSAFE_POINTER,CAPABILITY_REFLECT,CAPABILITY_EXEC",
-			wantCapabilities: map[cpb.Capability]struct{}{
-				cpb.Capability_CAPABILITY_FILES:               struct{}{},
-				cpb.Capability_CAPABILITY_NETWORK:             struct{}{},
-				cpb.Capability_CAPABILITY_RUNTIME:             struct{}{},
-				cpb.Capability_CAPABILITY_READ_SYSTEM_STATE:   struct{}{},
-				cpb.Capability_CAPABILITY_MODIFY_SYSTEM_STATE: struct{}{},
-				cpb.Capability_CAPABILITY_OPERATING_SYSTEM:    struct{}{},
-				cpb.Capability_CAPABILITY_SYSTEM_CALLS:        struct{}{},
-				cpb.Capability_CAPABILITY_ARBITRARY_EXECUTION: struct{}{},
-				cpb.Capability_CAPABILITY_CGO:                 struct{}{},
-				cpb.Capability_CAPABILITY_UNANALYZED:          struct{}{},
-				cpb.Capability_CAPABILITY_UNSAFE_POINTER:      struct{}{},
-				cpb.Capability_CAPABILITY_REFLECT:             struct{}{},
-				cpb.Capability_CAPABILITY_EXEC:                struct{}{},
+			name:   "ExcludeReplaced",
+			config: Config{ExcludeReplaced: true},
+			want: []string{
+				"example.com/m.ThroughDep example.com/m example.com/dep",
 			},
-			wantNegated: false,
 		},
 	} {
-		cs, err := NewCapabilitySet(test.list)
+		config := test.config
+		config.Classifier = interesting.DefaultClassifier()
+		config.OmitPaths = true
+		cil, err := GetCapabilityInfo(context.Background(), pkgs, GetQueriedPackages(pkgs), &config)
 		if err != nil {
-			t.Errorf("NewCapabilitySet(%q): got err == %v, want nil error",
-				test.list, err)
-			continue
+			t.Fatalf("GetCapabilityInfo with %s: %v", test.name, err)
 		}
-		if test.wantCapabilities == nil {
-			if cs != nil {
-				t.Errorf("NewCapabilitySet(%q): got non-nil, want nil", test.list)
-			}
-			continue
+		var got []string
+		for _, ci := range cil.GetCapabilityInfo() {
+			got = append(got, ci.GetPath()[0].GetName()+" "+ci.GetModulePath()+" "+ci.GetCapabilityModule().GetPath())
 		}
-		if !reflect.DeepEqual(cs.capabilities, test.wantCapabilities) {
-			t.Errorf("NewCapabilitySet(%q): got capabilities %v want %v",
-				test.list, cs.capabilities, test.wantCapabilities)
+		slices.Sort(got)
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("GetCapabilityInfo with %s: got diff (-want +got):\n%s", test.name, diff)
 		}
-		if cs.negated != test.wantNegated {
-			t.Errorf("NewCapabilitySet(%q): got negated = %v want %v",
-				test.list, cs.negated, test.wantNegated)
+		wantModule := &cpb.ModuleInfo{
+			Path:    proto.String("example.com/dep"),
+			Version: proto.String("v1.2.3"),
+			Replace: &cpb.ModuleInfo{Path: proto.String("../dep")},
+		}
+		var gotModule *cpb.ModuleInfo
+		for _, m := range cil.GetModuleInfo() {
+			if m.GetPath() == "example.com/dep" {
+				gotModule = m
+			}
+		}
+		if diff := cmp.Diff(wantModule, gotModule, protocmp.Transform()); diff != "" {
+			t.Errorf("GetCapabilityInfo with %s: module info diff (-want +got):\n%s", test.name, diff)
 		}
 	}
-	for _, list := range []string{
-		"NOTWORK",
-		"FILES!",
-		"NETWORKFILES",
-		"-NETWORK,FILES",
-		"NETWORK,-FILES",
-		",NETWORK",
-		"NETWORK,",
+}
+
+func TestAnalyzeModule(t *testing.T) {
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"m/go.mod": "module example.com/m\n\ngo 1.21\n\nrequire example.com/dep v1.2.3\n\nreplace example.com/dep => ../dep\n",
+		"m/m.go": `package m
+
+import "example.com/dep"
+
+func Env() string { return dep.Home() }
+`,
+		"m/sub/sub.go": `package sub
+
+import "os"
+
+func Pid() int { return os.Getpid() }
+`,
+		"dep/go.mod": "module example.com/dep\n\ngo 1.21\n",
+		"dep/dep.go": `package dep
+
+import "os"
+
+func Home() string { return os.Getenv("HOME") }
+
+func Pid() int { return os.Getpid() }
+`,
+	})
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("analysistest.WriteFiles: %v", err)
+	}
+	t.Setenv("GO111MODULE", "on")
+	t.Setenv("GOPROXY", "off")
+	t.Setenv("GOFLAGS", "-mod=mod")
+	cil, err := AnalyzeModule(context.Background(), filepath.Join(dir, "src", "m"), LoadConfig{}, &Config{
+		Classifier: interesting.DefaultClassifier(),
+		OmitPaths:  true,
+	})
+	if err != nil {
+		t.Fatalf("AnalyzeModule: %v", err)
+	}
+	var got []string
+	for _, ci := range cil.GetCapabilityInfo() {
+		got = append(got, ci.GetPath()[0].GetName()+" "+ci.GetCapability().String())
+	}
+	slices.Sort(got)
+	// The capabilities of the dependency are only reported where the module's
+	// own packages use them.
+	want := []string{
+		"example.com/m.Env CAPABILITY_READ_ENVIRONMENT",
+		"example.com/m/sub.Pid CAPABILITY_READ_SYSTEM_STATE",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("AnalyzeModule: got diff (-want +got):\n%s", diff)
+	}
+
+	if _, err := AnalyzeModule(context.Background(), filepath.Join(dir, "src", "missing"), LoadConfig{}, &Config{
+		Classifier: interesting.DefaultClassifier(),
+	}); err == nil {
+		t.Errorf("AnalyzeModule of a missing directory: got nil error, want error")
+	}
+}
+
+func TestMergeMajorVersions(t *testing.T) {
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"m/go.mod": "module example.com/m\n\ngo 1.21\n\n" +
+			"require (\n\texample.com/dep v1.0.0\n\texample.com/dep/v2 v2.0.0\n)\n\n" +
+			"replace example.com/dep => ../dep1\n\nreplace example.com/dep/v2 => ../dep2\n",
+		"m/m.go": `package m
+
+import (
+	_ "example.com/dep"
+	_ "example.com/dep/v2"
+)
+`,
+		"dep1/go.mod": "module example.com/dep\n\ngo 1.21\n",
+		"dep1/dep.go": `package dep
+
+import "os"
+
+func Getpid() int { return os.Getpid() }
+`,
+		"dep2/go.mod": "module example.com/dep/v2\n\ngo 1.21\n",
+		"dep2/dep.go": `package dep
+
+import "os"
+
+func Getpid() int { return os.Getpid() }
+
+func Pid() int { return Getpid() }
+`,
+	})
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("analysistest.WriteFiles: %v", err)
+	}
+	cfg := &packages.Config{
+		Mode: PackagesLoadModeNeeded,
+		Dir:  filepath.Join(dir, "src", "m"),
+		Env:  append(os.Environ(), "GO111MODULE=on", "GOPROXY=off", "GOFLAGS=-mod=mod"),
+	}
+	pkgs, err := packages.Load(cfg, "example.com/dep", "example.com/dep/v2")
+	if err != nil {
+		t.Fatalf("packages.Load: %v", err)
+	}
+	for _, test := range []struct {
+		granularity Granularity
+		merge       bool
+		want        []string
+	}{
+		{GranularityModule, false, []string{"example.com/dep", "example.com/dep/v2"}},
+		{GranularityModule, true, []string{"example.com/dep"}},
+		{GranularityPackage, false, []string{"example.com/dep", "example.com/dep/v2"}},
+		{GranularityPackage, true, []string{"example.com/dep"}},
+	} {
+		cil, err := GetCapabilityInfo(context.Background(), pkgs, GetQueriedPackages(pkgs), &Config{
+			Classifier:         interesting.DefaultClassifier(),
+			Granularity:        test.granularity,
+			MergeMajorVersions: test.merge,
+		})
+		if err != nil {
+			t.Fatalf("GetCapabilityInfo: %v", err)
+		}
+		var got []string
+		for _, ci := range cil.GetCapabilityInfo() {
+			got = append(got, ci.GetPackageDir())
+		}
+		slices.Sort(got)
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("GetCapabilityInfo with granularity %v and MergeMajorVersions=%v: got packages diff (-want +got):\n%s", test.granularity, test.merge, diff)
+		}
+	}
+}
+
+func TestTrimMajorVersions(t *testing.T) {
+	for path, want := range map[string]string{
+		"math/rand":                "math/rand",
+		"math/rand/v2":             "math/rand",
+		"example.com/m/v3/sub":     "example.com/m/sub",
+		"example.com/m/v1":         "example.com/m/v1",
+		"example.com/m/v02":        "example.com/m/v02",
+		"example.com/m/version":    "example.com/m/version",
+		"v2/pkg":                   "v2/pkg",
+		"gopkg.in/yaml.v3":         "gopkg.in/yaml",
+		"gopkg.in/check.v1":        "gopkg.in/check.v1",
+		"example.com/archive.v2":   "example.com/archive.v2",
+		"example.com/m/v2/sub/v10": "example.com/m/sub",
+	} {
+		if got := trimMajorVersions(path); got != want {
+			t.Errorf("trimMajorVersions(%q): got %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestAnalysisWorkspace(t *testing.T) {
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"go.work":   "go 1.21\n\nuse (\n\t./m1\n\t./m2\n)\n",
+		"m1/go.mod": "module example.com/m1\n\ngo 1.21\n\nrequire example.com/m2 v0.0.0\n",
+		"m2/go.mod": "module example.com/m2\n\ngo 1.21\n",
+		"m2/b/b.go": "package b\n\nimport \"os\"\n\nfunc G() { println(os.Getpid()) }\n",
+		"m1/a/a.go": `package a
+
+import "example.com/m2/b"
+
+func F() { b.G() }
+`,
+	})
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("analysistest.WriteFiles: %v", err)
+	}
+	cfg := &packages.Config{
+		Mode: PackagesLoadModeNeeded,
+		Dir:  filepath.Join(dir, "src"),
+		Env:  append(os.Environ(), "GO111MODULE=on", "GOPROXY=off", "GOFLAGS=", "GOWORK="),
+	}
+	// "./..." does not match across the modules of a workspace, so each
+	// module is listed separately.
+	pkgs, err := packages.Load(cfg, "./m1/...", "./m2/...")
+	if err != nil {
+		t.Fatalf("packages.Load: %v", err)
+	}
+	cil, err := GetCapabilityInfo(context.Background(), pkgs, GetQueriedPackages(pkgs), &Config{
+		Classifier:  interesting.DefaultClassifier(),
+		Granularity: GranularityFunction,
+	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
+	// Each function is attributed to the module containing it, even though
+	// the path from a.F continues into the other module.
+	got := make(map[string]string)
+	for _, ci := range cil.GetCapabilityInfo() {
+		got[ci.GetPath()[0].GetName()] = ci.GetModulePath()
+	}
+	want := map[string]string{
+		"example.com/m1/a.F": "example.com/m1",
+		"example.com/m2/b.G": "example.com/m2",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GetCapabilityInfo: module paths diff (-want +got):\n%s", diff)
+	}
+	wantModules := []*cpb.ModuleInfo{
+		{Path: proto.String("example.com/m1")},
+		{Path: proto.String("example.com/m2")},
+	}
+	if diff := cmp.Diff(wantModules, cil.GetModuleInfo(), protocmp.Transform()); diff != "" {
+		t.Errorf("GetCapabilityInfo: module info diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestPrunePackageInfo(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import (
+	"example.com/dep"
+	"example.com/other"
+)
+
+func Foo() { dep.Dial(); other.Pid() }
+`,
+		"example.com/dep/dial.go": `package dep
+
+import "net"
+
+func Dial() { net.Dial("tcp", "example.com:80") }
+`,
+		"example.com/other/pid.go": `package other
+
+func Pid() int { return 1 }
+`,
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	for _, test := range []struct {
+		prune bool
+		want  []string
+	}{
+		{false, []string{"example.com/dep", "example.com/other", "testlib"}},
+		{true, []string{"example.com/dep", "testlib"}},
+	} {
+		cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+			Classifier:       interesting.DefaultClassifier(),
+			OmitPaths:        true,
+			PrunePackageInfo: test.prune,
+		})
+		if err != nil {
+			t.Fatalf("GetCapabilityInfo: %v", err)
+		}
+		var got []string
+		for _, pi := range cil.GetPackageInfo() {
+			got = append(got, pi.GetPath())
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("GetCapabilityInfo with PrunePackageInfo=%v: got package info diff (-want +got):\n%s", test.prune, diff)
+		}
+	}
+}
+
+func TestReachableEnvVars(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import (
+	"os"
+
+	"example.com/dep"
+)
+
+func Foo() string { return dep.Config() }
+
+func Bar(k string) string { return os.Getenv(k) }
+
+func Baz() string {
+	name := "FIRST"
+	name = "SECOND"
+	return os.Getenv(name)
+}
+`,
+		"testlib/quiet/quiet.go": `package quiet
+
+func Quiet() int { return 1 }
+`,
+		"example.com/dep/dep.go": `package dep
+
+import "os"
+
+func Config() string {
+	if v, ok := os.LookupEnv("DEP_CONFIG"); ok {
+		return v
+	}
+	return os.Getenv("HOME")
+}
+`,
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib/...")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	got, err := GetReachableEnvVars(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier: interesting.DefaultClassifier(),
+	})
+	if err != nil {
+		t.Fatalf("GetReachableEnvVars: %v", err)
+	}
+	want := &cpb.ReachableEnvVarsList{
+		ReachableEnvVars: []*cpb.ReachableEnvVars{
+			{
+				Package:  proto.String("testlib"),
+				VarNames: []string{"=DYNAMIC=", "DEP_CONFIG", "HOME", "SECOND"},
+			},
+			{
+				Package: proto.String("testlib/quiet"),
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("GetReachableEnvVars: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestReachableEnvVarsWrapper(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import "example.com/dep"
+
+func cfg(k string) string { return dep.Get(k) }
+
+func lookup(k string) string { return cfg(k) }
+
+func Foo() string { return cfg("FOO") }
+
+func Bar() string { return lookup("BAR") }
+
+func Suffixed(k string) string { return cfg(k + "_SUFFIX") }
+`,
+		"testlib/other/other.go": `package other
+
+import "example.com/dep"
+
+func Other() string { return dep.Get("OTHER") }
+`,
+		"example.com/dep/dep.go": `package dep
+
+import "os"
+
+func Get(k string) string {
+	if v, ok := os.LookupEnv(k); ok {
+		return v
+	}
+	return ""
+}
+`,
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib/...")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	got, err := GetReachableEnvVars(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier: interesting.DefaultClassifier(),
+	})
+	if err != nil {
+		t.Fatalf("GetReachableEnvVars: %v", err)
+	}
+	// The names passed to the wrappers are reported for their callers, except
+	// for the name built by Suffixed, which is not a constant.
+	want := &cpb.ReachableEnvVarsList{
+		ReachableEnvVars: []*cpb.ReachableEnvVars{
+			{
+				Package:  proto.String("testlib"),
+				VarNames: []string{"=DYNAMIC=", "BAR", "FOO"},
+			},
+			{
+				Package:  proto.String("testlib/other"),
+				VarNames: []string{"OTHER"},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("GetReachableEnvVars: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestReachableEnvVarsEnviron(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import (
+	"os"
+	"strings"
+)
+
+func Prefixed() (vars []string) {
+	for _, e := range os.Environ() {
+		if strings.HasPrefix(e, "MYAPP_") {
+			vars = append(vars, e)
+		}
+	}
+	return vars
+}
+
+func Split() string {
+	for _, e := range os.Environ() {
+		kv := strings.SplitN(e, "=", 2)
+		if kv[0] == "EXACT" {
+			return kv[1]
+		}
+	}
+	return ""
+}
+
+func Cut() (vars []string) {
+	for _, e := range os.Environ() {
+		if k, _, ok := strings.Cut(e, "="); ok && strings.HasPrefix(k, "CUT_") {
+			vars = append(vars, k)
+		}
+	}
+	return vars
+}
+`,
+		"testlib/all/all.go": `package all
+
+import "os"
+
+func All() int { return len(os.Environ()) }
+`,
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib/...")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	got, err := GetReachableEnvVars(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier: interesting.DefaultClassifier(),
+	})
+	if err != nil {
+		t.Fatalf("GetReachableEnvVars: %v", err)
+	}
+	want := &cpb.ReachableEnvVarsList{
+		ReachableEnvVars: []*cpb.ReachableEnvVars{
+			{
+				Package:  proto.String("testlib"),
+				VarNames: []string{"CUT_*", "EXACT", "MYAPP_*"},
+			},
+			{
+				Package:  proto.String("testlib/all"),
+				VarNames: []string{"=DYNAMIC="},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("GetReachableEnvVars: got diff (-want +got):\n%s", diff)
+	}
+}
+
+// envCallClassifier categorizes example.com/dep.Home as
+// CAPABILITY_READ_ENVIRONMENT, and its calls from testlib/other.Other as
+// CAPABILITY_FILES_READ.
+type envCallClassifier struct{}
+
+func (envCallClassifier) FunctionCategory(pkg string, name string) cpb.Capability {
+	if name == "example.com/dep.Home" {
+		return cpb.Capability_CAPABILITY_READ_ENVIRONMENT
+	}
+	return cpb.Capability_CAPABILITY_UNSPECIFIED
+}
+
+func (envCallClassifier) IncludeCall(edge *callgraph.Edge) bool { return true }
+
+func (envCallClassifier) CallCategory(edge *callgraph.Edge) cpb.Capability {
+	if edge.Caller.Func.String() == "testlib/other.Other" {
+		return cpb.Capability_CAPABILITY_FILES_READ
+	}
+	return cpb.Capability_CAPABILITY_UNSPECIFIED
+}
+
+func TestReachableEnvVarsWithCallClassifier(t *testing.T) {
+	// The calls to dep.Home are categorized individually, so the search
+	// follows only the calls whose category is CAPABILITY_READ_ENVIRONMENT.
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import "example.com/dep"
+
+func Foo() string { return dep.Home() }
+`,
+		"testlib/other/other.go": `package other
+
+import "example.com/dep"
+
+func Other() string { return dep.Home() }
+`,
+		"example.com/dep/dep.go": `package dep
+
+import "os"
+
+func Home() string { return os.Getenv("HOME") }
+`,
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib/...")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	got, err := GetReachableEnvVars(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier: envCallClassifier{},
+	})
+	if err != nil {
+		t.Fatalf("GetReachableEnvVars: %v", err)
+	}
+	want := &cpb.ReachableEnvVarsList{
+		ReachableEnvVars: []*cpb.ReachableEnvVars{
+			{
+				Package:  proto.String("testlib"),
+				VarNames: []string{"HOME"},
+			},
+			{
+				Package: proto.String("testlib/other"),
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("GetReachableEnvVars: got diff (-want +got):\n%s", diff)
+	}
+}
+
+// openArgClassifier categorizes example.com/dep.Open as CAPABILITY_FILES,
+// and its calls whose second argument is a constant as CAPABILITY_FILES_WRITE
+// or CAPABILITY_FILES_READ.
+type openArgClassifier struct{}
+
+func (openArgClassifier) FunctionCategory(pkg string, name string) cpb.Capability {
+	if name == "example.com/dep.Open" {
+		return cpb.Capability_CAPABILITY_FILES
+	}
+	return cpb.Capability_CAPABILITY_UNSPECIFIED
+}
+
+func (openArgClassifier) IncludeCall(edge *callgraph.Edge) bool { return true }
+
+func (openArgClassifier) FunctionCategoryWithArgs(pkg string, name string, args []ssa.Value) cpb.Capability {
+	if name != "example.com/dep.Open" || len(args) != 2 {
+		return cpb.Capability_CAPABILITY_UNSPECIFIED
+	}
+	k, ok := args[1].(*ssa.Const)
+	if !ok {
+		return cpb.Capability_CAPABILITY_UNSPECIFIED
+	}
+	if constant.BoolVal(k.Value) {
+		return cpb.Capability_CAPABILITY_FILES_WRITE
+	}
+	return cpb.Capability_CAPABILITY_FILES_READ
+}
+
+func TestArgAwareClassifier(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import "example.com/dep"
+
+func Read() { dep.Open("a", false) }
+
+func Write() { dep.Open("a", true) }
+
+func Either(write bool) { dep.Open("a", write) }
+`,
+		"example.com/dep/dep.go": `package dep
+
+func Open(name string, write bool) {}
+`,
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	want := []string{
+		"testlib.Either CAPABILITY_FILES",
+		"testlib.Read CAPABILITY_FILES_READ",
+		"testlib.Write CAPABILITY_FILES_WRITE",
+	}
+	for _, classifier := range []Classifier{
+		openArgClassifier{},
+		ChainClassifiers(openArgClassifier{}),
+	} {
+		cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+			Classifier:     classifier,
+			DisableBuiltin: true,
+		})
+		if err != nil {
+			t.Fatalf("GetCapabilityInfo: %v", err)
+		}
+		var got []string
+		for _, ci := range cil.GetCapabilityInfo() {
+			got = append(got, ci.GetPath()[0].GetName()+" "+ci.GetCapability().String())
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("GetCapabilityInfo with %T: got %q, want %q", classifier, got, want)
+		}
+	}
+}
+
+func TestGetCapabilityInfoForFunctions(t *testing.T) {
+	filemap := map[string]string{
+		"example.com/plugin/plugin.go": `package plugin
+
+import (
+	"os"
+
+	"example.com/dep"
+)
+
+type T struct{}
+
+// Methoder is implemented by *T, so the program has a synthetic wrapper
+// (*T).Method for the value method T.Method.
+type Methoder interface{ Method() string }
+
+var M Methoder = &T{}
+
+func Entry() int { return os.Getpid() }
+func (T) Method() string { return os.Getenv("HOME") }
+func internal() { dep.Dial() }
+`,
+		"example.com/dep/dial.go": `package dep
+
+import "net"
+
+func Dial() { net.Dial("tcp", "example.com:80") }
+`,
+	}
+	pkgs, _, cleanup, err := setup(filemap, "example.com/plugin")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	for _, test := range []struct {
+		functions []string
+		want      []string
+	}{
+		{
+			functions: []string{"example.com/plugin.Entry"},
+			want:      []string{"example.com/plugin.Entry CAPABILITY_READ_SYSTEM_STATE"},
+		},
+		{
+			functions: []string{"example.com/plugin.*"},
+			want: []string{
+				"example.com/plugin.Entry CAPABILITY_READ_SYSTEM_STATE",
+				"example.com/plugin.internal CAPABILITY_NETWORK_DIAL",
+			},
+		},
+		{
+			functions: []string{"(example.com/plugin.T).*", "example.com/dep.Dial"},
+			want: []string{
+				"(example.com/plugin.T).Method CAPABILITY_READ_ENVIRONMENT",
+				"example.com/dep.Dial CAPABILITY_NETWORK_DIAL",
+			},
+		},
+		{
+			functions: []string{"example.com/plugin.Missing"},
+			want:      nil,
+		},
+		{
+			// The wrapper (*T).Method has no package, and is not reported.
+			functions: []string{"(*example.com/plugin.T).*"},
+			want:      nil,
+		},
+	} {
+		config := &Config{
+			Classifier: interesting.DefaultClassifier(),
+			OmitPaths:  true,
+		}
+		cil, err := GetCapabilityInfoForFunctions(context.Background(), pkgs, test.functions, config)
+		if err != nil {
+			t.Fatalf("GetCapabilityInfoForFunctions(%q): %v", test.functions, err)
+		}
+		if config.Granularity != GranularityUnset {
+			t.Errorf("GetCapabilityInfoForFunctions(%q): config.Granularity changed to %v", test.functions, config.Granularity)
+		}
+		var got []string
+		for _, ci := range cil.GetCapabilityInfo() {
+			got = append(got, ci.GetPath()[0].GetName()+" "+ci.GetCapability().String())
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("GetCapabilityInfoForFunctions(%q): got diff (-want +got):\n%s", test.functions, diff)
+		}
+	}
+	_, err = GetCapabilityInfoForFunctions(context.Background(), pkgs, []string{"example.com/plugin.Entry"}, &Config{
+		Classifier:  interesting.DefaultClassifier(),
+		Granularity: GranularityIntermediate,
+	})
+	if err == nil {
+		t.Errorf("GetCapabilityInfoForFunctions with intermediate granularity: got nil error, want an error")
+	}
+}
+
+func TestNewCapabilitySet(t *testing.T) {
+	for _, test := range []struct {
+		list             string
+		wantCapabilities map[cpb.Capability]struct{}
+		wantNegated      bool
+	}{
+		{
+			list: "NETWORK",
+			wantCapabilities: map[cpb.Capability]struct{}{
+				cpb.Capability_CAPABILITY_NETWORK:        struct{}{},
+				cpb.Capability_CAPABILITY_NETWORK_DIAL:   struct{}{},
+				cpb.Capability_CAPABILITY_NETWORK_LISTEN: struct{}{},
+				cpb.Capability_CAPABILITY_NETWORK_DNS:    struct{}{},
+			},
+			wantNegated: false,
+		},
+		{
+			list:             "",
+			wantCapabilities: nil,
+			wantNegated:      true,
+		},
+		{
+			list: "-NETWORK",
+			wantCapabilities: map[cpb.Capability]struct{}{
+				cpb.Capability_CAPABILITY_NETWORK:        struct{}{},
+				cpb.Capability_CAPABILITY_NETWORK_DIAL:   struct{}{},
+				cpb.Capability_CAPABILITY_NETWORK_LISTEN: struct{}{},
+				cpb.Capability_CAPABILITY_NETWORK_DNS:    struct{}{},
+			},
+			wantNegated: true,
+		},
+		{
+			list: "CAPABILITY_NETWORK",
+			wantCapabilities: map[cpb.Capability]struct{}{
+				cpb.Capability_CAPABILITY_NETWORK:        struct{}{},
+				cpb.Capability_CAPABILITY_NETWORK_DIAL:   struct{}{},
+				cpb.Capability_CAPABILITY_NETWORK_LISTEN: struct{}{},
+				cpb.Capability_CAPABILITY_NETWORK_DNS:    struct{}{},
+			},
+			wantNegated: false,
+		},
+		{
+			list: "NETWORK,FILES",
+			wantCapabilities: map[cpb.Capability]struct{}{
+				cpb.Capability_CAPABILITY_NETWORK:        struct{}{},
+				cpb.Capability_CAPABILITY_NETWORK_DIAL:   struct{}{},
+				cpb.Capability_CAPABILITY_NETWORK_LISTEN: struct{}{},
+				cpb.Capability_CAPABILITY_NETWORK_DNS:    struct{}{},
+				cpb.Capability_CAPABILITY_FILES:          struct{}{},
+				cpb.Capability_CAPABILITY_FILES_READ:     struct{}{},
+				cpb.Capability_CAPABILITY_FILES_WRITE:    struct{}{},
+			},
+			wantNegated: false,
+		},
+		{
+			list: "-NETWORK,-CAPABILITY_FILES",
+			wantCapabilities: map[cpb.Capability]struct{}{
+				cpb.Capability_CAPABILITY_NETWORK:        struct{}{},
+				cpb.Capability_CAPABILITY_NETWORK_DIAL:   struct{}{},
+				cpb.Capability_CAPABILITY_NETWORK_LISTEN: struct{}{},
+				cpb.Capability_CAPABILITY_NETWORK_DNS:    struct{}{},
+				cpb.Capability_CAPABILITY_FILES:          struct{}{},
+				cpb.Capability_CAPABILITY_FILES_READ:     struct{}{},
+				cpb.Capability_CAPABILITY_FILES_WRITE:    struct{}{},
+			},
+			wantNegated: true,
+		},
+		{
+			list: "CAPABILITY_FILES,CAPABILITY_NETWORK,CAPABILITY_RUNTIME,CAPABILITY_READ_SYSTEM_STATE,CAPABILITY_MODIFY_SYSTEM_STATE,CAPABILITY_OPERATING_SYSTEM,CAPABILITY_SYSTEM_CALLS,CAPABILITY_ARBITRARY_EXECUTION,CAPABILITY_CGO,CAPABILITY_UNANALYZED,CAPABILITY_UNSAFE_POINTER,CAPABILITY_REFLECT,CAPABILITY_EXEC",
+			wantCapabilities: map[cpb.Capability]struct{}{
+				cpb.Capability_CAPABILITY_FILES:               struct{}{},
+				cpb.Capability_CAPABILITY_FILES_READ:          struct{}{},
+				cpb.Capability_CAPABILITY_FILES_WRITE:         struct{}{},
+				cpb.Capability_CAPABILITY_NETWORK:             struct{}{},
+				cpb.Capability_CAPABILITY_NETWORK_DIAL:        struct{}{},
+				cpb.Capability_CAPABILITY_NETWORK_LISTEN:      struct{}{},
+				cpb.Capability_CAPABILITY_NETWORK_DNS:         struct{}{},
+				cpb.Capability_CAPABILITY_RUNTIME:             struct{}{},
+				cpb.Capability_CAPABILITY_READ_SYSTEM_STATE:   struct{}{},
+				cpb.Capability_CAPABILITY_MODIFY_SYSTEM_STATE: struct{}{},
+				cpb.Capability_CAPABILITY_OPERATING_SYSTEM:    struct{}{},
+				cpb.Capability_CAPABILITY_SYSTEM_CALLS:        struct{}{},
+				cpb.Capability_CAPABILITY_ARBITRARY_EXECUTION: struct{}{},
+				cpb.Capability_CAPABILITY_CGO:                 struct{}{},
+				cpb.Capability_CAPABILITY_UNANALYZED:          struct{}{},
+				cpb.Capability_CAPABILITY_UNSAFE_POINTER:      struct{}{},
+				cpb.Capability_CAPABILITY_REFLECT:             struct{}{},
+				cpb.Capability_CAPABILITY_EXEC:                struct{}{},
+			},
+			wantNegated: false,
+		},
+	} {
+		cs, err := NewCapabilitySet(test.list)
+		if err != nil {
+			t.Errorf("NewCapabilitySet(%q): got err == %v, want nil error",
+				test.list, err)
+			continue
+		}
+		if test.wantCapabilities == nil {
+			if cs != nil {
+				t.Errorf("NewCapabilitySet(%q): got non-nil, want nil", test.list)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(cs.capabilities, test.wantCapabilities) {
+			t.Errorf("NewCapabilitySet(%q): got capabilities %v want %v",
+				test.list, cs.capabilities, test.wantCapabilities)
+		}
+		if cs.negated != test.wantNegated {
+			t.Errorf("NewCapabilitySet(%q): got negated = %v want %v",
+				test.list, cs.negated, test.wantNegated)
+		}
+	}
+	for _, list := range []string{
+		"NOTWORK",
+		"FILES!",
+		"NETWORKFILES",
+		"-NETWORK,FILES",
+		"NETWORK,-FILES",
+		",NETWORK",
+		"NETWORK,",
 		"NETWORK,,FILES",
 		",",
 		",,",
 		"\x00",
 	} {
-		_, err := NewCapabilitySet(list)
-		if err == nil {
-			t.Errorf("NewCapabilitySet(%q): got err == nil, want error", list)
+		_, err := NewCapabilitySet(list)
+		if err == nil {
+			t.Errorf("NewCapabilitySet(%q): got err == nil, want error", list)
+		}
+	}
+}
+
+func TestParseCapabilitySet(t *testing.T) {
+	for _, test := range []struct {
+		spec string
+		has  []cpb.Capability
+		not  []cpb.Capability
+	}{
+		{
+			spec: "all,-CAPABILITY_REFLECT",
+			has:  []cpb.Capability{cpb.Capability_CAPABILITY_FILES_READ, cpb.Capability_CAPABILITY_EXEC},
+			not:  []cpb.Capability{cpb.Capability_CAPABILITY_REFLECT},
+		},
+		{
+			spec: "-REFLECT",
+			has:  []cpb.Capability{cpb.Capability_CAPABILITY_FILES_READ},
+			not:  []cpb.Capability{cpb.Capability_CAPABILITY_REFLECT},
+		},
+		{
+			spec: "FILES,-FILES_WRITE,EXEC",
+			has:  []cpb.Capability{cpb.Capability_CAPABILITY_FILES, cpb.Capability_CAPABILITY_FILES_READ, cpb.Capability_CAPABILITY_EXEC},
+			not:  []cpb.Capability{cpb.Capability_CAPABILITY_FILES_WRITE, cpb.Capability_CAPABILITY_REFLECT},
+		},
+		{
+			spec: "NETWORK_*",
+			has:  []cpb.Capability{cpb.Capability_CAPABILITY_NETWORK_DIAL, cpb.Capability_CAPABILITY_NETWORK_DNS},
+			not:  []cpb.Capability{cpb.Capability_CAPABILITY_NETWORK, cpb.Capability_CAPABILITY_FILES},
+		},
+		{
+			spec: "all,-CAPABILITY_NETWORK*,NETWORK_DNS",
+			has:  []cpb.Capability{cpb.Capability_CAPABILITY_NETWORK_DNS, cpb.Capability_CAPABILITY_FILES},
+			not:  []cpb.Capability{cpb.Capability_CAPABILITY_NETWORK, cpb.Capability_CAPABILITY_NETWORK_DIAL},
+		},
+		{
+			spec: "EXEC,-all,FILES_READ",
+			has:  []cpb.Capability{cpb.Capability_CAPABILITY_FILES_READ},
+			not:  []cpb.Capability{cpb.Capability_CAPABILITY_EXEC},
+		},
+	} {
+		cs, err := ParseCapabilitySet(test.spec)
+		if err != nil {
+			t.Errorf("ParseCapabilitySet(%q): %v", test.spec, err)
+			continue
+		}
+		for _, c := range test.has {
+			if !cs.Has(c) {
+				t.Errorf("ParseCapabilitySet(%q): set does not have %v", test.spec, c)
+			}
+		}
+		for _, c := range test.not {
+			if cs.Has(c) {
+				t.Errorf("ParseCapabilitySet(%q): set has %v", test.spec, c)
+			}
+		}
+	}
+	if cs, err := ParseCapabilitySet(""); cs != nil || err != nil {
+		t.Errorf("ParseCapabilitySet(\"\"): got %v, %v, want nil, nil", cs, err)
+	}
+	for _, spec := range []string{
+		"NOTWORK",
+		"all,-NOTWORK",
+		"NOT_*",
+		"NETWORK,,FILES",
+		"-",
+		"[",
+	} {
+		if _, err := ParseCapabilitySet(spec); err == nil {
+			t.Errorf("ParseCapabilitySet(%q): got err == nil, want error", spec)
+		}
+	}
+}
+
+func TestIntermediatePackages(t *testing.T) {
+	filemap := map[string]string{
+		"p1/p1.go": `package p1; func Foo() { Bar() }; func Bar() { }`,
+		"p2/p2.go": `package p2; import "p1"; func Foo() { p1.Foo() }`,
+		"p3/p3.go": `package p3; import "p1"; func Foo() { p1.Foo() }; func Bar() { p1.Bar() }`,
+		"p4/p4.go": `package p4; import "p2"; import "p3"; func Foo() { p2.Foo(); p3.Foo(); p3.Bar() }; func Bar() { }`,
+	}
+	classifier := testClassifier{
+		functions: map[[2]string]cpb.Capability{
+			{"p1", "p1.Foo"}: cpb.Capability_CAPABILITY_FILES,
+			{"p1", "p1.Bar"}: cpb.Capability_CAPABILITY_MODIFY_SYSTEM_STATE,
+			{"p4", "p4.Bar"}: cpb.Capability_CAPABILITY_READ_SYSTEM_STATE,
+		},
+		ignoredEdges: nil,
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "p4")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	for _, test := range []struct {
+		capabilities string
+		expected     *cpb.CapabilityInfoList
+	}{
+		{
+			capabilities: "", // all
+			expected: &cpb.CapabilityInfoList{
+				AnalyzedPackages: proto.Int64(1),
+				CapabilityInfo: []*cpb.CapabilityInfo{
+					{
+						PackageName: proto.String("p1"),
+						Capability:  cpb.Capability_CAPABILITY_FILES.Enum(),
+						Severity:    proto.Int32(3),
+						Cwe:         []string{"CWE-73"},
+						Path: []*cpb.Function{
+							&cpb.Function{Name: proto.String("p4.Foo"), Package: proto.String("p4")},
+							&cpb.Function{Name: proto.String("p2.Foo"), Package: proto.String("p2")},
+							&cpb.Function{Name: proto.String("p1.Foo"), Package: proto.String("p1")},
+						},
+						PackageDir: proto.String("p1"),
+					},
+					{
+						PackageName: proto.String("p2"),
+						Capability:  cpb.Capability_CAPABILITY_FILES.Enum(),
+						Severity:    proto.Int32(3),
+						Cwe:         []string{"CWE-73"},
+						Path: []*cpb.Function{
+							&cpb.Function{Name: proto.String("p4.Foo"), Package: proto.String("p4")},
+							&cpb.Function{Name: proto.String("p2.Foo"), Package: proto.String("p2")},
+							&cpb.Function{Name: proto.String("p1.Foo"), Package: proto.String("p1")},
+						},
+						PackageDir: proto.String("p2"),
+					},
+					{
+						PackageName: proto.String("p3"),
+						Capability:  cpb.Capability_CAPABILITY_FILES.Enum(),
+						Severity:    proto.Int32(3),
+						Cwe:         []string{"CWE-73"},
+						Path: []*cpb.Function{
+							&cpb.Function{Name: proto.String("p4.Foo"), Package: proto.String("p4")},
+							&cpb.Function{Name: proto.String("p3.Foo"), Package: proto.String("p3")},
+							&cpb.Function{Name: proto.String("p1.Foo"), Package: proto.String("p1")},
+						},
+						PackageDir: proto.String("p3"),
+					},
+					{
+						PackageName: proto.String("p4"),
+						Capability:  cpb.Capability_CAPABILITY_FILES.Enum(),
+						Severity:    proto.Int32(3),
+						Cwe:         []string{"CWE-73"},
+						Path: []*cpb.Function{
+							&cpb.Function{Name: proto.String("p4.Foo"), Package: proto.String("p4")},
+							&cpb.Function{Name: proto.String("p2.Foo"), Package: proto.String("p2")},
+							&cpb.Function{Name: proto.String("p1.Foo"), Package: proto.String("p1")},
+						},
+						PackageDir: proto.String("p4"),
+					},
+					{
+						PackageName: proto.String("p4"),
+						Capability:  cpb.Capability_CAPABILITY_READ_SYSTEM_STATE.Enum(),
+						Severity:    proto.Int32(2),
+						Cwe:         []string{"CWE-497"},
+						Path: []*cpb.Function{
+							&cpb.Function{Name: proto.String("p4.Bar"), Package: proto.String("p4")},
+						},
+						PackageDir: proto.String("p4"),
+					},
+					{
+						PackageName: proto.String("p1"),
+						Capability:  cpb.Capability_CAPABILITY_MODIFY_SYSTEM_STATE.Enum(),
+						Severity:    proto.Int32(3),
+						Cwe:         []string{"CWE-15"},
+						Path: []*cpb.Function{
+							&cpb.Function{Name: proto.String("p4.Foo"), Package: proto.String("p4")},
+							&cpb.Function{Name: proto.String("p3.Bar"), Package: proto.String("p3")},
+							&cpb.Function{Name: proto.String("p1.Bar"), Package: proto.String("p1")},
+						},
+						PackageDir: proto.String("p1"),
+					},
+					{
+						PackageName: proto.String("p3"),
+						Capability:  cpb.Capability_CAPABILITY_MODIFY_SYSTEM_STATE.Enum(),
+						Severity:    proto.Int32(3),
+						Cwe:         []string{"CWE-15"},
+						Path: []*cpb.Function{
+							&cpb.Function{Name: proto.String("p4.Foo"), Package: proto.String("p4")},
+							&cpb.Function{Name: proto.String("p3.Bar"), Package: proto.String("p3")},
+							&cpb.Function{Name: proto.String("p1.Bar"), Package: proto.String("p1")},
+						},
+						PackageDir: proto.String("p3"),
+					},
+					{
+						PackageName: proto.String("p4"),
+						Capability:  cpb.Capability_CAPABILITY_MODIFY_SYSTEM_STATE.Enum(),
+						Severity:    proto.Int32(3),
+						Cwe:         []string{"CWE-15"},
+						Path: []*cpb.Function{
+							&cpb.Function{Name: proto.String("p4.Foo"), Package: proto.String("p4")},
+							&cpb.Function{Name: proto.String("p3.Bar"), Package: proto.String("p3")},
+							&cpb.Function{Name: proto.String("p1.Bar"), Package: proto.String("p1")},
+						},
+						PackageDir: proto.String("p4"),
+					},
+				},
+			},
+		},
+		{
+			capabilities: "READ_SYSTEM_STATE",
+			expected: &cpb.CapabilityInfoList{
+				AnalyzedPackages: proto.Int64(1),
+				CapabilityInfo: []*cpb.CapabilityInfo{
+					{
+						PackageName: proto.String("p4"),
+						Capability:  cpb.Capability_CAPABILITY_READ_SYSTEM_STATE.Enum(),
+						Severity:    proto.Int32(2),
+						Cwe:         []string{"CWE-497"},
+						Path: []*cpb.Function{
+							&cpb.Function{Name: proto.String("p4.Bar"), Package: proto.String("p4")},
+						},
+						PackageDir: proto.String("p4"),
+					},
+				},
+			},
+		},
+	} {
+		cs, err := NewCapabilitySet(test.capabilities)
+		if err != nil {
+			t.Fatalf("NewCapabilitySet(%q): %v", test.capabilities, err)
+		}
+		cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+			Classifier:     &classifier,
+			DisableBuiltin: true,
+			Granularity:    GranularityIntermediate,
+			CapabilitySet:  cs,
+		})
+		if err != nil {
+			t.Fatalf("GetCapabilityInfo: %v", err)
+		}
+		opts := []cmp.Option{
+			protocmp.Transform(),
+			protocmp.SortRepeated(func(a, b *cpb.CapabilityInfo) bool {
+				if u, v := a.GetCapability(), b.GetCapability(); u != v {
+					return u < v
+				}
+				return a.GetPackageDir() < b.GetPackageDir()
+			}),
+			protocmp.IgnoreFields(&cpb.CapabilityInfoList{}, "package_info"),
+			protocmp.IgnoreFields(&cpb.CapabilityInfo{}, "dep_path"),
+			protocmp.IgnoreFields(&cpb.CapabilityInfo{}, "capability_type"),
+			protocmp.IgnoreFields(&cpb.Function{}, "site", "declaration"),
+			protocmp.IgnoreFields(&cpb.CapabilityInfo{}, "path_id"),
+			protocmp.IgnoreFields(&cpb.Function_Site{}, "filename"),
+			protocmp.IgnoreFields(&cpb.Function_Site{}, "line"),
+			protocmp.IgnoreFields(&cpb.Function_Site{}, "column"),
+		}
+		if diff := cmp.Diff(test.expected, cil, opts...); diff != "" {
+			t.Errorf("GetCapabilityInfo: got %v, want %v; diff %s",
+				cil, test.expected, diff)
+		}
+	}
+}
+
+func TestAlias(t *testing.T) {
+	filemap := map[string]string{
+		"p1/p1.go": `package p1; func Foo() { }; type T struct {}; func (t T) M() { Foo() }`,
+		"p2/p2.go": `package p2; import "p1"; func Foo() { type t = p1.T; m := t.M; m(t{}); }`,
+	}
+	classifier := testClassifier{
+		functions: map[[2]string]cpb.Capability{
+			{"p1", "p1.Foo"}: cpb.Capability_CAPABILITY_FILES,
+		},
+		ignoredEdges: nil,
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "p2")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	expected := &cpb.CapabilityInfoList{
+		AnalyzedPackages: proto.Int64(1),
+		CapabilityInfo: []*cpb.CapabilityInfo{
+			{
+				PackageName: proto.String("p2"),
+				Capability:  cpb.Capability_CAPABILITY_FILES.Enum(),
+				Severity:    proto.Int32(3),
+				Cwe:         []string{"CWE-73"},
+				Path: []*cpb.Function{
+					&cpb.Function{Name: proto.String("p2.Foo"), Package: proto.String("p2")},
+					&cpb.Function{Name: proto.String("(p2.t).M$thunk"), Package: proto.String("p1"), Wrapper: proto.String("thunk for func (p1.T).M()")},
+					&cpb.Function{Name: proto.String("(p1.T).M"), Package: proto.String("p1")},
+					&cpb.Function{Name: proto.String("p1.Foo"), Package: proto.String("p1")},
+				},
+				PackageDir: proto.String("p2"),
+			},
+		},
+	}
+
+	// Include the wrapper, to check the package it is attributed to.
+	cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier:      &classifier,
+		DisableBuiltin:  true,
+		IncludeWrappers: true,
+	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
+	opts := []cmp.Option{
+		protocmp.Transform(),
+		protocmp.SortRepeated(func(a, b *cpb.CapabilityInfo) bool {
+			if u, v := a.GetCapability(), b.GetCapability(); u != v {
+				return u < v
+			}
+			return a.GetPackageDir() < b.GetPackageDir()
+		}),
+		protocmp.IgnoreFields(&cpb.CapabilityInfoList{}, "package_info"),
+		protocmp.IgnoreFields(&cpb.CapabilityInfo{}, "dep_path"),
+		protocmp.IgnoreFields(&cpb.CapabilityInfo{}, "capability_type"),
+		protocmp.IgnoreFields(&cpb.Function{}, "site", "declaration"),
+		protocmp.IgnoreFields(&cpb.CapabilityInfo{}, "path_id"),
+		protocmp.IgnoreFields(&cpb.Function_Site{}, "filename"),
+		protocmp.IgnoreFields(&cpb.Function_Site{}, "line"),
+		protocmp.IgnoreFields(&cpb.Function_Site{}, "column"),
+	}
+	if diff := cmp.Diff(expected, cil, opts...); diff != "" {
+		t.Errorf("GetCapabilityInfo: got %v, want %v; diff %s", cil, expected, diff)
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	cil := &cpb.CapabilityInfoList{
+		CapabilityInfo: []*cpb.CapabilityInfo{{
+			PackageName: proto.String("foo"),
+			Capability:  cpb.Capability_CAPABILITY_NETWORK.Enum(),
+			DepPath:     proto.String("example.com/m/foo.F net.Dial"),
+			Path: []*cpb.Function{
+				&cpb.Function{Name: proto.String("example.com/m/foo.F"), Package: proto.String("example.com/m/foo")},
+				&cpb.Function{
+					Name:    proto.String("net.Dial"),
+					Package: proto.String("net"),
+					Site: &cpb.Function_Site{
+						Filename: proto.String("foo.go"),
+						Line:     proto.Int64(12),
+						Column:   proto.Int64(3),
+					},
+				},
+			},
+			PackageDir:     proto.String("example.com/m/foo"),
+			CapabilityType: cpb.CapabilityType_CAPABILITY_TYPE_DIRECT.Enum(),
+			Cwe:            []string{"CWE-918"},
+		}, {
+			PackageName: proto.String("bar"),
+			Capability:  cpb.Capability_CAPABILITY_FILES.Enum(),
+			Path: []*cpb.Function{
+				&cpb.Function{
+					Name:        proto.String("bar.G"),
+					Package:     proto.String("bar"),
+					Declaration: &cpb.Function_Site{Filename: proto.String("bar.go"), Line: proto.Int64(4), Column: proto.Int64(6)},
+				},
+			},
+			PackageDir:     proto.String("bar"),
+			CapabilityType: cpb.CapabilityType_CAPABILITY_TYPE_TRANSITIVE.Enum(),
+		}},
+		ModuleInfo: []*cpb.ModuleInfo{{
+			Path:    proto.String("example.com/m"),
+			Version: proto.String("v1.2.3"),
+		}, {
+			// A main module has no version, and gets no base URI.
+			Path: proto.String("bar"),
+		}},
+	}
+	var b bytes.Buffer
+	if err := WriteSARIF(&b, cil); err != nil {
+		t.Fatalf("WriteSARIF: %v", err)
+	}
+	var got sarifLog
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("parsing WriteSARIF output: %v\n%s", err, b.String())
+	}
+	want := sarifLog{
+		Version: "2.1.0",
+		Schema:  sarifSchema,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "capslock",
+				InformationURI: "https://github.com/google/capslock",
+				Rules: []sarifRule{
+					{ID: "CAPABILITY_FILES", ShortDescription: sarifMessage{Text: "Use of FILES capability"}},
+					{
+						ID:               "CAPABILITY_NETWORK",
+						ShortDescription: sarifMessage{Text: "Use of NETWORK capability"},
+						Properties:       &sarifRuleProps{Tags: []string{"external/cwe/cwe-918"}},
+					},
+				},
+			}},
+			OriginalURIBaseIDs: map[string]sarifArtifactLocation{
+				"example.com/m": {Description: &sarifMessage{Text: "Module example.com/m@v1.2.3"}},
+			},
+			Results: []sarifResult{{
+				RuleID:  "CAPABILITY_NETWORK",
+				Level:   "warning",
+				Message: sarifMessage{Text: "Package example.com/m/foo has capability CAPABILITY_NETWORK via call path: example.com/m/foo.F net.Dial"},
+				Locations: []sarifLocation{{
+					PhysicalLocation: &sarifPhysicalLocation{
+						ArtifactLocation: sarifArtifactLocation{URI: "foo/foo.go", URIBaseID: "example.com/m"},
+						Region:           &sarifRegion{StartLine: 12, StartColumn: 3},
+					},
+					LogicalLocations: []sarifLogicalLocation{{FullyQualifiedName: "example.com/m/foo.F", Kind: "function"}},
+				}},
+			}, {
+				RuleID:  "CAPABILITY_FILES",
+				Level:   "note",
+				Message: sarifMessage{Text: "Package bar has capability CAPABILITY_FILES in function bar.G"},
+				Locations: []sarifLocation{{
+					PhysicalLocation: &sarifPhysicalLocation{
+						ArtifactLocation: sarifArtifactLocation{URI: "bar/bar.go"},
+						Region:           &sarifRegion{StartLine: 4, StartColumn: 6},
+					},
+					LogicalLocations: []sarifLogicalLocation{{FullyQualifiedName: "bar.G", Kind: "function"}},
+				}},
+			}},
+		}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("WriteSARIF: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteHTMLReport(t *testing.T) {
+	cil := &cpb.CapabilityInfoList{
+		CapabilityInfo: []*cpb.CapabilityInfo{{
+			Capability: cpb.Capability_CAPABILITY_NETWORK.Enum(),
+			Path: []*cpb.Function{
+				&cpb.Function{Name: proto.String("example.com/m/foo.F")},
+				&cpb.Function{
+					Name: proto.String("net.Dial"),
+					Site: &cpb.Function_Site{
+						Filename: proto.String("foo.go"),
+						Line:     proto.Int64(12),
+						Column:   proto.Int64(3),
+					},
+				},
+			},
+			PackageDir:     proto.String("example.com/m/foo"),
+			CapabilityType: cpb.CapabilityType_CAPABILITY_TYPE_DIRECT.Enum(),
+		}, {
+			Capability: cpb.Capability_CAPABILITY_NETWORK.Enum(),
+			Path: []*cpb.Function{
+				&cpb.Function{Name: proto.String("example.com/m/bar.G<script>")},
+			},
+			PackageDir:     proto.String("example.com/m/bar"),
+			CapabilityType: cpb.CapabilityType_CAPABILITY_TYPE_TRANSITIVE.Enum(),
+		}, {
+			Capability:     cpb.Capability_CAPABILITY_FILES.Enum(),
+			Path:           []*cpb.Function{&cpb.Function{Name: proto.String("example.com/m/bar.H")}},
+			PackageDir:     proto.String("example.com/m/bar"),
+			CapabilityType: cpb.CapabilityType_CAPABILITY_TYPE_TRANSITIVE.Enum(),
+		}},
+	}
+	var b bytes.Buffer
+	if err := WriteHTMLReport(&b, cil); err != nil {
+		t.Fatalf("WriteHTMLReport: %v", err)
+	}
+	got := b.String()
+	for _, want := range []string{
+		// Counts for each capability, in the order of the enum.
+		"<tr><td><code>CAPABILITY_FILES</code></td><td class=\"num\">1</td><td class=\"num\">0</td><td class=\"num\">1</td></tr>\n" +
+			"<tr><td><code>CAPABILITY_NETWORK</code></td><td class=\"num\">2</td><td class=\"num\">1</td><td class=\"num\">1</td></tr>",
+		"<summary><code>example.com/m/foo.F</code></summary>",
+		"<li>net.Dial <span class=\"site\">foo.go:12:3</span></li>",
+		"example.com/m/bar.G&lt;script&gt;",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("WriteHTMLReport: output does not contain %q:\n%s", want, got)
+		}
+	}
+	for _, notWant := range []string{"<script src", "<link", "G<script>"} {
+		if strings.Contains(got, notWant) {
+			t.Errorf("WriteHTMLReport: output contains %q:\n%s", notWant, got)
+		}
+	}
+}
+
+func TestDiffCapabilityInfo(t *testing.T) {
+	ci := func(pkg, fn string, c cpb.Capability, path ...string) *cpb.CapabilityInfo {
+		ci := &cpb.CapabilityInfo{
+			PackageDir: proto.String(pkg),
+			Capability: c.Enum(),
+			Path:       []*cpb.Function{{Name: proto.String(fn), Package: proto.String(pkg)}},
+		}
+		for _, p := range path {
+			ci.Path = append(ci.Path, &cpb.Function{Name: proto.String(p)})
+		}
+		return ci
+	}
+	baseline := &cpb.CapabilityInfoList{CapabilityInfo: []*cpb.CapabilityInfo{
+		ci("a", "a.F", cpb.Capability_CAPABILITY_FILES, "os.Open"),
+		ci("a", "a.G", cpb.Capability_CAPABILITY_NETWORK, "net.Dial"),
+		ci("b", "b.F", cpb.Capability_CAPABILITY_FILES, "os.Open"),
+	}}
+	current := &cpb.CapabilityInfoList{CapabilityInfo: []*cpb.CapabilityInfo{
+		// The path differs from the baseline, which should not matter.
+		ci("a", "a.F", cpb.Capability_CAPABILITY_FILES, "os.ReadFile"),
+		ci("a", "a.H", cpb.Capability_CAPABILITY_NETWORK, "net.Dial"),
+		ci("b", "b.F", cpb.Capability_CAPABILITY_EXEC, "os/exec.Command"),
+	}}
+	entry := func(key string, c cpb.Capability, ci *cpb.CapabilityInfo) *cpb.CapabilityDiff_Entry {
+		return &cpb.CapabilityDiff_Entry{Key: proto.String(key), Capability: c.Enum(), CapabilityInfo: ci}
+	}
+	for _, test := range []struct {
+		g    Granularity
+		want *cpb.CapabilityDiff
+	}{
+		{
+			GranularityPackage,
+			&cpb.CapabilityDiff{
+				Added: []*cpb.CapabilityDiff_Entry{
+					entry("b", cpb.Capability_CAPABILITY_EXEC, current.CapabilityInfo[2]),
+				},
+				Removed: []*cpb.CapabilityDiff_Entry{
+					entry("b", cpb.Capability_CAPABILITY_FILES, baseline.CapabilityInfo[2]),
+				},
+				Unchanged: []*cpb.CapabilityDiff_Entry{
+					entry("a", cpb.Capability_CAPABILITY_FILES, current.CapabilityInfo[0]),
+					entry("a", cpb.Capability_CAPABILITY_NETWORK, current.CapabilityInfo[1]),
+				},
+			},
+		},
+		{
+			GranularityFunction,
+			&cpb.CapabilityDiff{
+				Added: []*cpb.CapabilityDiff_Entry{
+					entry("a.H", cpb.Capability_CAPABILITY_NETWORK, current.CapabilityInfo[1]),
+					entry("b.F", cpb.Capability_CAPABILITY_EXEC, current.CapabilityInfo[2]),
+				},
+				Removed: []*cpb.CapabilityDiff_Entry{
+					entry("b.F", cpb.Capability_CAPABILITY_FILES, baseline.CapabilityInfo[2]),
+					entry("a.G", cpb.Capability_CAPABILITY_NETWORK, baseline.CapabilityInfo[1]),
+				},
+				Unchanged: []*cpb.CapabilityDiff_Entry{
+					entry("a.F", cpb.Capability_CAPABILITY_FILES, current.CapabilityInfo[0]),
+				},
+			},
+		},
+	} {
+		got := DiffCapabilityInfo(baseline, current, test.g)
+		if diff := cmp.Diff(test.want, got, protocmp.Transform()); diff != "" {
+			t.Errorf("DiffCapabilityInfo with granularity %v: got diff (-want +got):\n%s", test.g, diff)
+		}
+	}
+}
+
+func TestCompareAgainstBaselineFile(t *testing.T) {
+	ci := func(pkg string, c cpb.Capability) *cpb.CapabilityInfo {
+		return &cpb.CapabilityInfo{PackageDir: proto.String(pkg), Capability: c.Enum()}
+	}
+	// The baseline has a field and a capability which this version of the
+	// schema does not know.
+	baselineJSON := `{
+  "capabilityInfo": [
+    {"packageDir": "a", "capability": "CAPABILITY_FILES", "oldField": 1},
+    {"packageDir": "a", "capability": "CAPABILITY_NETWORK"},
+    {"packageDir": "b", "capability": "CAPABILITY_FILES"},
+    {"packageDir": "z", "capability": "CAPABILITY_NOT_YET_KNOWN"}
+  ],
+  "oldListField": "x"
+}`
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "baseline.json")
+	if err := os.WriteFile(jsonPath, []byte(baselineJSON), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	binary, err := proto.Marshal(&cpb.CapabilityInfoList{CapabilityInfo: []*cpb.CapabilityInfo{
+		ci("a", cpb.Capability_CAPABILITY_FILES),
+		ci("a", cpb.Capability_CAPABILITY_NETWORK),
+		ci("b", cpb.Capability_CAPABILITY_FILES),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	binaryPath := filepath.Join(dir, "baseline.pb")
+	if err := os.WriteFile(binaryPath, binary, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	current := &cpb.CapabilityInfoList{CapabilityInfo: []*cpb.CapabilityInfo{
+		ci("a", cpb.Capability_CAPABILITY_FILES),
+		ci("b", cpb.Capability_CAPABILITY_EXEC),
+		ci("c", cpb.Capability_CAPABILITY_NETWORK),
+	}}
+	entry := func(key string, c cpb.Capability) *cpb.CapabilityDiff_Entry {
+		return &cpb.CapabilityDiff_Entry{Key: proto.String(key), Capability: c.Enum(), CapabilityInfo: ci(key, c)}
+	}
+	want := &Report{
+		Added: []*cpb.CapabilityDiff_Entry{
+			entry("c", cpb.Capability_CAPABILITY_NETWORK),
+			entry("b", cpb.Capability_CAPABILITY_EXEC),
+		},
+		Removed: []*cpb.CapabilityDiff_Entry{
+			entry("b", cpb.Capability_CAPABILITY_FILES),
+			entry("a", cpb.Capability_CAPABILITY_NETWORK),
+		},
+		NewCapabilities: []cpb.Capability{cpb.Capability_CAPABILITY_EXEC},
+	}
+	for _, path := range []string{jsonPath, binaryPath} {
+		got, err := CompareAgainstBaselineFile(current, path, GranularityPackage)
+		if err != nil {
+			t.Fatalf("CompareAgainstBaselineFile(%s): %v", path, err)
+		}
+		if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+			t.Errorf("CompareAgainstBaselineFile(%s): got diff (-want +got):\n%s", path, diff)
+		}
+		if !got.Different() {
+			t.Errorf("CompareAgainstBaselineFile(%s): Different() = false, want true", path)
+		}
+	}
+	if _, err := CompareAgainstBaselineFile(current, filepath.Join(dir, "missing.json"), GranularityPackage); err == nil {
+		t.Errorf("CompareAgainstBaselineFile with a missing file: got nil error, want error")
+	}
+}
+
+func TestMergeCapabilityInfoLists(t *testing.T) {
+	ci := func(pkg, fn string, c cpb.Capability, path ...string) *cpb.CapabilityInfo {
+		ci := &cpb.CapabilityInfo{
+			PackageDir: proto.String(pkg),
+			Capability: c.Enum(),
+			Path:       []*cpb.Function{{Name: proto.String(fn), Package: proto.String(pkg)}},
+			PathId:     proto.String(strings.Join(path, " ")),
+		}
+		for _, p := range path {
+			ci.Path = append(ci.Path, &cpb.Function{Name: proto.String(p)})
+		}
+		return ci
+	}
+	shard1 := &cpb.CapabilityInfoList{
+		CapabilityInfo: []*cpb.CapabilityInfo{
+			ci("a", "a.F", cpb.Capability_CAPABILITY_FILES, "os.Open"),
+			ci("a", "a.G", cpb.Capability_CAPABILITY_NETWORK, "net.Dial"),
+		},
+		ModuleInfo: []*cpb.ModuleInfo{{Path: proto.String("x"), Version: proto.String("v1.0.0")}},
+		PackageInfo: []*cpb.PackageInfo{
+			{Path: proto.String("a"), IgnoredFiles: []string{"a_plan9.go", "a_windows.go"}},
+		},
+		AnalyzedPackages: proto.Int64(1),
+	}
+	shard2 := &cpb.CapabilityInfoList{
+		CapabilityInfo: []*cpb.CapabilityInfo{
+			ci("b", "b.F", cpb.Capability_CAPABILITY_SYSTEM_CALLS, "syscall.LoadDLL"),
+			ci("a", "a.G", cpb.Capability_CAPABILITY_NETWORK, "net.Dial"),
+			ci("a", "a.F", cpb.Capability_CAPABILITY_FILES, "os.Create"),
+			ci("a", "a.H", cpb.Capability_CAPABILITY_NETWORK, "net.Dial"),
+		},
+		ModuleInfo: []*cpb.ModuleInfo{{Path: proto.String("w"), Version: proto.String("v2.0.0")}},
+		PackageInfo: []*cpb.PackageInfo{
+			{Path: proto.String("a"), IgnoredFiles: []string{"a_linux.go", "a_plan9.go"}},
+			{Path: proto.String("b")},
+		},
+		AnalyzedPackages: proto.Int64(2),
+	}
+	want := &cpb.CapabilityInfoList{
+		CapabilityInfo: []*cpb.CapabilityInfo{
+			ci("a", "a.F", cpb.Capability_CAPABILITY_FILES, "os.Create"),
+			ci("a", "a.G", cpb.Capability_CAPABILITY_NETWORK, "net.Dial"),
+			ci("a", "a.H", cpb.Capability_CAPABILITY_NETWORK, "net.Dial"),
+			ci("b", "b.F", cpb.Capability_CAPABILITY_SYSTEM_CALLS, "syscall.LoadDLL"),
+		},
+		ModuleInfo: []*cpb.ModuleInfo{
+			{Path: proto.String("w"), Version: proto.String("v2.0.0")},
+			{Path: proto.String("x"), Version: proto.String("v1.0.0")},
+		},
+		PackageInfo: []*cpb.PackageInfo{
+			{Path: proto.String("a"), IgnoredFiles: []string{"a_plan9.go"}},
+			{Path: proto.String("b")},
+		},
+		AnalyzedPackages: proto.Int64(3),
+	}
+	// The result does not depend on the order of the lists.
+	for _, cils := range [][]*cpb.CapabilityInfoList{{shard1, shard2}, {shard2, shard1}} {
+		got := MergeCapabilityInfoLists(cils...)
+		if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+			t.Errorf("MergeCapabilityInfoLists: got diff (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestGetCapabilityInfoMultiConfig(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import "os"
+
+func Foo() int { return os.Getpid() }
+`,
+		"testlib/bar_linux.go": `package testlib
+
+import "net"
+
+func Bar() { net.Dial("tcp", "example.com:80") }
+`,
+		"testlib/bar_windows.go": `package testlib
+
+import "os/exec"
+
+func Bar() { exec.Command("calc").Run() }
+`,
+	}
+	dir, cleanup, err := analysistest.WriteFiles(filemap)
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("analysistest.WriteFiles: %v", err)
+	}
+	loadConfigs := []LoadConfig{{GOOS: "linux", GOARCH: "amd64"}, {GOOS: "windows", GOARCH: "amd64"}}
+	var pkgsPerConfig [][]*packages.Package
+	for _, lcfg := range loadConfigs {
+		pkgs, err := packages.Load(&packages.Config{
+			Mode: PackagesLoadModeNeeded,
+			Dir:  dir,
+			Env:  append(os.Environ(), "GOPATH="+dir, "GO111MODULE=off", "GOPROXY=off", "GOOS="+lcfg.GOOS, "GOARCH="+lcfg.GOARCH),
+		}, "testlib")
+		if err != nil {
+			t.Fatalf("packages.Load: %v", err)
+		}
+		pkgsPerConfig = append(pkgsPerConfig, pkgs)
+	}
+	cil, err := GetCapabilityInfoMultiConfig(context.Background(), loadConfigs, pkgsPerConfig, &Config{
+		Classifier:  interesting.DefaultClassifier(),
+		Granularity: GranularityPackage,
+	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfoMultiConfig: %v", err)
+	}
+	got := make(map[cpb.Capability][]string)
+	for _, ci := range cil.GetCapabilityInfo() {
+		got[ci.GetCapability()] = ci.GetConfigs()
+	}
+	want := map[cpb.Capability][]string{
+		cpb.Capability_CAPABILITY_READ_SYSTEM_STATE: {"linux/amd64", "windows/amd64"},
+		cpb.Capability_CAPABILITY_NETWORK_DIAL:      {"linux/amd64"},
+		cpb.Capability_CAPABILITY_EXEC:              {"windows/amd64"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GetCapabilityInfoMultiConfig: got diff (-want +got):\n%s", diff)
+	}
+	if _, err := GetCapabilityInfoMultiConfig(context.Background(), loadConfigs, pkgsPerConfig[:1], &Config{
+		Classifier: interesting.DefaultClassifier(),
+	}); err == nil {
+		t.Errorf("GetCapabilityInfoMultiConfig with too few package lists: got nil error")
+	}
+}
+
+func TestLoadConfigName(t *testing.T) {
+	for _, test := range []struct {
+		lcfg LoadConfig
+		want string
+	}{
+		{LoadConfig{GOOS: "linux", GOARCH: "arm64"}, "linux/arm64"},
+		{LoadConfig{GOOS: "windows", GOARCH: "amd64", BuildTags: "foo,bar"}, "windows/amd64,tags=foo,bar"},
+	} {
+		if got := test.lcfg.Name(); got != test.want {
+			t.Errorf("%#v.Name(): got %q, want %q", test.lcfg, got, test.want)
+		}
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	b, err := LoadBaseline(t.Name(), strings.NewReader(`
+# Accepted capabilities.
+CAPABILITY_READ_SYSTEM_STATE testlib
+NETWORK testlib  # no longer used
+`))
+	if err != nil {
+		t.Fatalf("LoadBaseline: %v", err)
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier: interesting.DefaultClassifier(),
+		Baseline:   b,
+	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
+	expected := &cpb.CapabilityInfoList{
+		AnalyzedPackages:        proto.Int64(1),
+		BaselineSuppressedCount: proto.Int64(2),
+		StaleBaselineEntry: []*cpb.BaselineEntry{{
+			Capability: cpb.Capability_CAPABILITY_NETWORK.Enum(),
+			PackageDir: proto.String("testlib"),
+		}},
+	}
+	opts := []cmp.Option{
+		protocmp.Transform(),
+		protocmp.IgnoreFields(&cpb.CapabilityInfoList{}, "package_info"),
+	}
+	if diff := cmp.Diff(expected, cil, opts...); diff != "" {
+		t.Errorf("GetCapabilityInfo with baseline: got diff (-want +got):\n%s", diff)
+	}
+
+	// Comparing against the unsuppressed output finds no difference: the
+	// baseline is not applied to the comparison.
+	all, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier: interesting.DefaultClassifier(),
+	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
+	data, err := protojson.Marshal(all)
+	if err != nil {
+		t.Fatalf("protojson.Marshal: %v", err)
+	}
+	compareFile := filepath.Join(t.TempDir(), "compare.json")
+	if err := os.WriteFile(compareFile, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	different, err := compare(context.Background(), compareFile, pkgs, queriedPackages, &Config{
+		Classifier: interesting.DefaultClassifier(),
+		Baseline:   b,
+	})
+	if err != nil {
+		t.Fatalf("compare: %v", err)
+	}
+	if different {
+		t.Errorf("compare with baseline: got a difference, want none")
+	}
+
+	for _, input := range []string{
+		"CAPABILITY_NONSENSE testlib",
+		"CAPABILITY_NETWORK",
+		"CAPABILITY_NETWORK testlib extra",
+	} {
+		if _, err := LoadBaseline(t.Name(), strings.NewReader(input)); err == nil {
+			t.Errorf("LoadBaseline(%q): got nil error, want error", input)
+		}
+	}
+}
+
+func TestIncludeCallByPackage(t *testing.T) {
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	var pruned [][2]string
+	classifier := IncludeCallByPackage(interesting.DefaultClassifier(), func(callerPkg, calleePkg string) bool {
+		if callerPkg == "testlib" && calleePkg == "os" {
+			pruned = append(pruned, [2]string{callerPkg, calleePkg})
+			return true
+		}
+		return false
+	})
+	cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier: classifier,
+	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
+	if len(cil.GetCapabilityInfo()) != 0 {
+		t.Errorf("GetCapabilityInfo with calls from testlib to os pruned: got %v, want no capabilities", cil.GetCapabilityInfo())
+	}
+	if len(pruned) == 0 {
+		t.Errorf("IncludeCallByPackage: prune function was not called for any edge from testlib to os")
+	}
+}
+
+func TestWrappedClassifierMethods(t *testing.T) {
+	keep := func(callerPkg, calleePkg string) bool { return false }
+	// A wrapper categorizes individual calls only if the classifier it wraps
+	// does.
+	for _, test := range []struct {
+		classifier Classifier
+		want       bool
+	}{
+		{interesting.DefaultClassifier(), true},
+		{openArgClassifier{}, true},
+		{&testClassifier{}, false},
+	} {
+		wrapped := IncludeCallByPackage(test.classifier, keep)
+		if got := categorizesCalls(wrapped); got != test.want {
+			t.Errorf("categorizesCalls(IncludeCallByPackage(%T)): got %v, want %v", test.classifier, got, test.want)
+		}
+		if _, ok := wrapped.(SeverityClassifier); !ok {
+			t.Errorf("IncludeCallByPackage(%T) is not a SeverityClassifier", test.classifier)
+		}
+	}
+	// The severities of the wrapped classifier are used.
+	classifier, err := interesting.LoadClassifier("severity", strings.NewReader("severity CAPABILITY_FILES 1\n"), false)
+	if err != nil {
+		t.Fatalf("LoadClassifier: %v", err)
+	}
+	wrapped := IncludeCallByPackage(classifier, keep)
+	if got, want := capabilitySeverity(wrapped, cpb.Capability_CAPABILITY_FILES), interesting.SeverityLow; got != want {
+		t.Errorf("capabilitySeverity(IncludeCallByPackage(classifier), CAPABILITY_FILES): got %d, want %d", got, want)
+	}
+}
+
+func TestChainClassifiers(t *testing.T) {
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	// capabilities returns the capabilities found with the given classifier.
+	capabilities := func(classifier Classifier) []string {
+		cl, err := GetCapabilityCounts(context.Background(), pkgs, queriedPackages, &Config{
+			Classifier:     classifier,
+			DisableBuiltin: true,
+		})
+		if err != nil {
+			t.Fatalf("GetCapabilityCounts: %v", err)
+		}
+		var caps []string
+		for c := range cl.GetCapabilityCounts() {
+			caps = append(caps, c)
+		}
+		slices.Sort(caps)
+		return caps
+	}
+	// override marks os.Getpid as safe, and has no opinion about any other
+	// function.
+	override := &testClassifier{
+		functions: map[[2]string]cpb.Capability{
+			{"os", "os.Getpid"}: cpb.Capability_CAPABILITY_SAFE,
+		},
+	}
+	// ignoreGetpid excludes the calls to os.Getpid, and has no opinion about
+	// any function.
+	ignoreGetpid := &testClassifier{
+		ignoredEdges: map[[2]string]struct{}{
+			{"testlib.Foo", "os.Getpid"}: {},
+			{"testlib.Bar", "os.Getpid"}: {},
+		},
+	}
+	for _, test := range []struct {
+		name       string
+		classifier Classifier
+		want       []string
+	}{
+		{
+			name:       "default",
+			classifier: interesting.DefaultClassifier(),
+			want:       []string{"CAPABILITY_READ_SYSTEM_STATE"},
+		},
+		{
+			name:       "override first",
+			classifier: ChainClassifiers(override, interesting.DefaultClassifier()),
+			want:       nil,
+		},
+		{
+			name:       "override last",
+			classifier: ChainClassifiers(interesting.DefaultClassifier(), override),
+			want:       []string{"CAPABILITY_READ_SYSTEM_STATE"},
+		},
+		{
+			// testClassifier1 categorizes os.IsExist, which the default
+			// classifier considers safe, as CAPABILITY_FILES.
+			name:       "added category",
+			classifier: ChainClassifiers(&testClassifier1, interesting.DefaultClassifier()),
+			want:       []string{"CAPABILITY_FILES", "CAPABILITY_READ_SYSTEM_STATE"},
+		},
+		{
+			name:       "excluded calls",
+			classifier: ChainClassifiers(interesting.DefaultClassifier(), ignoreGetpid),
+			want:       nil,
+		},
+	} {
+		if got := capabilities(test.classifier); !slices.Equal(got, test.want) {
+			t.Errorf("%s: got capabilities %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFunctionsWithoutBodies(t *testing.T) {
+	// Functions declared without bodies, as in packages whose code is
+	// compiled without source or implemented in assembly.
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import "example.com/prebuilt"
+
+func Foo() { prebuilt.Classified() }
+func Bar() { prebuilt.Unclassified() }
+func Baz() { prebuilt.Safe() }
+`,
+		"example.com/prebuilt/prebuilt.go": `package prebuilt
+
+func Classified()
+func Unclassified()
+func Safe()
+`,
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	classifier := &testClassifier{
+		functions: map[[2]string]cpb.Capability{
+			{"example.com/prebuilt", "example.com/prebuilt.Classified"}: cpb.Capability_CAPABILITY_FILES_READ,
+			{"example.com/prebuilt", "example.com/prebuilt.Safe"}:       cpb.Capability_CAPABILITY_SAFE,
+		},
+	}
+	config := &Config{
+		Classifier:  ChainClassifiers(classifier, interesting.DefaultClassifier()),
+		Granularity: GranularityFunction,
+	}
+	cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, config)
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
+	var got []string
+	for _, ci := range cil.GetCapabilityInfo() {
+		got = append(got, ci.GetDepPath()+" "+ci.GetCapability().String())
+	}
+	slices.Sort(got)
+	want := []string{
+		"testlib.Bar example.com/prebuilt.Unclassified CAPABILITY_ARBITRARY_EXECUTION",
+		"testlib.Foo example.com/prebuilt.Classified CAPABILITY_FILES_READ",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GetCapabilityInfo: got diff (-want +got):\n%s", diff)
+	}
+	// Only the unclassified function is given CAPABILITY_ARBITRARY_EXECUTION
+	// for its missing body.
+	_, _, _, extra, _, _, _ := getPackageNodesWithCapability(pkgs, config)
+	got = nil
+	for v := range extra[cpb.Capability_CAPABILITY_ARBITRARY_EXECUTION] {
+		got = append(got, v.Func.String())
+	}
+	want = []string{"example.com/prebuilt.Unclassified"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("getPackageNodesWithCapability: got diff (-want +got) in functions with CAPABILITY_ARBITRARY_EXECUTION:\n%s", diff)
+	}
+}
+
+func TestCallGraphAlgorithm(t *testing.T) {
+	for _, a := range []string{"", "cha", "rta", "vta", "static"} {
+		t.Run(a, func(t *testing.T) {
+			algorithm, err := CallGraphAlgorithmFromString(a)
+			if err != nil {
+				t.Fatalf("CallGraphAlgorithmFromString(%q): %v", a, err)
+			}
+			pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+			if cleanup != nil {
+				defer cleanup()
+			}
+			if err != nil {
+				t.Fatalf("setup: %v", err)
+			}
+			cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+				Classifier:         interesting.DefaultClassifier(),
+				Granularity:        GranularityFunction,
+				CallGraphAlgorithm: algorithm,
+			})
+			if err != nil {
+				t.Fatalf("GetCapabilityInfo: %v", err)
+			}
+			var got []string
+			for _, ci := range cil.GetCapabilityInfo() {
+				got = append(got, ci.GetDepPath())
+			}
+			want := []string{"testlib.Bar os.Getpid", "testlib.Foo os.Getpid"}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("GetCapabilityInfo with call graph algorithm %q: got paths %q, want %q", a, got, want)
+			}
+		})
+	}
+	if _, err := CallGraphAlgorithmFromString("nonsense"); err == nil {
+		t.Errorf(`CallGraphAlgorithmFromString("nonsense"): got nil error, want error`)
+	}
+}
+
+func TestPathSites(t *testing.T) {
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier: interesting.DefaultClassifier(),
+	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
+	if len(cil.GetCapabilityInfo()) == 0 {
+		t.Fatalf("GetCapabilityInfo: got no results")
+	}
+	// The first entry is for testlib.Bar, declared on line 6 of foo.go, which
+	// calls os.Getpid on the same line.
+	got := cil.GetCapabilityInfo()[0].GetPath()
+	want := []*cpb.Function{
+		{
+			Name:    proto.String("testlib.Bar"),
+			Package: proto.String("testlib"),
+			// There is no call to the first function, so its declaration is
+			// recorded instead of a call site.
+			Declaration: &cpb.Function_Site{Filename: proto.String("foo.go"), Line: proto.Int64(6), Column: proto.Int64(6)},
+		},
+		{
+			Name:    proto.String("os.Getpid"),
+			Package: proto.String("os"),
+			Site:    &cpb.Function_Site{Filename: proto.String("foo.go"), Line: proto.Int64(6), Column: proto.Int64(31)},
+		},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("GetCapabilityInfo: got path diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestReflectCapabilitySite(t *testing.T) {
+	filemap := map[string]string{"testlib/foo.go": `package testlib
+
+import "reflect"
+
+var v, w reflect.Value
+
+func Store(x int) {
+	if x > 0 {
+		x--
+	} else {
+		v = reflect.ValueOf(x)
+	}
+	w = reflect.ValueOf(x)
+}
+
+func Foo() { Store(1) }
+`}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier: interesting.DefaultClassifier(),
+	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
+	// Both paths end at Store, and its first store of a reflect.Value in the
+	// source, on line 11, is reported, although the SSA block for the else
+	// branch comes after the block for the code following the if statement.
+	want := &cpb.Function_Site{Filename: proto.String("foo.go"), Line: proto.Int64(11), Column: proto.Int64(3)}
+	n := 0
+	for _, ci := range cil.GetCapabilityInfo() {
+		if ci.GetCapability() != cpb.Capability_CAPABILITY_REFLECT {
+			continue
+		}
+		n++
+		p := ci.GetPath()
+		last := p[len(p)-1]
+		if last.GetName() != "testlib.Store" {
+			t.Errorf("GetCapabilityInfo: got path %v, want a path ending at testlib.Store", ci.GetDepPath())
+		}
+		if diff := cmp.Diff(want, last.GetCapabilitySite(), protocmp.Transform()); diff != "" {
+			t.Errorf("GetCapabilityInfo: capability site for %v: diff (-want +got):\n%s", ci.GetDepPath(), diff)
+		}
+	}
+	if n != 2 {
+		t.Errorf("GetCapabilityInfo: got %d CAPABILITY_REFLECT results, want 2", n)
+	}
+}
+
+func TestShortestPath(t *testing.T) {
+	// Foo reaches a READ_SYSTEM_STATE function through W and X, and through
+	// each of Y and Z.  The paths through Y and Z are equally short, and the
+	// one through Y should be chosen because Y comes first by name, even
+	// though the search from os.Getpid reaches Z before the search from
+	// os.Getuid reaches Y.
+	filemap := map[string]string{"testlib/foo.go": `package testlib
+
+import "os"
+
+func Foo() { W(); Z(); Y() }
+func W()   { X() }
+func X()   { println(os.Getpid()) }
+func Y()   { println(os.Getuid()) }
+func Z()   { println(os.Getpid()) }
+`}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier: interesting.DefaultClassifier(),
+	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
+	var got []string
+	for _, ci := range cil.GetCapabilityInfo() {
+		if ci.GetCapability() == cpb.Capability_CAPABILITY_READ_SYSTEM_STATE && ci.GetPath()[0].GetName() == "testlib.Foo" {
+			got = append(got, ci.GetDepPath())
+		}
+	}
+	want := []string{"testlib.Foo testlib.Y os.Getuid"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GetCapabilityInfo: got paths for testlib.Foo diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestStreamCapabilityInfoJSONL(t *testing.T) {
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	var b bytes.Buffer
+	err = StreamCapabilityInfoJSONL(context.Background(), &b, pkgs, queriedPackages, &Config{
+		Classifier: interesting.DefaultClassifier(),
+	})
+	if err != nil {
+		t.Fatalf("StreamCapabilityInfoJSONL: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	header := new(cpb.CapabilityInfoList)
+	if err := protojson.Unmarshal([]byte(lines[0]), header); err != nil {
+		t.Fatalf("parsing header %q: %v", lines[0], err)
+	}
+	if len(header.GetPackageInfo()) == 0 || header.GetAnalyzedPackages() == 0 || len(header.GetCapabilityInfo()) != 0 {
+		t.Errorf("got header %v, want package information only", header)
+	}
+	got := new(cpb.CapabilityInfoList)
+	for _, line := range lines[1:] {
+		ci := new(cpb.CapabilityInfo)
+		if err := protojson.Unmarshal([]byte(line), ci); err != nil {
+			t.Fatalf("parsing record %q: %v", line, err)
+		}
+		got.CapabilityInfo = append(got.CapabilityInfo, ci)
+	}
+	want, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier: interesting.DefaultClassifier(),
+	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
+	want.ModuleInfo, want.PackageInfo, want.AnalyzedPackages = nil, nil, nil
+	sortCapabilityInfo := protocmp.SortRepeated(func(a, b *cpb.CapabilityInfo) bool {
+		if a.GetCapability() != b.GetCapability() {
+			return a.GetCapability() < b.GetCapability()
+		}
+		return a.GetDepPath() < b.GetDepPath()
+	})
+	if diff := cmp.Diff(want, got, protocmp.Transform(), sortCapabilityInfo); diff != "" {
+		t.Errorf("StreamCapabilityInfoJSONL: got diff from GetCapabilityInfo (-want +got):\n%s", diff)
+	}
+}
+
+func TestForEachCapabilityInfo(t *testing.T) {
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	config := &Config{Classifier: interesting.DefaultClassifier()}
+	var all []*cpb.CapabilityInfo
+	err = ForEachCapabilityInfo(context.Background(), pkgs, queriedPackages, config, func(ci *cpb.CapabilityInfo) bool {
+		all = append(all, ci)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("ForEachCapabilityInfo: %v", err)
+	}
+	if len(all) < 2 {
+		t.Fatalf("ForEachCapabilityInfo: got %d results, want at least 2", len(all))
+	}
+	if config.Granularity != GranularityUnset {
+		t.Errorf("ForEachCapabilityInfo: changed the granularity of its Config to %d", config.Granularity)
+	}
+	// Stopping after the first result reports only that one, and no error.
+	var first []*cpb.CapabilityInfo
+	err = ForEachCapabilityInfo(context.Background(), pkgs, queriedPackages, config, func(ci *cpb.CapabilityInfo) bool {
+		first = append(first, ci)
+		return false
+	})
+	if err != nil {
+		t.Fatalf("ForEachCapabilityInfo stopping early: %v", err)
+	}
+	if diff := cmp.Diff(all[:1], first, protocmp.Transform()); diff != "" {
+		t.Errorf("ForEachCapabilityInfo stopping early: got diff (-want +got):\n%s", diff)
+	}
+	// Cancelling the context is still reported.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = ForEachCapabilityInfo(ctx, pkgs, queriedPackages, config, func(*cpb.CapabilityInfo) bool { return false })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ForEachCapabilityInfo with cancelled context: got error %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestMaxPathLength(t *testing.T) {
+	filemap := map[string]string{"testlib/foo.go": `package testlib
+
+import "os"
+
+func Foo() { X() }
+func X()   { Y() }
+func Y()   { println(os.Getpid()) }
+`}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier:    interesting.DefaultClassifier(),
+		MaxPathLength: 2,
+	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
+	type result struct {
+		DepPath   string
+		Truncated bool
+	}
+	var got []result
+	for _, ci := range cil.GetCapabilityInfo() {
+		got = append(got, result{ci.GetDepPath(), ci.GetTruncated()})
+	}
+	want := []result{
+		{"testlib.Foo testlib.X", true},
+		{"testlib.X testlib.Y", true},
+		{"testlib.Y os.Getpid", false},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GetCapabilityInfo: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestFunctionCapabilities(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import (
+	"os"
+	"example.com/dep"
+)
+
+func Foo() { println(os.Getpid()); dep.Dial() }
+func Bar() {}
+`,
+		"example.com/dep/dial.go": `package dep
+
+import "net"
+
+func Dial() { net.Dial("tcp", "example.com:80") }
+`,
+	}
+	pkgs, _, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	idx, err := NewCapabilityIndex(context.Background(), pkgs, &Config{
+		Classifier: interesting.DefaultClassifier(),
+	})
+	if err != nil {
+		t.Fatalf("NewCapabilityIndex: %v", err)
+	}
+	type result struct {
+		Capability     cpb.Capability
+		CapabilityType cpb.CapabilityType
+		DepPath        string
+	}
+	for _, test := range []struct {
+		fn   string
+		want []result
+	}{
+		{
+			fn: "testlib.Foo",
+			want: []result{
+				{cpb.Capability_CAPABILITY_READ_SYSTEM_STATE, cpb.CapabilityType_CAPABILITY_TYPE_DIRECT, "testlib.Foo os.Getpid"},
+				{cpb.Capability_CAPABILITY_NETWORK_DIAL, cpb.CapabilityType_CAPABILITY_TYPE_TRANSITIVE, "testlib.Foo example.com/dep.Dial net.Dial"},
+			},
+		},
+		{
+			fn: "example.com/dep.Dial",
+			want: []result{
+				{cpb.Capability_CAPABILITY_NETWORK_DIAL, cpb.CapabilityType_CAPABILITY_TYPE_DIRECT, "example.com/dep.Dial net.Dial"},
+			},
+		},
+		{fn: "testlib.Bar"},
+		{fn: "testlib.DoesNotExist"},
+	} {
+		var got []result
+		for _, ci := range idx.FunctionCapabilities(test.fn) {
+			got = append(got, result{ci.GetCapability(), ci.GetCapabilityType(), ci.GetDepPath()})
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("FunctionCapabilities(%q): got diff (-want +got):\n%s", test.fn, diff)
+		}
+	}
+}
+
+func TestExportedSymbolCapabilities(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import (
+	"os"
+	"strings"
+)
+
+func Parse(s string) []string { return strings.Fields(s) }
+
+func Fetch() int { return pid() }
+
+func pid() int { return os.Getpid() }
+
+type T struct{}
+
+func (*T) Env() (string, int) { return os.Getenv("HOME"), os.Getpid() }
+
+func (T) Name() string { return "T" }
+
+func (T) hidden() int { return os.Getpid() }
+
+type t struct{}
+
+func (t) Exported() int { return os.Getpid() }
+
+func Generic[E any](e E) int { return os.Getpid() }
+`,
+	}
+	pkgs, _, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	got, err := ExportedSymbolCapabilities(context.Background(), pkgs, &Config{
+		Classifier: interesting.DefaultClassifier(),
+	})
+	if err != nil {
+		t.Fatalf("ExportedSymbolCapabilities: %v", err)
+	}
+	want := map[string][]cpb.Capability{
+		"testlib.Parse":   nil,
+		"testlib.Fetch":   {cpb.Capability_CAPABILITY_READ_SYSTEM_STATE},
+		"testlib.Generic": {cpb.Capability_CAPABILITY_READ_SYSTEM_STATE},
+		"(*testlib.T).Env": {
+			cpb.Capability_CAPABILITY_READ_SYSTEM_STATE,
+			cpb.Capability_CAPABILITY_READ_ENVIRONMENT,
+		},
+		"(testlib.T).Name": nil,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ExportedSymbolCapabilities: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestCapabilityFunctionIndex(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import (
+	"os"
+	"unsafe"
+)
+
+func Foo() { println(os.Getpid()) }
+
+func Unused(p unsafe.Pointer) *int { return (*int)(p) }
+`,
+	}
+	pkgs, _, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	index, err := CapabilityFunctionIndex(pkgs, &Config{
+		Classifier: interesting.DefaultClassifier(),
+	})
+	if err != nil {
+		t.Fatalf("CapabilityFunctionIndex: %v", err)
+	}
+	find := func(c cpb.Capability, name string) *cpb.Function {
+		for _, fn := range index[c] {
+			if fn.GetName() == name {
+				return fn
+			}
+		}
+		return nil
+	}
+	if find(cpb.Capability_CAPABILITY_READ_SYSTEM_STATE, "os.Getpid") == nil {
+		t.Errorf("CapabilityFunctionIndex: os.Getpid not listed under CAPABILITY_READ_SYSTEM_STATE")
+	}
+	// Functions which are not reachable from the queried packages are
+	// included, as are functions with capabilities found from their code.
+	want := &cpb.Function{
+		Name:        proto.String("testlib.Unused"),
+		Package:     proto.String("testlib"),
+		Declaration: &cpb.Function_Site{Filename: proto.String("foo.go"), Line: proto.Int64(10), Column: proto.Int64(6)},
+	}
+	if diff := cmp.Diff(want, find(cpb.Capability_CAPABILITY_UNSAFE_POINTER, "testlib.Unused"), protocmp.Transform()); diff != "" {
+		t.Errorf("CapabilityFunctionIndex: got diff for testlib.Unused (-want +got):\n%s", diff)
+	}
+	for c, fns := range index {
+		if !slices.IsSortedFunc(fns, func(a, b *cpb.Function) int { return strings.Compare(a.GetName(), b.GetName()) }) {
+			t.Errorf("CapabilityFunctionIndex: functions for %v are not sorted", c)
+		}
+	}
+
+	cs, err := NewCapabilitySet("UNSAFE_POINTER")
+	if err != nil {
+		t.Fatalf("NewCapabilitySet: %v", err)
+	}
+	index, err = CapabilityFunctionIndex(pkgs, &Config{
+		Classifier:    interesting.DefaultClassifier(),
+		CapabilitySet: cs,
+	})
+	if err != nil {
+		t.Fatalf("CapabilityFunctionIndex: %v", err)
+	}
+	for c := range index {
+		if c != cpb.Capability_CAPABILITY_UNSAFE_POINTER {
+			t.Errorf("CapabilityFunctionIndex with CapabilitySet UNSAFE_POINTER: got capability %v", c)
+		}
+	}
+}
+
+func TestCollapseStdlib(t *testing.T) {
+	// Packages whose paths have no dot are treated as part of the standard
+	// library.
+	filemap := map[string]string{
+		"example.com/app/app.go": `package app
+
+import (
+	"inner"
+	"os"
+)
+
+func Foo() { inner.A() }
+func Bar() { println(os.Getpid()) }
+`,
+		"inner/a.go": `package inner
+
+import "inner/b"
+
+func A() { b.B() }
+`,
+		"inner/b/b.go": `package b
+
+import "os"
+
+func B() { println(os.Getpid()) }
+`,
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "example.com/app")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	for _, test := range []struct {
+		collapse bool
+		want     [][]string
+	}{
+		{false, [][]string{
+			{"example.com/app.Bar", "os.Getpid"},
+			{"example.com/app.Foo", "inner.A", "inner/b.B", "os.Getpid"},
+		}},
+		{true, [][]string{
+			{"example.com/app.Bar", "os.Getpid"},
+			{"example.com/app.Foo", "<std:inner...inner/b>", "os.Getpid"},
+		}},
+	} {
+		cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+			Classifier:     interesting.DefaultClassifier(),
+			Granularity:    GranularityFunction,
+			CollapseStdlib: test.collapse,
+		})
+		if err != nil {
+			t.Fatalf("GetCapabilityInfo: %v", err)
+		}
+		var got [][]string
+		for _, ci := range cil.GetCapabilityInfo() {
+			var names []string
+			for _, fn := range ci.GetPath() {
+				names = append(names, fn.GetName())
+			}
+			got = append(got, names)
+			// Each function in the path is one word of dep_path.
+			if n := len(strings.Fields(ci.GetDepPath())); n != len(ci.GetPath()) {
+				t.Errorf("GetCapabilityInfo with CollapseStdlib=%v: dep_path %q has %d words, want %d", test.collapse, ci.GetDepPath(), n, len(ci.GetPath()))
+			}
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("GetCapabilityInfo with CollapseStdlib=%v: got paths diff (-want +got):\n%s", test.collapse, diff)
+		}
+	}
+}
+
+func TestPathID(t *testing.T) {
+	filemap := map[string]string{"testlib/foo.go": `package testlib
+
+import "os"
+
+func Foo() { Bar() }
+func Bar() { println(os.Getpid()) }
+func Baz() { println(os.Getpid()) }
+`}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	// pathIDs returns the path ID of each function's entry in the output of
+	// GetCapabilityInfo with the given config.
+	pathIDs := func(config *Config) map[string]string {
+		config.Classifier = interesting.DefaultClassifier()
+		config.Granularity = GranularityFunction
+		cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, config)
+		if err != nil {
+			t.Fatalf("GetCapabilityInfo: %v", err)
+		}
+		ids := make(map[string]string)
+		for _, ci := range cil.GetCapabilityInfo() {
+			ids[ci.GetPath()[0].GetName()] = ci.GetPathId()
+		}
+		return ids
+	}
+	want := pathIDs(&Config{})
+	if len(want) != 3 {
+		t.Fatalf("got path IDs %v, want one for each of three functions", want)
+	}
+	if want["testlib.Bar"] == want["testlib.Baz"] || want["testlib.Foo"] == want["testlib.Bar"] {
+		t.Errorf("got path IDs %v, want different IDs for different paths", want)
+	}
+	for _, config := range []*Config{
+		{},
+		{CallGraphAlgorithm: CallGraphCHA},
+		{OmitPaths: true},
+		{MaxPathLength: 1},
+	} {
+		if diff := cmp.Diff(want, pathIDs(config)); diff != "" {
+			t.Errorf("path IDs with config %+v: got diff (-want +got):\n%s", config, diff)
+		}
+	}
+}
+
+func TestPathIDOfOutputPath(t *testing.T) {
+	// Packages whose paths have no dot are treated as part of the standard
+	// library.
+	filemap := map[string]string{
+		"example.com/app/app.go": `package app
+
+import "inner"
+
+type T struct{}
+
+func (T) M() { inner.A() }
+
+func Foo() { inner.A() }
+
+func Bound() {
+	f := T{}.M
+	f()
+}
+
+func Thunk() {
+	f := T.M
+	f(T{})
+}
+`,
+		"inner/a.go": `package inner
+
+import "inner/b"
+
+func A() { b.B() }
+`,
+		"inner/b/b.go": `package b
+
+import "os"
+
+func B() { println(os.Getpid()) }
+`,
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "example.com/app")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	for _, config := range []*Config{
+		{},
+		{IncludeWrappers: true},
+		{CollapseStdlib: true},
+		{IncludeWrappers: true, CollapseStdlib: true},
+	} {
+		config.Classifier = interesting.DefaultClassifier()
+		for _, g := range []Granularity{GranularityFunction, GranularityPackage, GranularityIntermediate} {
+			config.Granularity = g
+			cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, config)
+			if err != nil {
+				t.Fatalf("GetCapabilityInfo: %v", err)
+			}
+			if len(cil.GetCapabilityInfo()) == 0 {
+				t.Errorf("GetCapabilityInfo with config %+v: got no capabilities", config)
+			}
+			for _, ci := range cil.GetCapabilityInfo() {
+				if got, want := ci.GetPathId(), pathID(ci.GetPath()); got != want {
+					t.Errorf("GetCapabilityInfo with config %+v: path %q has ID %q, want %q", config, ci.GetDepPath(), got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestProgressFn(t *testing.T) {
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	var stages []ProgressStage
+	var searched []cpb.Capability
+	_, err = GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier: interesting.DefaultClassifier(),
+		ProgressFn: func(e ProgressEvent) {
+			if e.Stage == ProgressSearchStarted {
+				searched = append(searched, e.Capability)
+				return
+			}
+			if e.Count <= 0 {
+				t.Errorf("got event %+v, want positive count", e)
+			}
+			stages = append(stages, e.Stage)
+		},
+	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
+	want := []ProgressStage{ProgressPackagesLoaded, ProgressSSABuilt, ProgressCallGraphBuilt, ProgressComplete}
+	if diff := cmp.Diff(want, stages); diff != "" {
+		t.Errorf("got progress stages diff (-want +got):\n%s", diff)
+	}
+	if !slices.Contains(searched, cpb.Capability_CAPABILITY_READ_SYSTEM_STATE) {
+		t.Errorf("got searches for %v, want CAPABILITY_READ_SYSTEM_STATE among them", searched)
+	}
+	if !slices.IsSorted(searched) {
+		t.Errorf("got searches for %v, want them in order", searched)
+	}
+}
+
+func TestProgram(t *testing.T) {
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"testlib/foo.go": `package testlib
+
+import "os"
+
+func Foo() { println(os.Getpid()) }
+`,
+	})
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("analysistest.WriteFiles: %v", err)
+	}
+	loads := 0
+	p, err := NewProgram(func() ([]*packages.Package, error) {
+		loads++
+		return packages.Load(&packages.Config{
+			Mode: PackagesLoadModeNeeded,
+			Dir:  dir,
+			Env:  append(os.Environ(), "GOPATH="+dir, "GO111MODULE=off", "GOPROXY=off"),
+		}, "testlib")
+	})
+	if err != nil {
+		t.Fatalf("NewProgram: %v", err)
+	}
+	builds := 0
+	config := &Config{
+		Classifier: interesting.DefaultClassifier(),
+		Program:    p,
+		ProgressFn: func(e ProgressEvent) {
+			if e.Stage == ProgressCallGraphBuilt {
+				builds++
+			}
+		},
+	}
+	// capabilities returns the capabilities of the Program's packages.
+	capabilities := func() []string {
+		pkgs, err := p.Packages()
+		if err != nil {
+			t.Fatalf("Packages: %v", err)
+		}
+		cl, err := GetCapabilityCounts(context.Background(), pkgs, GetQueriedPackages(pkgs), config)
+		if err != nil {
+			t.Fatalf("GetCapabilityCounts: %v", err)
+		}
+		var caps []string
+		for c := range cl.GetCapabilityCounts() {
+			caps = append(caps, c)
+		}
+		slices.Sort(caps)
+		return caps
+	}
+	want := []string{"CAPABILITY_READ_SYSTEM_STATE"}
+	for i := 0; i < 2; i++ {
+		if got := capabilities(); !slices.Equal(got, want) {
+			t.Errorf("got capabilities %v, want %v", got, want)
+		}
+	}
+	if loads != 1 || builds != 1 {
+		t.Errorf("after two analyses: got %d loads and %d call graph builds, want 1 of each", loads, builds)
+	}
+
+	if p.Invalidate("example.com/unrelated") {
+		t.Errorf("Invalidate(%q): got true, want false", "example.com/unrelated")
+	}
+	// osPackage returns the os package loaded by the Program.
+	osPackage := func() *packages.Package {
+		pkgs, err := p.Packages()
+		if err != nil {
+			t.Fatalf("Packages: %v", err)
+		}
+		return pkgs[0].Imports["os"]
+	}
+	oldOS := osPackage()
+	err = os.WriteFile(filepath.Join(dir, "src", "testlib", "foo.go"), []byte(`package testlib
+
+import "os"
+
+func Foo() { println(os.Getpid()); os.ReadFile("foo") }
+`), 0o644)
+	if err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+	if !p.Invalidate("testlib") {
+		t.Errorf("Invalidate(%q): got false, want true", "testlib")
+	}
+	want = []string{"CAPABILITY_FILES_READ", "CAPABILITY_READ_SYSTEM_STATE"}
+	if got := capabilities(); !slices.Equal(got, want) {
+		t.Errorf("after change: got capabilities %v, want %v", got, want)
+	}
+	if loads != 1 || builds != 2 {
+		t.Errorf("after change: got %d loads and %d call graph builds, want 1 and 2", loads, builds)
+	}
+	if osPackage() != oldOS {
+		t.Errorf("after change: unchanged package os was not reused")
+	}
+
+	// A change which imports a package that was not loaded needs a new load.
+	err = os.WriteFile(filepath.Join(dir, "src", "testlib", "foo.go"), []byte(`package testlib
+
+import (
+	"net/url"
+	"os"
+)
+
+func Foo() { println(os.Getpid(), url.PathEscape("foo")) }
+`), 0o644)
+	if err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+	if !p.Invalidate("testlib") {
+		t.Errorf("Invalidate(%q): got false, want true", "testlib")
+	}
+	want = []string{"CAPABILITY_READ_SYSTEM_STATE"}
+	if got := capabilities(); !slices.Equal(got, want) {
+		t.Errorf("after new import: got capabilities %v, want %v", got, want)
+	}
+	if loads != 2 || builds != 3 {
+		t.Errorf("after new import: got %d loads and %d call graph builds, want 2 and 3", loads, builds)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var b bytes.Buffer
+	err := WriteCountsCSV(&b, &cpb.CapabilityCountList{
+		CapabilityCounts: map[string]int64{
+			"CAPABILITY_READ_SYSTEM_STATE": 3,
+			"CAPABILITY_NETWORK":           1,
+			"CAPABILITY_FILES":             2,
+		},
+	})
+	if err != nil {
+		t.Fatalf("WriteCountsCSV: %v", err)
+	}
+	want := "capability,count\n" +
+		"CAPABILITY_FILES,2\n" +
+		"CAPABILITY_NETWORK,1\n" +
+		"CAPABILITY_READ_SYSTEM_STATE,3\n"
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("WriteCountsCSV: got diff (-want +got):\n%s", diff)
+	}
+
+	b.Reset()
+	err = WriteStatsCSV(&b, &cpb.CapabilityStatList{
+		CapabilityStats: []*cpb.CapabilityStats{{
+			Capability:      cpb.Capability_CAPABILITY_READ_SYSTEM_STATE.Enum(),
+			Count:           proto.Int64(3),
+			DirectCount:     proto.Int64(1),
+			TransitiveCount: proto.Int64(2),
+			Severity:        proto.Int32(2),
+		}, {
+			Capability:      cpb.Capability_CAPABILITY_NETWORK.Enum(),
+			Count:           proto.Int64(1),
+			DirectCount:     proto.Int64(0),
+			TransitiveCount: proto.Int64(1),
+			Severity:        proto.Int32(3),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("WriteStatsCSV: %v", err)
+	}
+	want = "capability,count,direct,transitive,severity\n" +
+		"CAPABILITY_NETWORK,1,0,1,3\n" +
+		"CAPABILITY_READ_SYSTEM_STATE,3,1,2,2\n"
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("WriteStatsCSV: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestExcludePackages(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import "testlib/gen"
+
+func Foo() { gen.G() }
+`,
+		"testlib/gen/gen.go": `package gen
+
+import "os"
+
+func G() { println(os.Getpid()) }
+`,
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib/...")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	for _, test := range []struct {
+		exclude []string
+		want    []string
+	}{
+		{nil, []string{"testlib.Foo testlib/gen.G os.Getpid", "testlib/gen.G os.Getpid"}},
+		{[]string{"testlib/gen"}, []string{"testlib.Foo testlib/gen.G os.Getpid"}},
+		{[]string{"testlib/..."}, nil},
+		{[]string{"testlib/g*"}, []string{"testlib.Foo testlib/gen.G os.Getpid"}},
+		{[]string{"testlib/g"}, []string{"testlib.Foo testlib/gen.G os.Getpid", "testlib/gen.G os.Getpid"}},
+	} {
+		cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+			Classifier:      interesting.DefaultClassifier(),
+			ExcludePackages: test.exclude,
+		})
+		if err != nil {
+			t.Fatalf("GetCapabilityInfo: %v", err)
+		}
+		var got []string
+		for _, ci := range cil.GetCapabilityInfo() {
+			got = append(got, ci.GetDepPath())
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("GetCapabilityInfo with ExcludePackages %q: got diff (-want +got):\n%s", test.exclude, diff)
+		}
+	}
+}
+
+// BenchmarkGetCapabilityInfo measures the analysis of a large package and its
+// dependencies.  Run with -benchmem to see the memory used by the search.
+func BenchmarkGetCapabilityInfo(b *testing.B) {
+	pkgs, err := LoadPackages([]string{"net/http"}, LoadConfig{})
+	if err != nil {
+		b.Fatalf("LoadPackages: %v", err)
+	}
+	queriedPackages := GetQueriedPackages(pkgs)
+	config := &Config{Classifier: interesting.DefaultClassifier()}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, config); err != nil {
+			b.Fatalf("GetCapabilityInfo: %v", err)
+		}
+	}
+}
+
+// BenchmarkMaxSSAConcurrency measures the analysis of a large package with
+// different limits on the number of packages whose SSA code is built at
+// once.  Fewer packages built at once lower the peak memory use, which can be
+// compared by running each sub-benchmark separately under /usr/bin/time -v.
+func BenchmarkMaxSSAConcurrency(b *testing.B) {
+	pkgs, err := LoadPackages([]string{"net/http"}, LoadConfig{})
+	if err != nil {
+		b.Fatalf("LoadPackages: %v", err)
+	}
+	queriedPackages := GetQueriedPackages(pkgs)
+	for _, n := range []int{0, 1, 4} {
+		b.Run(fmt.Sprintf("max=%d", n), func(b *testing.B) {
+			config := &Config{Classifier: interesting.DefaultClassifier(), MaxSSAConcurrency: n}
+			for i := 0; i < b.N; i++ {
+				if _, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, config); err != nil {
+					b.Fatalf("GetCapabilityInfo: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxSSAConcurrency(t *testing.T) {
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	want, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier: interesting.DefaultClassifier(),
+	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
+	// Building the packages one at a time gives the same results.
+	got, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier:        interesting.DefaultClassifier(),
+		MaxSSAConcurrency: 1,
+	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo with MaxSSAConcurrency 1: %v", err)
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("GetCapabilityInfo with MaxSSAConcurrency 1: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestLoadError(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import "os"
+
+func Foo() int { return os.Getpid() }
+
+func Bar() int { return undefined() }
+`,
+		"testlib/ok/ok.go": `package ok
+
+import "os"
+
+func Foo() int { return os.Getpid() }
+`,
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib/...")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	_, err = GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier: interesting.DefaultClassifier(),
+	})
+	var loadErr *LoadError
+	if !errors.As(err, &loadErr) {
+		t.Fatalf("GetCapabilityInfo: got error %v, want a *LoadError", err)
+	}
+	if errs := loadErr.Packages["testlib"]; len(errs) != 1 || !strings.Contains(errs[0].Msg, "undefined") {
+		t.Errorf("GetCapabilityInfo: got LoadError.Packages %v, want one error for testlib", loadErr.Packages)
+	}
+	if _, err := GetReachableEnvVars(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier: interesting.DefaultClassifier(),
+	}); !errors.As(err, &loadErr) {
+		t.Errorf("GetReachableEnvVars: got error %v, want a *LoadError", err)
+	}
+	// With IgnoreLoadErrors, the packages which could be loaded are analyzed.
+	// The package which did not type-check is skipped.
+	cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier:       interesting.DefaultClassifier(),
+		IgnoreLoadErrors: true,
+	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo with IgnoreLoadErrors: %v", err)
+	}
+	var got []string
+	for _, ci := range cil.GetCapabilityInfo() {
+		got = append(got, ci.GetPath()[0].GetName())
+	}
+	if want := []string{"testlib/ok.Foo"}; !slices.Equal(got, want) {
+		t.Errorf("GetCapabilityInfo with IgnoreLoadErrors: got %v, want %v", got, want)
+	}
+}
+
+func TestExcludeInitFunctions(t *testing.T) {
+	filemap := map[string]string{"testlib/foo.go": `package testlib
+
+import (
+	"os"
+	"unsafe"
+)
+
+var pid = os.Getpid()
+
+var n int
+
+var p = (*int)(unsafe.Pointer(&n))
+
+func init() { _ = os.Getenv("HOME") }
+
+func Foo() (string, error) { return os.Getwd() }
+`}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	for _, test := range []struct {
+		exclude bool
+		want    []string
+	}{
+		{false, []string{
+			"testlib.Foo CAPABILITY_READ_SYSTEM_STATE",
+			"testlib.init CAPABILITY_READ_ENVIRONMENT",
+			"testlib.init CAPABILITY_READ_SYSTEM_STATE",
+			"testlib.init CAPABILITY_UNSAFE_POINTER",
+			"testlib.init#1 CAPABILITY_READ_ENVIRONMENT",
+		}},
+		// The unsafe.Pointer conversion in the initializer of p is still
+		// found, but the calls made during initialization are not followed.
+		{true, []string{
+			"testlib.Foo CAPABILITY_READ_SYSTEM_STATE",
+			"testlib.init CAPABILITY_UNSAFE_POINTER",
+		}},
+	} {
+		cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+			Classifier:           interesting.DefaultClassifier(),
+			Granularity:          GranularityFunction,
+			ExcludeInitFunctions: test.exclude,
+		})
+		if err != nil {
+			t.Fatalf("GetCapabilityInfo: %v", err)
+		}
+		var got []string
+		for _, ci := range cil.GetCapabilityInfo() {
+			got = append(got, ci.GetPath()[0].GetName()+" "+ci.GetCapability().String())
+		}
+		slices.Sort(got)
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("GetCapabilityInfo with ExcludeInitFunctions=%v: got diff (-want +got):\n%s", test.exclude, diff)
+		}
+	}
+}
+
+func TestCapabilityStatsCapabilitySet(t *testing.T) {
+	filemap := map[string]string{"testlib/foo.go": `package testlib
+
+import (
+	"net"
+	"os"
+)
+
+func Foo() { println(os.Getpid()) }
+func Bar() { println(os.Getpid()) }
+func Baz() { net.Dial("tcp", "example.com:80") }
+`}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	for _, test := range []struct {
+		capabilities string
+		want         map[cpb.Capability]int64
+	}{
+		{"READ_SYSTEM_STATE", map[cpb.Capability]int64{cpb.Capability_CAPABILITY_READ_SYSTEM_STATE: 2}},
+		{"-READ_SYSTEM_STATE", map[cpb.Capability]int64{cpb.Capability_CAPABILITY_NETWORK_DIAL: 1}},
+		{"", map[cpb.Capability]int64{
+			cpb.Capability_CAPABILITY_READ_SYSTEM_STATE: 2,
+			cpb.Capability_CAPABILITY_NETWORK_DIAL:      1,
+		}},
+	} {
+		cs, err := NewCapabilitySet(test.capabilities)
+		if err != nil {
+			t.Fatalf("NewCapabilitySet(%q): %v", test.capabilities, err)
+		}
+		stats, err := GetCapabilityStats(context.Background(), pkgs, queriedPackages, &Config{
+			Classifier:    interesting.DefaultClassifier(),
+			CapabilitySet: cs,
+		})
+		if err != nil {
+			t.Fatalf("GetCapabilityStats: %v", err)
+		}
+		got := make(map[cpb.Capability]int64)
+		for _, s := range stats.GetCapabilityStats() {
+			got[s.GetCapability()] = s.GetCount()
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("GetCapabilityStats with capabilities %q: got diff (-want +got):\n%s", test.capabilities, diff)
+		}
+	}
+}
+
+func TestProvidedPackages(t *testing.T) {
+	// Packages built without go/packages, as by a build system with its own
+	// loader, are analyzed in the same way.
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "foo.go", `package testlib
+
+import "unsafe"
+
+func Foo(x *int) *int64 { return (*int64)(unsafe.Pointer(x)) }
+`, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Implicits:  make(map[ast.Node]types.Object),
+		Instances:  make(map[*ast.Ident]types.Instance),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		Scopes:     make(map[ast.Node]*types.Scope),
+	}
+	tpkg, err := (&types.Config{Importer: importer.Default()}).Check("testlib", fset, []*ast.File{file}, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := &packages.Package{
+		ID:        "testlib",
+		Name:      "testlib",
+		PkgPath:   "testlib",
+		Fset:      fset,
+		Syntax:    []*ast.File{file},
+		Types:     tpkg,
+		TypesInfo: info,
+		Imports:   map[string]*packages.Package{"unsafe": {ID: "unsafe", Name: "unsafe", PkgPath: "unsafe", Types: types.Unsafe}},
+	}
+	pkgs := []*packages.Package{pkg}
+	cil, err := GetCapabilityInfo(context.Background(), pkgs, GetQueriedPackages(pkgs), &Config{
+		Classifier: interesting.DefaultClassifier(),
+	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
+	var got []cpb.Capability
+	for _, ci := range cil.GetCapabilityInfo() {
+		got = append(got, ci.GetCapability())
+	}
+	if want := []cpb.Capability{cpb.Capability_CAPABILITY_UNSAFE_POINTER}; !slices.Equal(got, want) {
+		t.Errorf("GetCapabilityInfo: got capabilities %v, want %v", got, want)
+	}
+
+	// A package without its syntax can't be analyzed.
+	incomplete := *pkg
+	incomplete.Syntax = nil
+	pkgs = []*packages.Package{&incomplete}
+	_, err = GetCapabilityInfo(context.Background(), pkgs, GetQueriedPackages(pkgs), &Config{
+		Classifier:       interesting.DefaultClassifier(),
+		IgnoreLoadErrors: true,
+	})
+	var incompleteErr *IncompletePackageError
+	if !errors.As(err, &incompleteErr) {
+		t.Fatalf("GetCapabilityInfo: got error %v, want an *IncompletePackageError", err)
+	}
+	if want := (&IncompletePackageError{Package: "testlib", Missing: []string{"Syntax"}}); !cmp.Equal(incompleteErr, want) {
+		t.Errorf("GetCapabilityInfo: got error %#v, want %#v", incompleteErr, want)
+	}
+}
+
+func TestCapabilityStatsPathCount(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import "example.com/dep"
+
+func Foo() { dep.One(); dep.Two() }
+func Bar() { dep.One(); dep.One() }
+`,
+		"example.com/dep/dep.go": `package dep
+
+import "os"
+
+func One() { println(os.Getpid()) }
+func Two() { println(os.Getpid(), os.Getppid()) }
+func Three() { One(); Two() }
+`,
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	// Foo has one path through One and two through Two, and Bar has one
+	// through each of its calls to One.  Three is not in a queried package.
+	for _, test := range []struct {
+		maxPathCount int
+		want         int64
+		wantAtLeast  bool
+	}{
+		{0, 5, false},
+		{6, 5, false},
+		{5, 5, true},
+		{3, 3, true},
+	} {
+		stats, err := GetCapabilityStats(context.Background(), pkgs, queriedPackages, &Config{
+			Classifier:   interesting.DefaultClassifier(),
+			MaxPathCount: test.maxPathCount,
+		})
+		if err != nil {
+			t.Fatalf("GetCapabilityStats: %v", err)
+		}
+		found := false
+		for _, s := range stats.GetCapabilityStats() {
+			if s.GetCapability() != cpb.Capability_CAPABILITY_READ_SYSTEM_STATE {
+				continue
+			}
+			found = true
+			if got, gotAtLeast := s.GetPathCount(), s.GetPathCountAtLeast(); got != test.want || gotAtLeast != test.wantAtLeast {
+				t.Errorf("GetCapabilityStats with MaxPathCount %d: got path count %d (at least: %t), want %d (at least: %t)",
+					test.maxPathCount, got, gotAtLeast, test.want, test.wantAtLeast)
+			}
+		}
+		if !found {
+			t.Errorf("GetCapabilityStats with MaxPathCount %d: no stats for CAPABILITY_READ_SYSTEM_STATE", test.maxPathCount)
+		}
+	}
+}
+
+func TestPruneDynamicDispatch(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import (
+	"os"
+
+	"example.com/dep"
+)
+
+type I interface{ M() string }
+
+type Local struct{}
+
+func (Local) M() string { return os.Getenv("HOME") }
+
+var _ I = Local{}
+var _ I = dep.Remote{}
+
+func Foo(i I) string { return i.M() }
+`,
+		"example.com/dep/dep.go": `package dep
+
+import "os"
+
+type Remote struct{}
+
+func (Remote) M() string { println(os.Getpid()); return "" }
+`,
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	for _, test := range []struct {
+		prune bool
+		want  []string
+	}{
+		{false, []string{"CAPABILITY_READ_ENVIRONMENT", "CAPABILITY_READ_SYSTEM_STATE"}},
+		// The implementation in example.com/dep is outside the analyzed
+		// packages, so the call to it through the interface is ignored.
+		{true, []string{"CAPABILITY_READ_ENVIRONMENT"}},
+	} {
+		cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+			Classifier:           interesting.DefaultClassifier(),
+			CallGraphAlgorithm:   CallGraphCHA,
+			PruneDynamicDispatch: test.prune,
+		})
+		if err != nil {
+			t.Fatalf("GetCapabilityInfo: %v", err)
+		}
+		var got []string
+		for _, ci := range cil.GetCapabilityInfo() {
+			if ci.GetPath()[0].GetName() == "testlib.Foo" {
+				got = append(got, ci.GetCapability().String())
+			}
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("GetCapabilityInfo with PruneDynamicDispatch=%v: got capabilities %v for testlib.Foo, want %v", test.prune, got, test.want)
+		}
+	}
+}
+
+func TestPackageCapabilitySummary(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import (
+	"os"
+
+	"example.com/dep"
+)
+
+func Foo() { println(os.Getpid()) }
+func Bar() { dep.Pid() }
+func Baz() { dep.Dial() }
+`,
+		"testlib/other/other.go": `package other
+
+func Nothing() {}
+`,
+		"example.com/dep/dep.go": `package dep
+
+import (
+	"net"
+	"os"
+)
+
+func Pid() { println(os.Getpid()) }
+func Dial() { net.Dial("tcp", "example.com:80") }
+`,
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib/...")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	got, err := PackageCapabilitySummary(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier: interesting.DefaultClassifier(),
+	})
+	if err != nil {
+		t.Fatalf("PackageCapabilitySummary: %v", err)
+	}
+	// READ_SYSTEM_STATE is direct, because testlib.Foo has it directly,
+	// even though testlib.Bar has it transitively.
+	want := map[string]PackageSummary{
+		"testlib": {
+			Module: "testlib",
+			Capabilities: map[cpb.Capability]cpb.CapabilityType{
+				cpb.Capability_CAPABILITY_READ_SYSTEM_STATE: cpb.CapabilityType_CAPABILITY_TYPE_DIRECT,
+				cpb.Capability_CAPABILITY_NETWORK_DIAL:      cpb.CapabilityType_CAPABILITY_TYPE_TRANSITIVE,
+			},
+		},
+		"testlib/other": {
+			Module:       "testlib/other",
+			Capabilities: map[cpb.Capability]cpb.CapabilityType{},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("PackageCapabilitySummary: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteDescriptorSet(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteDescriptorSet(&b); err != nil {
+		t.Fatalf("WriteDescriptorSet: %v", err)
+	}
+	var fds descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(b.Bytes(), &fds); err != nil {
+		t.Fatalf("unmarshaling descriptor set: %v", err)
+	}
+	files, err := protodesc.NewFiles(&fds)
+	if err != nil {
+		t.Fatalf("protodesc.NewFiles: %v", err)
+	}
+	d, err := files.FindDescriptorByName("capslock.proto.CapabilityInfoList")
+	if err != nil {
+		t.Fatalf("finding CapabilityInfoList: %v", err)
+	}
+	// Output parsed with the exported schema should match output parsed with
+	// the compiled-in one.
+	cil := &cpb.CapabilityInfoList{
+		CapabilityInfo: []*cpb.CapabilityInfo{{
+			PackageName: proto.String("foo"),
+			Capability:  cpb.Capability_CAPABILITY_FILES.Enum(),
+		}},
+	}
+	j, err := protojson.Marshal(cil)
+	if err != nil {
+		t.Fatalf("protojson.Marshal: %v", err)
+	}
+	m := dynamicpb.NewMessage(d.(protoreflect.MessageDescriptor))
+	if err := protojson.Unmarshal(j, m); err != nil {
+		t.Fatalf("parsing output with exported schema: %v", err)
+	}
+	wire, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatalf("proto.Marshal: %v", err)
+	}
+	got := new(cpb.CapabilityInfoList)
+	if err := proto.Unmarshal(wire, got); err != nil {
+		t.Fatalf("proto.Unmarshal: %v", err)
+	}
+	if diff := cmp.Diff(cil, got, protocmp.Transform()); diff != "" {
+		t.Errorf("round trip through exported schema: diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestOnlyReachableFromMain(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/main.go": `package main
+
+import "os"
+
+var home = os.Getenv("HOME")
+
+func main() { used() }
+
+func used() { println(os.Getpid()) }
+
+func unused() { println(os.Getpid()) }
+
+func Exported() { println(os.Getpid()) }
+`,
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	for _, test := range []struct {
+		reachable, exported bool
+		want                []string
+	}{
+		{false, false, []string{"testlib.Exported", "testlib.init", "testlib.main", "testlib.unused", "testlib.used"}},
+		{true, false, []string{"testlib.init", "testlib.main", "testlib.used"}},
+		{true, true, []string{"testlib.Exported", "testlib.init", "testlib.main", "testlib.used"}},
+	} {
+		cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+			Classifier:            interesting.DefaultClassifier(),
+			OnlyReachableFromMain: test.reachable,
+			ExportedEntryPoints:   test.exported,
+		})
+		if err != nil {
+			t.Fatalf("GetCapabilityInfo: %v", err)
+		}
+		var got []string
+		for _, ci := range cil.GetCapabilityInfo() {
+			got = append(got, ci.GetPath()[0].GetName())
+		}
+		slices.Sort(got)
+		got = slices.Compact(got)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("GetCapabilityInfo with OnlyReachableFromMain=%v, ExportedEntryPoints=%v: got functions %v, want %v", test.reachable, test.exported, got, test.want)
+		}
+	}
+}
+
+func TestFindUnsafePointerFunctions(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import (
+	"unsafe"
+
+	"example.com/dep"
+)
+
+var i int
+
+var p = (*int)(unsafe.Pointer(&i))
+
+func Conv(q unsafe.Pointer) *int { return (*int)(q) }
+
+func Uintptr(q unsafe.Pointer) uintptr { return uintptr(q) }
+
+func Safe() { dep.Conv(nil) }
+`,
+		"example.com/dep/dep.go": `package dep
+
+import "unsafe"
+
+func Conv(q unsafe.Pointer) *int { return (*int)(q) }
+`,
+	}
+	pkgs, _, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	got := FindUnsafePointerFunctions(pkgs)
+	for i := range got {
+		got[i].Position.Filename = filepath.Base(got[i].Position.Filename)
+		got[i].Position.Offset = 0
+	}
+	want := []FunctionLocation{
+		{Package: "testlib", Name: "testlib.Conv", Position: token.Position{Filename: "foo.go", Line: 13, Column: 6}},
+		{Package: "testlib", Name: "testlib.init", Position: token.Position{Filename: "foo.go", Line: 11, Column: 9}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("FindUnsafePointerFunctions: diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestEvaluatePolicy(t *testing.T) {
+	ci := func(pkg string, c cpb.Capability, path ...string) *cpb.CapabilityInfo {
+		ci := &cpb.CapabilityInfo{PackageDir: proto.String(pkg), Capability: c.Enum()}
+		for _, f := range path {
+			ci.Path = append(ci.Path, &cpb.Function{Name: proto.String(f)})
+		}
+		return ci
+	}
+	cil := &cpb.CapabilityInfoList{CapabilityInfo: []*cpb.CapabilityInfo{
+		ci("example.com/a", cpb.Capability_CAPABILITY_FILES, "example.com/a.F", "os.Open"),
+		ci("example.com/a", cpb.Capability_CAPABILITY_NETWORK, "example.com/a.G", "net.Dial"),
+		ci("example.com/b", cpb.Capability_CAPABILITY_NETWORK, "example.com/b.H", "net.Dial"),
+		ci("example.com/c", cpb.Capability_CAPABILITY_FILES),
+	}}
+	policy := Policy{
+		Allowed: []cpb.Capability{cpb.Capability_CAPABILITY_FILES},
+		Packages: map[string][]cpb.Capability{
+			// b may use the network, and c has nothing, not even FILES.
+			"example.com/b": {cpb.Capability_CAPABILITY_NETWORK},
+			"example.com/c": nil,
+		},
+	}
+	violations, ok := EvaluatePolicy(cil, policy)
+	want := []Violation{
+		{Capability: cpb.Capability_CAPABILITY_NETWORK, Package: "example.com/a", Path: []string{"example.com/a.G", "net.Dial"}},
+		{Capability: cpb.Capability_CAPABILITY_FILES, Package: "example.com/c"},
+	}
+	if diff := cmp.Diff(want, violations); diff != "" || ok {
+		t.Errorf("EvaluatePolicy: got ok=%v, violations diff (-want +got):\n%s", ok, diff)
+	}
+	if got, want := violations[0].String(), "example.com/a: CAPABILITY_NETWORK is not allowed (example.com/a.G -> net.Dial)"; got != want {
+		t.Errorf("Violation.String: got %q, want %q", got, want)
+	}
+	policy.Allowed = append(policy.Allowed, cpb.Capability_CAPABILITY_NETWORK)
+	policy.Packages["example.com/c"] = []cpb.Capability{cpb.Capability_CAPABILITY_FILES}
+	if violations, ok := EvaluatePolicy(cil, policy); !ok || len(violations) != 0 {
+		t.Errorf("EvaluatePolicy: got ok=%v, violations %v; want none", ok, violations)
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	violations := []Violation{
+		{Capability: cpb.Capability_CAPABILITY_NETWORK, Package: "example.com/a", Path: []string{"example.com/a.G", "net.Dial"}},
+		{Capability: cpb.Capability_CAPABILITY_NETWORK, Package: "example.com/a", Path: []string{"example.com/a.H", "net.Dial"}},
+		{Capability: cpb.Capability_CAPABILITY_FILES, Package: "example.com/c"},
+	}
+	var b bytes.Buffer
+	if err := WriteJUnit(&b, []string{"example.com/b", "example.com/a"}, violations); err != nil {
+		t.Fatalf("WriteJUnit: %v", err)
+	}
+	var doc struct {
+		Suites []struct {
+			Tests     int `xml:"tests,attr"`
+			Failures  int `xml:"failures,attr"`
+			TestCases []struct {
+				Name      string `xml:"name,attr"`
+				ClassName string `xml:"classname,attr"`
+				Failure   *struct {
+					Message string `xml:"message,attr"`
+					Text    string `xml:",chardata"`
+				} `xml:"failure"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	if err := xml.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatalf("WriteJUnit: invalid XML: %v\n%s", err, b.String())
+	}
+	if len(doc.Suites) != 1 {
+		t.Fatalf("WriteJUnit: got %d test suites, want 1\n%s", len(doc.Suites), b.String())
+	}
+	suite := doc.Suites[0]
+	if suite.Tests != 3 || suite.Failures != 2 {
+		t.Errorf("WriteJUnit: got tests=%d failures=%d, want tests=3 failures=2", suite.Tests, suite.Failures)
+	}
+	var got []string
+	for _, tc := range suite.TestCases {
+		s := tc.ClassName + " " + tc.Name
+		if tc.Failure != nil {
+			s += " FAIL: " + tc.Failure.Message
+			if tc.ClassName == "example.com/a" && !strings.Contains(tc.Failure.Text, "example.com/a.G\n  net.Dial\n") {
+				t.Errorf("WriteJUnit: failure text %q does not contain the example path", tc.Failure.Text)
+			}
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		"example.com/a CAPABILITY_NETWORK FAIL: example.com/a: CAPABILITY_NETWORK is not allowed (example.com/a.G -> net.Dial)",
+		"example.com/b capability policy",
+		"example.com/c CAPABILITY_FILES FAIL: example.com/c: CAPABILITY_FILES is not allowed",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("WriteJUnit: test cases diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import (
+	"os"
+
+	"example.com/dep"
+)
+
+// Pid returns the process ID.
+//
+//capslock:safe
+func Pid() int { return os.Getpid() }
+
+//capslock:capability NETWORK
+func Fetch() {}
+
+type T struct{}
+
+//capslock:capability CAPABILITY_FILES
+func (*T) M() {}
+
+func Foo() { println(Pid()); dep.Hidden() }
+`,
+		"example.com/dep/dep.go": `package dep
+
+import "os"
+
+// Directives in dependencies are ignored.
+//
+//capslock:safe
+func Hidden() { println(os.Getpid()) }
+`,
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	for _, test := range []struct {
+		directives bool
+		want       []string
+	}{
+		{false, []string{
+			"testlib.Foo CAPABILITY_READ_SYSTEM_STATE",
+			"testlib.Pid CAPABILITY_READ_SYSTEM_STATE",
+		}},
+		{true, []string{
+			"(*testlib.T).M CAPABILITY_FILES",
+			"testlib.Fetch CAPABILITY_NETWORK",
+			"testlib.Foo CAPABILITY_READ_SYSTEM_STATE",
+		}},
+	} {
+		cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+			Classifier:    interesting.DefaultClassifier(),
+			UseDirectives: test.directives,
+		})
+		if err != nil {
+			t.Fatalf("GetCapabilityInfo: %v", err)
+		}
+		var got []string
+		for _, ci := range cil.GetCapabilityInfo() {
+			got = append(got, ci.GetPath()[0].GetName()+" "+ci.GetCapability().String())
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("GetCapabilityInfo with UseDirectives=%v: got %v, want %v", test.directives, got, test.want)
 		}
 	}
 }
 
-func TestIntermediatePackages(t *testing.T) {
+func TestDirectiveErrors(t *testing.T) {
+	for _, test := range []struct {
+		src, want string
+	}{
+		{"//capslock:capability NETWORK\n//capslock:safe\nfunc F() {}", "conflicts"},
+		{"//capslock:capability TELEPORT\nfunc F() {}", "unsupported capability"},
+		{"//capslock:unsafe\nfunc F() {}", "invalid directive"},
+	} {
+		pkgs, queriedPackages, cleanup, err := setup(map[string]string{"testlib/foo.go": "package testlib\n\n" + test.src + "\n"}, "testlib")
+		if cleanup != nil {
+			defer cleanup()
+		}
+		if err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+		_, err = GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+			Classifier:    interesting.DefaultClassifier(),
+			UseDirectives: true,
+		})
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("GetCapabilityInfo for %q: got error %v, want one containing %q", test.src, err, test.want)
+		}
+	}
+}
+
+func TestNewAnalysis(t *testing.T) {
+	// G has CAPABILITY_REFLECT, which is found from its body rather than by
+	// its name, so paths to other capabilities can go through it.
+	filemap := map[string]string{"testlib/foo.go": `package testlib
+
+import (
+	"os"
+	"reflect"
+)
+
+var v reflect.Value
+
+func Foo() { G() }
+
+func G() {
+	v = reflect.ValueOf(0)
+	println(os.Getpid())
+}
+`}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	ctx := context.Background()
+	newConfig := func() *Config {
+		return &Config{Classifier: interesting.DefaultClassifier()}
+	}
+	wantInfo, err := GetCapabilityInfo(ctx, pkgs, queriedPackages, newConfig())
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
+	wantStats, err := GetCapabilityStats(ctx, pkgs, queriedPackages, newConfig())
+	if err != nil {
+		t.Fatalf("GetCapabilityStats: %v", err)
+	}
+	wantCounts, err := GetCapabilityCounts(ctx, pkgs, queriedPackages, newConfig())
+	if err != nil {
+		t.Fatalf("GetCapabilityCounts: %v", err)
+	}
+
+	config := newConfig()
+	graphsBuilt := 0
+	config.ProgressFn = func(e ProgressEvent) {
+		if e.Stage == ProgressCallGraphBuilt {
+			graphsBuilt++
+		}
+	}
+	a, err := NewAnalysis(pkgs, queriedPackages, config)
+	if err != nil {
+		t.Fatalf("NewAnalysis: %v", err)
+	}
+	// Each output is produced twice, to check that reusing the
+	// classification does not change it.
+	for i := 0; i < 2; i++ {
+		info, err := a.Info(ctx)
+		if err != nil {
+			t.Fatalf("Analysis.Info: %v", err)
+		}
+		if diff := cmp.Diff(wantInfo, info, protocmp.Transform()); diff != "" {
+			t.Errorf("Analysis.Info: diff (-want +got):\n%s", diff)
+		}
+		stats, err := a.Stats(ctx)
+		if err != nil {
+			t.Fatalf("Analysis.Stats: %v", err)
+		}
+		if diff := cmp.Diff(wantStats, stats, protocmp.Transform()); diff != "" {
+			t.Errorf("Analysis.Stats: diff (-want +got):\n%s", diff)
+		}
+		counts, err := a.Counts(ctx)
+		if err != nil {
+			t.Fatalf("Analysis.Counts: %v", err)
+		}
+		if diff := cmp.Diff(wantCounts, counts, protocmp.Transform()); diff != "" {
+			t.Errorf("Analysis.Counts: diff (-want +got):\n%s", diff)
+		}
+	}
+	if graphsBuilt != 1 {
+		t.Errorf("Analysis: built the call graph %d times, want 1", graphsBuilt)
+	}
+}
+
+func TestIncludeWrappers(t *testing.T) {
+	filemap := map[string]string{"testlib/foo.go": `package testlib
+
+import "os"
+
+type T struct{}
+
+func (T) M() int { return os.Getpid() }
+
+func Bound() int {
+	f := T{}.M
+	return f()
+}
+`}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	for _, test := range []struct {
+		includeWrappers bool
+		want            []*cpb.Function
+	}{
+		{
+			includeWrappers: false,
+			want: []*cpb.Function{
+				{Name: proto.String("testlib.Bound")},
+				{Name: proto.String("(testlib.T).M"), Site: &cpb.Function_Site{Line: proto.Int64(11)}},
+				{Name: proto.String("os.Getpid"), Site: &cpb.Function_Site{Line: proto.Int64(7)}},
+			},
+		},
+		{
+			includeWrappers: true,
+			want: []*cpb.Function{
+				{Name: proto.String("testlib.Bound")},
+				{
+					Name:    proto.String("(testlib.T).M$bound"),
+					Site:    &cpb.Function_Site{Line: proto.Int64(11)},
+					Wrapper: proto.String("bound method wrapper for func (testlib.T).M() int"),
+				},
+				{Name: proto.String("(testlib.T).M")},
+				{Name: proto.String("os.Getpid"), Site: &cpb.Function_Site{Line: proto.Int64(7)}},
+			},
+		},
+	} {
+		cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+			Classifier:      interesting.DefaultClassifier(),
+			DisableBuiltin:  true,
+			IncludeWrappers: test.includeWrappers,
+		})
+		if err != nil {
+			t.Fatalf("GetCapabilityInfo: %v", err)
+		}
+		var got []*cpb.Function
+		for _, ci := range cil.GetCapabilityInfo() {
+			if ci.GetPath()[0].GetName() == "testlib.Bound" {
+				got = ci.GetPath()
+			}
+		}
+		// Compare only the names, lines and wrapper descriptions.
+		opts := []cmp.Option{
+			protocmp.Transform(),
+			protocmp.IgnoreFields(&cpb.Function{}, "package", "declaration"),
+			protocmp.IgnoreFields(&cpb.Function_Site{}, "filename", "column"),
+		}
+		if diff := cmp.Diff(test.want, got, opts...); diff != "" {
+			t.Errorf("GetCapabilityInfo with IncludeWrappers=%v: got diff (-want +got):\n%s", test.includeWrappers, diff)
+		}
+	}
+}
+
+func TestNoFindings(t *testing.T) {
+	filemap := map[string]string{"testlib/foo.go": `package testlib
+
+func Foo() int { return 1 }
+`}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	want := &cpb.CapabilityInfoList{
+		PackageInfo:      []*cpb.PackageInfo{{Path: proto.String("testlib")}},
+		AnalyzedPackages: proto.Int64(1),
+	}
+	for _, g := range []Granularity{GranularityFunction, GranularityPackage, GranularityIntermediate} {
+		cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+			Classifier:  interesting.DefaultClassifier(),
+			Granularity: g,
+		})
+		if err != nil {
+			t.Fatalf("GetCapabilityInfo: %v", err)
+		}
+		if diff := cmp.Diff(want, cil, protocmp.Transform()); diff != "" {
+			t.Errorf("GetCapabilityInfo with granularity %v: got diff (-want +got):\n%s", g, diff)
+		}
+	}
+	if got := mergeCapabilityInfoLists(GranularityPackage, nil, []*cpb.CapabilityInfoList{want}); !proto.Equal(got, want) {
+		t.Errorf("MergeCapabilityInfoLists: got %v, want %v", got, want)
+	}
+}
+
+func TestOnlyTransitive(t *testing.T) {
 	filemap := map[string]string{
-		"p1/p1.go": `package p1; func Foo() { Bar() }; func Bar() { }`,
-		"p2/p2.go": `package p2; import "p1"; func Foo() { p1.Foo() }`,
-		"p3/p3.go": `package p3; import "p1"; func Foo() { p1.Foo() }; func Bar() { p1.Bar() }`,
-		"p4/p4.go": `package p4; import "p2"; import "p3"; func Foo() { p2.Foo(); p3.Foo(); p3.Bar() }; func Bar() { }`,
+		"testlib/foo.go": `package testlib
+
+import (
+	"os"
+
+	"example.com/dep"
+)
+
+func Direct() int { return os.Getpid() }
+
+func Transitive() int { return dep.Getpid() }
+`,
+		"example.com/dep/dep.go": `package dep
+
+import "os"
+
+func Getpid() int { return os.Getpid() }
+`,
 	}
-	classifier := testClassifier{
-		functions: map[[2]string]cpb.Capability{
-			{"p1", "p1.Foo"}: cpb.Capability_CAPABILITY_FILES,
-			{"p1", "p1.Bar"}: cpb.Capability_CAPABILITY_MODIFY_SYSTEM_STATE,
-			{"p4", "p4.Bar"}: cpb.Capability_CAPABILITY_READ_SYSTEM_STATE,
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	for _, test := range []struct {
+		name   string
+		config Config
+		want   []string
+	}{
+		{"default", Config{}, []string{"testlib.Direct", "testlib.Transitive"}},
+		{"only transitive", Config{OnlyTransitive: true}, []string{"testlib.Transitive"}},
+		{"only direct", Config{OnlyDirect: true}, []string{"testlib.Direct"}},
+	} {
+		config := test.config
+		config.Classifier = interesting.DefaultClassifier()
+		cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &config)
+		if err != nil {
+			t.Fatalf("%s: GetCapabilityInfo: %v", test.name, err)
+		}
+		var got []string
+		for _, ci := range cil.GetCapabilityInfo() {
+			got = append(got, ci.GetPath()[0].GetName())
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s: got paths from %q, want %q", test.name, got, test.want)
+		}
+	}
+	for _, config := range []*Config{
+		{OnlyTransitive: true, OnlyDirect: true},
+		{OnlyTransitive: true, Granularity: GranularityIntermediate},
+	} {
+		config.Classifier = interesting.DefaultClassifier()
+		if _, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, config); err == nil {
+			t.Errorf("GetCapabilityInfo with OnlyTransitive=%v, OnlyDirect=%v and granularity %v: got nil error", config.OnlyTransitive, config.OnlyDirect, config.Granularity)
+		}
+	}
+}
+
+func TestBuildCapabilityTree(t *testing.T) {
+	ci := func(pkg string, c cpb.Capability) *cpb.CapabilityInfo {
+		return &cpb.CapabilityInfo{PackageDir: proto.String(pkg), Capability: c.Enum()}
+	}
+	files := cpb.Capability_CAPABILITY_FILES
+	network := cpb.Capability_CAPABILITY_NETWORK
+	repoFiles := ci("example.com/org/repo", files)
+	pkgFiles := ci("example.com/org/repo/pkg", files)
+	pkgNetwork := ci("example.com/org/repo/pkg", network)
+	other := ci("example.com/other", network)
+	std := ci("os", files)
+	cil := &cpb.CapabilityInfoList{CapabilityInfo: []*cpb.CapabilityInfo{
+		std, pkgFiles, other, repoFiles, pkgNetwork,
+	}}
+	want := &PackageTreeNode{
+		Counts: map[cpb.Capability]int{files: 3, network: 2},
+		Children: []*PackageTreeNode{{
+			Name:   "example.com",
+			Path:   "example.com",
+			Counts: map[cpb.Capability]int{files: 2, network: 2},
+			Children: []*PackageTreeNode{{
+				Name:   "org",
+				Path:   "example.com/org",
+				Counts: map[cpb.Capability]int{files: 2, network: 1},
+				Children: []*PackageTreeNode{{
+					Name:   "repo",
+					Path:   "example.com/org/repo",
+					Counts: map[cpb.Capability]int{files: 2, network: 1},
+					Children: []*PackageTreeNode{{
+						Name:           "pkg",
+						Path:           "example.com/org/repo/pkg",
+						Counts:         map[cpb.Capability]int{files: 1, network: 1},
+						CapabilityInfo: []*cpb.CapabilityInfo{pkgFiles, pkgNetwork},
+					}},
+					CapabilityInfo: []*cpb.CapabilityInfo{repoFiles},
+				}},
+			}, {
+				Name:           "other",
+				Path:           "example.com/other",
+				Counts:         map[cpb.Capability]int{network: 1},
+				CapabilityInfo: []*cpb.CapabilityInfo{other},
+			}},
+		}, {
+			Name:           "os",
+			Path:           "os",
+			Counts:         map[cpb.Capability]int{files: 1},
+			CapabilityInfo: []*cpb.CapabilityInfo{std},
+		}},
+	}
+	if diff := cmp.Diff(want, BuildCapabilityTree(cil), protocmp.Transform()); diff != "" {
+		t.Errorf("BuildCapabilityTree: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestGetEmbedPatterns(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import (
+	"embed"
+
+	_ "example.com/dep"
+)
+
+//go:embed static/*.html "static/a b.txt"
+//go:embed static/index.html
+var content embed.FS
+
+var (
+	//go:embed version.txt
+	version string
+
+	// Not a directive:
+	//go:embedded other.txt
+	other string
+)
+
+func Read() ([]byte, error) { return content.ReadFile("static/index.html") }
+`,
+		"testlib/static/index.html": "<html></html>\n",
+		"testlib/static/a b.txt":    "a b\n",
+		"testlib/version.txt":       "1.0\n",
+		"testlib/quiet/quiet.go": `package quiet
+
+func Quiet() int { return 1 }
+`,
+		"example.com/dep/dep.go": `package dep
+
+import _ "embed"
+
+//go:embed	logo.png
+var Logo []byte
+`,
+		"example.com/dep/logo.png": "png\n",
+	}
+	pkgs, _, cleanup, err := setup(filemap, "testlib/...")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	want := &cpb.EmbedPatternsList{
+		EmbedPatterns: []*cpb.EmbedPatterns{
+			{
+				Package:  proto.String("example.com/dep"),
+				Patterns: []string{"logo.png"},
+			},
+			{
+				Package:  proto.String("testlib"),
+				Patterns: []string{"static/*.html", "static/a b.txt", "static/index.html", "version.txt"},
+			},
 		},
-		ignoredEdges: nil,
 	}
-	pkgs, queriedPackages, cleanup, err := setup(filemap, "p4")
+	if diff := cmp.Diff(want, GetEmbedPatterns(pkgs), protocmp.Transform()); diff != "" {
+		t.Errorf("GetEmbedPatterns: got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestProbeCapability(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import (
+	"os"
+	"example.com/dep"
+)
+
+func Foo() { println(os.Getpid()); dep.Wrap() }
+`,
+		"example.com/dep/dial.go": `package dep
+
+import "net"
+
+func Wrap() { Dial() }
+func Dial() { net.Dial("tcp", "example.com:80") }
+`,
+	}
+	pkgs, _, cleanup, err := setup(filemap, "testlib")
 	if cleanup != nil {
 		defer cleanup()
 	}
 	if err != nil {
 		t.Fatalf("setup: %v", err)
 	}
+	// override marks example.com/dep.Wrap as safe.
+	override := &testClassifier{
+		functions: map[[2]string]cpb.Capability{
+			{"example.com/dep", "example.com/dep.Wrap"}: cpb.Capability_CAPABILITY_SAFE,
+		},
+	}
+	// Classified is checked only for containing the function named by
+	// classified, since it lists every such function in the program.
 	for _, test := range []struct {
-		capabilities string
-		expected     *cpb.CapabilityInfoList
+		c          cpb.Capability
+		classified string
+		want       Probe
 	}{
 		{
-			capabilities: "", // all
-			expected: &cpb.CapabilityInfoList{
-				CapabilityInfo: []*cpb.CapabilityInfo{
-					{
-						PackageName: proto.String("p1"),
-						Capability:  cpb.Capability_CAPABILITY_FILES.Enum(),
-						Path: []*cpb.Function{
-							&cpb.Function{Name: proto.String("p4.Foo"), Package: proto.String("p4")},
-							&cpb.Function{Name: proto.String("p2.Foo"), Package: proto.String("p2")},
-							&cpb.Function{Name: proto.String("p1.Foo"), Package: proto.String("p1")},
-						},
-						PackageDir: proto.String("p1"),
-					},
-					{
-						PackageName: proto.String("p2"),
-						Capability:  cpb.Capability_CAPABILITY_FILES.Enum(),
-						Path: []*cpb.Function{
-							&cpb.Function{Name: proto.String("p4.Foo"), Package: proto.String("p4")},
-							&cpb.Function{Name: proto.String("p2.Foo"), Package: proto.String("p2")},
-							&cpb.Function{Name: proto.String("p1.Foo"), Package: proto.String("p1")},
-						},
-						PackageDir: proto.String("p2"),
-					},
-					{
-						PackageName: proto.String("p3"),
-						Capability:  cpb.Capability_CAPABILITY_FILES.Enum(),
-						Path: []*cpb.Function{
-							&cpb.Function{Name: proto.String("p4.Foo"), Package: proto.String("p4")},
-							&cpb.Function{Name: proto.String("p3.Foo"), Package: proto.String("p3")},
-							&cpb.Function{Name: proto.String("p1.Foo"), Package: proto.String("p1")},
-						},
-						PackageDir: proto.String("p3"),
-					},
-					{
-						PackageName: proto.String("p4"),
-						Capability:  cpb.Capability_CAPABILITY_FILES.Enum(),
-						Path: []*cpb.Function{
-							&cpb.Function{Name: proto.String("p4.Foo"), Package: proto.String("p4")},
-							&cpb.Function{Name: proto.String("p2.Foo"), Package: proto.String("p2")},
-							&cpb.Function{Name: proto.String("p1.Foo"), Package: proto.String("p1")},
-						},
-						PackageDir: proto.String("p4"),
-					},
-					{
-						PackageName: proto.String("p4"),
-						Capability:  cpb.Capability_CAPABILITY_READ_SYSTEM_STATE.Enum(),
-						Path: []*cpb.Function{
-							&cpb.Function{Name: proto.String("p4.Bar"), Package: proto.String("p4")},
-						},
-						PackageDir: proto.String("p4"),
-					},
-					{
-						PackageName: proto.String("p1"),
-						Capability:  cpb.Capability_CAPABILITY_MODIFY_SYSTEM_STATE.Enum(),
-						Path: []*cpb.Function{
-							&cpb.Function{Name: proto.String("p4.Foo"), Package: proto.String("p4")},
-							&cpb.Function{Name: proto.String("p3.Bar"), Package: proto.String("p3")},
-							&cpb.Function{Name: proto.String("p1.Bar"), Package: proto.String("p1")},
-						},
-						PackageDir: proto.String("p1"),
-					},
-					{
-						PackageName: proto.String("p3"),
-						Capability:  cpb.Capability_CAPABILITY_MODIFY_SYSTEM_STATE.Enum(),
-						Path: []*cpb.Function{
-							&cpb.Function{Name: proto.String("p4.Foo"), Package: proto.String("p4")},
-							&cpb.Function{Name: proto.String("p3.Bar"), Package: proto.String("p3")},
-							&cpb.Function{Name: proto.String("p1.Bar"), Package: proto.String("p1")},
-						},
-						PackageDir: proto.String("p3"),
-					},
-					{
-						PackageName: proto.String("p4"),
-						Capability:  cpb.Capability_CAPABILITY_MODIFY_SYSTEM_STATE.Enum(),
-						Path: []*cpb.Function{
-							&cpb.Function{Name: proto.String("p4.Foo"), Package: proto.String("p4")},
-							&cpb.Function{Name: proto.String("p3.Bar"), Package: proto.String("p3")},
-							&cpb.Function{Name: proto.String("p1.Bar"), Package: proto.String("p1")},
-						},
-						PackageDir: proto.String("p4"),
-					},
-				},
+			c:          cpb.Capability_CAPABILITY_READ_SYSTEM_STATE,
+			classified: "os.Getpid",
+			want: Probe{
+				Reachable:                true,
+				ReachableIgnoringPruning: true,
 			},
 		},
 		{
-			capabilities: "READ_SYSTEM_STATE",
-			expected: &cpb.CapabilityInfoList{
-				CapabilityInfo: []*cpb.CapabilityInfo{
-					{
-						PackageName: proto.String("p4"),
-						Capability:  cpb.Capability_CAPABILITY_READ_SYSTEM_STATE.Enum(),
-						Path: []*cpb.Function{
-							&cpb.Function{Name: proto.String("p4.Bar"), Package: proto.String("p4")},
-						},
-						PackageDir: proto.String("p4"),
-					},
-				},
+			c:          cpb.Capability_CAPABILITY_NETWORK_DIAL,
+			classified: "net.Dial",
+			want: Probe{
+				ReachableIgnoringPruning: true,
+				PrunedBy:                 []string{"example.com/dep.Wrap"},
 			},
 		},
+		{
+			c:    cpb.Capability_CAPABILITY_EMBED,
+			want: Probe{},
+		},
 	} {
-		cs, err := NewCapabilitySet(test.capabilities)
-		if err != nil {
-			t.Fatalf("NewCapabilitySet(%q): %v", test.capabilities, err)
-		}
-		cil := GetCapabilityInfo(pkgs, queriedPackages, &Config{
-			Classifier:     &classifier,
+		got, err := ProbeCapability(context.Background(), pkgs, "testlib", test.c, &Config{
+			Classifier:     ChainClassifiers(override, interesting.DefaultClassifier()),
 			DisableBuiltin: true,
-			Granularity:    GranularityIntermediate,
-			CapabilitySet:  cs,
 		})
-		opts := []cmp.Option{
-			protocmp.Transform(),
-			protocmp.SortRepeated(func(a, b *cpb.CapabilityInfo) bool {
-				if u, v := a.GetCapability(), b.GetCapability(); u != v {
-					return u < v
-				}
-				return a.GetPackageDir() < b.GetPackageDir()
-			}),
-			protocmp.IgnoreFields(&cpb.CapabilityInfoList{}, "package_info"),
-			protocmp.IgnoreFields(&cpb.CapabilityInfo{}, "dep_path"),
-			protocmp.IgnoreFields(&cpb.CapabilityInfo{}, "capability_type"),
-			protocmp.IgnoreFields(&cpb.Function{}, "site"),
-			protocmp.IgnoreFields(&cpb.Function_Site{}, "filename"),
-			protocmp.IgnoreFields(&cpb.Function_Site{}, "line"),
-			protocmp.IgnoreFields(&cpb.Function_Site{}, "column"),
+		if err != nil {
+			t.Fatalf("ProbeCapability(%v): %v", test.c, err)
 		}
-		if diff := cmp.Diff(test.expected, cil, opts...); diff != "" {
-			t.Errorf("GetCapabilityInfo: got %v, want %v; diff %s",
-				cil, test.expected, diff)
+		if test.classified == "" && len(got.Classified) != 0 {
+			t.Errorf("ProbeCapability(%v): got Classified %q, want none", test.c, got.Classified)
+		} else if test.classified != "" && !slices.Contains(got.Classified, test.classified) {
+			t.Errorf("ProbeCapability(%v): got Classified %q, want it to contain %q", test.c, got.Classified, test.classified)
+		}
+		got.Classified = nil
+		test.want.Capability, test.want.Package = test.c, "testlib"
+		if diff := cmp.Diff(&test.want, got); diff != "" {
+			t.Errorf("ProbeCapability(%v): got diff (-want +got):\n%s", test.c, diff)
 		}
 	}
 }
 
-func TestAlias(t *testing.T) {
+func TestGetClassifications(t *testing.T) {
 	filemap := map[string]string{
-		"p1/p1.go": `package p1; func Foo() { }; type T struct {}; func (t T) M() { Foo() }`,
-		"p2/p2.go": `package p2; import "p1"; func Foo() { type t = p1.T; m := t.M; m(t{}); }`,
+		"testlib/foo.go": `package testlib
+
+import (
+	"net"
+	"os"
+	"unsafe"
+)
+
+//capslock:capability NETWORK
+func Fetch() {}
+
+func Foo() { println(os.Getpid()); net.Dial("tcp", "example.com:80"); Fetch() }
+
+func Convert(p *int) *int64 { return (*int64)(unsafe.Pointer(p)) }
+`,
 	}
-	classifier := testClassifier{
+	pkgs, _, cleanup, err := setup(filemap, "testlib")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	// override marks os.Getpid as safe.
+	override := &testClassifier{
 		functions: map[[2]string]cpb.Capability{
-			{"p1", "p1.Foo"}: cpb.Capability_CAPABILITY_FILES,
+			{"os", "os.Getpid"}: cpb.Capability_CAPABILITY_SAFE,
 		},
-		ignoredEdges: nil,
 	}
-	pkgs, queriedPackages, cleanup, err := setup(filemap, "p2")
+	cl, err := GetClassifications(pkgs, &Config{
+		Classifier:    ChainClassifiers(override, interesting.DefaultClassifier()),
+		UseDirectives: true,
+	})
+	if err != nil {
+		t.Fatalf("GetClassifications: %v", err)
+	}
+	got := make(map[string]string)
+	for _, c := range cl.GetClassifications() {
+		switch fn := c.GetFunction(); fn {
+		case "os.Getpid", "net.Dial", "testlib.Fetch", "testlib.Convert", "testlib.Foo":
+			got[fn] = c.GetCapability().String() + " " + c.GetSource().String()
+		}
+	}
+	want := map[string]string{
+		"os.Getpid":       "CAPABILITY_SAFE CLASSIFICATION_SOURCE_OVERRIDE",
+		"net.Dial":        "CAPABILITY_NETWORK_DIAL CLASSIFICATION_SOURCE_DEFAULT",
+		"testlib.Fetch":   "CAPABILITY_NETWORK CLASSIFICATION_SOURCE_DIRECTIVE",
+		"testlib.Convert": "CAPABILITY_UNSAFE_POINTER CLASSIFICATION_SOURCE_BUILTIN",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GetClassifications: got diff (-want +got):\n%s", diff)
+	}
+	if !slices.IsSortedFunc(cl.GetClassifications(), func(a, b *cpb.Classification) int {
+		return strings.Compare(a.GetFunction(), b.GetFunction())
+	}) {
+		t.Errorf("GetClassifications: result is not sorted by function")
+	}
+}
+
+func TestQueriedPackagesFromGitDiff(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir, cleanup, err := analysistest.WriteFiles(map[string]string{
+		"m/go.mod":             "module example.com/m\n\ngo 1.21\n",
+		"m/a/a.go":             "package a\n",
+		"m/b/b.go":             "package b\n",
+		"m/c/c.go":             "package c\n",
+		"m/c/testdata/data.go": "package data\n",
+	})
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err != nil {
+		t.Fatalf("analysistest.WriteFiles: %v", err)
+	}
+	t.Setenv("GO111MODULE", "on")
+	t.Setenv("GOPROXY", "off")
+	root := filepath.Join(dir, "src", "m")
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", root, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "base")
+	git("tag", "base")
+	// Change a, add d, and delete the only package file of c.  b is
+	// unchanged, and so is the data file in c's testdata directory, which is
+	// not a package of the module anyway.
+	for name, content := range map[string]string{
+		"a/a.go":             "package a\n\nfunc A() {}\n",
+		"d/d.go":             "package d\n",
+		"c/testdata/data.go": "package data\n\nfunc D() {}\n",
+	} {
+		if err := os.MkdirAll(filepath.Join(root, filepath.Dir(name)), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("rm", "-q", "c/c.go")
+	git("add", ".")
+	git("commit", "-q", "-m", "change")
+
+	got, err := QueriedPackagesFromGitDiff(root, "base")
+	if err != nil {
+		t.Fatalf("QueriedPackagesFromGitDiff: %v", err)
+	}
+	if want := []string{"example.com/m/a", "example.com/m/d"}; !slices.Equal(got, want) {
+		t.Errorf("QueriedPackagesFromGitDiff: got %q, want %q", got, want)
+	}
+	got, err = QueriedPackagesFromGitDiff(root, "HEAD")
+	if err != nil {
+		t.Fatalf("QueriedPackagesFromGitDiff: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("QueriedPackagesFromGitDiff with no changes: got %q, want none", got)
+	}
+	if _, err := QueriedPackagesFromGitDiff(root, "no-such-ref"); err == nil {
+		t.Errorf("QueriedPackagesFromGitDiff with unknown revision: got nil error")
+	}
+}
+
+func TestAnnotateInstantiations(t *testing.T) {
+	filemap := map[string]string{
+		"testlib/foo.go": `package testlib
+
+import (
+	"os"
+	"example.com/list"
+)
+
+type Pid struct{}
+
+func (Pid) Get() string { println(os.Getpid()); return "" }
+
+func Foo() { list.Each([]list.Box[Pid]{{}}) }
+
+func Bar() *int64 { return list.Cast[int64](new(int)) }
+
+func Baz() { println(os.Getpid()) }
+`,
+		"example.com/list/list.go": `package list
+
+import "unsafe"
+
+type Getter interface{ Get() string }
+
+func Each[T Getter](xs []T) {
+	for _, x := range xs {
+		func() { x.Get() }()
+	}
+}
+
+type Box[T Getter] struct{ v T }
+
+func (b Box[T]) Get() string { return b.v.Get() }
+
+func Cast[T any](p *int) *T { return (*T)(unsafe.Pointer(p)) }
+`,
+	}
+	pkgs, queriedPackages, cleanup, err := setup(filemap, "testlib")
 	if cleanup != nil {
 		defer cleanup()
 	}
 	if err != nil {
 		t.Fatalf("setup: %v", err)
 	}
-	expected := &cpb.CapabilityInfoList{
-		CapabilityInfo: []*cpb.CapabilityInfo{
+	cil, err := GetCapabilityInfo(context.Background(), pkgs, queriedPackages, &Config{
+		Classifier:             interesting.DefaultClassifier(),
+		Granularity:            GranularityFunction,
+		AnnotateInstantiations: true,
+	})
+	if err != nil {
+		t.Fatalf("GetCapabilityInfo: %v", err)
+	}
+	got := make(map[string][]*cpb.CapabilityInfo_Instantiation)
+	for _, ci := range cil.GetCapabilityInfo() {
+		got[ci.GetPath()[0].GetName()+" "+ci.GetCapability().String()] = ci.GetInstantiations()
+	}
+	want := map[string][]*cpb.CapabilityInfo_Instantiation{
+		"testlib.Foo CAPABILITY_READ_SYSTEM_STATE": {
 			{
-				PackageName: proto.String("p2"),
-				Capability:  cpb.Capability_CAPABILITY_FILES.Enum(),
-				Path: []*cpb.Function{
-					&cpb.Function{Name: proto.String("p2.Foo"), Package: proto.String("p2")},
-					&cpb.Function{Name: proto.String("(p2.t).M$thunk"), Package: proto.String("p1")},
-					&cpb.Function{Name: proto.String("(p1.T).M"), Package: proto.String("p1")},
-					&cpb.Function{Name: proto.String("p1.Foo"), Package: proto.String("p1")},
-				},
-				PackageDir: proto.String("p2"),
+				Function: proto.String("example.com/list.Each[example.com/list.Box[testlib.Pid]]"),
+				Generic:  proto.String("example.com/list.Each"),
+				TypeArgs: []string{"example.com/list.Box[testlib.Pid]"},
+			},
+			{
+				Function: proto.String("(example.com/list.Box[testlib.Pid]).Get[testlib.Pid]"),
+				Generic:  proto.String("(example.com/list.Box[T]).Get"),
+				TypeArgs: []string{"testlib.Pid"},
 			},
 		},
+		"testlib.Bar CAPABILITY_UNSAFE_POINTER": {
+			{
+				Function:      proto.String("example.com/list.Cast[int64]"),
+				Generic:       proto.String("example.com/list.Cast"),
+				TypeArgs:      []string{"int64"},
+				HasCapability: proto.Bool(true),
+			},
+		},
+		"testlib.Baz CAPABILITY_READ_SYSTEM_STATE":       nil,
+		"(testlib.Pid).Get CAPABILITY_READ_SYSTEM_STATE": nil,
 	}
-
-	cil := GetCapabilityInfo(pkgs, queriedPackages, &Config{
-		Classifier:     &classifier,
-		DisableBuiltin: true,
-	})
-	opts := []cmp.Option{
-		protocmp.Transform(),
-		protocmp.SortRepeated(func(a, b *cpb.CapabilityInfo) bool {
-			if u, v := a.GetCapability(), b.GetCapability(); u != v {
-				return u < v
-			}
-			return a.GetPackageDir() < b.GetPackageDir()
-		}),
-		protocmp.IgnoreFields(&cpb.CapabilityInfoList{}, "package_info"),
-		protocmp.IgnoreFields(&cpb.CapabilityInfo{}, "dep_path"),
-		protocmp.IgnoreFields(&cpb.CapabilityInfo{}, "capability_type"),
-		protocmp.IgnoreFields(&cpb.Function{}, "site"),
-		protocmp.IgnoreFields(&cpb.Function_Site{}, "filename"),
-		protocmp.IgnoreFields(&cpb.Function_Site{}, "line"),
-		protocmp.IgnoreFields(&cpb.Function_Site{}, "column"),
-	}
-	if diff := cmp.Diff(expected, cil, opts...); diff != "" {
-		t.Errorf("GetCapabilityInfo: got %v, want %v; diff %s", cil, expected, diff)
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("GetCapabilityInfo with AnnotateInstantiations: got diff (-want +got):\n%s", diff)
 	}
 }
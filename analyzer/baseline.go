@@ -0,0 +1,109 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	cpb "github.com/google/capslock/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// Baseline is a set of (capability, package) pairs which have been accepted,
+// and which GetCapabilityInfo omits from its output.
+type Baseline struct {
+	entries map[baselineKey]struct{}
+}
+
+type baselineKey struct {
+	capability cpb.Capability
+	packageDir string
+}
+
+// LoadBaseline reads a Baseline from r.  The source argument is used only for
+// providing context to error messages.
+//
+// Each line of the input contains a capability name and a package path,
+// separated by whitespace, e.g.:
+//
+//	CAPABILITY_NETWORK example.com/some/package
+//
+// The "CAPABILITY_" prefix may be omitted.  Text following a '#' character is
+// ignored.
+func LoadBaseline(source string, r io.Reader) (*Baseline, error) {
+	b := &Baseline{entries: make(map[baselineKey]struct{})}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		t, _, _ := strings.Cut(scanner.Text(), "#")
+		args := strings.Fields(t)
+		if len(args) == 0 {
+			continue
+		}
+		if len(args) != 2 {
+			return nil, fmt.Errorf("%v:%v: invalid format", source, line)
+		}
+		c, ok := cpb.Capability_value[args[0]]
+		if !ok {
+			c, ok = cpb.Capability_value["CAPABILITY_"+args[0]]
+		}
+		if !ok {
+			return nil, fmt.Errorf("%v:%v: unsupported capability %q", source, line, args[0])
+		}
+		b.entries[baselineKey{cpb.Capability(c), args[1]}] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%v: %w", source, err)
+	}
+	return b, nil
+}
+
+// suppresses returns true if ci matches an entry of b.
+func (b *Baseline) suppresses(ci *cpb.CapabilityInfo) bool {
+	_, ok := b.entries[baselineKey{ci.GetCapability(), ci.GetPackageDir()}]
+	return ok
+}
+
+// apply removes the entries of cil which match b.  It sets the number of
+// entries removed, and adds each entry of b which matched nothing to the
+// stale entries of cil.
+func (b *Baseline) apply(cil *cpb.CapabilityInfoList) {
+	matched := make(map[baselineKey]struct{})
+	var suppressed int64
+	cil.CapabilityInfo = slices.DeleteFunc(cil.CapabilityInfo, func(ci *cpb.CapabilityInfo) bool {
+		if !b.suppresses(ci) {
+			return false
+		}
+		matched[baselineKey{ci.GetCapability(), ci.GetPackageDir()}] = struct{}{}
+		suppressed++
+		return true
+	})
+	cil.BaselineSuppressedCount = proto.Int64(suppressed)
+	var stale []baselineKey
+	for k := range b.entries {
+		if _, ok := matched[k]; !ok {
+			stale = append(stale, k)
+		}
+	}
+	slices.SortFunc(stale, func(a, b baselineKey) int {
+		if a.capability != b.capability {
+			return int(a.capability) - int(b.capability)
+		}
+		return strings.Compare(a.packageDir, b.packageDir)
+	})
+	for _, k := range stale {
+		cil.StaleBaselineEntry = append(cil.StaleBaselineEntry, &cpb.BaselineEntry{
+			Capability: k.capability.Enum(),
+			PackageDir: proto.String(k.packageDir),
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/google/capslock/interesting"
+	cpb "github.com/google/capslock/proto"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/packages"
+	"google.golang.org/protobuf/proto"
+)
+
+// GetClassifications analyzes the packages in pkgs, and their dependencies,
+// and returns a record of each function in the call graph which was given a
+// capability, including CAPABILITY_SAFE, and where that decision came from:
+//   - CLASSIFICATION_SOURCE_DIRECTIVE, for a function with a directive
+//     comment, when config.UseDirectives is set;
+//   - CLASSIFICATION_SOURCE_DEFAULT, for a function which config.Classifier
+//     classifies as the built-in capability map does;
+//   - CLASSIFICATION_SOURCE_OVERRIDE, for a function which config.Classifier
+//     classifies differently, for example because of a custom capability map;
+//   - CLASSIFICATION_SOURCE_BUILTIN, for a function given a capability by the
+//     analysis of its code, such as a conversion of an unsafe.Pointer.
+//
+// A function whose capability depends on the arguments of each call, such as
+// os.ReadFile, has a record for each capability its calls were given.  The
+// records are sorted by function name and capability.
+func GetClassifications(pkgs []*packages.Package, config *Config) (*cpb.ClassificationList, error) {
+	_, safe, nodesByCapability, extraNodesByCapability, _, _, err := getPackageNodesWithCapability(pkgs, config)
+	if err != nil {
+		return nil, err
+	}
+	var directives map[string]cpb.Capability
+	if config.UseDirectives {
+		if directives, err = functionDirectives(pkgs); err != nil {
+			return nil, err
+		}
+	}
+	defaults := interesting.DefaultClassifier()
+	// source returns where the capability given to v by the classifier came
+	// from.
+	source := func(v *callgraph.Node) cpb.ClassificationSource {
+		pkg, name, _ := functionName(v.Func)
+		if _, ok := directives[name]; ok {
+			return cpb.ClassificationSource_CLASSIFICATION_SOURCE_DIRECTIVE
+		}
+		if defaults.FunctionCategory(pkg, name) == config.Classifier.FunctionCategory(pkg, name) {
+			return cpb.ClassificationSource_CLASSIFICATION_SOURCE_DEFAULT
+		}
+		return cpb.ClassificationSource_CLASSIFICATION_SOURCE_OVERRIDE
+	}
+	cl := new(cpb.ClassificationList)
+	add := func(v *callgraph.Node, c cpb.Capability, s cpb.ClassificationSource) {
+		pkg, _, ok := functionName(v.Func)
+		if !ok {
+			return
+		}
+		cl.Classifications = append(cl.Classifications, &cpb.Classification{
+			Function:   proto.String(v.Func.String()),
+			Package:    proto.String(pkg),
+			Capability: c.Enum(),
+			Source:     s.Enum(),
+		})
+	}
+	explicit := make(nodeset)
+	for v := range safe {
+		add(v, cpb.Capability_CAPABILITY_SAFE, source(v))
+	}
+	for c, nodes := range nodesByCapability {
+		for v := range nodes {
+			add(v, c, source(v))
+			explicit[v] = struct{}{}
+		}
+	}
+	for c, nodes := range extraNodesByCapability {
+		for v := range nodes {
+			// As in mergeCapabilities, the findings of the analysis are ignored
+			// for functions the classifier has already categorized.
+			if _, ok := explicit[v]; !ok {
+				add(v, c, cpb.ClassificationSource_CLASSIFICATION_SOURCE_BUILTIN)
+			}
+		}
+	}
+	slices.SortFunc(cl.Classifications, func(a, b *cpb.Classification) int {
+		if c := cmp.Compare(a.GetFunction(), b.GetFunction()); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.GetCapability(), b.GetCapability())
+	})
+	return cl, nil
+}
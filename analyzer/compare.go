@@ -7,15 +7,20 @@
 package analyzer
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"go/types"
+	"io"
 	"os"
+	"slices"
 	"sort"
 	"text/tabwriter"
 
 	cpb "github.com/google/capslock/proto"
 	"golang.org/x/tools/go/packages"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 )
 
 // Granularity determines the kind of comparison done by compare.
@@ -26,6 +31,7 @@ const (
 	GranularityPackage                         // compare capabilities per package
 	GranularityFunction                        // compare capabilities per function
 	GranularityIntermediate                    // compare capabilities per intermediate package
+	GranularityModule                          // compare capabilities per module
 )
 
 func GranularityFromString(g string) (Granularity, error) {
@@ -38,28 +44,108 @@ func GranularityFromString(g string) (Granularity, error) {
 		return GranularityFunction, nil
 	case "intermediate":
 		return GranularityIntermediate, nil
+	case "module":
+		return GranularityModule, nil
 	default:
 		return 0, fmt.Errorf("unknown granularity: %q", g)
 	}
 }
 
-func compare(baselineFilename string, pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config) (different bool, err error) {
+func compare(ctx context.Context, baselineFilename string, pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config) (different bool, err error) {
 	if config.Granularity == GranularityUnset {
 		config.Granularity = GranularityPackage
 	}
-	compareData, err := os.ReadFile(baselineFilename)
+	baseline, err := readCapabilityInfoFile(baselineFilename)
 	if err != nil {
 		return false, fmt.Errorf("Comparison file should include output from running `%s -output=j`. Error from reading comparison file: %v", programName(), err.Error())
 	}
-	baseline := new(cpb.CapabilityInfoList)
-	err = protojson.Unmarshal(compareData, baseline)
+	if config.Baseline != nil {
+		// The comparison file already records the accepted capabilities, and
+		// entries suppressed by the baseline would be reported as removed.
+		c := *config
+		c.Baseline = nil
+		config = &c
+	}
+	cil, err := GetCapabilityInfo(ctx, pkgs, queriedPackages, config)
 	if err != nil {
-		return false, fmt.Errorf("Comparison file should include output from running `%s -output=j`. Error from parsing comparison file: %v", programName(), err.Error())
+		return false, err
 	}
-	cil := GetCapabilityInfo(pkgs, queriedPackages, config)
 	return diffCapabilityInfoLists(baseline, cil, config.Granularity), nil
 }
 
+// readCapabilityInfoFile reads a CapabilityInfoList from the named file, in
+// the JSON format output with -output=json, or in binary protocol buffer
+// format.  Fields which this version of the schema does not know, such as
+// those in output from other versions of Capslock, are ignored, as are
+// entries whose capability it does not know.
+func readCapabilityInfoFile(filename string) (*cpb.CapabilityInfoList, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	cil := new(cpb.CapabilityInfoList)
+	if t := bytes.TrimSpace(data); len(t) > 0 && t[0] != '{' {
+		err = proto.Unmarshal(data, cil)
+	} else {
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, cil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filename, err)
+	}
+	cil.CapabilityInfo = slices.DeleteFunc(cil.CapabilityInfo, func(ci *cpb.CapabilityInfo) bool {
+		return ci.GetCapability() == cpb.Capability_CAPABILITY_UNSPECIFIED
+	})
+	return cil, nil
+}
+
+// Report is the result of CompareAgainstBaselineFile.
+type Report struct {
+	// Added holds the (capability, key) pairs in the current analysis which
+	// were not in the baseline, each with an example from the current
+	// analysis.
+	Added []*cpb.CapabilityDiff_Entry
+	// Removed holds the (capability, key) pairs in the baseline which are no
+	// longer in the current analysis, each with an example from the baseline.
+	Removed []*cpb.CapabilityDiff_Entry
+	// NewCapabilities lists, in order, the capabilities of the entries in
+	// Added which no entry of the baseline had at all.
+	NewCapabilities []cpb.Capability
+}
+
+// Different returns true if r has any added or removed entries.
+func (r *Report) Different() bool {
+	return len(r.Added) != 0 || len(r.Removed) != 0
+}
+
+// CompareAgainstBaselineFile compares current with the CapabilityInfoList
+// stored in the file baselinePath, at granularity g, as DiffCapabilityInfo
+// does.  The file can hold the output of -output=json, or the same list in
+// binary protocol buffer format.  Baselines written by other versions of
+// Capslock are accepted; fields and capabilities which are not known to this
+// version are ignored.
+//
+// This is meant for checks in continuous integration, for example to report
+// that a new dependency adds capabilities which the code did not have before.
+func CompareAgainstBaselineFile(current *cpb.CapabilityInfoList, baselinePath string, g Granularity) (*Report, error) {
+	baseline, err := readCapabilityInfoFile(baselinePath)
+	if err != nil {
+		return nil, err
+	}
+	d := DiffCapabilityInfo(baseline, current, g)
+	r := &Report{Added: d.GetAdded(), Removed: d.GetRemoved()}
+	old := make(map[cpb.Capability]bool)
+	for _, ci := range baseline.GetCapabilityInfo() {
+		old[ci.GetCapability()] = true
+	}
+	for _, e := range r.Added {
+		if c := e.GetCapability(); !old[c] {
+			old[c] = true
+			r.NewCapabilities = append(r.NewCapabilities, c)
+		}
+	}
+	return r, nil
+}
+
 type mapKey struct {
 	key        string
 	capability cpb.Capability
@@ -72,33 +158,63 @@ type capabilitiesMap map[mapKey]*cpb.CapabilityInfo
 func populateMap(cil *cpb.CapabilityInfoList, g Granularity) capabilitiesMap {
 	m := make(capabilitiesMap)
 	for _, ci := range cil.GetCapabilityInfo() {
-		mk := mapKey{capability: ci.GetCapability()}
-		// The calculation of mk.key depends on the desired granularity.
-		switch g {
-		case GranularityPackage:
-			mk.key = ci.GetPackageDir()
+		for _, mk := range mapKeys(cil, ci, g) {
 			m[mk] = ci
-		case GranularityFunction:
-			if len(ci.Path) == 0 {
-				break
-			}
-			mk.key = ci.Path[0].GetName()
-			if mk.key != "" {
-				m[mk] = ci
-			}
-		case GranularityIntermediate:
-			for _, f := range ci.Path {
-				mk.key = f.GetPackage()
-				if mk.key != "" {
-					m[mk] = ci
-				}
-			}
 		}
 	}
 	return m
 }
 
+// mapKeys returns the keys for ci, an entry in cil, in a capabilitiesMap.
+// The calculation of the keys depends on the desired granularity.
+func mapKeys(cil *cpb.CapabilityInfoList, ci *cpb.CapabilityInfo, g Granularity) []mapKey {
+	var keys []mapKey
+	add := func(key string) {
+		keys = append(keys, mapKey{key: key, capability: ci.GetCapability()})
+	}
+	switch g {
+	case GranularityPackage:
+		add(ci.GetPackageDir())
+	case GranularityFunction:
+		if len(ci.Path) == 0 {
+			break
+		}
+		if key := ci.Path[0].GetName(); key != "" {
+			add(key)
+		}
+	case GranularityModule:
+		if m := ci.GetModulePath(); m != "" {
+			add(m)
+		} else {
+			add(moduleForPackageDir(cil.GetModuleInfo(), ci.GetPackageDir()))
+		}
+	case GranularityIntermediate:
+		for _, f := range ci.Path {
+			if key := f.GetPackage(); key != "" {
+				add(key)
+			}
+		}
+	}
+	return keys
+}
+
 func diffCapabilityInfoLists(baseline, current *cpb.CapabilityInfoList, g Granularity) (different bool) {
+	d := DiffCapabilityInfo(baseline, current, g)
+	WriteCapabilityDiff(os.Stdout, d)
+	return len(d.GetAdded()) != 0 || len(d.GetRemoved()) != 0
+}
+
+// DiffCapabilityInfo compares two CapabilityInfoLists, and returns the
+// (capability, key) pairs which were added, removed, or unchanged in current
+// relative to baseline.  The key is the package, function, or module,
+// depending on g.  Example paths are not compared, so different paths to the
+// same capability do not produce a difference.
+//
+// If g is GranularityUnset, packages are compared.
+func DiffCapabilityInfo(baseline, current *cpb.CapabilityInfoList, g Granularity) *cpb.CapabilityDiff {
+	if g == GranularityUnset {
+		g = GranularityPackage
+	}
 	baselineMap := populateMap(baseline, g)
 	currentMap := populateMap(current, g)
 	var keys []mapKey
@@ -116,39 +232,68 @@ func diffCapabilityInfoLists(baseline, current *cpb.CapabilityInfoList, g Granul
 		}
 		return keys[i].key < keys[j].key
 	})
+	d := new(cpb.CapabilityDiff)
 	for _, key := range keys {
 		ciBaseline, inBaseline := baselineMap[key]
 		ciCurrent, inCurrent := currentMap[key]
-		if !inBaseline && inCurrent {
-			if different {
-				fmt.Println()
-			}
-			different = true
-			fmt.Printf("Package %s has new capability %s compared to the baseline.\n",
-				key.key, key.capability)
-			printCallPath(ciCurrent.Path)
+		e := &cpb.CapabilityDiff_Entry{
+			Key:            proto.String(key.key),
+			Capability:     key.capability.Enum(),
+			CapabilityInfo: ciCurrent,
 		}
-		if inBaseline && !inCurrent {
-			if different {
-				fmt.Println()
-			}
-			different = true
-			fmt.Printf("Package %s no longer has capability %s which was in the baseline.\n",
-				key.key, key.capability)
-			printCallPath(ciBaseline.Path)
+		switch {
+		case inBaseline && inCurrent:
+			d.Unchanged = append(d.Unchanged, e)
+		case inCurrent:
+			d.Added = append(d.Added, e)
+		default:
+			e.CapabilityInfo = ciBaseline
+			d.Removed = append(d.Removed, e)
+		}
+	}
+	return d
+}
+
+// WriteCapabilityDiff writes a human-readable summary of the added and
+// removed entries in d to w, with an example call path for each.
+func WriteCapabilityDiff(w io.Writer, d *cpb.CapabilityDiff) {
+	different := false
+	// Print the entries sorted by capability and key, as they are in d.
+	entries := append(append([]*cpb.CapabilityDiff_Entry(nil), d.GetAdded()...), d.GetRemoved()...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if a, b := entries[i].GetCapability(), entries[j].GetCapability(); a != b {
+			return a < b
+		}
+		return entries[i].GetKey() < entries[j].GetKey()
+	})
+	added := make(map[*cpb.CapabilityDiff_Entry]bool)
+	for _, e := range d.GetAdded() {
+		added[e] = true
+	}
+	for _, e := range entries {
+		if different {
+			fmt.Fprintln(w)
+		}
+		different = true
+		if added[e] {
+			fmt.Fprintf(w, "Package %s has new capability %s compared to the baseline.\n",
+				e.GetKey(), e.GetCapability())
+		} else {
+			fmt.Fprintf(w, "Package %s no longer has capability %s which was in the baseline.\n",
+				e.GetKey(), e.GetCapability())
 		}
+		printCallPath(w, e.GetCapabilityInfo().GetPath())
 	}
-	return different
 }
 
-func printCallPath(fns []*cpb.Function) {
+func printCallPath(w io.Writer, fns []*cpb.Function) {
 	tw := tabwriter.NewWriter(
-		os.Stdout, // output
-		10,        // minwidth
-		8,         // tabwidth
-		2,         // padding
-		' ',       // padchar
-		0)         // flags
+		w,   // output
+		10,  // minwidth
+		8,   // tabwidth
+		2,   // padding
+		' ', // padchar
+		0)   // flags
 	for _, f := range fns {
 		if f.Site != nil {
 			fmt.Fprint(tw, f.Site.GetFilename(), ":", f.Site.GetLine(), ":", f.Site.GetColumn())
@@ -0,0 +1,57 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+
+	cpb "github.com/google/capslock/proto"
+)
+
+// WriteCountsCSV writes the capability counts in cl to w as CSV, with a
+// header row followed by one "capability,count" row for each capability,
+// sorted by capability name.
+func WriteCountsCSV(w io.Writer, cl *cpb.CapabilityCountList) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"capability", "count"})
+	var caps []string
+	for c := range cl.GetCapabilityCounts() {
+		caps = append(caps, c)
+	}
+	sort.Strings(caps)
+	for _, c := range caps {
+		cw.Write([]string{c, strconv.FormatInt(cl.GetCapabilityCounts()[c], 10)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteStatsCSV writes the capability statistics in sl to w as CSV, with a
+// header row followed by one "capability,count,direct,transitive,severity"
+// row for each capability, sorted by capability name.
+func WriteStatsCSV(w io.Writer, sl *cpb.CapabilityStatList) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"capability", "count", "direct", "transitive", "severity"})
+	stats := append([]*cpb.CapabilityStats(nil), sl.GetCapabilityStats()...)
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].GetCapability().String() < stats[j].GetCapability().String()
+	})
+	for _, s := range stats {
+		cw.Write([]string{
+			s.GetCapability().String(),
+			strconv.FormatInt(s.GetCount(), 10),
+			strconv.FormatInt(s.GetDirectCount(), 10),
+			strconv.FormatInt(s.GetTransitiveCount(), 10),
+			strconv.Itoa(int(s.GetSeverity())),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
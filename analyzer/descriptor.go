@@ -0,0 +1,38 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"io"
+
+	cpb "github.com/google/capslock/proto"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// DescriptorSet returns a FileDescriptorSet describing the capslock.proto
+// package, whose messages, such as CapabilityInfoList, are the schema of
+// capslock's json and jsonl output.
+func DescriptorSet() *descriptorpb.FileDescriptorSet {
+	return &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{
+			protodesc.ToFileDescriptorProto(cpb.File_capability_proto),
+		},
+	}
+}
+
+// WriteDescriptorSet writes the result of DescriptorSet to w in the binary
+// protocol buffer format, as produced by "protoc --descriptor_set_out".
+func WriteDescriptorSet(w io.Writer) error {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(DescriptorSet())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
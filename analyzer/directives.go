@@ -0,0 +1,110 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+
+	cpb "github.com/google/capslock/proto"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/packages"
+)
+
+// directivePrefix begins the comments which classify the function they
+// document.  See Config.UseDirectives.
+const directivePrefix = "//capslock:"
+
+// functionDirectives returns the capabilities given by directive comments to
+// the functions and methods declared in pkgs, keyed by function name in the
+// form used by Classifier.FunctionCategory.  The dependencies of pkgs are not
+// examined.  It returns an error for a malformed directive, or for a
+// function with directives giving it different capabilities.
+func functionDirectives(pkgs []*packages.Package) (map[string]cpb.Capability, error) {
+	directives := make(map[string]cpb.Capability)
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Syntax {
+			for _, decl := range file.Decls {
+				fd, ok := decl.(*ast.FuncDecl)
+				if !ok || fd.Doc == nil {
+					continue
+				}
+				fn, ok := pkg.TypesInfo.Defs[fd.Name].(*types.Func)
+				if !ok {
+					continue
+				}
+				name := fn.FullName()
+				for _, c := range fd.Doc.List {
+					text, ok := strings.CutPrefix(c.Text, directivePrefix)
+					if !ok {
+						continue
+					}
+					capability, err := parseDirective(text)
+					if err != nil {
+						return nil, fmt.Errorf("%v: %w", pkg.Fset.Position(c.Pos()), err)
+					}
+					if prev, ok := directives[name]; ok && prev != capability {
+						return nil, fmt.Errorf("%v: directive for %v conflicts with an earlier one giving it %v",
+							pkg.Fset.Position(c.Pos()), name, prev)
+					}
+					directives[name] = capability
+				}
+			}
+		}
+	}
+	return directives, nil
+}
+
+// parseDirective returns the capability given by a directive, whose text
+// after directivePrefix is text: either "safe", or "capability" followed by
+// a capability name, with or without its "CAPABILITY_" prefix.
+func parseDirective(text string) (cpb.Capability, error) {
+	args := strings.Fields(text)
+	switch {
+	case len(args) == 1 && args[0] == "safe":
+		return cpb.Capability_CAPABILITY_SAFE, nil
+	case len(args) == 2 && args[0] == "capability":
+		c, ok := cpb.Capability_value[args[1]]
+		if !ok {
+			c, ok = cpb.Capability_value["CAPABILITY_"+args[1]]
+		}
+		if !ok || c == int32(cpb.Capability_CAPABILITY_UNSPECIFIED) {
+			return 0, fmt.Errorf("unsupported capability %q in directive", args[1])
+		}
+		return cpb.Capability(c), nil
+	}
+	return 0, fmt.Errorf("invalid directive %q", directivePrefix+text)
+}
+
+// directiveClassifier is a Classifier which gives the functions in
+// directives their capabilities from there, instead of from the underlying
+// Classifier.
+type directiveClassifier struct {
+	wrappedClassifier
+	directives map[string]cpb.Capability
+}
+
+func (d directiveClassifier) FunctionCategory(pkg string, name string) cpb.Capability {
+	if c, ok := d.directives[name]; ok {
+		return c
+	}
+	return d.Classifier.FunctionCategory(pkg, name)
+}
+
+// callCategory returns the category of the call from the underlying
+// Classifier, unless the callee has a directive, which applies to all its
+// calls.
+func (d directiveClassifier) callCategory(edge *callgraph.Edge) cpb.Capability {
+	if edge.Callee.Func != nil {
+		if _, ok := d.directives[edge.Callee.Func.String()]; ok {
+			return cpb.Capability_CAPABILITY_UNSPECIFIED
+		}
+	}
+	return callCategory(d.Classifier, edge)
+}
@@ -0,0 +1,92 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"go/ast"
+	"slices"
+	"strconv"
+	"strings"
+
+	cpb "github.com/google/capslock/proto"
+	"golang.org/x/tools/go/packages"
+	"google.golang.org/protobuf/proto"
+)
+
+// embedDirectivePrefix begins the comments which embed files in the variable
+// they document.
+const embedDirectivePrefix = "//go:embed"
+
+// GetEmbedPatterns returns the patterns in the //go:embed directives of pkgs
+// and their dependencies, for each package with at least one directive,
+// sorted by package path.  The files matching the patterns are embedded in
+// the binary when it is built, whether or not the variables holding them are
+// used.
+func GetEmbedPatterns(pkgs []*packages.Package) *cpb.EmbedPatternsList {
+	out := new(cpb.EmbedPatternsList)
+	forEachPackageIncludingDependencies(pkgs, func(pkg *packages.Package) {
+		var patterns []string
+		for _, file := range pkg.Syntax {
+			for _, decl := range file.Decls {
+				gd, ok := decl.(*ast.GenDecl)
+				if !ok {
+					continue
+				}
+				patterns = append(patterns, embedDirectivePatterns(gd.Doc)...)
+				for _, spec := range gd.Specs {
+					if vs, ok := spec.(*ast.ValueSpec); ok {
+						patterns = append(patterns, embedDirectivePatterns(vs.Doc)...)
+					}
+				}
+			}
+		}
+		if len(patterns) == 0 {
+			return
+		}
+		slices.Sort(patterns)
+		out.EmbedPatterns = append(out.EmbedPatterns, &cpb.EmbedPatterns{
+			Package:  proto.String(pkg.PkgPath),
+			Patterns: slices.Compact(patterns),
+		})
+	})
+	slices.SortFunc(out.EmbedPatterns, func(a, b *cpb.EmbedPatterns) int {
+		return strings.Compare(a.GetPackage(), b.GetPackage())
+	})
+	return out
+}
+
+// embedDirectivePatterns returns the patterns in the //go:embed directives in
+// doc.  Patterns are separated by spaces or tabs, and can be quoted as Go string
+// literals if they contain spaces.  A quoted pattern which can't be unquoted
+// is returned as it is.
+func embedDirectivePatterns(doc *ast.CommentGroup) []string {
+	if doc == nil {
+		return nil
+	}
+	var patterns []string
+	for _, c := range doc.List {
+		text, ok := strings.CutPrefix(c.Text, embedDirectivePrefix)
+		if !ok || (text != "" && text[0] != ' ' && text[0] != '\t') {
+			continue
+		}
+		for text = strings.TrimSpace(text); text != ""; text = strings.TrimSpace(text) {
+			var pattern string
+			if q, err := strconv.QuotedPrefix(text); err == nil {
+				pattern, text = q, text[len(q):]
+				if p, err := strconv.Unquote(q); err == nil {
+					pattern = p
+				}
+			} else if i := strings.IndexAny(text, " \t"); i >= 0 {
+				pattern, text = text[:i], text[i:]
+			} else {
+				pattern, text = text, ""
+			}
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
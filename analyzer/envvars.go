@@ -0,0 +1,345 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"context"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"sort"
+
+	cpb "github.com/google/capslock/proto"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"google.golang.org/protobuf/proto"
+)
+
+// dynamicEnvVar is used in place of the name of an environment variable when
+// the name is not a constant, or when the whole environment is read.
+const dynamicEnvVar = "=DYNAMIC="
+
+// envVarReaders lists the functions which read environment variables.  The
+// value is true for functions whose first argument is the name of the
+// variable, and false for functions which read the whole environment.
+var envVarReaders = map[string]bool{
+	"os.Environ":      false,
+	"os.Getenv":       true,
+	"os.LookupEnv":    true,
+	"syscall.Environ": false,
+	"syscall.Getenv":  true,
+}
+
+// envVarNames returns the names of the environment variables read by a call
+// to one of the functions in envVarReaders.  For a function which reads the
+// whole environment, these are the names matched against the entries of the
+// result by environNames, if any.  Otherwise, and for names which are not
+// constants, the result is dynamicEnvVar.
+func envVarNames(call ssa.CallInstruction, takesName bool) []string {
+	if !takesName {
+		if v := call.Value(); v != nil {
+			if names := environNames(v); len(names) > 0 {
+				return names
+			}
+		}
+		return []string{dynamicEnvVar}
+	}
+	if args := call.Common().Args; len(args) > 0 {
+		if s, ok := stringConst(args[0]); ok {
+			return []string{s}
+		}
+	}
+	return []string{dynamicEnvVar}
+}
+
+// stringConst returns the value of v if it is a string constant.
+func stringConst(v ssa.Value) (string, bool) {
+	c, ok := v.(*ssa.Const)
+	if !ok || c.Value == nil || c.Value.Kind() != constant.String {
+		return "", false
+	}
+	return constant.StringVal(c.Value), true
+}
+
+// environNames returns the names of the variables looked for in env, the
+// result of a call to os.Environ or syscall.Environ, by a loop over its
+// entries.  An entry compared with strings.HasPrefix or strings.CutPrefix
+// gives the prefix followed by "*", as in "MYAPP_*".  An entry split at "="
+// with strings.Split, strings.SplitN or strings.Cut gives the constant its
+// key is compared with, or the prefix the key is matched against.
+func environNames(env ssa.Value) []string {
+	var names []string
+	for _, entry := range sliceElements(env) {
+		names = append(names, prefixMatches(entry)...)
+		for _, key := range entryKeys(entry) {
+			names = append(names, prefixMatches(key)...)
+			for _, ref := range *key.Referrers() {
+				if op, ok := ref.(*ssa.BinOp); ok && op.Op == token.EQL {
+					if s, ok := stringConst(otherOperand(op, key)); ok {
+						names = append(names, s)
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+// sliceElements returns the values loaded from the elements of s with a
+// constant or variable index, as in the body of a range loop over s.
+// If an index is given, only elements with that constant index are returned.
+func sliceElements(s ssa.Value, index ...int64) []ssa.Value {
+	var elems []ssa.Value
+	refs := s.Referrers()
+	if refs == nil {
+		return nil
+	}
+	for _, ref := range *refs {
+		addr, ok := ref.(*ssa.IndexAddr)
+		if !ok || addr.X != s {
+			continue
+		}
+		if len(index) > 0 {
+			c, ok := addr.Index.(*ssa.Const)
+			if !ok || c.Int64() != index[0] {
+				continue
+			}
+		}
+		for _, ref := range *addr.Referrers() {
+			if load, ok := ref.(*ssa.UnOp); ok && load.Op == token.MUL {
+				elems = append(elems, load)
+			}
+		}
+	}
+	return elems
+}
+
+// stringsCalls returns the calls to functions in the strings package with the
+// given names which have v as their first argument.
+func stringsCalls(v ssa.Value, names ...string) []*ssa.Call {
+	var calls []*ssa.Call
+	refs := v.Referrers()
+	if refs == nil {
+		return nil
+	}
+	for _, ref := range *refs {
+		call, ok := ref.(*ssa.Call)
+		if !ok || len(call.Call.Args) < 2 || call.Call.Args[0] != v {
+			continue
+		}
+		callee := call.Call.StaticCallee()
+		if callee == nil || callee.Pkg == nil || callee.Pkg.Pkg.Path() != "strings" {
+			continue
+		}
+		for _, name := range names {
+			if callee.Name() == name {
+				calls = append(calls, call)
+				break
+			}
+		}
+	}
+	return calls
+}
+
+// prefixMatches returns the constant prefixes which v is matched against with
+// strings.HasPrefix or strings.CutPrefix, each followed by "*".
+func prefixMatches(v ssa.Value) []string {
+	var names []string
+	for _, call := range stringsCalls(v, "HasPrefix", "CutPrefix") {
+		if s, ok := stringConst(call.Call.Args[1]); ok {
+			names = append(names, s+"*")
+		}
+	}
+	return names
+}
+
+// entryKeys returns the values holding the part of an environment entry
+// before the first "=", when the entry is split with strings.Split,
+// strings.SplitN or strings.Cut.
+func entryKeys(entry ssa.Value) []ssa.Value {
+	var keys []ssa.Value
+	for _, call := range stringsCalls(entry, "Split", "SplitN", "Cut") {
+		if sep, ok := stringConst(call.Call.Args[1]); !ok || sep != "=" {
+			continue
+		}
+		if call.Call.StaticCallee().Name() != "Cut" {
+			keys = append(keys, sliceElements(call, 0)...)
+			continue
+		}
+		for _, ref := range *call.Referrers() {
+			if ex, ok := ref.(*ssa.Extract); ok && ex.Index == 0 {
+				keys = append(keys, ex)
+			}
+		}
+	}
+	return keys
+}
+
+// otherOperand returns the operand of op which is not v.
+func otherOperand(op *ssa.BinOp, v ssa.Value) ssa.Value {
+	if op.X == v {
+		return op.Y
+	}
+	return op.X
+}
+
+// forwardsParam returns true if f has a single parameter, which is arg, so
+// that a call of f with a name passes the name on as arg.
+func forwardsParam(f *ssa.Function, arg ssa.Value) bool {
+	return f != nil && f.Signature.Recv() == nil && len(f.Params) == 1 && arg == f.Params[0]
+}
+
+// addForwardedReads records the reads of environment variables by the
+// callers of node, a wrapper which passes its only parameter on as the name
+// of a variable to read, as in
+//
+//	func cfg(k string) string { return os.Getenv(k) }
+//
+// A caller which passes a constant reads the variable with that name, and
+// one which passes on its own only parameter is a wrapper too.  Other callers
+// read dynamicEnvVar.  If node has no callers, the names it is called with
+// are unknown, so it reads dynamicEnvVar itself.
+func addForwardedReads(reads map[string]nodeset, node *callgraph.Node, seen map[*callgraph.Node]bool) {
+	if seen[node] {
+		return
+	}
+	seen[node] = true
+	add := func(name string, n *callgraph.Node) {
+		if reads[name] == nil {
+			reads[name] = make(nodeset)
+		}
+		reads[name][n] = struct{}{}
+	}
+	callers := 0
+	for _, e := range node.In {
+		if e.Site == nil || len(e.Site.Common().Args) != 1 {
+			continue
+		}
+		callers++
+		arg := e.Site.Common().Args[0]
+		if s, ok := stringConst(arg); ok {
+			add(s, e.Caller)
+		} else if forwardsParam(e.Caller.Func, arg) {
+			addForwardedReads(reads, e.Caller, seen)
+		} else {
+			add(dynamicEnvVar, e.Caller)
+		}
+	}
+	if callers == 0 {
+		add(dynamicEnvVar, node)
+	}
+}
+
+// findEnvVarReads returns the nodes of the functions in allFunctions which
+// call a function in envVarReaders, grouped by the name of the variable read.
+// Calls made by the functions in envVarReaders themselves are not included.
+// For a function which only forwards its parameter to one of them, the reads
+// are those of its callers instead; see addForwardedReads.
+func findEnvVarReads(graph *callgraph.Graph, allFunctions map[*ssa.Function]bool) map[string]nodeset {
+	reads := make(map[string]nodeset)
+	forwarded := make(map[*callgraph.Node]bool)
+	for f := range allFunctions {
+		if _, ok := envVarReaders[f.String()]; ok {
+			continue
+		}
+		node, ok := graph.Nodes[f]
+		if !ok {
+			continue
+		}
+		for _, b := range f.Blocks {
+			for _, i := range b.Instrs {
+				call, ok := i.(ssa.CallInstruction)
+				if !ok {
+					continue
+				}
+				callee := call.Common().StaticCallee()
+				if callee == nil {
+					continue
+				}
+				takesName, ok := envVarReaders[callee.String()]
+				if !ok {
+					continue
+				}
+				if args := call.Common().Args; takesName && len(args) > 0 && forwardsParam(f, args[0]) {
+					addForwardedReads(reads, node, forwarded)
+					continue
+				}
+				for _, name := range envVarNames(call, takesName) {
+					if reads[name] == nil {
+						reads[name] = make(nodeset)
+					}
+					reads[name][node] = struct{}{}
+				}
+			}
+		}
+	}
+	return reads
+}
+
+// GetReachableEnvVars returns, for each of the queried packages, the names of
+// the environment variables which may be read by functions in that package,
+// either directly or through a path in the callgraph.  Paths are found in the
+// same way as paths to capabilities; for example, they do not pass through
+// functions which the classifier has categorized.
+func GetReachableEnvVars(ctx context.Context, pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config) (*cpb.ReachableEnvVarsList, error) {
+	if err := checkPackages(pkgs, config); err != nil {
+		return nil, err
+	}
+	config = pruneCalls(pkgs, config)
+	queriedPackages = queriedPackagesToReport(pkgs, queriedPackages, config)
+	graph, _, allFunctions := buildGraph(pkgs, false, config)
+	safe, nodesByCapability, callCapabilities := getNodeCapabilities(graph, config.Classifier)
+	_, allNodesWithExplicitCapability := mergeCapabilities(nodesByCapability, nil)
+	reads := findEnvVarReads(graph, allFunctions)
+	var names []string
+	for name := range reads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	varsPerPackage := make(map[*types.Package][]string)
+	for _, name := range names {
+		// The search treats the functions which read the variable as if they had
+		// the capability CAPABILITY_READ_ENVIRONMENT, which is the capability of
+		// the functions in envVarReaders.
+		bfs, err := searchBackwardsFromCapabilities(ctx,
+			nodesetPerCapability{cpb.Capability_CAPABILITY_READ_ENVIRONMENT: reads[name]},
+			callCapabilities, safe, allNodesWithExplicitCapability, config.Classifier)
+		if err != nil {
+			return nil, err
+		}
+		found := make(map[*types.Package]struct{})
+		for _, v := range bfs.nodes {
+			pkg := nodeToPackage(v)
+			if pkg == nil {
+				continue
+			}
+			if _, ok := queriedPackages[pkg]; !ok {
+				continue
+			}
+			if _, ok := found[pkg]; ok {
+				continue
+			}
+			found[pkg] = struct{}{}
+			// names is sorted, so each package's list of names is sorted too.
+			varsPerPackage[pkg] = append(varsPerPackage[pkg], name)
+		}
+	}
+	var queried []*types.Package
+	for pkg := range queriedPackages {
+		queried = append(queried, pkg)
+	}
+	sort.Slice(queried, func(i, j int) bool { return queried[i].Path() < queried[j].Path() })
+	out := new(cpb.ReachableEnvVarsList)
+	for _, pkg := range queried {
+		out.ReachableEnvVars = append(out.ReachableEnvVars, &cpb.ReachableEnvVars{
+			Package:  proto.String(pkg.Path()),
+			VarNames: varsPerPackage[pkg],
+		})
+	}
+	return out, nil
+}
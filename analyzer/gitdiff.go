@@ -0,0 +1,75 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// QueriedPackagesFromGitDiff returns the import paths, sorted, of the packages
+// with a .go file that differs between the git revision baseRef and the
+// working tree of the repository containing repoRoot.  Only files beneath
+// repoRoot are considered, and the packages are found as the go command in
+// repoRoot sees them, so repoRoot is usually the root directory of a module.
+//
+// The result is meant for checking a change quickly: passing it to
+// LoadPackages loads the changed packages, and everything they depend on, so
+// that the capabilities found for them are complete, while the packages
+// whose capabilities are reported are only the changed ones.
+//
+// Directories which no longer contain a package, such as those whose files
+// were all deleted, and testdata directories, are skipped, as are files which
+// git does not track yet.  The result is empty if no package changed.
+func QueriedPackagesFromGitDiff(repoRoot, baseRef string) ([]string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", "-C", repoRoot, "diff", "--name-only", "-z", "--relative", baseRef, "--")
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("listing files changed since %s: %w: %s", baseRef, err, strings.TrimSpace(stderr.String()))
+	}
+	var patterns []string
+	for _, name := range strings.Split(stdout.String(), "\x00") {
+		if !strings.HasSuffix(name, ".go") {
+			continue
+		}
+		dir := path.Dir(name)
+		if slices.Contains(strings.Split(dir, "/"), "testdata") {
+			continue
+		}
+		if fi, err := os.Stat(filepath.Join(repoRoot, filepath.FromSlash(dir))); err != nil || !fi.IsDir() {
+			continue
+		}
+		patterns = append(patterns, "./"+dir)
+	}
+	slices.Sort(patterns)
+	patterns = slices.Compact(patterns)
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	pkgs, err := packages.Load(&packages.Config{Mode: packages.NeedName | packages.NeedFiles, Dir: repoRoot}, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, p := range pkgs {
+		if slices.ContainsFunc(p.Errors, func(e packages.Error) bool { return e.Kind == packages.ListError }) {
+			continue
+		}
+		paths = append(paths, p.PkgPath)
+	}
+	slices.Sort(paths)
+	return slices.Compact(paths), nil
+}
@@ -8,10 +8,14 @@ package analyzer
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"go/types"
 	"io"
+	"maps"
 	"os"
+	"path"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -36,12 +40,28 @@ func (cs *CapabilitySet) Has(c cpb.Capability) bool {
 	return ok != cs.negated
 }
 
+// subCapabilities maps combined capabilities to the finer-grained
+// capabilities they contain.
+var subCapabilities = map[cpb.Capability][]cpb.Capability{
+	cpb.Capability_CAPABILITY_FILES: {
+		cpb.Capability_CAPABILITY_FILES_READ,
+		cpb.Capability_CAPABILITY_FILES_WRITE,
+	},
+	cpb.Capability_CAPABILITY_NETWORK: {
+		cpb.Capability_CAPABILITY_NETWORK_DIAL,
+		cpb.Capability_CAPABILITY_NETWORK_LISTEN,
+		cpb.Capability_CAPABILITY_NETWORK_DNS,
+	},
+}
+
 // NewCapabilitySet returns a *CapabilitySet parsed from a string.
 //
 // If cs is empty, a nil *CapabilitySet is returned, which represents the set
 // of all capabilities.  Otherwise, cs should be a comma-separated list of
 // capabilities.  Optionally, all capabilities can be prefixed with '-' to
-// specify the capabilities to exclude from the set.
+// specify the capabilities to exclude from the set.  A combined capability,
+// such as FILES, also includes the capabilities it contains, such as
+// FILES_READ and FILES_WRITE.
 func NewCapabilitySet(cs string) (*CapabilitySet, error) {
 	if len(cs) == 0 {
 		return nil, nil
@@ -68,71 +88,246 @@ func NewCapabilitySet(cs string) (*CapabilitySet, error) {
 			return nil, fmt.Errorf("unknown capability %q", s)
 		}
 		out[cpb.Capability(c)] = struct{}{}
+		for _, sub := range subCapabilities[cpb.Capability(c)] {
+			out[sub] = struct{}{}
+		}
 	}
 	return &CapabilitySet{out, negated}, nil
 }
 
-func graphOutput(pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config) error {
+// ParseCapabilitySet returns a *CapabilitySet parsed from spec, which is a
+// comma-separated list of capability names, applied from left to right.  A
+// name adds its capabilities to the set, and a name prefixed with '-' removes
+// them.  The name "all" stands for every capability, so "all,-REFLECT" is
+// every capability except CAPABILITY_REFLECT.  If the first name is negated,
+// the set starts with every capability.  As in NewCapabilitySet, the
+// "CAPABILITY_" prefix is optional, and a combined capability also includes
+// the capabilities it contains.  A name can be a glob pattern in the syntax
+// of path.Match, such as "NETWORK_*", which must match at least one
+// capability.
+//
+// If spec is empty, a nil *CapabilitySet is returned, which represents the
+// set of all capabilities.  Unknown names are an error.
+func ParseCapabilitySet(spec string) (*CapabilitySet, error) {
+	if len(spec) == 0 {
+		return nil, nil
+	}
+	// The set is represented as in CapabilitySet: if negated is true, it
+	// contains the capabilities not in out.
+	out := make(map[cpb.Capability]struct{})
+	negated := false
+	for i, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		neg := strings.HasPrefix(s, "-")
+		if neg {
+			s = s[1:]
+		}
+		if len(s) == 0 {
+			return nil, fmt.Errorf("empty capability in list: %q", spec)
+		}
+		if i == 0 && neg {
+			negated = true
+		}
+		if s == "all" {
+			clear(out)
+			negated = !neg
+			continue
+		}
+		caps, err := matchCapabilities(s)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range caps {
+			for _, c := range append([]cpb.Capability{c}, subCapabilities[c]...) {
+				if neg == negated {
+					out[c] = struct{}{}
+				} else {
+					delete(out, c)
+				}
+			}
+		}
+	}
+	return &CapabilitySet{out, negated}, nil
+}
+
+// matchCapabilities returns the capabilities named by s, which is a
+// capability name or glob pattern, with or without the "CAPABILITY_" prefix.
+func matchCapabilities(s string) ([]cpb.Capability, error) {
+	if c, ok := cpb.Capability_value[s]; ok {
+		return []cpb.Capability{cpb.Capability(c)}, nil
+	}
+	if c, ok := cpb.Capability_value["CAPABILITY_"+s]; ok {
+		return []cpb.Capability{cpb.Capability(c)}, nil
+	}
+	if _, err := path.Match(s, ""); err != nil || !strings.ContainsAny(s, "*?[") {
+		return nil, fmt.Errorf("unknown capability %q", s)
+	}
+	var caps []cpb.Capability
+	for name, c := range cpb.Capability_value {
+		if ok, _ := path.Match(s, name); ok {
+			caps = append(caps, cpb.Capability(c))
+		} else if ok, _ := path.Match(s, strings.TrimPrefix(name, "CAPABILITY_")); ok {
+			caps = append(caps, cpb.Capability(c))
+		}
+	}
+	if len(caps) == 0 {
+		return nil, fmt.Errorf("capability pattern %q matches no capabilities", s)
+	}
+	return caps, nil
+}
+
+func graphOutput(ctx context.Context, pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config) error {
+	w := bufio.NewWriterSize(os.Stdout, 1<<20)
+	if err := WriteDOT(ctx, w, pkgs, queriedPackages, config); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func graphMLOutput(ctx context.Context, pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config) error {
 	w := bufio.NewWriterSize(os.Stdout, 1<<20)
+	if err := WriteGraphML(ctx, w, pkgs, queriedPackages, config); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// WriteDOT writes the graph produced by CapabilityGraph to w in the Graphviz
+// DOT language.
+//
+// Nodes are identified by function name, or by capability name for
+// capabilities, so that the output is stable across runs.  Capability nodes
+// are drawn in red, and functions in queriedPackages are drawn filled, to mark
+// them as entry points.  Each edge is written once, as it is found, and node
+// attributes are written at the end in sorted order.
+//
+// If config.CapabilitySet is non-nil, only paths to capabilities in the set
+// are included.  If the analysis fails, part of the graph may already have
+// been written to w.
+func WriteDOT(ctx context.Context, w io.Writer, pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config) error {
 	gb := newGraphBuilder(w, func(v interface{}) string {
 		switch v := v.(type) {
 		case *callgraph.Node:
-			if v.Func != nil {
-				return v.Func.String()
-			}
-			return strconv.Itoa(v.ID)
+			return graphNodeName(v)
 		case cpb.Capability:
 			return v.String()
 		default:
 			panic("unexpected node type")
 		}
 	})
+	node := func(_ *bfsStateMap, v *callgraph.Node, _ *bfsStateMap) {
+		if v.Func == nil || v.Func.Package() == nil {
+			return
+		}
+		if _, ok := queriedPackages[v.Func.Package().Pkg]; ok {
+			gb.Node(v, `style=filled, fillcolor=lightblue`)
+		}
+	}
 	callEdge := func(edge *callgraph.Edge) {
 		gb.Edge(edge.Caller, edge.Callee)
 	}
 	capabilityEdge := func(fn *callgraph.Node, c cpb.Capability) {
+		gb.Node(c, `shape=box, color=red, fontcolor=red`)
 		gb.Edge(fn, c)
 	}
 	var filter func(c cpb.Capability) bool
 	if config.CapabilitySet != nil {
 		filter = config.CapabilitySet.Has
 	}
-	CapabilityGraph(pkgs, queriedPackages, config, nil, callEdge, capabilityEdge, filter)
-	gb.Done()
-	return w.Flush()
+	if err := CapabilityGraph(ctx, pkgs, queriedPackages, config, node, callEdge, capabilityEdge, filter); err != nil {
+		return err
+	}
+	return gb.Done()
+}
+
+// graphNodeName returns the name used to identify v in a graph written by
+// WriteDOT or WriteGraphML: the name of its function, or its ID if it has no
+// function.
+func graphNodeName(v *callgraph.Node) string {
+	if v.Func != nil {
+		return v.Func.String()
+	}
+	return strconv.Itoa(v.ID)
 }
 
+// graphBuilder writes the edges of a graph in DOT format as they are added,
+// and the attributes of its nodes when Done is called.  Edges are
+// deduplicated by the identity of their endpoints, so their names are not
+// kept in memory.
 type graphBuilder struct {
 	io.Writer
 	nodeNamer func(any) string
+	nodeAttrs map[any]string
+	edges     map[[2]any]struct{}
+	started   bool
 	done      bool
+	err       error
 }
 
-func newGraphBuilder(w io.Writer, nodeNamer func(any) string) graphBuilder {
-	gb := graphBuilder{
+func newGraphBuilder(w io.Writer, nodeNamer func(any) string) *graphBuilder {
+	return &graphBuilder{
 		Writer:    w,
 		nodeNamer: nodeNamer,
+		nodeAttrs: make(map[any]string),
+		edges:     make(map[[2]any]struct{}),
 	}
-	gb.Write([]byte("digraph {\n"))
-	return gb
 }
 
+// Node sets the attributes of a node, in DOT syntax.
+func (gb *graphBuilder) Node(v interface{}, attrs string) {
+	if gb.done {
+		panic("done")
+	}
+	gb.nodeAttrs[v] = attrs
+}
+
+// Edge writes an edge between two nodes, unless it has been written before.
 func (gb *graphBuilder) Edge(from, to interface{}) {
 	if gb.done {
 		panic("done")
 	}
-	gb.Write([]byte("\t"))
-	gb.Write([]byte(`"`))
-	gb.Write([]byte(strings.ReplaceAll(gb.nodeNamer(from), `"`, `\"`)))
-	gb.Write([]byte(`" -> "`))
-	gb.Write([]byte(strings.ReplaceAll(gb.nodeNamer(to), `"`, `\"`)))
-	gb.Write([]byte("\"\n"))
+	e := [2]any{from, to}
+	if _, ok := gb.edges[e]; ok {
+		return
+	}
+	gb.edges[e] = struct{}{}
+	gb.start()
+	gb.printf("\t%s -> %s\n", quoteDOT(gb.nodeNamer(from)), quoteDOT(gb.nodeNamer(to)))
 }
 
-func (gb *graphBuilder) Done() {
+// Done writes the node attributes, sorted by node name, and ends the graph.
+func (gb *graphBuilder) Done() error {
 	if gb.done {
 		panic("done")
 	}
-	gb.Write([]byte("}\n"))
 	gb.done = true
+	gb.start()
+	names := make(map[string]string, len(gb.nodeAttrs))
+	for v, attrs := range gb.nodeAttrs {
+		names[gb.nodeNamer(v)] = attrs
+	}
+	for _, n := range slices.Sorted(maps.Keys(names)) {
+		gb.printf("\t%s [%s]\n", quoteDOT(n), names[n])
+	}
+	gb.printf("}\n")
+	return gb.err
+}
+
+// start writes the beginning of the graph, if it has not been written yet.
+func (gb *graphBuilder) start() {
+	if !gb.started {
+		gb.started = true
+		gb.printf("digraph {\n")
+	}
+}
+
+// printf writes to the output, recording the first error.
+func (gb *graphBuilder) printf(format string, args ...any) {
+	if gb.err == nil {
+		_, gb.err = fmt.Fprintf(gb.Writer, format, args...)
+	}
+}
+
+func quoteDOT(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
 }
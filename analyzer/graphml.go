@@ -0,0 +1,128 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"go/types"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	cpb "github.com/google/capslock/proto"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/packages"
+)
+
+// graphMLNode holds the attributes of a node written by WriteGraphML.
+type graphMLNode struct {
+	pkg, function, capability string
+	queryRoot                 bool
+}
+
+// WriteGraphML writes the graph produced by CapabilityGraph to w in the
+// GraphML format, which can be read by tools such as Gephi.
+//
+// As in WriteDOT, nodes are identified by function name, or by capability
+// name for capabilities, so that the output is stable across runs.  Function
+// nodes have the attributes "package", "function" and "is_query_root", which
+// is true for functions in queriedPackages.  Capability nodes have
+// "is_capability" set, and the capability's name as "capability", as do the
+// edges from functions to capabilities, so that the graph can be filtered by
+// capability.  Nodes and edges are written in sorted order once the analysis
+// is complete.
+//
+// If config.CapabilitySet is non-nil, only paths to capabilities in the set
+// are included.  If the analysis fails, nothing is written to w.
+func WriteGraphML(ctx context.Context, w io.Writer, pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config) error {
+	nodes := make(map[string]*graphMLNode)
+	edges := make(map[[2]string]string)
+	node := func(_ *bfsStateMap, v *callgraph.Node, _ *bfsStateMap) {
+		name := graphNodeName(v)
+		if _, ok := nodes[name]; ok {
+			return
+		}
+		n := &graphMLNode{}
+		if v.Func != nil {
+			n.function = v.Func.String()
+			if pkg := v.Func.Package(); pkg != nil {
+				n.pkg = pkg.Pkg.Path()
+				_, n.queryRoot = queriedPackages[pkg.Pkg]
+			}
+		}
+		nodes[name] = n
+	}
+	callEdge := func(edge *callgraph.Edge) {
+		edges[[2]string{graphNodeName(edge.Caller), graphNodeName(edge.Callee)}] = ""
+	}
+	capabilityEdge := func(fn *callgraph.Node, c cpb.Capability) {
+		nodes[c.String()] = &graphMLNode{capability: c.String()}
+		edges[[2]string{graphNodeName(fn), c.String()}] = c.String()
+	}
+	var filter func(c cpb.Capability) bool
+	if config.CapabilitySet != nil {
+		filter = config.CapabilitySet.Has
+	}
+	if err := CapabilityGraph(ctx, pkgs, queriedPackages, config, node, callEdge, capabilityEdge, filter); err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	for _, k := range []struct{ id, target, name, typ string }{
+		{"package", "node", "package", "string"},
+		{"function", "node", "function", "string"},
+		{"capability", "node", "capability", "string"},
+		{"is_capability", "node", "is_capability", "boolean"},
+		{"is_query_root", "node", "is_query_root", "boolean"},
+		{"edge_capability", "edge", "capability", "string"},
+	} {
+		fmt.Fprintf(&b, "\t<key id=%q for=%q attr.name=%q attr.type=%q/>\n", k.id, k.target, k.name, k.typ)
+	}
+	b.WriteString("\t<graph id=\"capslock\" edgedefault=\"directed\">\n")
+	for _, name := range slices.Sorted(maps.Keys(nodes)) {
+		n := nodes[name]
+		fmt.Fprintf(&b, "\t\t<node id=\"%s\">\n", escapeXML(name))
+		writeGraphMLData(&b, "package", n.pkg)
+		writeGraphMLData(&b, "function", n.function)
+		writeGraphMLData(&b, "capability", n.capability)
+		fmt.Fprintf(&b, "\t\t\t<data key=\"is_capability\">%t</data>\n", n.capability != "")
+		fmt.Fprintf(&b, "\t\t\t<data key=\"is_query_root\">%t</data>\n", n.queryRoot)
+		b.WriteString("\t\t</node>\n")
+	}
+	keys := slices.SortedFunc(maps.Keys(edges), func(a, b [2]string) int {
+		return slices.Compare(a[:], b[:])
+	})
+	for _, e := range keys {
+		fmt.Fprintf(&b, "\t\t<edge source=\"%s\" target=\"%s\">\n", escapeXML(e[0]), escapeXML(e[1]))
+		writeGraphMLData(&b, "edge_capability", edges[e])
+		b.WriteString("\t\t</edge>\n")
+	}
+	b.WriteString("\t</graph>\n</graphml>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeGraphMLData writes a data element with the given key and value, unless
+// the value is empty.
+func writeGraphMLData(b *strings.Builder, key, value string) {
+	if value != "" {
+		fmt.Fprintf(b, "\t\t\t<data key=%q>%s</data>\n", key, escapeXML(value))
+	}
+}
+
+// escapeXML returns s escaped for use in XML character data or a quoted
+// attribute value.
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
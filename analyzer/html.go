@@ -0,0 +1,101 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+
+	cpb "github.com/google/capslock/proto"
+)
+
+// htmlReport is the data used by the HTML report template.
+type htmlReport struct {
+	Capabilities []htmlCapability
+	Rows         []htmlRow
+}
+
+// htmlCapability is the number of entries for a capability in an HTML report.
+type htmlCapability struct {
+	Capability string
+	Count      int
+	Direct     int
+	Transitive int
+}
+
+// htmlRow is an entry in the table of an HTML report.
+type htmlRow struct {
+	Capability string
+	Package    string
+	Type       string // "direct", "transitive", or empty
+	Function   string
+	Path       []htmlFunction
+}
+
+type htmlFunction struct {
+	Name string
+	Site string
+}
+
+// WriteHTMLReport writes the capabilities in cil to w as a self-contained
+// HTML page, for sharing with readers who do not use the command-line tool.
+// The page lists the number of uses of each capability, followed by a table
+// of the entries in cil which can be sorted and filtered, with the example
+// path of each entry.  Its styles and scripts are included in the page, so
+// it does not need network access to be viewed.
+func WriteHTMLReport(w io.Writer, cil *cpb.CapabilityInfoList) error {
+	var r htmlReport
+	counts := make(map[cpb.Capability]*htmlCapability)
+	for _, ci := range cil.GetCapabilityInfo() {
+		c := ci.GetCapability()
+		hc, ok := counts[c]
+		if !ok {
+			hc = &htmlCapability{Capability: c.String()}
+			counts[c] = hc
+		}
+		hc.Count++
+		row := htmlRow{
+			Capability: c.String(),
+			Package:    ci.GetPackageDir(),
+		}
+		switch ci.GetCapabilityType() {
+		case cpb.CapabilityType_CAPABILITY_TYPE_DIRECT:
+			hc.Direct++
+			row.Type = "direct"
+		case cpb.CapabilityType_CAPABILITY_TYPE_TRANSITIVE:
+			hc.Transitive++
+			row.Type = "transitive"
+		}
+		for _, fn := range ci.GetPath() {
+			f := htmlFunction{Name: fn.GetName()}
+			if s := fn.GetSite(); s != nil {
+				f.Site = fmt.Sprintf("%s:%d:%d", s.GetFilename(), s.GetLine(), s.GetColumn())
+			}
+			row.Path = append(row.Path, f)
+		}
+		if len(row.Path) > 0 {
+			row.Function = row.Path[0].Name
+		}
+		r.Rows = append(r.Rows, row)
+	}
+	for _, hc := range counts {
+		r.Capabilities = append(r.Capabilities, *hc)
+	}
+	sort.Slice(r.Capabilities, func(i, j int) bool {
+		return cpb.Capability_value[r.Capabilities[i].Capability] < cpb.Capability_value[r.Capabilities[j].Capability]
+	})
+	t, err := template.New("report.html.tmpl").Funcs(template.FuncMap{
+		"short": func(c string) string { return strings.TrimPrefix(c, "CAPABILITY_") },
+	}).ParseFS(staticContent, "static/report.html.tmpl")
+	if err != nil {
+		return fmt.Errorf("internal error: couldn't parse HTML template: %w", err)
+	}
+	return t.Execute(w, r)
+}
@@ -0,0 +1,129 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"go/types"
+	"io"
+
+	cpb "github.com/google/capslock/proto"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/packages"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// StreamCapabilityInfoJSONL analyzes the packages in pkgs like
+// GetCapabilityInfo, but writes the results to w in JSON Lines format as they
+// are found, instead of collecting them in a list, so that memory usage does
+// not grow with the number of results.
+//
+// The first line is a CapabilityInfoList containing only the ModuleInfo,
+// PackageInfo and AnalyzedPackages fields.  Each following line is a single
+// CapabilityInfo, as passed to the callback of ForEachCapabilityInfo.
+//
+// Only function granularity is supported, since the other granularities
+// require all the results to be seen before any can be written.  If
+// config.Baseline is non-nil, matching entries are omitted, but the number
+// omitted and the stale baseline entries are not reported.
+//
+// If writing to w fails, or ctx is cancelled, StreamCapabilityInfoJSONL stops
+// the analysis and returns the error.
+func StreamCapabilityInfoJSONL(ctx context.Context, w io.Writer, pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config) error {
+	config, err := streamingConfig(config)
+	if err != nil {
+		return err
+	}
+	var writeErr error
+	write := func(m proto.Message) {
+		b, err := protojson.Marshal(m)
+		if err == nil {
+			b = append(b, '\n')
+			_, err = w.Write(b)
+		}
+		writeErr = err
+	}
+	write(&cpb.CapabilityInfoList{
+		ModuleInfo:       collectModuleInfo(pkgs),
+		PackageInfo:      collectPackageInfo(pkgs),
+		AnalyzedPackages: proto.Int64(analyzedPackages(pkgs)),
+	})
+	if writeErr != nil {
+		return writeErr
+	}
+	err = ForEachCapabilityInfo(ctx, pkgs, queriedPackages, config, func(c *cpb.CapabilityInfo) bool {
+		write(c)
+		return writeErr == nil
+	})
+	if writeErr != nil {
+		return writeErr
+	}
+	return err
+}
+
+// ForEachCapabilityInfo analyzes the packages in pkgs like GetCapabilityInfo,
+// but calls fn with each CapabilityInfo as it is found, instead of collecting
+// them in a list.  If fn returns false, the analysis stops, and
+// ForEachCapabilityInfo returns nil.
+//
+// The CapabilityInfo records are in the order they were found by the search
+// through the call graph, which is breadth-first for each capability in turn,
+// rather than the sorted order of GetCapabilityInfo.  As with
+// StreamCapabilityInfoJSONL, only function granularity is supported, and if
+// config.Baseline is non-nil, matching entries are omitted but not counted.
+//
+// If ctx is cancelled before the analysis is complete,
+// ForEachCapabilityInfo returns ctx.Err().
+func ForEachCapabilityInfo(ctx context.Context, pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config, fn func(*cpb.CapabilityInfo) bool) error {
+	config, err := streamingConfig(config)
+	if err != nil {
+		return err
+	}
+	inner, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stopped := false
+	modules := packageModules(pkgs, config.ReportReplacedAsLocal)
+	err = forEachPath(inner, pkgs, queriedPackages,
+		func(cap cpb.Capability, nodes *bfsStateMap, v *callgraph.Node) {
+			if stopped || !config.includesPathType(pathType(nodes, v)) {
+				return
+			}
+			c, _ := capabilityInfo(cap, nodes, v, modules, config)
+			if config.Baseline != nil && config.Baseline.suppresses(c) {
+				return
+			}
+			if !fn(c) {
+				stopped = true
+				cancel()
+			}
+		}, nil, config)
+	if stopped && ctx.Err() == nil {
+		return nil
+	}
+	return err
+}
+
+// streamingConfig returns config, or a copy of it with function granularity
+// if its granularity is unset, so that the caller's Config is not modified.
+// It returns an error if config cannot be used to report capabilities as
+// they are found.
+func streamingConfig(config *Config) (*Config, error) {
+	if config.Granularity == GranularityUnset {
+		c := *config
+		c.Granularity = GranularityFunction
+		config = &c
+	}
+	if config.Granularity != GranularityFunction {
+		return nil, fmt.Errorf("streaming output only supports function granularity")
+	}
+	if err := config.checkPathType(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
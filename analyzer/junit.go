@@ -0,0 +1,121 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	cpb "github.com/google/capslock/proto"
+)
+
+// The following types are the subset of the JUnit XML format, as read by
+// most CI systems, which WriteJUnit populates.
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitPolicyTest is the name of the test case for a package with no
+// violations.
+const junitPolicyTest = "capability policy"
+
+// WriteJUnit writes violations, as returned by EvaluatePolicy, to w as a
+// JUnit XML test suite, so that CI systems can show them as failed tests.
+//
+// Each package in packages, which should be the packages that were
+// analyzed, and each package with a violation, is the class name of the test
+// cases for it.  Each (capability, package) pair with a violation is a
+// failing test case named after the capability, whose failure message
+// includes the example path of the first violation for the pair.  Each
+// package with no violations is a passing test case.  Test cases are sorted
+// by package and name.
+func WriteJUnit(w io.Writer, packages []string, violations []Violation) error {
+	type key struct {
+		pkg string
+		cpb.Capability
+	}
+	failed := make(map[key]Violation)
+	var keys []key
+	for _, v := range violations {
+		k := key{v.Package, v.Capability}
+		if _, ok := failed[k]; !ok {
+			failed[k] = v
+			keys = append(keys, k)
+		}
+	}
+	violated := make(map[string]bool)
+	for _, k := range keys {
+		violated[k.pkg] = true
+	}
+	suite := junitTestSuite{Name: "capslock"}
+	for _, k := range keys {
+		v := failed[k]
+		text := v.String()
+		if len(v.Path) > 0 {
+			text = fmt.Sprintf("%s: %s is not allowed\n\nExample path:\n  %s\n", v.Package, v.Capability, strings.Join(v.Path, "\n  "))
+		}
+		suite.TestCases = append(suite.TestCases, junitTestCase{
+			Name:      k.Capability.String(),
+			ClassName: k.pkg,
+			Failure: &junitFailure{
+				Message: v.String(),
+				Type:    k.Capability.String(),
+				Text:    text,
+			},
+		})
+	}
+	for _, p := range packages {
+		if violated[p] {
+			continue
+		}
+		violated[p] = true // don't add duplicates
+		suite.TestCases = append(suite.TestCases, junitTestCase{Name: junitPolicyTest, ClassName: p})
+	}
+	slices.SortFunc(suite.TestCases, func(a, b junitTestCase) int {
+		if c := strings.Compare(a.ClassName, b.ClassName); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	suite.Tests = len(suite.TestCases)
+	suite.Failures = len(keys)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
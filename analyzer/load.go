@@ -7,10 +7,16 @@
 package analyzer
 
 import (
+	"fmt"
+	"go/build"
 	"go/types"
+	"maps"
 	"os"
 	"path"
+	"regexp"
+	"slices"
 	"sort"
+	"strings"
 	"sync"
 
 	cpb "github.com/google/capslock/proto"
@@ -23,6 +29,10 @@ var (
 	standardLibraryPackagesMap  map[string]struct{}
 )
 
+// stdModule is the synthetic module path used for standard library packages
+// when collapsing capabilities per module.
+const stdModule = "std"
+
 // LoadConfig specifies the build tags, GOOS value, and GOARCH value to use
 // when loading packages.  These will be used to determine when a file's build
 // constraint is satisfied.  See
@@ -31,11 +41,149 @@ type LoadConfig struct {
 	BuildTags string
 	GOOS      string
 	GOARCH    string
+	// IncludeTests loads the test files of each package too, so that the
+	// capabilities of test code are analyzed.  CapabilityInfo entries for
+	// functions in test files have FromTest set.
+	IncludeTests bool
+	// Dir is the directory in which package patterns are resolved, such as
+	// the root of a module.  If it is empty, the current directory is used.
+	Dir string
+}
+
+// Name returns a name for the configuration, such as "linux/amd64", using
+// the default GOOS and GOARCH values if they are not set.  If there are build
+// tags, they are appended, as in "linux/amd64,tags=foo,bar".
+func (c LoadConfig) Name() string {
+	goos, goarch := c.GOOS, c.GOARCH
+	if goos == "" {
+		goos = build.Default.GOOS
+	}
+	if goarch == "" {
+		goarch = build.Default.GOARCH
+	}
+	name := goos + "/" + goarch
+	if c.BuildTags != "" {
+		name += ",tags=" + c.BuildTags
+	}
+	return name
+}
+
+// LoadError is the error returned by the analysis functions when some of the
+// packages being analyzed, or their dependencies, had errors when they were
+// loaded, for example because a package does not compile.  The analysis of
+// such packages would be incomplete, so their capabilities could be
+// under-reported.  Config.IgnoreLoadErrors can be set to analyze them anyway.
+type LoadError struct {
+	// Packages maps the path of each package with errors to its errors.
+	Packages map[string][]packages.Error
+}
+
+func (e *LoadError) Error() string {
+	paths := slices.Sorted(maps.Keys(e.Packages))
+	n := 0
+	for _, p := range paths {
+		n += len(e.Packages[p])
+	}
+	if n == 0 {
+		return "errors loading packages"
+	}
+	s := fmt.Sprintf("errors loading packages: %s: %v", paths[0], e.Packages[paths[0]][0])
+	if n > 1 {
+		s += fmt.Sprintf(" (and %d more)", n-1)
+	}
+	return s
+}
+
+// loadErrors returns a *LoadError holding the errors of pkgs and their
+// dependencies, or nil if there are none.
+func loadErrors(pkgs []*packages.Package) error {
+	var e *LoadError
+	forEachPackageIncludingDependencies(pkgs, func(pkg *packages.Package) {
+		if len(pkg.Errors) == 0 {
+			return
+		}
+		if e == nil {
+			e = &LoadError{Packages: make(map[string][]packages.Error)}
+		}
+		e.Packages[pkg.PkgPath] = append(e.Packages[pkg.PkgPath], pkg.Errors...)
+	})
+	if e == nil {
+		return nil
+	}
+	return e
+}
+
+// IncompletePackageError is returned by the analysis functions when a
+// package without load errors lacks information which the analysis needs,
+// which would otherwise cause it to be skipped or to have no function bodies.
+// This usually means the packages were not loaded with
+// PackagesLoadModeNeeded, or were constructed by other means without setting
+// the corresponding fields.
+type IncompletePackageError struct {
+	// Package is the path of the package.
+	Package string
+	// Missing contains the names of the packages.Package fields which are
+	// not set.
+	Missing []string
+}
+
+func (e *IncompletePackageError) Error() string {
+	return fmt.Sprintf("package %s is missing %s; it must be loaded with PackagesLoadModeNeeded or have the same information",
+		e.Package, strings.Join(e.Missing, ", "))
+}
+
+// checkPackages returns an error if pkgs and their dependencies cannot be
+// analyzed: an *IncompletePackageError for the first package, in path order,
+// lacking information the analysis needs, or unless config.IgnoreLoadErrors
+// is set, a *LoadError if any package had errors when it was loaded.
+// Packages with errors are not checked for missing information, since with
+// config.IgnoreLoadErrors they are skipped.
+func checkPackages(pkgs []*packages.Package, config *Config) error {
+	var incomplete []*IncompletePackageError
+	forEachPackageIncludingDependencies(pkgs, func(pkg *packages.Package) {
+		if len(pkg.Errors) != 0 || pkg.PkgPath == "unsafe" {
+			// The unsafe package has no source files, and its types are
+			// built in.
+			return
+		}
+		var missing []string
+		if pkg.Fset == nil {
+			missing = append(missing, "Fset")
+		}
+		if pkg.Types == nil {
+			missing = append(missing, "Types")
+		}
+		if pkg.TypesInfo == nil {
+			missing = append(missing, "TypesInfo")
+		}
+		if len(pkg.Syntax) == 0 {
+			missing = append(missing, "Syntax")
+		}
+		if len(missing) != 0 {
+			incomplete = append(incomplete, &IncompletePackageError{Package: pkg.PkgPath, Missing: missing})
+		}
+	})
+	if len(incomplete) != 0 {
+		return slices.MinFunc(incomplete, func(a, b *IncompletePackageError) int {
+			return strings.Compare(a.Package, b.Package)
+		})
+	}
+	if config.IgnoreLoadErrors {
+		return nil
+	}
+	return loadErrors(pkgs)
 }
 
 // PackagesLoadModeNeeded is a packages.LoadMode that has all the bits set for
 // the information that this package uses to perform its analysis.  Users
 // should load packages for analysis using this LoadMode (or a superset.)
+//
+// Packages loaded by other means, for example by a build system whose
+// packages cannot be found by go/packages, can be passed to the analysis
+// functions too, as long as they and the packages in their Imports have the
+// same information: at least PkgPath, Fset, Types, TypesInfo and Syntax, and
+// Module for the module-based options.  NewProgram accepts a function which
+// loads packages in such a way.
 const PackagesLoadModeNeeded packages.LoadMode = packages.NeedName |
 	packages.NeedFiles |
 	packages.NeedCompiledGoFiles |
@@ -58,8 +206,76 @@ func GetQueriedPackages(pkgs []*packages.Package) map[*types.Package]struct{} {
 	return queriedPackages
 }
 
+// excludeQueriedPackages returns the packages in queriedPackages whose
+// paths do not match any of patterns.  If patterns is empty,
+// queriedPackages is returned unchanged.
+//
+// As with the go command, "..." in a pattern matches any string, and a
+// pattern ending in "/..." also matches the path without that suffix.  "*"
+// and "?" match any sequence of characters, or any single character, within
+// a single path element.
+func excludeQueriedPackages(queriedPackages map[*types.Package]struct{}, patterns []string) map[*types.Package]struct{} {
+	if len(patterns) == 0 {
+		return queriedPackages
+	}
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		re := regexp.QuoteMeta(p)
+		re = strings.ReplaceAll(re, `\.\.\.`, `.*`)
+		re = strings.ReplaceAll(re, `\*`, `[^/]*`)
+		re = strings.ReplaceAll(re, `\?`, `[^/]`)
+		if strings.HasSuffix(re, `/.*`) {
+			re = strings.TrimSuffix(re, `/.*`) + `(/.*)?`
+		}
+		res = append(res, regexp.MustCompile(`^`+re+`$`))
+	}
+	out := make(map[*types.Package]struct{})
+	for p := range queriedPackages {
+		excluded := false
+		for _, re := range res {
+			if re.MatchString(p.Path()) {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			out[p] = struct{}{}
+		}
+	}
+	return out
+}
+
+// excludeReplacedPackages returns the packages in queriedPackages which are
+// not in a module replaced by a replace directive, according to the module
+// information of pkgs and their dependencies.
+func excludeReplacedPackages(pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}) map[*types.Package]struct{} {
+	replaced := make(map[*types.Package]bool)
+	forEachPackageIncludingDependencies(pkgs, func(pkg *packages.Package) {
+		if m := pkg.Module; m != nil && m.Replace != nil {
+			replaced[pkg.Types] = true
+		}
+	})
+	out := make(map[*types.Package]struct{})
+	for p := range queriedPackages {
+		if !replaced[p] {
+			out[p] = struct{}{}
+		}
+	}
+	return out
+}
+
+// queriedPackagesToReport returns the packages in queriedPackages which are
+// not excluded by config.ExcludePackages or config.ExcludeReplaced.
+func queriedPackagesToReport(pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config) map[*types.Package]struct{} {
+	queriedPackages = excludeQueriedPackages(queriedPackages, config.ExcludePackages)
+	if config.ExcludeReplaced {
+		queriedPackages = excludeReplacedPackages(pkgs, queriedPackages)
+	}
+	return queriedPackages
+}
+
 func LoadPackages(packageNames []string, lcfg LoadConfig) ([]*packages.Package, error) {
-	cfg := &packages.Config{Mode: PackagesLoadModeNeeded}
+	cfg := &packages.Config{Mode: PackagesLoadModeNeeded, Tests: lcfg.IncludeTests, Dir: lcfg.Dir}
 	if lcfg.BuildTags != "" {
 		cfg.BuildFlags = []string{"-tags=" + lcfg.BuildTags}
 	}
@@ -73,7 +289,32 @@ func LoadPackages(packageNames []string, lcfg LoadConfig) ([]*packages.Package,
 		}
 		cfg.Env = env
 	}
-	return packages.Load(cfg, packageNames...)
+	pkgs, err := packages.Load(cfg, packageNames...)
+	if err != nil || !lcfg.IncludeTests {
+		return pkgs, err
+	}
+	return removeTestDuplicates(pkgs), nil
+}
+
+// removeTestDuplicates removes from pkgs, which were loaded with tests, the
+// packages which are superseded by a test variant, and the generated test
+// main packages.  A test variant of a package contains the same code plus
+// its _test.go files, so analyzing both would report each capability of the
+// package twice.
+func removeTestDuplicates(pkgs []*packages.Package) []*packages.Package {
+	// testVariantID returns the ID that go list gives to the test variant of
+	// the package with path p.
+	testVariantID := func(p string) string { return p + " [" + p + ".test]" }
+	ids := make(map[string]bool)
+	for _, p := range pkgs {
+		ids[p.ID] = true
+	}
+	return slices.DeleteFunc(pkgs, func(p *packages.Package) bool {
+		if p.ID == p.PkgPath && ids[testVariantID(p.PkgPath)] {
+			return true
+		}
+		return p.Name == "main" && strings.HasSuffix(p.ID, ".test")
+	})
 }
 
 func standardLibraryPackages() map[string]struct{} {
@@ -90,11 +331,14 @@ func standardLibraryPackages() map[string]struct{} {
 	return standardLibraryPackagesMap
 }
 
+// collectModuleInfo returns the modules containing pkgs and their
+// dependencies, sorted by path.  Main modules are included with no version,
+// so that every module that GetCapabilityInfo groups by is listed.
 func collectModuleInfo(pkgs []*packages.Package) []*cpb.ModuleInfo {
 	pathToModule := make(map[string]*cpb.ModuleInfo)
 	forEachPackageIncludingDependencies(pkgs, func(pkg *packages.Package) {
 		m := pkg.Module
-		if m == nil || m.Path == "" || m.Version == "" {
+		if m == nil || m.Path == "" {
 			// No module information.
 			return
 		}
@@ -102,10 +346,7 @@ func collectModuleInfo(pkgs []*packages.Package) []*cpb.ModuleInfo {
 			// We've seen this module.
 			return
 		}
-		pm := new(cpb.ModuleInfo)
-		pm.Path = proto.String(m.Path)
-		pm.Version = proto.String(m.Version)
-		pathToModule[m.Path] = pm
+		pathToModule[m.Path] = moduleInfo(m)
 	})
 	// Sort by path.
 	var modulePaths []string
@@ -121,6 +362,125 @@ func collectModuleInfo(pkgs []*packages.Package) []*cpb.ModuleInfo {
 	return modules
 }
 
+// moduleInfo returns the ModuleInfo for m, noting its replacement if it has
+// one.
+func moduleInfo(m *packages.Module) *cpb.ModuleInfo {
+	mi := &cpb.ModuleInfo{Path: proto.String(m.Path)}
+	if m.Version != "" {
+		mi.Version = proto.String(m.Version)
+	}
+	if m.Replace != nil {
+		mi.Replace = moduleInfo(m.Replace)
+	}
+	return mi
+}
+
+// attributedModule returns the module to which the packages of m are
+// attributed: m itself, or if replacedAsLocal is set and m is replaced, its
+// replacement.
+func attributedModule(m *packages.Module, replacedAsLocal bool) *packages.Module {
+	if replacedAsLocal && m.Replace != nil {
+		return m.Replace
+	}
+	return m
+}
+
+// modulePaths returns a map from the path of each package in pkgs, and their
+// dependencies, to the path of the module containing it.  Standard library
+// packages are all mapped to the synthetic module "std".  Packages with no
+// module information are mapped to their own package path.  If
+// replacedAsLocal is set, packages in replaced modules are mapped to the
+// path of the replacement.
+func modulePaths(pkgs []*packages.Package, replacedAsLocal bool) map[string]string {
+	out := make(map[string]string)
+	std := standardLibraryPackages()
+	forEachPackageIncludingDependencies(pkgs, func(pkg *packages.Package) {
+		if m := pkg.Module; m != nil && m.Path != "" {
+			out[pkg.PkgPath] = attributedModule(m, replacedAsLocal).Path
+		} else if _, ok := std[pkg.PkgPath]; ok {
+			out[pkg.PkgPath] = stdModule
+		} else {
+			out[pkg.PkgPath] = pkg.PkgPath
+		}
+	})
+	return out
+}
+
+// trimMajorVersions returns path with its major version elements removed,
+// so that the paths of different major versions of a package or module, such
+// as "math/rand" and "math/rand/v2", or "example.com/m" and
+// "example.com/m/v3/sub", are the same.  A major version element is one of
+// the form "vN", where N is a number greater than 1, after the first
+// element.  A ".vN" suffix of the last element of a gopkg.in path, as in
+// "gopkg.in/yaml.v3", is removed too.
+func trimMajorVersions(path string) string {
+	elems := strings.Split(path, "/")
+	out := elems[:1]
+	for _, e := range elems[1:] {
+		if !isMajorVersion(e) {
+			out = append(out, e)
+		}
+	}
+	if strings.HasPrefix(path, "gopkg.in/") && len(out) > 1 {
+		last := out[len(out)-1]
+		if i := strings.LastIndex(last, "."); i > 0 && isMajorVersion(last[i+1:]) {
+			out[len(out)-1] = last[:i]
+		}
+	}
+	return strings.Join(out, "/")
+}
+
+// isMajorVersion returns true if e is of the form "vN", where N is a number
+// greater than 1 with no leading zeros.
+func isMajorVersion(e string) bool {
+	if len(e) < 2 || e[0] != 'v' || e[1] == '0' || e == "v1" {
+		return false
+	}
+	for _, c := range e[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// packageModules returns a map from the path of each package in pkgs, and
+// their dependencies, to the module containing it, with its version if it
+// has one.  Unlike modulePaths, packages with no module information,
+// including the standard library, are omitted.  In a workspace, packages in
+// each of the workspace's modules are mapped to their own module.  If
+// replacedAsLocal is set, packages in replaced modules are mapped to the
+// replacement.
+func packageModules(pkgs []*packages.Package, replacedAsLocal bool) map[string]*cpb.ModuleInfo {
+	out := make(map[string]*cpb.ModuleInfo)
+	forEachPackageIncludingDependencies(pkgs, func(pkg *packages.Package) {
+		if m := pkg.Module; m != nil && m.Path != "" {
+			out[pkg.PkgPath] = moduleInfo(attributedModule(m, replacedAsLocal))
+		}
+	})
+	return out
+}
+
+// moduleForPackageDir returns the path of the module in modules which
+// contains the package with path dir, or "std" for a standard library
+// package.  If there is no such module, dir is returned unchanged.
+func moduleForPackageDir(modules []*cpb.ModuleInfo, dir string) string {
+	if _, ok := standardLibraryPackages()[dir]; ok {
+		return stdModule
+	}
+	var best string
+	for _, m := range modules {
+		mp := m.GetPath()
+		if (dir == mp || strings.HasPrefix(dir, mp+"/")) && len(mp) > len(best) {
+			best = mp
+		}
+	}
+	if best == "" {
+		return dir
+	}
+	return best
+}
+
 func collectPackageInfo(pkgs []*packages.Package) []*cpb.PackageInfo {
 	var out []*cpb.PackageInfo
 	std := standardLibraryPackages()
@@ -141,3 +501,48 @@ func collectPackageInfo(pkgs []*packages.Package) []*cpb.PackageInfo {
 	})
 	return out
 }
+
+// analyzedPackages returns the number of distinct packages in pkgs, not
+// counting their dependencies.  A package and its test variant, as loaded
+// with tests included, count once.
+func analyzedPackages(pkgs []*packages.Package) int64 {
+	paths := make(map[string]struct{})
+	for _, pkg := range pkgs {
+		paths[pkg.PkgPath] = struct{}{}
+	}
+	return int64(len(paths))
+}
+
+// prunePackageInfo removes from cil the modules and packages which do not
+// appear on the path of any of its CapabilityInfo entries.  The packages on
+// the path of each entry are taken from pathPackages, or if the entry is
+// not in pathPackages, from the entry's Path.
+func prunePackageInfo(cil *cpb.CapabilityInfoList, pathPackages map[*cpb.CapabilityInfo][]string) {
+	used := make(map[string]struct{})
+	for _, ci := range cil.GetCapabilityInfo() {
+		used[ci.GetPackageDir()] = struct{}{}
+		if pkgs, ok := pathPackages[ci]; ok {
+			for _, p := range pkgs {
+				used[p] = struct{}{}
+			}
+			continue
+		}
+		for _, f := range ci.GetPath() {
+			if p := f.GetPackage(); p != "" {
+				used[p] = struct{}{}
+			}
+		}
+	}
+	usedModules := make(map[string]struct{})
+	for p := range used {
+		usedModules[moduleForPackageDir(cil.GetModuleInfo(), p)] = struct{}{}
+	}
+	cil.ModuleInfo = slices.DeleteFunc(cil.ModuleInfo, func(m *cpb.ModuleInfo) bool {
+		_, ok := usedModules[m.GetPath()]
+		return !ok
+	})
+	cil.PackageInfo = slices.DeleteFunc(cil.PackageInfo, func(pi *cpb.PackageInfo) bool {
+		_, ok := used[pi.GetPath()]
+		return !ok
+	})
+}
@@ -0,0 +1,221 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	cpb "github.com/google/capslock/proto"
+	"golang.org/x/tools/go/packages"
+	"google.golang.org/protobuf/proto"
+)
+
+// MergeCapabilityInfoLists returns the union of several CapabilityInfoLists,
+// such as the results of analyzing different subsets of a program's packages
+// on different machines.
+//
+// Entries are identified by capability, package, and the function at the
+// start of their example path, if any.  When several lists have an entry
+// with the same identity, the one with the lowest PathId is kept, so the
+// result does not depend on the order of cils.  The entries of the result
+// are sorted by capability, package and function.
+//
+// The ModuleInfo and PackageInfo of the result are the union of those in the
+// input lists.  A file is listed as ignored in a package only if it was
+// ignored in every list which includes that package.  AnalyzedPackages is the
+// sum of those in the input lists, which is the number of packages analyzed
+// if each package was analyzed by only one of them.
+func MergeCapabilityInfoLists(cils ...*cpb.CapabilityInfoList) *cpb.CapabilityInfoList {
+	return mergeCapabilityInfoLists(GranularityUnset, nil, cils)
+}
+
+// GetCapabilityInfoMultiConfig analyzes the packages loaded for each of
+// several build configurations, such as different GOOS values, and returns
+// the union of the results, so that capabilities used only on some platforms
+// are not missed.  pkgsPerConfig holds the packages loaded for each of
+// loadConfigs, for example by LoadPackages, and the packages queried for each
+// configuration are those in pkgsPerConfig.
+//
+// The results are merged as by MergeCapabilityInfoLists, except that entries
+// are identified by the package, function, or module they refer to,
+// depending on config.Granularity, and AnalyzedPackages is the largest of
+// those of the configurations.  Each entry's Configs lists the names, as
+// given by LoadConfig.Name, of the configurations in which it was found.
+//
+// If ctx is cancelled before the analysis is complete,
+// GetCapabilityInfoMultiConfig returns ctx.Err() and no results.
+func GetCapabilityInfoMultiConfig(ctx context.Context, loadConfigs []LoadConfig, pkgsPerConfig [][]*packages.Package, config *Config) (*cpb.CapabilityInfoList, error) {
+	if len(loadConfigs) != len(pkgsPerConfig) {
+		return nil, fmt.Errorf("got packages for %d configurations, want %d", len(pkgsPerConfig), len(loadConfigs))
+	}
+	var names []string
+	var cils []*cpb.CapabilityInfoList
+	for i, pkgs := range pkgsPerConfig {
+		cil, err := GetCapabilityInfo(ctx, pkgs, GetQueriedPackages(pkgs), config)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", loadConfigs[i].Name(), err)
+		}
+		names = append(names, loadConfigs[i].Name())
+		cils = append(cils, cil)
+	}
+	g := config.Granularity
+	if g == GranularityUnset {
+		g = GranularityFunction
+	}
+	return mergeCapabilityInfoLists(g, names, cils), nil
+}
+
+// mergeCapabilityInfoLists implements MergeCapabilityInfoLists.  If g is
+// GranularityUnset, entries are identified as MergeCapabilityInfoLists
+// describes; otherwise they are identified by capability and by the package,
+// function, or module they refer to, depending on g, in the same way as
+// DiffCapabilityInfo.
+//
+// If names is non-nil, the lists are the results of analyzing the same
+// packages in different configurations.  names holds a name for each of
+// cils, and the Configs of each entry in the result list the names of the
+// lists which contain the entry, in the order of cils.  The entries are then
+// copies, so that the inputs are not modified, and AnalyzedPackages is the
+// largest of those in the input lists rather than their sum.
+func mergeCapabilityInfoLists(g Granularity, names []string, cils []*cpb.CapabilityInfoList) *cpb.CapabilityInfoList {
+	type candidate struct {
+		*cpb.CapabilityInfo
+		list int // the index in cils of the list containing the entry
+		keys []mapKey
+	}
+	type entry struct {
+		*cpb.CapabilityInfo
+		key   mapKey // used for sorting
+		lists []int  // the indexes of the lists containing the entry
+	}
+	var candidates []candidate
+	modules := make(map[string]*cpb.ModuleInfo)
+	packages := make(map[string]*cpb.PackageInfo)
+	var analyzed *int64
+	for i, cil := range cils {
+		if cil.AnalyzedPackages != nil {
+			switch {
+			case analyzed == nil:
+				analyzed = proto.Int64(cil.GetAnalyzedPackages())
+			case names != nil:
+				*analyzed = max(*analyzed, cil.GetAnalyzedPackages())
+			default:
+				*analyzed += cil.GetAnalyzedPackages()
+			}
+		}
+		for _, ci := range cil.GetCapabilityInfo() {
+			candidates = append(candidates, candidate{ci, i, mergeKeys(cil, ci, g)})
+		}
+		for _, m := range cil.GetModuleInfo() {
+			if _, ok := modules[m.GetPath()]; !ok {
+				modules[m.GetPath()] = m
+			}
+		}
+		for _, pi := range cil.GetPackageInfo() {
+			p, ok := packages[pi.GetPath()]
+			if !ok {
+				packages[pi.GetPath()] = proto.Clone(pi).(*cpb.PackageInfo)
+				continue
+			}
+			// Keep only the files which are ignored in both lists.
+			ignored := make(map[string]struct{})
+			for _, f := range pi.GetIgnoredFiles() {
+				ignored[f] = struct{}{}
+			}
+			var files []string
+			for _, f := range p.GetIgnoredFiles() {
+				if _, ok := ignored[f]; ok {
+					files = append(files, f)
+				}
+			}
+			p.IgnoredFiles = files
+		}
+	}
+	// Consider the entries in order of PathId, so that the entry kept for
+	// each identity is the one with the lowest.  Entries with the same PathId
+	// are ordered by their contents, and then by list.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.GetPathId() != b.GetPathId() {
+			return a.GetPathId() < b.GetPathId()
+		}
+		return bytes.Compare(marshalDeterministic(a.CapabilityInfo), marshalDeterministic(b.CapabilityInfo)) < 0
+	})
+	var entries []*entry
+	seen := make(map[mapKey]*entry)
+	for _, c := range candidates {
+		var e *entry
+		for _, k := range c.keys {
+			if prev, ok := seen[k]; ok {
+				if !slices.Contains(prev.lists, c.list) {
+					prev.lists = append(prev.lists, c.list)
+				}
+				continue
+			}
+			if e == nil {
+				e = &entry{CapabilityInfo: c.CapabilityInfo, key: c.keys[0], lists: []int{c.list}}
+				entries = append(entries, e)
+			}
+			seen[k] = e
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if a, b := entries[i].key.capability, entries[j].key.capability; a != b {
+			return a < b
+		}
+		return entries[i].key.key < entries[j].key.key
+	})
+	out := &cpb.CapabilityInfoList{AnalyzedPackages: analyzed}
+	for _, e := range entries {
+		if names != nil {
+			e.CapabilityInfo = proto.Clone(e.CapabilityInfo).(*cpb.CapabilityInfo)
+			slices.Sort(e.lists)
+			e.Configs = nil
+			for _, i := range e.lists {
+				e.Configs = append(e.Configs, names[i])
+			}
+		}
+		out.CapabilityInfo = append(out.CapabilityInfo, e.CapabilityInfo)
+	}
+	for _, m := range modules {
+		out.ModuleInfo = append(out.ModuleInfo, m)
+	}
+	sort.Slice(out.ModuleInfo, func(i, j int) bool {
+		return out.ModuleInfo[i].GetPath() < out.ModuleInfo[j].GetPath()
+	})
+	for _, p := range packages {
+		out.PackageInfo = append(out.PackageInfo, p)
+	}
+	sort.Slice(out.PackageInfo, func(i, j int) bool {
+		return out.PackageInfo[i].GetPath() < out.PackageInfo[j].GetPath()
+	})
+	return out
+}
+
+// mergeKeys returns the keys identifying ci, an entry in cil, when merging
+// with granularity g, as described by mergeCapabilityInfoLists.
+func mergeKeys(cil *cpb.CapabilityInfoList, ci *cpb.CapabilityInfo, g Granularity) []mapKey {
+	if g != GranularityUnset {
+		return mapKeys(cil, ci, g)
+	}
+	key := ci.GetPackageDir()
+	if len(ci.Path) > 0 {
+		key += " " + ci.Path[0].GetName()
+	}
+	return []mapKey{{key: key, capability: ci.GetCapability()}}
+}
+
+// marshalDeterministic returns the deterministic wire encoding of m, used to
+// order messages which are otherwise equal.
+func marshalDeterministic(m proto.Message) []byte {
+	b, _ := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	return b
+}
@@ -0,0 +1,50 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"go/types"
+
+	cpb "github.com/google/capslock/proto"
+	"golang.org/x/tools/go/packages"
+)
+
+// AnalyzeModule analyzes the module whose root directory is dir.  It loads
+// every package of the module, with the pattern "./...", together with all
+// the packages they depend on, and returns the capabilities of the module's
+// own packages, as GetCapabilityInfo does for queried packages.  This answers
+// the question of which capabilities the module could pull in, without
+// having to choose which of its packages to query.
+//
+// lcfg.Dir is ignored; the other fields of lcfg are used as in LoadPackages.
+// It is an error if dir is not in a module, or if the module's packages cannot
+// be listed.
+func AnalyzeModule(ctx context.Context, dir string, lcfg LoadConfig, config *Config) (*cpb.CapabilityInfoList, error) {
+	lcfg.Dir = dir
+	pkgs, err := LoadPackages([]string{"./..."}, lcfg)
+	if err != nil {
+		return nil, err
+	}
+	queriedPackages := make(map[*types.Package]struct{})
+	for _, p := range pkgs {
+		for _, e := range p.Errors {
+			if e.Kind == packages.ListError {
+				return nil, fmt.Errorf("loading module in %s: %v", dir, e)
+			}
+		}
+		if p.Module == nil || !p.Module.Main {
+			continue
+		}
+		queriedPackages[p.Types] = struct{}{}
+	}
+	if len(queriedPackages) == 0 {
+		return nil, fmt.Errorf("no packages found in a module in %s", dir)
+	}
+	return GetCapabilityInfo(ctx, pkgs, queriedPackages, config)
+}
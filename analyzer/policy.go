@@ -0,0 +1,77 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	cpb "github.com/google/capslock/proto"
+)
+
+// Policy declares which capabilities packages are permitted to have.
+type Policy struct {
+	// Allowed lists the capabilities permitted in every package which has no
+	// entry in Packages.
+	Allowed []cpb.Capability
+	// Packages maps package paths to the capabilities permitted in that
+	// package.  An entry replaces Allowed for its package, so a package can
+	// be given fewer capabilities than the default as well as more.
+	Packages map[string][]cpb.Capability
+}
+
+// allows returns true if p permits capability c in the package with path
+// pkg.
+func (p Policy) allows(pkg string, c cpb.Capability) bool {
+	if allowed, ok := p.Packages[pkg]; ok {
+		return slices.Contains(allowed, c)
+	}
+	return slices.Contains(p.Allowed, c)
+}
+
+// Violation is a capability reported for a package which its Policy does not
+// permit.
+type Violation struct {
+	Capability cpb.Capability
+	// Package is the path of the package.
+	Package string
+	// Path is the names of the functions in an example call path from the
+	// package to the capability.  It is empty if the CapabilityInfo had no
+	// path.
+	Path []string
+}
+
+// String returns a description of v suitable for an error message.
+func (v Violation) String() string {
+	s := fmt.Sprintf("%s: %s is not allowed", v.Package, v.Capability)
+	if len(v.Path) > 0 {
+		s += " (" + strings.Join(v.Path, " -> ") + ")"
+	}
+	return s
+}
+
+// EvaluatePolicy returns a Violation for each CapabilityInfo in cil whose
+// capability is not permitted for its package by policy, in the order of
+// cil, and whether there were none.  It does not report or exit, so that the
+// caller can decide how to present the violations and what exit code to use.
+func EvaluatePolicy(cil *cpb.CapabilityInfoList, policy Policy) (violations []Violation, ok bool) {
+	for _, ci := range cil.GetCapabilityInfo() {
+		if policy.allows(ci.GetPackageDir(), ci.GetCapability()) {
+			continue
+		}
+		v := Violation{
+			Capability: ci.GetCapability(),
+			Package:    ci.GetPackageDir(),
+		}
+		for _, f := range ci.GetPath() {
+			v.Path = append(v.Path, f.GetName())
+		}
+		violations = append(violations, v)
+	}
+	return violations, len(violations) == 0
+}
@@ -0,0 +1,110 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"context"
+	"slices"
+
+	cpb "github.com/google/capslock/proto"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/packages"
+)
+
+// Probe explains whether, and why not, a capability is reported for a
+// package.  It is returned by ProbeCapability.
+type Probe struct {
+	// Capability and Package are the capability and package that were probed.
+	Capability cpb.Capability
+	Package    string
+	// Classified contains the names of the functions in the program which
+	// have the capability themselves, sorted.  If it is empty, no package in
+	// the program can have the capability.
+	Classified []string
+	// Reachable is true if some function in the package has a path to a
+	// function in Classified, so that the capability is reported for the
+	// package.
+	Reachable bool
+	// ReachableIgnoringPruning is true if there would be such a path if
+	// functions classified as CAPABILITY_SAFE, and functions classified with
+	// some other capability, did not stop the search for paths.
+	ReachableIgnoringPruning bool
+	// PrunedBy contains, when the capability is not Reachable but is
+	// ReachableIgnoringPruning, the names of the functions that stopped the
+	// search on the example paths from the package, sorted.  Each is either
+	// classified as CAPABILITY_SAFE or classified with another capability.
+	PrunedBy []string
+}
+
+// ProbeCapability analyzes the packages in pkgs, and their dependencies, and
+// explains whether the capability c is reported for the package with the
+// path queriedPkg, which should be one of the packages analyzed.  This can be
+// used to find out why an expected capability is missing from the output of
+// GetCapabilityInfo: because no function in the program has it, or because
+// the paths to it from the package go through a function that is classified
+// as safe, or with another capability.
+//
+// Calls excluded by config.Classifier, and by the pruning options in config,
+// are not followed by either search.  ProbeCapability may modify pkgs.  If
+// ctx is cancelled before the analysis is complete, it returns ctx.Err().
+func ProbeCapability(ctx context.Context, pkgs []*packages.Package, queriedPkg string, c cpb.Capability, config *Config) (*Probe, error) {
+	config = pruneCalls(pkgs, config)
+	_, safe, nodesByCapability, extraNodesByCapability, callCapabilities, _, err := getPackageNodesWithCapability(pkgs, config)
+	if err != nil {
+		return nil, err
+	}
+	nodesByCapability, allNodesWithExplicitCapability := mergeCapabilities(nodesByCapability, extraNodesByCapability)
+	nodes := nodesByCapability[c]
+	p := &Probe{Capability: c, Package: queriedPkg}
+	for v := range nodes {
+		p.Classified = append(p.Classified, v.Func.String())
+	}
+	slices.Sort(p.Classified)
+	if len(nodes) == 0 {
+		return p, nil
+	}
+
+	inQueried := func(v *callgraph.Node) bool {
+		return v.Func != nil && v.Func.Package() != nil && v.Func.Package().Pkg.Path() == queriedPkg
+	}
+	start := nodesetPerCapability{c: nodes}
+	bfs, err := searchBackwardsFromCapabilities(ctx, start, callCapabilities, safe, allNodesWithExplicitCapability, config.Classifier)
+	if err != nil {
+		return nil, err
+	}
+	if p.Reachable = slices.ContainsFunc(bfs.nodes, inQueried); p.Reachable {
+		p.ReachableIgnoringPruning = true
+		return p, nil
+	}
+	unpruned, err := searchBackwardsFromCapabilities(ctx, start, callCapabilities, nil, nil, config.Classifier)
+	if err != nil {
+		return nil, err
+	}
+	pruned := make(map[string]struct{})
+	for _, v := range unpruned.nodes {
+		if !inQueried(v) {
+			continue
+		}
+		p.ReachableIgnoringPruning = true
+		// Find the first function in the example path from v which the
+		// search with pruning would not have followed.
+		for w := v; w != nil; w = unpruned.state(w).next() {
+			_, isSafe := safe[w]
+			_, isExplicit := allNodesWithExplicitCapability[w]
+			_, isStart := nodes[w]
+			if isSafe || (isExplicit && !isStart) {
+				pruned[w.Func.String()] = struct{}{}
+				break
+			}
+		}
+	}
+	for name := range pruned {
+		p.PrunedBy = append(p.PrunedBy, name)
+	}
+	slices.Sort(p.PrunedBy)
+	return p, nil
+}
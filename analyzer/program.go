@@ -0,0 +1,280 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"slices"
+	"strconv"
+	"sync"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+)
+
+// Program is a set of packages which is analyzed repeatedly, for example by
+// a tool which runs the analysis again whenever a file is saved.  It keeps
+// the loaded packages, and the call graph built from them, between analyses,
+// so that they are only updated after Invalidate reports that some of the
+// packages have changed.
+//
+// To use a Program, pass the packages returned by its Packages method to the
+// analysis functions, with Config.Program set to the Program.  The call graph
+// is reused for any Config with the same CallGraphAlgorithm.
+//
+// After a change, only the changed packages and the packages which import
+// them, directly or indirectly, are parsed and type-checked again; the other
+// packages are reused as they are.  If that is not possible, for example
+// because a changed package uses cgo or now imports a package which was not
+// loaded, all the packages are loaded again.  The SSA form and call graph of
+// a program cannot be updated in place, so they are always built again.
+type Program struct {
+	load func() ([]*packages.Package, error)
+
+	mu     sync.Mutex
+	pkgs   []*packages.Package // nil if the packages need to be loaded
+	stale  map[*packages.Package]struct{}
+	graphs map[CallGraphAlgorithm]*programGraph
+}
+
+// programGraph holds the results of buildGraph for a Program.
+type programGraph struct {
+	graph        *callgraph.Graph
+	ssaProg      *ssa.Program
+	allFunctions map[*ssa.Function]bool
+}
+
+// NewProgram returns a Program whose packages are loaded by calling load.
+// load is called immediately, and again by Packages after a change reported
+// to Invalidate if the changed packages cannot be type-checked again on their
+// own.  load need not use go/packages, as long as the packages it returns
+// have the information described at PackagesLoadModeNeeded.
+func NewProgram(load func() ([]*packages.Package, error)) (*Program, error) {
+	p := &Program{load: load}
+	if _, err := p.Packages(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// LoadProgram returns a Program for the named packages, which are loaded
+// using LoadPackages.
+func LoadProgram(packageNames []string, lcfg LoadConfig) (*Program, error) {
+	return NewProgram(func() ([]*packages.Package, error) {
+		return LoadPackages(packageNames, lcfg)
+	})
+}
+
+// Packages returns the packages of the Program, updating them first if they
+// have changed since they were last loaded.
+func (p *Program) Packages() ([]*packages.Package, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pkgs != nil && p.stale == nil {
+		return p.pkgs, nil
+	}
+	var (
+		pkgs []*packages.Package
+		err  error
+	)
+	if p.pkgs != nil {
+		pkgs, err = p.recheck()
+	}
+	if p.pkgs == nil || err != nil {
+		if pkgs, err = p.load(); err != nil {
+			return nil, err
+		}
+	}
+	p.pkgs, p.stale = pkgs, nil
+	p.graphs = make(map[CallGraphAlgorithm]*programGraph)
+	return pkgs, nil
+}
+
+// Invalidate reports that the packages with the given import paths have
+// changed.  If any of them is one of the Program's packages or their
+// dependencies, the Program marks them, and the packages which import them,
+// to be type-checked again, and discards its call graphs, so that they are
+// updated and built again when next used, and Invalidate returns true.
+// Otherwise, it does nothing and returns false.
+func (p *Program) Invalidate(pkgPaths ...string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pkgs == nil {
+		return false
+	}
+	changed := make(map[string]struct{})
+	for _, path := range pkgPaths {
+		changed[path] = struct{}{}
+	}
+	// Dependencies are visited before the packages which import them, so
+	// each package's imports are already known to be stale or not.
+	stale := make(map[*packages.Package]struct{})
+	forEachPackageIncludingDependencies(p.pkgs, func(pkg *packages.Package) {
+		_, ok := changed[pkg.PkgPath]
+		for _, dep := range pkg.Imports {
+			if _, s := stale[dep]; s {
+				ok = true
+			}
+		}
+		if ok {
+			stale[pkg] = struct{}{}
+		}
+	})
+	if len(stale) == 0 {
+		return false
+	}
+	if p.stale == nil {
+		p.stale = stale
+	} else {
+		for pkg := range stale {
+			p.stale[pkg] = struct{}{}
+		}
+	}
+	p.graphs = nil
+	return true
+}
+
+// recheck returns the Program's packages after parsing and type-checking the
+// stale packages again from the current contents of their files, reusing the
+// other packages.  It returns an error if a stale package cannot be
+// type-checked on its own.  p.mu must be held.
+func (p *Program) recheck() ([]*packages.Package, error) {
+	rechecked := make(map[*packages.Package]*packages.Package)
+	var update func(old *packages.Package) (*packages.Package, error)
+	update = func(old *packages.Package) (*packages.Package, error) {
+		if _, ok := p.stale[old]; !ok {
+			return old, nil
+		}
+		if pkg, ok := rechecked[old]; ok {
+			return pkg, nil
+		}
+		pkg, err := recheckPackage(old, update)
+		if err != nil {
+			return nil, err
+		}
+		rechecked[old] = pkg
+		return pkg, nil
+	}
+	pkgs := make([]*packages.Package, len(p.pkgs))
+	for i, old := range p.pkgs {
+		pkg, err := update(old)
+		if err != nil {
+			return nil, err
+		}
+		pkgs[i] = pkg
+	}
+	return pkgs, nil
+}
+
+// recheckPackage returns a copy of old whose files have been parsed and
+// type-checked again, with the packages it imports replaced by the results of
+// calling update on them.  It returns an error if old uses cgo, imports a
+// package which is not in old.Imports, or has errors.
+func recheckPackage(old *packages.Package, update func(*packages.Package) (*packages.Package, error)) (*packages.Package, error) {
+	if old.Fset == nil || !slices.Equal(old.GoFiles, old.CompiledGoFiles) {
+		return nil, fmt.Errorf("package %s cannot be type-checked again on its own", old.PkgPath)
+	}
+	files := make([]*ast.File, len(old.CompiledGoFiles))
+	for i, name := range old.CompiledGoFiles {
+		f, err := parser.ParseFile(old.Fset, name, nil, parser.AllErrors|parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		files[i] = f
+	}
+	imports := make(map[string]*packages.Package)
+	for _, f := range files {
+		for _, spec := range f.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := imports[path]; ok {
+				continue
+			}
+			dep, ok := old.Imports[path]
+			if !ok {
+				return nil, fmt.Errorf("package %s: import of %q was not loaded", old.PkgPath, path)
+			}
+			if imports[path], err = update(dep); err != nil {
+				return nil, err
+			}
+		}
+	}
+	conf := types.Config{
+		Importer: importerFunc(func(path string) (*types.Package, error) {
+			if dep, ok := imports[path]; ok {
+				return dep.Types, nil
+			}
+			return nil, fmt.Errorf("package %s: import of %q was not loaded", old.PkgPath, path)
+		}),
+		Sizes: old.TypesSizes,
+	}
+	if old.Module != nil && old.Module.GoVersion != "" {
+		conf.GoVersion = "go" + old.Module.GoVersion
+	}
+	info := &types.Info{
+		Types:        make(map[ast.Expr]types.TypeAndValue),
+		Defs:         make(map[*ast.Ident]types.Object),
+		Uses:         make(map[*ast.Ident]types.Object),
+		Implicits:    make(map[ast.Node]types.Object),
+		Instances:    make(map[*ast.Ident]types.Instance),
+		Scopes:       make(map[ast.Node]*types.Scope),
+		Selections:   make(map[*ast.SelectorExpr]*types.Selection),
+		FileVersions: make(map[*ast.File]string),
+	}
+	tpkg, err := conf.Check(old.PkgPath, old.Fset, files, info)
+	if err != nil {
+		return nil, err
+	}
+	pkg := *old
+	pkg.Syntax, pkg.Types, pkg.TypesInfo, pkg.Imports = files, tpkg, info, imports
+	pkg.Errors, pkg.IllTyped = nil, false
+	return &pkg, nil
+}
+
+// importerFunc is a types.Importer which calls the function.
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+// holds returns true if pkgs is the current set of packages of the Program.
+// p.mu must be held.
+func (p *Program) holds(pkgs []*packages.Package) bool {
+	if p.pkgs == nil || p.stale != nil || len(pkgs) != len(p.pkgs) {
+		return false
+	}
+	for i := range pkgs {
+		if pkgs[i] != p.pkgs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// buildGraph returns the call graph of pkgs for config.CallGraphAlgorithm,
+// building it if it has not been built already.  The SSA form is always built
+// with syntax information, so that it is suitable for every analysis.  ok is
+// false if pkgs are not the current packages of the Program.
+func (p *Program) buildGraph(pkgs []*packages.Package, config *Config) (graph *callgraph.Graph, ssaProg *ssa.Program, allFunctions map[*ssa.Function]bool, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.holds(pkgs) {
+		return nil, nil, nil, false
+	}
+	g, ok := p.graphs[config.CallGraphAlgorithm]
+	if !ok {
+		g = new(programGraph)
+		g.graph, g.ssaProg, g.allFunctions = newGraph(pkgs, true, config)
+		p.graphs[config.CallGraphAlgorithm] = g
+	}
+	return g.graph, g.ssaProg, g.allFunctions, true
+}
@@ -0,0 +1,89 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"sort"
+
+	cpb "github.com/google/capslock/proto"
+)
+
+// ProgressStage identifies a milestone in an analysis.
+type ProgressStage int8
+
+const (
+	// ProgressPackagesLoaded is reported when the analysis starts.  Count is
+	// the number of packages, including dependencies.
+	ProgressPackagesLoaded ProgressStage = iota + 1
+	// ProgressSSABuilt is reported when the SSA form of the packages has been
+	// built.  Count is the number of functions.
+	ProgressSSABuilt
+	// ProgressCallGraphBuilt is reported when the call graph has been built.
+	// Count is the number of nodes in the call graph.
+	ProgressCallGraphBuilt
+	// ProgressSearchStarted is reported when the search for paths to a
+	// capability starts.  Capability is the capability, and Count is the
+	// number of functions which have it.
+	ProgressSearchStarted
+	// ProgressComplete is reported when the analysis is complete.  Count is
+	// the number of capabilities searched for.
+	ProgressComplete
+)
+
+func (s ProgressStage) String() string {
+	switch s {
+	case ProgressPackagesLoaded:
+		return "packages loaded"
+	case ProgressSSABuilt:
+		return "SSA built"
+	case ProgressCallGraphBuilt:
+		return "call graph built"
+	case ProgressSearchStarted:
+		return "search started"
+	case ProgressComplete:
+		return "analysis complete"
+	}
+	return "unknown stage"
+}
+
+// ProgressEvent describes a milestone in an analysis.  See Config.ProgressFn.
+type ProgressEvent struct {
+	Stage ProgressStage
+	// Count is a number of items relevant to the stage; see the description of
+	// each stage.
+	Count int
+	// Capability is the capability being searched for, for
+	// ProgressSearchStarted events.
+	Capability cpb.Capability
+}
+
+// progress calls config.ProgressFn with e, if it is non-nil.
+func (config *Config) progress(e ProgressEvent) {
+	if config.ProgressFn != nil {
+		config.ProgressFn(e)
+	}
+}
+
+// searchStarted reports a ProgressSearchStarted event for each capability in
+// nodesByCapability, in order.
+func (config *Config) searchStarted(nodesByCapability nodesetPerCapability) {
+	if config.ProgressFn == nil {
+		return
+	}
+	var caps []cpb.Capability
+	for c := range nodesByCapability {
+		caps = append(caps, c)
+	}
+	sort.Slice(caps, func(i, j int) bool { return caps[i] < caps[j] })
+	for _, c := range caps {
+		config.ProgressFn(ProgressEvent{
+			Stage:      ProgressSearchStarted,
+			Count:      len(nodesByCapability[c]),
+			Capability: c,
+		})
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"context"
+	"go/types"
+	"slices"
+	"sort"
+
+	cpb "github.com/google/capslock/proto"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+)
+
+// CapabilityIndex answers queries about the capabilities of individual
+// functions in a set of packages.  The call graph is built, and searched
+// backwards from the functions with each capability, once when the index is
+// created, so that each query only needs to look up the results.
+type CapabilityIndex struct {
+	config *Config
+	// modules maps package paths to modules, as returned by packageModules.
+	modules map[string]*cpb.ModuleInfo
+	// nodes maps function names to call graph nodes.
+	nodes map[string]*callgraph.Node
+	caps  []cpb.Capability
+	// searches contains the state of the search for each capability in caps.
+	searches map[cpb.Capability]*bfsStateMap
+}
+
+// NewCapabilityIndex analyzes the packages in pkgs, and their dependencies,
+// and returns an index which can be used to query the capabilities of the
+// functions in them.
+//
+// NewCapabilityIndex may modify pkgs.  If ctx is cancelled before the
+// analysis is complete, it returns ctx.Err().
+func NewCapabilityIndex(ctx context.Context, pkgs []*packages.Package, config *Config) (*CapabilityIndex, error) {
+	config = pruneCalls(pkgs, config)
+	_, safe, nodesByCapability, extraNodesByCapability, callCapabilities, sites, err := getPackageNodesWithCapability(pkgs, config)
+	if err != nil {
+		return nil, err
+	}
+	nodesByCapability, allNodesWithExplicitCapability := mergeCapabilities(nodesByCapability, extraNodesByCapability)
+	idx := &CapabilityIndex{
+		config:   config,
+		modules:  packageModules(pkgs, config.ReportReplacedAsLocal),
+		nodes:    make(map[string]*callgraph.Node),
+		searches: make(map[cpb.Capability]*bfsStateMap),
+	}
+	for c, nodes := range nodesByCapability {
+		config.searchStarted(nodesetPerCapability{c: nodes})
+		bfs, err := searchBackwardsFromCapabilities(ctx, nodesetPerCapability{c: nodes}, callCapabilities, safe, allNodesWithExplicitCapability, config.Classifier)
+		if err != nil {
+			return nil, err
+		}
+		bfs.sites = sites[c]
+		idx.caps = append(idx.caps, c)
+		idx.searches[c] = bfs
+		for _, v := range bfs.nodes {
+			if v.Func != nil && v.Func.Package() != nil {
+				idx.nodes[v.Func.String()] = v
+			}
+		}
+	}
+	sort.Slice(idx.caps, func(i, j int) bool { return idx.caps[i] < idx.caps[j] })
+	config.progress(ProgressEvent{Stage: ProgressComplete, Count: len(idx.caps)})
+	return idx, nil
+}
+
+// FunctionCapabilities returns a CapabilityInfo for each capability of the
+// named function, with an example path to a function with that capability.
+// The function name is in the form used in CapabilityInfo paths, e.g.
+// "example.com/pkg.Foo" or "(*example.com/pkg.T).Bar".  The CapabilityType of
+// each result shows whether the capability is direct or transitive.
+//
+// The result is empty if the function has no capabilities, or if there is no
+// function with that name in the analyzed packages.
+func (idx *CapabilityIndex) FunctionCapabilities(fn string) []*cpb.CapabilityInfo {
+	v, ok := idx.nodes[fn]
+	if !ok {
+		return nil
+	}
+	var cis []*cpb.CapabilityInfo
+	for _, c := range idx.caps {
+		bfs := idx.searches[c]
+		if _, ok := bfs.get(v); !ok {
+			continue
+		}
+		ci, _ := capabilityInfo(c, bfs, v, idx.modules, idx.config)
+		cis = append(cis, ci)
+	}
+	return cis
+}
+
+// FunctionCapabilities analyzes the packages in pkgs, and returns a
+// CapabilityInfo for each capability of the named function.  See
+// CapabilityIndex.FunctionCapabilities for details.  To query several
+// functions, use NewCapabilityIndex instead, which analyzes the packages only
+// once.
+func FunctionCapabilities(ctx context.Context, pkgs []*packages.Package, fn string, config *Config) ([]*cpb.CapabilityInfo, error) {
+	idx, err := NewCapabilityIndex(ctx, pkgs, config)
+	if err != nil {
+		return nil, err
+	}
+	return idx.FunctionCapabilities(fn), nil
+}
+
+// CapabilityFunctionIndex analyzes the packages in pkgs, and their
+// dependencies, and returns the functions which have each capability
+// themselves, because they are classified with it or because of what their
+// code does, such as converting an unsafe.Pointer.  These are the functions
+// at the end of the paths reported by GetCapabilityInfo, but unlike
+// GetCapabilityInfo, the result does not depend on whether the functions can
+// be reached from any particular package, so it lists everything in the
+// program that has each capability.
+//
+// Each Function has its name, package, and the position of its declaration,
+// if known.  The functions for each capability are sorted by name.  If
+// config.CapabilitySet is non-nil, only capabilities in the set are included.
+func CapabilityFunctionIndex(pkgs []*packages.Package, config *Config) (map[cpb.Capability][]*cpb.Function, error) {
+	_, _, nodesByCapability, extraNodesByCapability, _, _, err := getPackageNodesWithCapability(pkgs, config)
+	if err != nil {
+		return nil, err
+	}
+	nodesByCapability, _ = mergeCapabilities(nodesByCapability, extraNodesByCapability)
+	out := make(map[cpb.Capability][]*cpb.Function)
+	for c, nodes := range nodesByCapability {
+		if !config.CapabilitySet.Has(c) {
+			continue
+		}
+		var fns []*cpb.Function
+		for v := range nodes {
+			if v.Func != nil {
+				addFunction(&fns, v, nil)
+			}
+		}
+		if len(fns) == 0 {
+			continue
+		}
+		sort.Slice(fns, func(i, j int) bool { return fns[i].GetName() < fns[j].GetName() })
+		out[c] = fns
+	}
+	return out, nil
+}
+
+// ExportedSymbolCapabilities returns the capabilities of each exported
+// function of the packages in pkgs, and each exported method of their
+// exported types, as found by using each of them as the starting point of
+// paths to capabilities.  This can be used to document the capabilities of
+// each part of a library's API.
+//
+// The result is keyed by function name, in the form used in CapabilityInfo
+// paths, such as "example.com/pkg.Parse" or "(*example.com/pkg.T).Fetch".
+// Every exported function and method is included, with no capabilities if it
+// has none.  The capabilities of each are sorted.  If config.CapabilitySet is
+// non-nil, only capabilities in the set are included.
+//
+// If ctx is cancelled before the analysis is complete,
+// ExportedSymbolCapabilities returns ctx.Err().
+func ExportedSymbolCapabilities(ctx context.Context, pkgs []*packages.Package, config *Config) (map[string][]cpb.Capability, error) {
+	config = pruneCalls(pkgs, config)
+	out := make(map[string][]cpb.Capability)
+	add := func(f *types.Func) {
+		if f.Exported() {
+			out[f.FullName()] = nil
+		}
+	}
+	queriedPackages := GetQueriedPackages(pkgs)
+	for p := range queriedPackages {
+		scope := p.Scope()
+		for _, name := range scope.Names() {
+			switch obj := scope.Lookup(name).(type) {
+			case *types.Func:
+				add(obj)
+			case *types.TypeName:
+				if n, ok := obj.Type().(*types.Named); ok && obj.Exported() && !obj.IsAlias() {
+					for i := 0; i < n.NumMethods(); i++ {
+						add(n.Method(i))
+					}
+				}
+			}
+		}
+	}
+	inQueried := inPackages(queriedPackages)
+	queried := func(f *ssa.Function) bool { return isExported(f) && inQueried(f) }
+	err := forEachPathFrom(ctx, pkgs, queried,
+		func(cap cpb.Capability, nodes *bfsStateMap, v *callgraph.Node) {
+			f, ok := v.Func.Object().(*types.Func)
+			if !ok {
+				return
+			}
+			name := f.FullName()
+			if _, ok := out[name]; ok && !slices.Contains(out[name], cap) {
+				out[name] = append(out[name], cap)
+			}
+		}, config.CapabilitySet.Has, config)
+	if err != nil {
+		return nil, err
+	}
+	for _, caps := range out {
+		slices.Sort(caps)
+	}
+	return out, nil
+}
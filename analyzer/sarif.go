@@ -0,0 +1,263 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"encoding/json"
+	"io"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	cpb "github.com/google/capslock/proto"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// The following types are a subset of the SARIF 2.1.0 object model, containing
+// only the properties that WriteSARIF populates.  See
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html for the
+// full specification.
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                        `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactLocation `json:"originalUriBaseIds,omitempty"`
+	Results            []sarifResult                    `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules,omitempty"`
+}
+
+type sarifRule struct {
+	ID               string          `json:"id"`
+	ShortDescription sarifMessage    `json:"shortDescription"`
+	Properties       *sarifRuleProps `json:"properties,omitempty"`
+}
+
+type sarifRuleProps struct {
+	Tags []string `json:"tags,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI         string        `json:"uri,omitempty"`
+	URIBaseID   string        `json:"uriBaseId,omitempty"`
+	Description *sarifMessage `json:"description,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int64 `json:"startLine,omitempty"`
+	StartColumn int64 `json:"startColumn,omitempty"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// WriteSARIF writes the contents of cil to w as a SARIF 2.1.0 log.
+//
+// Each CapabilityInfo becomes a result whose ruleId is the name of the
+// capability.  The CWE identifiers of the entries for each capability are
+// added to its rule as tags of the form "external/cwe/cwe-78", which code
+// scanning tools use to link rules to CWE entries.  Direct capabilities are reported with level "warning", and
+// transitive capabilities with level "note".  The primary location of each
+// result is in the first function of the path; when no source position is
+// available, for example because paths were omitted, the location refers to
+// the package directory instead.
+//
+// Each versioned module in cil.ModuleInfo is added to the run's
+// originalUriBaseIds, and locations in packages belonging to that module are
+// made relative to it.  The base has no uri, since the module's location on
+// disk is not known, only a description naming the module and version.  Main
+// modules have no version, so their locations are left as they are.
+func WriteSARIF(w io.Writer, cil *cpb.CapabilityInfoList) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "capslock",
+			InformationURI: "https://github.com/google/capslock",
+		}},
+		Results: []sarifResult{},
+	}
+	var modules []*cpb.ModuleInfo
+	for _, m := range cil.GetModuleInfo() {
+		if m.GetVersion() == "" {
+			continue
+		}
+		modules = append(modules, m)
+		if run.OriginalURIBaseIDs == nil {
+			run.OriginalURIBaseIDs = make(map[string]sarifArtifactLocation)
+		}
+		run.OriginalURIBaseIDs[m.GetPath()] = sarifArtifactLocation{
+			Description: &sarifMessage{Text: "Module " + m.GetPath() + "@" + m.GetVersion()},
+		}
+	}
+	rules := make(map[string][]string) // rule ID to tags
+	for _, ci := range cil.GetCapabilityInfo() {
+		ruleID := ci.GetCapability().String()
+		tags := rules[ruleID]
+		for _, id := range ci.GetCwe() {
+			if tag := "external/cwe/" + strings.ToLower(id); !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		rules[ruleID] = tags
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    ruleID,
+			Level:     sarifLevel(ci.GetCapabilityType()),
+			Message:   sarifMessage{Text: sarifMessageText(ci)},
+			Locations: []sarifLocation{sarifPrimaryLocation(ci, modules)},
+		})
+	}
+	var ruleIDs []string
+	for id := range rules {
+		ruleIDs = append(ruleIDs, id)
+	}
+	sort.Slice(ruleIDs, func(i, j int) bool {
+		return cpb.Capability_value[ruleIDs[i]] < cpb.Capability_value[ruleIDs[j]]
+	})
+	for _, id := range ruleIDs {
+		rule := sarifRule{
+			ID:               id,
+			ShortDescription: sarifMessage{Text: "Use of " + strings.TrimPrefix(id, "CAPABILITY_") + " capability"},
+		}
+		if tags := rules[id]; len(tags) > 0 {
+			rule.Properties = &sarifRuleProps{Tags: tags}
+		}
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, rule)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs:    []sarifRun{run},
+	})
+}
+
+// sarifLevel returns the SARIF result level for a capability type.
+func sarifLevel(t cpb.CapabilityType) string {
+	switch t {
+	case cpb.CapabilityType_CAPABILITY_TYPE_DIRECT:
+		return "warning"
+	case cpb.CapabilityType_CAPABILITY_TYPE_TRANSITIVE:
+		return "note"
+	}
+	return "none"
+}
+
+func sarifMessageText(ci *cpb.CapabilityInfo) string {
+	var b strings.Builder
+	b.WriteString("Package ")
+	b.WriteString(ci.GetPackageDir())
+	b.WriteString(" has capability ")
+	b.WriteString(ci.GetCapability().String())
+	if dp := ci.GetDepPath(); dp != "" {
+		b.WriteString(" via call path: ")
+		b.WriteString(dp)
+	} else if p := ci.GetPath(); len(p) > 0 {
+		b.WriteString(" in function ")
+		b.WriteString(p[0].GetName())
+	}
+	return b.String()
+}
+
+// sarifPrimaryLocation returns the location of the first function in the path
+// of ci.  The position is taken from the call site of the second function,
+// which is in the first function's body, or if that is unavailable, from the
+// declaration of the first function.
+func sarifPrimaryLocation(ci *cpb.CapabilityInfo, modules []*cpb.ModuleInfo) sarifLocation {
+	var loc sarifLocation
+	p := ci.GetPath()
+	if len(p) > 0 {
+		loc.LogicalLocations = []sarifLogicalLocation{{
+			FullyQualifiedName: p[0].GetName(),
+			Kind:               "function",
+		}}
+	}
+	var site *cpb.Function_Site
+	if len(p) > 1 {
+		site = p[1].GetSite()
+	}
+	if site == nil && len(p) > 0 {
+		site = p[0].GetDeclaration()
+	}
+	dir := ci.GetPackageDir()
+	if site == nil || site.GetFilename() == "" {
+		// No position is available, so we produce a synthetic location
+		// referring to the package directory.
+		loc.PhysicalLocation = &sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocationFor(dir+"/", modules),
+		}
+		return loc
+	}
+	loc.PhysicalLocation = &sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocationFor(path.Join(dir, site.GetFilename()), modules),
+		Region: &sarifRegion{
+			StartLine:   site.GetLine(),
+			StartColumn: site.GetColumn(),
+		},
+	}
+	return loc
+}
+
+// sarifArtifactLocationFor returns an artifact location for the file or
+// directory with the given import-path-based name.  If the name is inside one
+// of modules, the location is relative to that module's base URI.
+func sarifArtifactLocationFor(name string, modules []*cpb.ModuleInfo) sarifArtifactLocation {
+	var best string
+	for _, m := range modules {
+		mp := m.GetPath()
+		if strings.HasPrefix(name, mp+"/") && len(mp) > len(best) {
+			best = mp
+		}
+	}
+	if best == "" {
+		return sarifArtifactLocation{URI: name}
+	}
+	return sarifArtifactLocation{
+		URI:       strings.TrimPrefix(name, best+"/"),
+		URIBaseID: best,
+	}
+}
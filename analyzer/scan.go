@@ -7,6 +7,8 @@
 package analyzer
 
 import (
+	"bufio"
+	"context"
 	"embed"
 	"fmt"
 	"go/types"
@@ -31,13 +33,13 @@ func (d DifferenceFoundError) Error() string {
 	return "difference found"
 }
 
-func RunCapslock(args []string, output string, pkgs []*packages.Package, queriedPackages map[*types.Package]struct{},
+func RunCapslock(ctx context.Context, args []string, output string, pkgs []*packages.Package, queriedPackages map[*types.Package]struct{},
 	config *Config) error {
 	if output == "compare" {
 		if len(args) != 1 {
 			return fmt.Errorf("Usage: %s -output=compare <filename>; provided %v args", programName(), len(args))
 		}
-		different, err := compare(args[0], pkgs, queriedPackages, config)
+		different, err := compare(ctx, args[0], pkgs, queriedPackages, config)
 		if err != nil {
 			return err
 		}
@@ -52,16 +54,28 @@ func RunCapslock(args []string, output string, pkgs []*packages.Package, queried
 		"format": templateFormat,
 	}
 	if output == "json" || output == "j" {
-		cil := GetCapabilityInfo(pkgs, queriedPackages, config)
+		cil, err := GetCapabilityInfo(ctx, pkgs, queriedPackages, config)
+		if err != nil {
+			return err
+		}
 		b, err := protojson.MarshalOptions{Multiline: true, Indent: "\t"}.Marshal(cil)
 		if err != nil {
 			return fmt.Errorf("internal error: couldn't marshal protocol buffer: %s", err.Error())
 		}
 		fmt.Println(string(b))
 		return nil
+	} else if output == "jsonl" {
+		w := bufio.NewWriter(os.Stdout)
+		if err := StreamCapabilityInfoJSONL(ctx, w, pkgs, queriedPackages, config); err != nil {
+			return err
+		}
+		return w.Flush()
 	} else if output == "m" || output == "machine" {
 		var cs []string
-		cil := GetCapabilityCounts(pkgs, queriedPackages, config)
+		cil, err := GetCapabilityCounts(ctx, pkgs, queriedPackages, config)
+		if err != nil {
+			return err
+		}
 		for c := range cil.CapabilityCounts {
 			cs = append(cs, c)
 		}
@@ -70,14 +84,64 @@ func RunCapslock(args []string, output string, pkgs []*packages.Package, queried
 			fmt.Println(c)
 		}
 		return nil
+	} else if output == "csv" {
+		cl, err := GetCapabilityCounts(ctx, pkgs, queriedPackages, config)
+		if err != nil {
+			return err
+		}
+		return WriteCountsCSV(os.Stdout, cl)
+	} else if output == "csv-stats" {
+		sl, err := GetCapabilityStats(ctx, pkgs, queriedPackages, config)
+		if err != nil {
+			return err
+		}
+		return WriteStatsCSV(os.Stdout, sl)
 	} else if output == "v" || output == "verbose" {
-		cil := GetCapabilityStats(pkgs, queriedPackages, config)
+		cil, err := GetCapabilityStats(ctx, pkgs, queriedPackages, config)
+		if err != nil {
+			return err
+		}
 		ctm := template.Must(template.New("verbose.tmpl").Funcs(templateFuncMap).ParseFS(staticContent, "static/verbose.tmpl"))
 		return ctm.Execute(os.Stdout, cil)
+	} else if output == "html" {
+		cil, err := GetCapabilityInfo(ctx, pkgs, queriedPackages, config)
+		if err != nil {
+			return err
+		}
+		return WriteHTMLReport(os.Stdout, cil)
+	} else if output == "envvars" {
+		el, err := GetReachableEnvVars(ctx, pkgs, queriedPackages, config)
+		if err != nil {
+			return err
+		}
+		b, err := protojson.MarshalOptions{Multiline: true, Indent: "\t"}.Marshal(el)
+		if err != nil {
+			return fmt.Errorf("internal error: couldn't marshal protocol buffer: %s", err.Error())
+		}
+		fmt.Println(string(b))
+		return nil
+	} else if output == "embeds" {
+		b, err := protojson.MarshalOptions{Multiline: true, Indent: "\t"}.Marshal(GetEmbedPatterns(pkgs))
+		if err != nil {
+			return fmt.Errorf("internal error: couldn't marshal protocol buffer: %s", err.Error())
+		}
+		fmt.Println(string(b))
+		return nil
 	} else if output == "g" || output == "graph" {
-		return graphOutput(pkgs, queriedPackages, config)
+		return graphOutput(ctx, pkgs, queriedPackages, config)
+	} else if output == "graphml" {
+		return graphMLOutput(ctx, pkgs, queriedPackages, config)
+	} else if output == "sarif" {
+		cil, err := GetCapabilityInfo(ctx, pkgs, queriedPackages, config)
+		if err != nil {
+			return err
+		}
+		return WriteSARIF(os.Stdout, cil)
+	}
+	cil, err := GetCapabilityCounts(ctx, pkgs, queriedPackages, config)
+	if err != nil {
+		return err
 	}
-	cil := GetCapabilityCounts(pkgs, queriedPackages, config)
 	ctm := template.Must(template.New("default.tmpl").Funcs(templateFuncMap).ParseFS(staticContent, "static/default.tmpl"))
 	return ctm.Execute(os.Stdout, cil)
 }
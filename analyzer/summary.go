@@ -0,0 +1,64 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"context"
+	"go/types"
+
+	cpb "github.com/google/capslock/proto"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/packages"
+)
+
+// PackageSummary describes the capabilities of a package, without the
+// functions or paths which have them.
+type PackageSummary struct {
+	// Module is the path of the module containing the package, "std" for
+	// the standard library, or the package's own path if it has no module.
+	Module string
+	// Capabilities contains each capability of the package, and whether any
+	// function in the package has the capability directly.  If not, the
+	// capability is transitive.
+	Capabilities map[cpb.Capability]cpb.CapabilityType
+}
+
+// PackageCapabilitySummary returns a summary of the capabilities of each of
+// the queried packages, keyed by package path.  Packages with no
+// capabilities are included, with an empty set of capabilities.  Packages
+// matching config.ExcludePackages, and with config.ExcludeReplaced those in
+// replaced modules, are not included.
+//
+// A capability is direct for a package if any function in the package has a
+// direct path to it.  Once a capability is known to be direct for a package,
+// no more paths from the package to it are examined, so this is cheaper than
+// GetCapabilityInfo.
+//
+// If ctx is cancelled before the analysis is complete,
+// PackageCapabilitySummary returns ctx.Err() and no results.
+func PackageCapabilitySummary(ctx context.Context, pkgs []*packages.Package, queriedPackages map[*types.Package]struct{}, config *Config) (map[string]PackageSummary, error) {
+	modules := modulePaths(pkgs, config.ReportReplacedAsLocal)
+	out := make(map[string]PackageSummary)
+	for p := range queriedPackagesToReport(pkgs, queriedPackages, config) {
+		out[p.Path()] = PackageSummary{
+			Module:       modules[p.Path()],
+			Capabilities: make(map[cpb.Capability]cpb.CapabilityType),
+		}
+	}
+	err := forEachPath(ctx, pkgs, queriedPackages,
+		func(cap cpb.Capability, nodes *bfsStateMap, v *callgraph.Node) {
+			s, ok := out[v.Func.Package().Pkg.Path()]
+			if !ok || s.Capabilities[cap] == cpb.CapabilityType_CAPABILITY_TYPE_DIRECT {
+				return
+			}
+			s.Capabilities[cap] = pathType(nodes, v)
+		}, nil, config)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"slices"
+	"strings"
+
+	cpb "github.com/google/capslock/proto"
+)
+
+// PackageTreeNode is a node in a tree of capabilities grouped by package
+// path, as returned by BuildCapabilityTree.  Each node corresponds to a
+// prefix of one or more package paths, ending at a "/".
+type PackageTreeNode struct {
+	// Name is the last element of Path, or "" for the root of the tree.
+	Name string
+	// Path is the path prefix the node corresponds to, e.g. "github.com/org".
+	Path string
+	// Counts contains the number of CapabilityInfo entries for each
+	// capability in the packages at or below this node.
+	Counts map[cpb.Capability]int
+	// Children contains the nodes for the longer path prefixes, sorted by
+	// name.
+	Children []*PackageTreeNode
+	// CapabilityInfo contains the entries for the package whose path is Path,
+	// if there is one.  This is usually a leaf node, unless other packages
+	// are nested under the package's path.
+	CapabilityInfo []*cpb.CapabilityInfo
+}
+
+// BuildCapabilityTree returns a tree of the entries in cil, nested by the
+// elements of their package paths, with the number of entries for each
+// capability aggregated at each node.  The returned node is the root of the
+// tree, with an empty path.  Chains of nodes with a single child and no
+// entries are not collapsed, so "github.com/org/repo/pkg" is under nodes for
+// "github.com", "github.com/org" and "github.com/org/repo".
+func BuildCapabilityTree(cil *cpb.CapabilityInfoList) *PackageTreeNode {
+	root := &PackageTreeNode{Counts: make(map[cpb.Capability]int)}
+	for _, ci := range cil.GetCapabilityInfo() {
+		n := root
+		n.Counts[ci.GetCapability()]++
+		for _, elem := range strings.Split(ci.GetPackageDir(), "/") {
+			n = n.child(elem)
+			n.Counts[ci.GetCapability()]++
+		}
+		n.CapabilityInfo = append(n.CapabilityInfo, ci)
+	}
+	root.sort()
+	return root
+}
+
+// child returns the child of n with the given name, adding it if necessary.
+func (n *PackageTreeNode) child(name string) *PackageTreeNode {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	path := name
+	if n.Path != "" {
+		path = n.Path + "/" + name
+	}
+	c := &PackageTreeNode{Name: name, Path: path, Counts: make(map[cpb.Capability]int)}
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// sort sorts the children of n and its descendants by name.
+func (n *PackageTreeNode) sort() {
+	slices.SortFunc(n.Children, func(a, b *PackageTreeNode) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	for _, c := range n.Children {
+		c.sort()
+	}
+}
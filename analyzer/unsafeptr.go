@@ -0,0 +1,66 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package analyzer
+
+import (
+	"cmp"
+	"go/token"
+	"slices"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// FunctionLocation identifies a function and its position in the source.
+type FunctionLocation struct {
+	// Package is the path of the package containing the function.
+	Package string
+	// Name is the name of the function, in the form used in CapabilityInfo
+	// paths, e.g. "example.com/pkg.Foo" or "(*example.com/pkg.T).Bar".
+	Name string
+	// Position is the position of the function's declaration.  For a package
+	// initializer, which has no declaration, it is the position of the first
+	// unsafe.Pointer conversion in the initialization of a package-scoped
+	// variable.
+	Position token.Position
+}
+
+// FindUnsafePointerFunctions returns the functions in pkgs which convert an
+// unsafe.Pointer value to another pointer type, which is what Capslock
+// reports as CAPABILITY_UNSAFE_POINTER.  A conversion in the initialization
+// of a package-scoped variable is reported for the package's init function.
+// Functions in the dependencies of pkgs are not included.  The result is
+// sorted by package and then by name.
+//
+// Unlike the capability analysis, FindUnsafePointerFunctions does not build
+// a call graph, so it is much faster.  pkgs must have been loaded with at
+// least PackagesLoadModeNeeded.
+func FindUnsafePointerFunctions(pkgs []*packages.Package) []FunctionLocation {
+	ssaProg, _ := ssautil.AllPackages(pkgs, ssa.InstantiateGenerics|ssa.GlobalDebug)
+	ssaProg.Build()
+	queried := GetQueriedPackages(pkgs)
+	var out []FunctionLocation
+	for f, pos := range findUnsafePointerConversions(pkgs, ssaProg, ssautil.AllFunctions(ssaProg)) {
+		if f.Package() == nil || f.Origin() != nil {
+			// Instantiations of generic functions are reported as their origin.
+			continue
+		}
+		if _, ok := queried[f.Package().Pkg]; !ok {
+			continue
+		}
+		out = append(out, FunctionLocation{
+			Package:  f.Package().Pkg.Path(),
+			Name:     f.String(),
+			Position: ssaProg.Fset.Position(pos),
+		})
+	}
+	slices.SortFunc(out, func(a, b FunctionLocation) int {
+		return cmp.Or(cmp.Compare(a.Package, b.Package), cmp.Compare(a.Name, b.Name))
+	})
+	return out
+}
@@ -7,15 +7,23 @@
 package analyzer
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"go/ast"
 	"go/token"
 	"go/types"
 	"os"
 	"path"
+	"sort"
 	"strings"
+	"sync"
 
 	cpb "github.com/google/capslock/proto"
 	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/callgraph/cha"
+	"golang.org/x/tools/go/callgraph/rta"
+	"golang.org/x/tools/go/callgraph/static"
 	"golang.org/x/tools/go/callgraph/vta"
 	"golang.org/x/tools/go/packages"
 	"golang.org/x/tools/go/ssa"
@@ -27,11 +35,278 @@ type bfsState struct {
 	// edge is the callgraph edge leading to the next node in a path to an
 	// interesting function.
 	edge *callgraph.Edge
+	// visited is true if the node has been reached by the search.
+	visited bool
+	// depth is the number of calls in the path from the node to an initial
+	// node of a search backwards through the call graph.
+	depth int
+	// paths is the number of distinct shortest paths from the node to an
+	// initial node of a search by forEachPathFrom, up to the limit given by
+	// Config.MaxPathCount.
+	paths int
+	// summary describes the path from the node, once it has been computed by
+	// bfsStateMap.summary.
+	summary *pathSummary
+	// output describes the path from the node as it is output, once it has
+	// been computed by bfsStateMap.output.
+	output *outputSummary
+}
+
+// pathSummary describes the path from a node found by a search backwards
+// from capabilities, so that the type and ID of the path can be found without
+// following it each time.
+type pathSummary struct {
+	// pkg is the path of the only package outside the standard library with
+	// a function in the path, or "" if there is none.
+	pkg string
+	// mixed is true if there is more than one such package.
+	mixed bool
+	// last is the path of the last package outside the standard library with
+	// a function in the path, or "" if there is none.
+	last string
+}
+
+// pathOptions are the options which change which functions of a path are
+// output, and so its ID.
+type pathOptions struct {
+	includeWrappers bool
+	collapseStdlib  bool
+}
+
+// pathOptions returns the options config sets for outputting paths.
+func (config *Config) pathOptions() pathOptions {
+	return pathOptions{includeWrappers: config.IncludeWrappers, collapseStdlib: config.CollapseStdlib}
+}
+
+// outputSummary describes the path from a node found by a search backwards
+// from capabilities as it is output, after omitting wrappers and collapsing
+// runs of standard library functions as the pathOptions require, so that the
+// ID of the path can be found without following it each time.  The output
+// path is described as a part of a longer path, whose first function is
+// never collapsed.
+type outputSummary struct {
+	// kept is the first node in the path which is output: the node itself,
+	// unless it is a wrapper which is omitted.
+	kept *callgraph.Node
+	// keptSite is the position output for kept, if it is not the node itself
+	// and the wrappers omitted before it have no call site.
+	keptSite *cpb.Function_Site
+	// std is the number of functions in the run of standard library functions
+	// starting at kept, not counting the last function of the path, if runs
+	// are collapsed.  stdLast is the package of the last function in the
+	// run, and after is the node following it in the path, which is reached
+	// by afterEdge.
+	std       int
+	stdLast   string
+	after     *callgraph.Node
+	afterEdge *callgraph.Edge
+	// alone is the hash, as computed by pathID, of the output path from kept
+	// when kept is output on its own, as the first function of a path is.
+	alone []byte
+	// hash is the hash of the output path from kept when it may begin a run
+	// of standard library functions which is collapsed.
+	hash []byte
 }
 
 // bfsStateMap represents the state of a BFS search, and can be used to trace
 // paths from the initial nodes of the search to any other node reached.
-type bfsStateMap map[*callgraph.Node]bfsState
+//
+// The callgraph package numbers the nodes of a graph densely from zero, so
+// the state of each node is stored in a slice indexed by the node's ID rather
+// than in a map keyed by the node.
+type bfsStateMap struct {
+	states []bfsState        // indexed by callgraph.Node.ID
+	nodes  []*callgraph.Node // the nodes visited, in the order they were visited
+	// sites holds the positions, within some of the initial nodes of a search
+	// backwards from capabilities, of the operations which have the capability.
+	sites map[*callgraph.Node]token.Pos
+	// outputOptions are the options with which the output summaries in
+	// states were computed.
+	outputOptions pathOptions
+}
+
+func newBFSStateMap() *bfsStateMap {
+	return new(bfsStateMap)
+}
+
+// get returns the state of v, and whether v has been visited.
+func (m *bfsStateMap) get(v *callgraph.Node) (bfsState, bool) {
+	if v.ID < 0 || v.ID >= len(m.states) {
+		return bfsState{}, false
+	}
+	s := m.states[v.ID]
+	return s, s.visited
+}
+
+// state returns the state of v, which is the zero bfsState if v has not been
+// visited.
+func (m *bfsStateMap) state(v *callgraph.Node) bfsState {
+	s, _ := m.get(v)
+	return s
+}
+
+// capabilitySite returns the position recorded in m.sites for v, or nil if
+// there is none.
+func (m *bfsStateMap) capabilitySite(v *callgraph.Node) *cpb.Function_Site {
+	pos, ok := m.sites[v]
+	if !ok || v.Func.Prog == nil || v.Func.Prog.Fset == nil {
+		return nil
+	}
+	position := v.Func.Prog.Fset.Position(pos)
+	return &cpb.Function_Site{
+		Filename: proto.String(path.Base(position.Filename)),
+		Line:     proto.Int64(int64(position.Line)),
+		Column:   proto.Int64(int64(position.Column)),
+	}
+}
+
+// reset clears the state of the search, keeping the allocated memory so that
+// it can be reused for another search of the same graph.
+func (m *bfsStateMap) reset() {
+	for _, v := range m.nodes {
+		m.states[v.ID] = bfsState{}
+	}
+	m.nodes = m.nodes[:0]
+}
+
+// visit records that v was reached by the search via edge, which is nil for
+// the initial nodes of the search.
+func (m *bfsStateMap) visit(v *callgraph.Node, edge *callgraph.Edge) {
+	if n := v.ID + 1; n > len(m.states) {
+		m.states = append(m.states, make([]bfsState, n-len(m.states))...)
+	}
+	if !m.states[v.ID].visited {
+		m.nodes = append(m.nodes, v)
+	}
+	depth := 0
+	if edge != nil {
+		depth = m.state(edge.Callee).depth + 1
+	}
+	m.states[v.ID] = bfsState{edge: edge, visited: true, depth: depth}
+}
+
+// addPaths adds n to the number of paths from v, which must have been
+// visited, without exceeding limit.
+func (m *bfsStateMap) addPaths(v *callgraph.Node, n, limit int) {
+	m.states[v.ID].paths = min(m.states[v.ID].paths+n, limit)
+}
+
+// summary returns the pathSummary for the path from v, which must have been
+// visited by a search backwards from capabilities.  Summaries are computed
+// from the summary of the next node in the path, and stored, so that finding
+// the summaries of many nodes follows each call in their paths only once.
+func (m *bfsStateMap) summary(v *callgraph.Node) *pathSummary {
+	// Find the nodes in the path from v whose summaries are not yet known.
+	var stack []*callgraph.Node
+	for w := v; w != nil && m.states[w.ID].summary == nil; w = m.states[w.ID].next() {
+		stack = append(stack, w)
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		w := stack[i]
+		s := &m.states[w.ID]
+		pkg := packagePath(w.Func)
+		if isStdLib(pkg) {
+			pkg = ""
+		}
+		next := s.next()
+		if next == nil {
+			s.summary = &pathSummary{pkg: pkg, last: pkg}
+			continue
+		}
+		ns := m.states[next.ID].summary
+		sum := &pathSummary{
+			pkg:   ns.pkg,
+			mixed: ns.mixed,
+			last:  ns.last,
+		}
+		if sum.last == "" {
+			sum.last = pkg
+		}
+		if pkg != "" && !sum.mixed {
+			if sum.pkg == "" {
+				sum.pkg = pkg
+			} else if sum.pkg != pkg {
+				sum.pkg, sum.mixed = "", true
+			}
+		}
+		s.summary = sum
+	}
+	return m.states[v.ID].summary
+}
+
+// pathID returns the identifier that the function pathID returns for the
+// path from v as it is output with the options opts.  v must have been
+// visited by a search backwards from capabilities.
+func (m *bfsStateMap) pathID(v *callgraph.Node, opts pathOptions) string {
+	if opts != m.outputOptions {
+		for _, w := range m.nodes {
+			m.states[w.ID].output = nil
+		}
+		m.outputOptions = opts
+	}
+	o := m.output(v)
+	return pathIDFromHash(m.outputSite(v, nil, o), o.alone)
+}
+
+// output returns the outputSummary for the path from v with the options
+// m.outputOptions.  As with summary, the summaries are stored, so that
+// finding the summaries of many nodes follows each call in their paths only
+// once.
+func (m *bfsStateMap) output(v *callgraph.Node) *outputSummary {
+	var stack []*callgraph.Node
+	for w := v; w != nil && m.states[w.ID].output == nil; w = m.states[w.ID].next() {
+		stack = append(stack, w)
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		w := stack[i]
+		s := &m.states[w.ID]
+		next := s.next()
+		if next == nil {
+			// The last function is always output on its own.
+			h := pathHash(w.Func.String(), nil, nil)
+			s.output = &outputSummary{kept: w, alone: h, hash: h}
+			continue
+		}
+		no := m.states[next.ID].output
+		if isWrapper(w.Func) && !m.outputOptions.includeWrappers {
+			o := *no
+			if no.kept == next {
+				o.keptSite, _ = functionSite(next, s.edge)
+			}
+			s.output = &o
+			continue
+		}
+		o := &outputSummary{kept: w}
+		o.alone = pathHash(w.Func.String(), m.outputSite(next, s.edge, no), no.hash)
+		o.hash = o.alone
+		if pkg := nodeToPackage(w); m.outputOptions.collapseStdlib && pkg != nil && isStdLib(pkg.Path()) {
+			o.std, o.stdLast, o.after, o.afterEdge = 1, pkg.Path(), next, s.edge
+			if no.std > 0 {
+				o.std, o.stdLast, o.after, o.afterEdge = no.std+1, no.stdLast, no.after, no.afterEdge
+			}
+			if o.std >= 2 {
+				// The run is collapsed as by collapseStdlib.
+				ao := m.states[o.after.ID].output
+				name := fmt.Sprintf("<std:%s...%s>", pkg.Path(), o.stdLast)
+				o.hash = pathHash(name, m.outputSite(o.after, o.afterEdge, ao), ao.hash)
+			}
+		}
+		s.output = o
+	}
+	return m.states[v.ID].output
+}
+
+// outputSite returns the position output for the first function of the
+// path from v, whose outputSummary is o, when v is reached by incomingEdge.
+// As in omitWrappers, if v is an omitted wrapper, this is the site of the
+// call to v, if there is one.
+func (m *bfsStateMap) outputSite(v *callgraph.Node, incomingEdge *callgraph.Edge, o *outputSummary) *cpb.Function_Site {
+	site, declaration := functionSite(v, incomingEdge)
+	if o.kept == v || (site != nil && !declaration) {
+		return site
+	}
+	return o.keptSite
+}
 
 // next returns the next node in the path to an interesting function.
 func (b bfsState) next() *callgraph.Node {
@@ -53,6 +328,50 @@ func (nc nodesetPerCapability) add(cap cpb.Capability, node *callgraph.Node) {
 	m[node] = struct{}{}
 }
 
+// capabilitySites records the positions of the operations within functions
+// which give them a capability, for the capabilities found by analyzing the
+// bodies of functions.
+type capabilitySites map[cpb.Capability]map[*callgraph.Node]token.Pos
+
+// add records pos for node and cap if it is valid and comes before any
+// position already recorded for them, so that the first in the source is
+// kept.
+func (cs capabilitySites) add(cap cpb.Capability, node *callgraph.Node, pos token.Pos) {
+	if !pos.IsValid() {
+		return
+	}
+	m := cs[cap]
+	if m == nil {
+		m = make(map[*callgraph.Node]token.Pos)
+		cs[cap] = m
+	}
+	if old, ok := m[node]; !ok || pos < old {
+		m[node] = pos
+	}
+}
+
+// edgeCapabilities maps calls to the categories of the call, for functions
+// whose calls are categorized individually.  A call has more than one
+// category when it may use each of them, such as a call of os.OpenFile whose
+// flags are not known.
+type edgeCapabilities map[*callgraph.Edge][]cpb.Capability
+
+// includes returns true if edge should be followed when searching for paths
+// to the nodes in nodesByCapability: that is, unless edge has its own
+// categories and its callee is not in nodesByCapability for any of them.
+func (ec edgeCapabilities) includes(edge *callgraph.Edge, nodesByCapability nodesetPerCapability) bool {
+	cs, ok := ec[edge]
+	if !ok {
+		return true
+	}
+	for _, c := range cs {
+		if _, ok := nodesByCapability[c][edge.Callee]; ok {
+			return true
+		}
+	}
+	return false
+}
+
 // byFunction is a slice of *callgraph.Node that can be sorted using sort.Sort.
 // The ordering is first by package name, then function name.
 type byFunction []*callgraph.Node
@@ -86,15 +405,20 @@ type byCallee []*callgraph.Edge
 
 func (s byCallee) Len() int { return len(s) }
 func (s byCallee) Less(i, j int) bool {
-	if c := nodeCompare(s[i].Callee, s[j].Callee); c != 0 {
-		return c < 0
-	}
-	return positionLess(callsitePosition(s[i]), callsitePosition(s[j]))
+	return calleeLess(s[i], s[j])
 }
 func (s byCallee) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 }
 
+// calleeLess orders edges by callee function, then callsite position.
+func calleeLess(a, b *callgraph.Edge) bool {
+	if c := nodeCompare(a.Callee, b.Callee); c != 0 {
+		return c < 0
+	}
+	return positionLess(callsitePosition(a), callsitePosition(b))
+}
+
 func nodeCompare(a, b *callgraph.Node) int {
 	return funcCompare(a.Func, b.Func)
 }
@@ -184,6 +508,52 @@ func callsitePosition(edge *callgraph.Edge) token.Position {
 	}
 }
 
+// functionPosition returns a token.Position for the function's declaration.
+// The position is invalid for synthetic functions.
+func functionPosition(f *ssa.Function) token.Position {
+	if f == nil || f.Prog == nil || f.Prog.Fset == nil {
+		return token.Position{}
+	}
+	return f.Prog.Fset.Position(f.Pos())
+}
+
+// isExported returns true if f is an exported function, or an exported method
+// of an exported type, so that it can be called from other packages.
+func isExported(f *ssa.Function) bool {
+	if f == nil || f.Parent() != nil || !token.IsExported(f.Name()) {
+		return false
+	}
+	recv := f.Signature.Recv()
+	if recv == nil {
+		return true
+	}
+	t := recv.Type()
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	if n, ok := types.Unalias(t).(*types.Named); ok {
+		return n.Obj().Exported()
+	}
+	return false
+}
+
+// isInitFunction returns true if f is the initializer of a package, or an
+// init function declared in a package.
+func isInitFunction(f *ssa.Function) bool {
+	if f == nil || f.Parent() != nil || f.Signature.Recv() != nil {
+		return false
+	}
+	return f.Synthetic == "package initializer" || strings.HasPrefix(f.Name(), "init#")
+}
+
+// isTestFunction returns true if f is declared in a _test.go file.
+func isTestFunction(f *ssa.Function) bool {
+	if f.Origin() != nil {
+		f = f.Origin()
+	}
+	return strings.HasSuffix(functionPosition(f).Filename, "_test.go")
+}
+
 func isStdLib(p string) bool {
 	if strings.Contains(p, ".") {
 		return false
@@ -191,7 +561,73 @@ func isStdLib(p string) bool {
 	return true
 }
 
-func buildGraph(pkgs []*packages.Package, populateSyntax bool) (*callgraph.Graph, *ssa.Program, map[*ssa.Function]bool) {
+// CallGraphAlgorithm selects the algorithm used to construct the call graph.
+// The algorithms differ in how they resolve dynamic calls, i.e. calls of
+// interface methods and function values.  Less precise algorithms add more
+// call edges that cannot occur at run time, which can produce spurious
+// capabilities.
+type CallGraphAlgorithm int8
+
+const (
+	CallGraphDefault CallGraphAlgorithm = iota // use the default algorithm, VTA
+	// CallGraphCHA uses Class Hierarchy Analysis, which assumes a dynamic call
+	// can reach any function or method with a compatible type anywhere in the
+	// program.  It is fast, but the least precise.
+	CallGraphCHA
+	// CallGraphRTA uses Rapid Type Analysis, which only considers types that
+	// are used in code reachable from the requested packages.  It is more
+	// precise than CHA at a similar cost.
+	CallGraphRTA
+	// CallGraphVTA uses Variable Type Analysis, which tracks the flow of types
+	// through variables, fields and function parameters.  It is the most
+	// precise of the algorithms for interface-heavy code, and also the
+	// slowest.
+	CallGraphVTA
+	// CallGraphStatic only includes calls whose callee is known statically.
+	// It is the fastest algorithm, but omits all dynamic calls, so it can miss
+	// capabilities.
+	CallGraphStatic
+)
+
+// CallGraphAlgorithmFromString returns the CallGraphAlgorithm named by a,
+// which is one of "cha", "rta", "vta" or "static".  The empty string selects
+// CallGraphDefault, which uses VTA.  Any other value is an error.
+func CallGraphAlgorithmFromString(a string) (CallGraphAlgorithm, error) {
+	switch a {
+	case "":
+		return CallGraphDefault, nil
+	case "cha":
+		return CallGraphCHA, nil
+	case "rta":
+		return CallGraphRTA, nil
+	case "vta":
+		return CallGraphVTA, nil
+	case "static":
+		return CallGraphStatic, nil
+	default:
+		return 0, fmt.Errorf("unknown call graph algorithm: %q", a)
+	}
+}
+
+// buildGraph returns the call graph of pkgs, the SSA program it was built
+// from, and the set of all functions in the program.  If config.Program holds
+// pkgs, the result is reused from earlier calls with the same call graph
+// algorithm.
+func buildGraph(pkgs []*packages.Package, populateSyntax bool, config *Config) (*callgraph.Graph, *ssa.Program, map[*ssa.Function]bool) {
+	if config.ProgressFn != nil {
+		n := 0
+		forEachPackageIncludingDependencies(pkgs, func(*packages.Package) { n++ })
+		config.progress(ProgressEvent{Stage: ProgressPackagesLoaded, Count: n})
+	}
+	if config.Program != nil {
+		if graph, ssaProg, allFunctions, ok := config.Program.buildGraph(pkgs, config); ok {
+			return graph, ssaProg, allFunctions
+		}
+	}
+	return newGraph(pkgs, populateSyntax, config)
+}
+
+func newGraph(pkgs []*packages.Package, populateSyntax bool, config *Config) (*callgraph.Graph, *ssa.Program, map[*ssa.Function]bool) {
 	rewriteCallsToSort(pkgs)
 	rewriteCallsToOnceDoEtc(pkgs)
 	ssaBuilderMode := ssa.InstantiateGenerics
@@ -203,12 +639,75 @@ func buildGraph(pkgs []*packages.Package, populateSyntax bool) (*callgraph.Graph
 		ssaBuilderMode |= ssa.GlobalDebug
 	}
 	ssaProg, _ := ssautil.AllPackages(pkgs, ssaBuilderMode)
-	ssaProg.Build()
+	buildSSA(ssaProg, config.MaxSSAConcurrency)
 	allFunctions := ssautil.AllFunctions(ssaProg)
-	graph := vta.CallGraph(allFunctions, nil)
+	config.progress(ProgressEvent{Stage: ProgressSSABuilt, Count: len(allFunctions)})
+	var graph *callgraph.Graph
+	switch config.CallGraphAlgorithm {
+	case CallGraphCHA:
+		graph = cha.CallGraph(ssaProg)
+	case CallGraphRTA:
+		graph = rtaCallGraph(pkgs, allFunctions)
+	case CallGraphStatic:
+		graph = static.CallGraph(ssaProg)
+	default:
+		graph = vta.CallGraph(allFunctions, nil)
+	}
+	if graph.Root != nil && graph.Root.Func == nil {
+		// Some algorithms add a root node with no function, which we don't use.
+		graph.DeleteNode(graph.Root)
+		graph.Root = nil
+	}
+	config.progress(ProgressEvent{Stage: ProgressCallGraphBuilt, Count: len(graph.Nodes)})
 	return graph, ssaProg, allFunctions
 }
 
+// buildSSA builds the SSA code of the packages in ssaProg, building at most
+// maxConcurrency packages at a time.  If maxConcurrency is not positive, all
+// packages are built concurrently, as by ssaProg.Build.
+func buildSSA(ssaProg *ssa.Program, maxConcurrency int) {
+	if maxConcurrency <= 0 {
+		ssaProg.Build()
+		return
+	}
+	sem := make(chan struct{}, maxConcurrency)
+	var wg sync.WaitGroup
+	for _, p := range ssaProg.AllPackages() {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			p.Build()
+		}()
+	}
+	wg.Wait()
+}
+
+// rtaCallGraph returns a call graph constructed using Rapid Type Analysis.
+// The roots of the analysis are the non-generic functions in pkgs.
+func rtaCallGraph(pkgs []*packages.Package, allFunctions map[*ssa.Function]bool) *callgraph.Graph {
+	rootPackages := make(map[*types.Package]struct{})
+	for _, p := range pkgs {
+		rootPackages[p.Types] = struct{}{}
+	}
+	var roots []*ssa.Function
+	for f := range allFunctions {
+		if f.Package() == nil || f.TypeParams().Len() > 0 {
+			continue
+		}
+		if _, ok := rootPackages[f.Package().Pkg]; ok {
+			roots = append(roots, f)
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool { return funcCompare(roots[i], roots[j]) < 0 })
+	res := rta.Analyze(roots, true)
+	if res == nil {
+		// There were no roots.
+		return &callgraph.Graph{Nodes: make(map[*ssa.Function]*callgraph.Node)}
+	}
+	return res.CallGraph
+}
+
 // functionsToRewrite lists the functions and methods like (*sync.Once).Do that
 // rewriteCallsToOnceDoEtc will rewrite to calls to their arguments.
 var functionsToRewrite = []matcher{
@@ -393,9 +892,9 @@ func (m *methodMatcher) match(typeInfo *types.Info, call *ast.CallExpr) ast.Expr
 type visitor struct {
 	// The sets we are populating.
 	unsafeFunctionNodes map[ast.Node]struct{}
-	// Set to true if an unsafe.Pointer conversion is found that is not inside
-	// a function, method, or function literal definition.
-	seenUnsafePointerUseInInitialization *bool
+	// Set to the position of the first unsafe.Pointer conversion found that
+	// is not inside a function, method, or function literal definition.
+	unsafePointerUseInInitialization *token.Pos
 	// The Package for the ast Node being visited.  This is used to get type
 	// information.
 	pkg *packages.Package
@@ -490,7 +989,9 @@ func (v *visitor) Visit(node ast.Node) ast.Visitor {
 			break
 		}
 		if v.currentFunction == nil {
-			*v.seenUnsafePointerUseInInitialization = true
+			if !v.unsafePointerUseInInitialization.IsValid() {
+				*v.unsafePointerUseInInitialization = node.Pos()
+			}
 		} else {
 			v.unsafeFunctionNodes[v.currentFunction] = struct{}{}
 		}
@@ -527,21 +1028,211 @@ func programName() string {
 
 // addFunction adds an entry to *fns for the given node and edge.
 // The edge can be nil.
+//
+// The entry's site is the position of the call in incomingEdge.  If there is
+// no such position, for example for the first function in a path, the
+// position of the function's declaration is recorded instead, in the
+// entry's declaration field.
 func addFunction(fns *[]*cpb.Function, v *callgraph.Node, incomingEdge *callgraph.Edge) {
 	fn := &cpb.Function{Name: proto.String(v.Func.String())}
+	if site, declaration := functionSite(v, incomingEdge); declaration {
+		fn.Declaration = site
+	} else {
+		fn.Site = site
+	}
 	if pkg := nodeToPackage(v); pkg != nil {
 		fn.Package = proto.String(pkg.Path())
 	}
-	if position := callsitePosition(incomingEdge); position.IsValid() {
-		fn.Site = &cpb.Function_Site{
-			Filename: proto.String(path.Base(position.Filename)),
-			Line:     proto.Int64(int64(position.Line)),
-			Column:   proto.Int64(int64(position.Column)),
-		}
+	if isWrapper(v.Func) {
+		fn.Wrapper = proto.String(v.Func.Synthetic)
 	}
 	*fns = append(*fns, fn)
 }
 
+// isWrapper returns true if f is a synthetic wrapper of a method, such as the
+// bound method (T).M$bound, the method expression (T).M$thunk, or (*T).M for
+// a method declared with receiver type T.
+func isWrapper(f *ssa.Function) bool {
+	return f.Synthetic != "" && f.Package() == nil && f.Origin() == nil
+}
+
+// instantiation returns f if it is an instantiation of a generic function, or
+// the instantiation containing f if f is a function literal within one, and
+// nil otherwise.  Function literals in an instantiation are instantiated with
+// it, so the outermost instantiation is the one returned.
+func instantiation(f *ssa.Function) *ssa.Function {
+	var inst *ssa.Function
+	for ; f != nil; f = f.Parent() {
+		if len(f.TypeArgs()) > 0 {
+			inst = f
+		}
+	}
+	return inst
+}
+
+// pathInstantiations returns the instantiations of generic functions in the
+// path found by a search backwards from capabilities from v, in path order.
+// Each appears once, even if the path goes through several function literals
+// within it.
+func pathInstantiations(nodes *bfsStateMap, v *callgraph.Node) []*cpb.CapabilityInfo_Instantiation {
+	var out []*cpb.CapabilityInfo_Instantiation
+	seen := make(map[*ssa.Function]*cpb.CapabilityInfo_Instantiation)
+	for w := v; w != nil; w = nodes.state(w).next() {
+		f := instantiation(w.Func)
+		if f == nil {
+			continue
+		}
+		inst, ok := seen[f]
+		if !ok {
+			inst = &cpb.CapabilityInfo_Instantiation{Function: proto.String(f.String())}
+			if origin := f.Origin(); origin != nil {
+				inst.Generic = proto.String(origin.String())
+			}
+			for _, t := range f.TypeArgs() {
+				inst.TypeArgs = append(inst.TypeArgs, types.TypeString(t, nil))
+			}
+			seen[f] = inst
+			out = append(out, inst)
+		}
+		if nodes.state(w).next() == nil {
+			inst.HasCapability = proto.Bool(true)
+		}
+	}
+	return out
+}
+
+// omitWrappers returns fns without the wrappers marked by addFunction, except
+// for the last function, which has the capability.  The function following
+// each run of omitted wrappers is given the site of the call to the first of
+// them, which is in a function that is kept.
+func omitWrappers(fns []*cpb.Function) []*cpb.Function {
+	var (
+		out     []*cpb.Function
+		site    *cpb.Function_Site
+		omitted bool
+	)
+	for i, fn := range fns {
+		if fn.Wrapper != nil && i != len(fns)-1 {
+			if !omitted {
+				site, omitted = fn.GetSite(), true
+			}
+			continue
+		}
+		if omitted && site != nil {
+			fn.Site, fn.Declaration = site, nil
+		}
+		omitted = false
+		out = append(out, fn)
+	}
+	return out
+}
+
+// functionSite returns the position of the entry for v added by addFunction,
+// or nil if it has no position.  declaration reports whether the position is
+// that of v's declaration rather than of the call in incomingEdge.
+func functionSite(v *callgraph.Node, incomingEdge *callgraph.Edge) (site *cpb.Function_Site, declaration bool) {
+	position := callsitePosition(incomingEdge)
+	if !position.IsValid() {
+		position, declaration = functionPosition(v.Func), true
+	}
+	if !position.IsValid() {
+		return nil, false
+	}
+	return &cpb.Function_Site{
+		Filename: proto.String(path.Base(position.Filename)),
+		Line:     proto.Int64(int64(position.Line)),
+		Column:   proto.Int64(int64(position.Column)),
+	}, declaration
+}
+
+// functionPositionOf returns the position recorded for fn, which is either
+// its call site or its declaration.
+func functionPositionOf(fn *cpb.Function) *cpb.Function_Site {
+	if site := fn.GetSite(); site != nil {
+		return site
+	}
+	return fn.GetDeclaration()
+}
+
+// collapseStdlib returns fns with each run of two or more consecutive
+// functions in the standard library replaced by a single Function whose name
+// shows the packages of the first and last function in the run, and whose
+// site is that of the first.  The name contains no spaces, so that each
+// function is still one word of a CapabilityInfo's dep_path.  The first and
+// last functions in fns are never collapsed.
+func collapseStdlib(fns []*cpb.Function) []*cpb.Function {
+	if len(fns) <= 3 {
+		return fns
+	}
+	var out []*cpb.Function
+	out = append(out, fns[0])
+	for i := 1; i < len(fns)-1; {
+		j := i
+		for j < len(fns)-1 && fns[j].Package != nil && isStdLib(fns[j].GetPackage()) {
+			j++
+		}
+		if j-i < 2 {
+			out = append(out, fns[i])
+			i++
+			continue
+		}
+		first, last := fns[i], fns[j-1]
+		out = append(out, &cpb.Function{
+			Name:        proto.String(fmt.Sprintf("<std:%s...%s>", first.GetPackage(), last.GetPackage())),
+			Site:        first.GetSite(),
+			Declaration: first.GetDeclaration(),
+			Package:     first.Package,
+		})
+		i = j
+	}
+	return append(out, fns[len(fns)-1])
+}
+
+// pathID returns an identifier for the call path fns, which is a hash of the
+// names and sites of the functions in it.  It depends only on the contents
+// of fns, so it is the same for the same path in different runs.
+//
+// The hash is built from the end of the path, so that the hash of each path
+// can be computed from the hash of the rest of the path; see
+// bfsStateMap.output, which finds the same ID for a path found by a search
+// as this finds for the path once it is output.
+func pathID(fns []*cpb.Function) string {
+	if len(fns) == 0 {
+		return pathIDFromHash(nil, nil)
+	}
+	var hash []byte
+	for i := len(fns) - 1; i >= 0; i-- {
+		var nextSite *cpb.Function_Site
+		if i+1 < len(fns) {
+			nextSite = functionPositionOf(fns[i+1])
+		}
+		hash = pathHash(fns[i].GetName(), nextSite, hash)
+	}
+	return pathIDFromHash(functionPositionOf(fns[0]), hash)
+}
+
+// pathHash returns the hash of a path starting with the function name,
+// followed by a function at nextSite and the rest of the path, whose hash is
+// nextHash.  nextSite and nextHash are nil if the path has one function.
+func pathHash(name string, nextSite *cpb.Function_Site, nextHash []byte) []byte {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", name)
+	if nextHash != nil {
+		fmt.Fprintf(h, "%s:%d:%d\x00", nextSite.GetFilename(), nextSite.GetLine(), nextSite.GetColumn())
+		h.Write(nextHash)
+	}
+	return h.Sum(nil)
+}
+
+// pathIDFromHash returns the path ID of a path whose first function has the
+// given site, and whose hash is given by pathHash.
+func pathIDFromHash(site *cpb.Function_Site, hash []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s:%d:%d\x00", site.GetFilename(), site.GetLine(), site.GetColumn())
+	h.Write(hash)
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
 // nodeToPackage returns the package of the node's function, or nil if it has
 // no associated package, e.g. because it is a wrapper function.
 func nodeToPackage(node *callgraph.Node) *types.Package {
@@ -276,8 +276,8 @@ func sortAndPrintCapabilities(cs []cpb.Capability) {
 		2:  "Access to the file system",
 		3:  "Access to the network",
 		4:  "Read or modify settings in the Go runtime",
-		5:  "Read system information, e.g. environment variables",
-		6:  "Modify system information, e.g. environment variables",
+		5:  "Read system information, e.g. the process ID",
+		6:  "Modify system information, e.g. the working directory",
 		7:  `Call miscellaneous functions in the "os" package `,
 		8:  "Make system calls",
 		9:  "Invoke arbitrary code, e.g. assembly or go:linkname",
@@ -286,6 +286,30 @@ func sortAndPrintCapabilities(cs []cpb.Capability) {
 		12: "Uses unsafe.Pointer",
 		13: "Uses reflect",
 		14: "Execute other programs, usually via os/exec",
+		15: "Read environment variables",
+		16: "Set, unset, or clear environment variables",
+		17: "Read from the file system",
+		18: "Write to or modify the file system",
+		19: "Read the current time or wait for a duration",
+		20: "Use non-cryptographic random numbers, e.g. via math/rand",
+		21: "Use cryptographic random numbers from crypto/rand",
+		22: "Call arbitrary functions or methods using reflect",
+		23: "Start goroutines",
+		24: "Terminate the process, e.g. via os.Exit or log.Fatal",
+		25: "Make outgoing network connections, e.g. via net.Dial or http.Get",
+		26: "Listen for incoming network connections, e.g. via net.Listen",
+		27: "Resolve names using DNS, e.g. via net.LookupHost",
+		28: "Load and run code from Go plugins",
+		29: "Make raw system calls or map memory, e.g. via syscall.Syscall",
+		30: "Install or reset signal handlers, e.g. via os/signal.Notify",
+		31: "Change file permissions or ownership, or the working directory",
+		32: "Access /proc, /sys or /dev, e.g. via os.ReadFile(\"/proc/self/maps\")",
+		33: "Put the terminal in raw mode or read passwords, e.g. via golang.org/x/term.MakeRaw",
+		34: "Load trusted certificates, e.g. via crypto/x509.SystemCertPool",
+		35: "Decode untrusted data into arbitrary types, e.g. via encoding/gob.NewDecoder",
+		36: "Read files embedded in the binary at build time, e.g. via embed.FS",
+		37: "Read the host's name resolution settings, e.g. via os.ReadFile(\"/etc/resolv.conf\")",
+		38: "Run the go command, e.g. via os/exec.Command(\"go\", \"run\", ...)",
 	}
 	for _, c := range cs {
 		fmt.Fprint(tw, "\t", cpb.Capability_name[int32(c)], ":\t", capabilityDescription[c], "\n")
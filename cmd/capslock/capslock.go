@@ -14,12 +14,14 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 	"strings"
@@ -27,25 +29,52 @@ import (
 	"github.com/google/capslock/analyzer"
 	"github.com/google/capslock/interesting"
 	"golang.org/x/tools/go/packages"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
 var (
 	packageList    = flag.String("packages", "", "target patterns to be analysed; allows wildcarding")
-	output         = flag.String("output", "", "output mode to use; non-default options are json, m, v, graph, and compare")
+	output         = flag.String("output", "", "output mode to use; non-default options are json, jsonl, m, v, csv, csv-stats, envvars, embeds, graph, graphml, html, sarif, and compare")
 	verbose        = flag.Int("v", 0, "verbosity level")
 	noiseFlag      = flag.Bool("noisy", false, "include output on unanalyzed function calls (can be noisy)")
-	customMap      = flag.String("capability_map", "", "use a custom capability map file")
+	customMap      = flag.String("capability_map", "", "use a custom capability map file; files ending in .json are read as a JSON list of glob patterns, in which * also matches / (see interesting.ClassifierFromFile); YAML is not supported")
 	disableBuiltin = flag.Bool("disable_builtin", false, "when using a custom capability map, disable the builtin capability mappings")
-	capabilities   = flag.String("capabilities", "", "if non-empty, a comma-separated list of capabilities to consider for graph output.  Optionally, all capabilities can be prefixed with '-' to specify capabilities to ignore.")
+	capabilities   = flag.String("capabilities", "", "if non-empty, a comma-separated list of capabilities to consider for graph, graphml, csv-stats and verbose output, applied from left to right.  A capability prefixed with '-' is removed, \"all\" stands for every capability, and names can be glob patterns, e.g. \"all,-REFLECT\" or \"NETWORK_*\".")
 	buildTags      = flag.String("buildtags", "", "command-separated list of build tags to use when loading packages")
 	goos           = flag.String("goos", "", "GOOS value to use when loading packages")
 	goarch         = flag.String("goarch", "", "GOARCH value to use when loading packages")
+	includeTests   = flag.Bool("include_tests", false, "also analyze the _test.go files of the requested packages; capabilities of functions in test files are marked fromTest in json output")
+	platforms      = flag.String("platforms", "", "if non-empty, a comma-separated list of GOOS/GOARCH pairs, such as \"linux/amd64,windows/amd64\"; packages are loaded and analyzed once for each, and the union of the capabilities found is output.  Supported with json and sarif output only.")
 	cpuprofile     = flag.String("cpuprofile", "", "write cpu profile to specified file")
 	memprofile     = flag.String("memprofile", "", "write memory profile to specified file")
 	granularity    = flag.String("granularity", "",
-		`the granularity to use for comparisons, either "package" or "function".`)
-	forceLocalModule = flag.Bool("force_local_module", false, "if the requested packages cannot be loaded in the current workspace, return an error immediately, instead of trying to load them in a temporary module")
-	omitPaths        = flag.Bool("omit_paths", false, "omit example call paths from output")
+		`the granularity to use for comparisons, either "package", "module", or "function".`)
+	forceLocalModule  = flag.Bool("force_local_module", false, "if the requested packages cannot be loaded in the current workspace, return an error immediately, instead of trying to load them in a temporary module")
+	omitPaths         = flag.Bool("omit_paths", false, "omit example call paths from output")
+	callGraph         = flag.String("callgraph", "", `the call graph construction algorithm, one of "cha", "rta", "vta", or "static"; the default is "vta"`)
+	baselineFile      = flag.String("baseline", "", "file listing accepted capabilities, one \"CAPABILITY package\" pair per line, to omit from json and sarif output")
+	maxPathLength     = flag.Int("max_path_length", 0, "if positive, the maximum number of functions in each example call path in json output; longer paths are truncated, and are only followed as far as they are output")
+	collapseStdlib    = flag.Bool("collapse_stdlib", false, "in json output, replace each run of standard library functions in example call paths with a single entry")
+	excludePackages   = flag.String("exclude_packages", "", "comma-separated list of import path patterns, such as example.com/gen/...; capabilities are not reported for functions in matching packages, but are still found through them")
+	prunePackageInfo  = flag.Bool("prune_package_info", false, "in json output, list only the modules and packages which appear on the path to a reported capability")
+	pruneDispatch     = flag.Bool("prune_dynamic_dispatch", false, "ignore calls of interface methods whose implementation is outside the modules of the requested packages; this reduces spurious capabilities but can miss real ones")
+	reachableOnly     = flag.Bool("only_reachable_from_main", false, "report only capabilities of functions which can be called from a main function or package initializer, omitting dead code")
+	exportedEntry     = flag.Bool("exported_entry_points", false, "with -only_reachable_from_main, also treat the exported functions and methods of the requested packages as entry points")
+	useDirectives     = flag.Bool("directives", false, "classify functions in the requested packages according to //capslock:safe and //capslock:capability NAME comments in their doc comments; only use this for code you trust")
+	includeWrappers   = flag.Bool("include_wrappers", false, "keep synthetic method wrappers, such as bound method values, in example call paths, marked with a wrapper field in json output")
+	onlyTransitive    = flag.Bool("only_transitive", false, "in json, jsonl, html and sarif output, report only capabilities reached through another package, omitting direct uses")
+	onlyDirect        = flag.Bool("only_direct", false, "in json, jsonl, html and sarif output, report only direct uses of capabilities, omitting those reached through another package")
+	mergeMajor        = flag.Bool("merge_major_versions", false, "with -granularity=package or -granularity=module, report packages and modules whose paths differ only in a major version suffix such as /v2 once")
+	replacedAsLocal   = flag.Bool("replaced_as_local", false, "attribute packages in modules replaced by a replace directive to the replacement, such as a local fork, instead of the module they replace")
+	excludeReplaced   = flag.Bool("exclude_replaced", false, "do not report capabilities starting in packages of modules replaced by a replace directive")
+	maxSSA            = flag.Int("max_ssa_concurrency", 0, "if positive, the maximum number of packages whose SSA code is built at once, to reduce peak memory use at the cost of time")
+	ignoreLoadErrors  = flag.Bool("ignore_load_errors", false, "print errors loading packages but analyze them anyway; packages which cannot be type-checked are skipped, so capabilities may be under-reported")
+	excludeInit       = flag.Bool("exclude_init", false, "do not follow calls made by init functions and package variable initializers, to report only capabilities used through packages' APIs")
+	maxPathCount      = flag.Int("max_path_count", analyzer.DefaultMaxPathCount, "the number of distinct paths to a capability at which to stop counting, for -output=v")
+	descriptorSet     = flag.Bool("descriptor_set", false, "write a FileDescriptorSet for the schema of json and jsonl output, in binary protocol buffer format, to stdout and exit without analyzing any packages")
+	annotateInst      = flag.Bool("annotate_instantiations", false, "in json and jsonl output, list the type arguments of the instantiations of generic functions in each capability's call path")
+	classificationLog = flag.String("classification_log", "", "if non-empty, also write a JSON record of each function given a capability, and whether it came from the built-in capability map, an override, a directive comment, or the analysis of its code, to this file")
+	coarse            = flag.Bool("coarse", false, "report combined capabilities such as FILES and NETWORK instead of finer-grained ones such as FILES_READ and NETWORK_DIAL")
 )
 
 func main() {
@@ -73,13 +102,20 @@ func run() error {
 		}
 		defer pprof.StopCPUProfile()
 	}
+	if *descriptorSet {
+		return analyzer.WriteDescriptorSet(os.Stdout)
+	}
 
 	packageNames := strings.Split(*packageList, ",")
 	g, err := analyzer.GranularityFromString(*granularity)
 	if err != nil {
 		return fmt.Errorf("parsing flag -granularity: %w", err)
 	}
-	cs, err := analyzer.NewCapabilitySet(*capabilities)
+	cga, err := analyzer.CallGraphAlgorithmFromString(*callGraph)
+	if err != nil {
+		return fmt.Errorf("parsing flag -callgraph: %w", err)
+	}
+	cs, err := analyzer.ParseCapabilitySet(*capabilities)
 	if err != nil {
 		return fmt.Errorf("parsing flag -capabilities: %w", err)
 	}
@@ -87,7 +123,19 @@ func run() error {
 		return fmt.Errorf("Error: --disable_builtin only makes sense with a --capability_map file specified")
 	}
 	var classifier *interesting.Classifier
-	if *customMap != "" {
+	if *customMap != "" && filepath.Ext(*customMap) == ".json" {
+		if *disableBuiltin {
+			return fmt.Errorf("Error: --disable_builtin is not supported with a JSON capability map")
+		}
+		classifier, err = interesting.ClassifierFromFile(*customMap)
+		if err != nil {
+			return err
+		}
+		if *noiseFlag {
+			classifier = interesting.ClassifierExcludingUnanalyzed(classifier)
+		}
+		log.Printf("Using custom capability map %q", *customMap)
+	} else if *customMap != "" {
 		f, err := os.Open(*customMap)
 		if err != nil {
 			return err
@@ -103,14 +151,40 @@ func run() error {
 	} else {
 		classifier = analyzer.GetClassifier(*noiseFlag)
 	}
+	if *coarse {
+		classifier = interesting.ClassifierWithCoarseCapabilities(classifier)
+	}
 
-	loadConfig := analyzer.LoadConfig{
-		BuildTags: *buildTags,
-		GOOS:      *goos,
-		GOARCH:    *goarch,
+	var baseline *analyzer.Baseline
+	if *baselineFile != "" {
+		f, err := os.Open(*baselineFile)
+		if err != nil {
+			return err
+		}
+		baseline, err = analyzer.LoadBaseline(*baselineFile, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	loadConfigs, err := platformLoadConfigs(*platforms, analyzer.LoadConfig{
+		BuildTags:    *buildTags,
+		GOOS:         *goos,
+		GOARCH:       *goarch,
+		IncludeTests: *includeTests,
+	})
+	if err != nil {
+		return fmt.Errorf("parsing flag -platforms: %w", err)
+	}
+	if *platforms != "" && *output != "json" && *output != "j" && *output != "sarif" {
+		return fmt.Errorf("Error: --platforms is only supported with json and sarif output")
 	}
-	pkgs, listFailed, failedPackage, err := loadPackages(packageNames, loadConfig)
-	if (listFailed || len(pkgs) == 0) && !*forceLocalModule {
+	if *platforms != "" && *classificationLog != "" {
+		return fmt.Errorf("Error: --classification_log is not supported with --platforms")
+	}
+	pkgsPerConfig, listFailed, failedPackage, err := loadPackagesForConfigs(packageNames, loadConfigs)
+	if (listFailed || noPackages(pkgsPerConfig)) && !*forceLocalModule {
 		// Either:
 		// - `go list` returned an error for one of the packages, perhaps because
 		//   it is not a dependency of the current workspace; or
@@ -147,7 +221,7 @@ func run() error {
 		}
 
 		// Try loading the packages again.
-		pkgs, _, _, err = loadPackages(packageNames, loadConfig)
+		pkgsPerConfig, _, _, err = loadPackagesForConfigs(packageNames, loadConfigs)
 
 		// Switch back to the original working directory.
 		err1 := os.Chdir(wd)
@@ -158,26 +232,71 @@ func run() error {
 	if err != nil {
 		return fmt.Errorf("Error loading packages: %w", err)
 	}
-	if len(pkgs) == 0 {
+	if noPackages(pkgsPerConfig) {
 		return fmt.Errorf("No packages matching %v", packageNames)
 	}
 
-	queriedPackages := analyzer.GetQueriedPackages(pkgs)
+	for _, pkgs := range pkgsPerConfig {
+		if *verbose > 0 {
+			for _, p := range pkgs {
+				log.Printf("Loaded package %q\n", p.Name)
+			}
+		}
+		if printErrors(pkgs) && !*ignoreLoadErrors {
+			return fmt.Errorf("Some packages had errors. Aborting analysis.")
+		}
+	}
+	config := &analyzer.Config{
+		Classifier:             classifier,
+		DisableBuiltin:         *disableBuiltin,
+		Granularity:            g,
+		CapabilitySet:          cs,
+		OmitPaths:              *omitPaths,
+		Baseline:               baseline,
+		CallGraphAlgorithm:     cga,
+		MaxPathLength:          *maxPathLength,
+		PrunePackageInfo:       *prunePackageInfo,
+		CollapseStdlib:         *collapseStdlib,
+		PruneDynamicDispatch:   *pruneDispatch,
+		OnlyReachableFromMain:  *reachableOnly,
+		ExportedEntryPoints:    *exportedEntry,
+		UseDirectives:          *useDirectives,
+		IncludeWrappers:        *includeWrappers,
+		OnlyTransitive:         *onlyTransitive,
+		OnlyDirect:             *onlyDirect,
+		MergeMajorVersions:     *mergeMajor,
+		ReportReplacedAsLocal:  *replacedAsLocal,
+		ExcludeReplaced:        *excludeReplaced,
+		MaxSSAConcurrency:      *maxSSA,
+		IgnoreLoadErrors:       *ignoreLoadErrors,
+		ExcludeInitFunctions:   *excludeInit,
+		MaxPathCount:           *maxPathCount,
+		AnnotateInstantiations: *annotateInst,
+	}
+	if *excludePackages != "" {
+		config.ExcludePackages = strings.Split(*excludePackages, ",")
+	}
 	if *verbose > 0 {
-		for _, p := range pkgs {
-			log.Printf("Loaded package %q\n", p.Name)
+		config.ProgressFn = func(e analyzer.ProgressEvent) {
+			if e.Stage == analyzer.ProgressSearchStarted {
+				log.Printf("%v for %v (%d functions)", e.Stage, e.Capability, e.Count)
+			} else {
+				log.Printf("%v (%d)", e.Stage, e.Count)
+			}
 		}
 	}
-	if printErrors(pkgs) {
-		return fmt.Errorf("Some packages had errors. Aborting analysis.")
+	if *platforms != "" {
+		err = runForPlatforms(context.Background(), *output, loadConfigs, pkgsPerConfig, config)
+	} else {
+		pkgs := pkgsPerConfig[0]
+		queriedPackages := analyzer.GetQueriedPackages(pkgs)
+		if *classificationLog != "" {
+			if err := writeClassificationLog(*classificationLog, pkgs, config); err != nil {
+				return err
+			}
+		}
+		err = analyzer.RunCapslock(context.Background(), flag.Args(), *output, pkgs, queriedPackages, config)
 	}
-	err = analyzer.RunCapslock(flag.Args(), *output, pkgs, queriedPackages, &analyzer.Config{
-		Classifier:     classifier,
-		DisableBuiltin: *disableBuiltin,
-		Granularity:    g,
-		CapabilitySet:  cs,
-		OmitPaths:      *omitPaths,
-	})
 
 	if *memprofile != "" {
 		f, err := os.Create(*memprofile)
@@ -195,6 +314,24 @@ func run() error {
 	return err
 }
 
+// writeClassificationLog writes the classification of each function in the
+// call graph of pkgs, as returned by analyzer.GetClassifications, to the file
+// named filename as JSON.
+func writeClassificationLog(filename string, pkgs []*packages.Package, config *analyzer.Config) error {
+	cl, err := analyzer.GetClassifications(pkgs, config)
+	if err != nil {
+		return err
+	}
+	b, err := protojson.MarshalOptions{Multiline: true, Indent: "\t"}.Marshal(cl)
+	if err != nil {
+		return fmt.Errorf("internal error: couldn't marshal protocol buffer: %s", err.Error())
+	}
+	if err := os.WriteFile(filename, append(b, '\n'), 0o666); err != nil {
+		return fmt.Errorf("could not write classification log: %w", err)
+	}
+	return nil
+}
+
 // loadPackages calls analyzer.LoadPackages to load the specified packages.
 //
 // If it fails due to a ListError (for example, if one of the packages is not a
@@ -212,6 +349,75 @@ func loadPackages(packageNames []string, loadConfig analyzer.LoadConfig) (pkgs [
 	return pkgs, false, "", err
 }
 
+// platformLoadConfigs returns the configurations to use when loading
+// packages.  If platforms is empty, this is just lcfg.  Otherwise, platforms
+// is a comma-separated list of GOOS/GOARCH pairs, and there is one
+// configuration for each, with the other settings from lcfg.
+func platformLoadConfigs(platforms string, lcfg analyzer.LoadConfig) ([]analyzer.LoadConfig, error) {
+	if platforms == "" {
+		return []analyzer.LoadConfig{lcfg}, nil
+	}
+	if lcfg.GOOS != "" || lcfg.GOARCH != "" {
+		return nil, fmt.Errorf("cannot be used with -goos or -goarch")
+	}
+	var out []analyzer.LoadConfig
+	for _, p := range strings.Split(platforms, ",") {
+		goos, goarch, ok := strings.Cut(strings.TrimSpace(p), "/")
+		if !ok || goos == "" || goarch == "" {
+			return nil, fmt.Errorf("%q is not of the form GOOS/GOARCH", p)
+		}
+		lcfg.GOOS, lcfg.GOARCH = goos, goarch
+		out = append(out, lcfg)
+	}
+	return out, nil
+}
+
+// loadPackagesForConfigs calls loadPackages once for each of loadConfigs,
+// and returns the packages loaded for each.  It stops at the first error or
+// failed package.
+func loadPackagesForConfigs(packageNames []string, loadConfigs []analyzer.LoadConfig) (pkgsPerConfig [][]*packages.Package, listFailed bool, failedPackage string, err error) {
+	for _, lcfg := range loadConfigs {
+		pkgs, listFailed, failedPackage, err := loadPackages(packageNames, lcfg)
+		pkgsPerConfig = append(pkgsPerConfig, pkgs)
+		if listFailed || err != nil {
+			return pkgsPerConfig, listFailed, failedPackage, err
+		}
+	}
+	return pkgsPerConfig, false, "", nil
+}
+
+// noPackages returns true if no packages were loaded for some configuration.
+func noPackages(pkgsPerConfig [][]*packages.Package) bool {
+	for _, pkgs := range pkgsPerConfig {
+		if len(pkgs) == 0 {
+			return true
+		}
+	}
+	return len(pkgsPerConfig) == 0
+}
+
+// runForPlatforms analyzes each set of packages in pkgsPerConfig, which were
+// loaded for the corresponding platforms in loadConfigs, and outputs the
+// union of the capabilities found.
+func runForPlatforms(ctx context.Context, output string, loadConfigs []analyzer.LoadConfig, pkgsPerConfig [][]*packages.Package, config *analyzer.Config) error {
+	if len(flag.Args()) >= 1 {
+		return fmt.Errorf("%s: unknown command", flag.Args())
+	}
+	cil, err := analyzer.GetCapabilityInfoMultiConfig(ctx, loadConfigs, pkgsPerConfig, config)
+	if err != nil {
+		return err
+	}
+	if output == "sarif" {
+		return analyzer.WriteSARIF(os.Stdout, cil)
+	}
+	b, err := protojson.MarshalOptions{Multiline: true, Indent: "\t"}.Marshal(cil)
+	if err != nil {
+		return fmt.Errorf("internal error: couldn't marshal protocol buffer: %s", err.Error())
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
 // makeTemporaryModule switches to a new temporary directory, creates a module
 // there, and adds the specified packages to that module with `go get`.
 //
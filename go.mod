@@ -5,6 +5,7 @@ go 1.23.3
 require (
 	github.com/fatih/color v1.18.0
 	github.com/google/go-cmp v0.7.0
+	golang.org/x/term v0.32.0
 	golang.org/x/tools v0.33.0
 	google.golang.org/protobuf v1.36.6
 )
@@ -11,15 +11,22 @@ package interesting
 import (
 	"bufio"
 	_ "embed"
+	"encoding/json"
 	"fmt"
+	"go/constant"
+	"go/types"
 	"io"
 	"maps"
+	"os"
+	"regexp"
 	"slices"
 	"sort"
+	"strconv"
 	"strings"
 
 	cpb "github.com/google/capslock/proto"
 	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
 )
 
 //go:embed interesting.cm
@@ -33,6 +40,190 @@ type Classifier struct {
 	packageCategory    map[string]cpb.Capability
 	ignoredEdges       map[[2]string]struct{}
 	cgoSuffixes        []string
+	// functionGlobs are consulted before any other classification.  The
+	// first matching entry is used.
+	functionGlobs []functionGlob
+	// coarse is set if finer-grained capabilities should be reported as the
+	// combined capability that contains them.
+	coarse bool
+	// severities overrides the default severities of capabilities.
+	severities map[cpb.Capability]int
+	// cwes holds CWE identifiers for capabilities, in addition to the
+	// default ones.
+	cwes map[cpb.Capability][]string
+}
+
+// Severity levels of capabilities, as returned by Severity.  Higher levels
+// carry more risk.
+const (
+	SeverityNone     = 0
+	SeverityLow      = 1
+	SeverityMedium   = 2
+	SeverityHigh     = 3
+	SeverityCritical = 4
+)
+
+// defaultSeverity holds the default severity of each capability.
+// Capabilities which are not listed have SeverityNone.
+var defaultSeverity = map[cpb.Capability]int{
+	cpb.Capability_CAPABILITY_ARBITRARY_EXECUTION: SeverityCritical,
+	cpb.Capability_CAPABILITY_CGO:                 SeverityCritical,
+	cpb.Capability_CAPABILITY_EXEC:                SeverityCritical,
+	cpb.Capability_CAPABILITY_GO_TOOLCHAIN:        SeverityCritical,
+	cpb.Capability_CAPABILITY_PLUGIN:              SeverityCritical,
+	cpb.Capability_CAPABILITY_RAW_SYSCALL:         SeverityCritical,
+	cpb.Capability_CAPABILITY_SYSTEM_CALLS:        SeverityCritical,
+	cpb.Capability_CAPABILITY_FILES:               SeverityHigh,
+	cpb.Capability_CAPABILITY_FILES_WRITE:         SeverityHigh,
+	cpb.Capability_CAPABILITY_MODIFY_ENVIRONMENT:  SeverityHigh,
+	cpb.Capability_CAPABILITY_MODIFY_SYSTEM_STATE: SeverityHigh,
+	cpb.Capability_CAPABILITY_NETWORK:             SeverityHigh,
+	cpb.Capability_CAPABILITY_NETWORK_DIAL:        SeverityHigh,
+	cpb.Capability_CAPABILITY_NETWORK_LISTEN:      SeverityHigh,
+	cpb.Capability_CAPABILITY_OPERATING_SYSTEM:    SeverityHigh,
+	cpb.Capability_CAPABILITY_REFLECT_INVOKE:      SeverityHigh,
+	cpb.Capability_CAPABILITY_SYSTEM_FILES:        SeverityHigh,
+	cpb.Capability_CAPABILITY_CERT_STORE:          SeverityHigh,
+	cpb.Capability_CAPABILITY_DESERIALIZE:         SeverityHigh,
+	cpb.Capability_CAPABILITY_EMBED:               SeverityLow,
+	cpb.Capability_CAPABILITY_UNSAFE_POINTER:      SeverityHigh,
+	cpb.Capability_CAPABILITY_FILES_READ:          SeverityMedium,
+	cpb.Capability_CAPABILITY_FS_METADATA:         SeverityMedium,
+	cpb.Capability_CAPABILITY_HOST_CONFIG:         SeverityMedium,
+	cpb.Capability_CAPABILITY_NETWORK_DNS:         SeverityMedium,
+	cpb.Capability_CAPABILITY_PROCESS_EXIT:        SeverityMedium,
+	cpb.Capability_CAPABILITY_READ_ENVIRONMENT:    SeverityMedium,
+	cpb.Capability_CAPABILITY_READ_SYSTEM_STATE:   SeverityMedium,
+	cpb.Capability_CAPABILITY_RUNTIME:             SeverityMedium,
+	cpb.Capability_CAPABILITY_SIGNAL:              SeverityMedium,
+	cpb.Capability_CAPABILITY_TERMINAL:            SeverityMedium,
+	cpb.Capability_CAPABILITY_UNANALYZED:          SeverityMedium,
+	cpb.Capability_CAPABILITY_CLOCK:               SeverityLow,
+	cpb.Capability_CAPABILITY_CRYPTO_RAND:         SeverityLow,
+	cpb.Capability_CAPABILITY_GOROUTINE:           SeverityLow,
+	cpb.Capability_CAPABILITY_RANDOM:              SeverityLow,
+	cpb.Capability_CAPABILITY_REFLECT:             SeverityLow,
+}
+
+// Severity returns the default severity of the capability c, from
+// SeverityNone to SeverityCritical.  CAPABILITY_SAFE and
+// CAPABILITY_UNSPECIFIED have SeverityNone.
+func Severity(c cpb.Capability) int {
+	return defaultSeverity[c]
+}
+
+// defaultCWEs holds the identifiers of the Common Weakness Enumeration
+// entries related to each capability: the weaknesses which code with the
+// capability can have, and which a reviewer should look for.
+var defaultCWEs = map[cpb.Capability][]string{
+	cpb.Capability_CAPABILITY_ARBITRARY_EXECUTION: {"CWE-94"},
+	cpb.Capability_CAPABILITY_CERT_STORE:          {"CWE-295"},
+	cpb.Capability_CAPABILITY_CGO:                 {"CWE-676"},
+	cpb.Capability_CAPABILITY_DESERIALIZE:         {"CWE-502"},
+	cpb.Capability_CAPABILITY_EXEC:                {"CWE-78"},
+	cpb.Capability_CAPABILITY_FILES:               {"CWE-73"},
+	cpb.Capability_CAPABILITY_FILES_READ:          {"CWE-73"},
+	cpb.Capability_CAPABILITY_FILES_WRITE:         {"CWE-73"},
+	cpb.Capability_CAPABILITY_GO_TOOLCHAIN:        {"CWE-94"},
+	cpb.Capability_CAPABILITY_HOST_CONFIG:         {"CWE-497"},
+	cpb.Capability_CAPABILITY_MODIFY_ENVIRONMENT:  {"CWE-15"},
+	cpb.Capability_CAPABILITY_MODIFY_SYSTEM_STATE: {"CWE-15"},
+	cpb.Capability_CAPABILITY_NETWORK:             {"CWE-918"},
+	cpb.Capability_CAPABILITY_NETWORK_DIAL:        {"CWE-918"},
+	cpb.Capability_CAPABILITY_NETWORK_LISTEN:      {"CWE-1327"},
+	cpb.Capability_CAPABILITY_PLUGIN:              {"CWE-829"},
+	cpb.Capability_CAPABILITY_RANDOM:              {"CWE-338"},
+	cpb.Capability_CAPABILITY_RAW_SYSCALL:         {"CWE-676"},
+	cpb.Capability_CAPABILITY_READ_ENVIRONMENT:    {"CWE-526"},
+	cpb.Capability_CAPABILITY_READ_SYSTEM_STATE:   {"CWE-497"},
+	cpb.Capability_CAPABILITY_REFLECT_INVOKE:      {"CWE-470"},
+	cpb.Capability_CAPABILITY_SYSTEM_CALLS:        {"CWE-676"},
+	cpb.Capability_CAPABILITY_SYSTEM_FILES:        {"CWE-22"},
+	cpb.Capability_CAPABILITY_UNSAFE_POINTER:      {"CWE-787"},
+}
+
+// cwePattern matches a CWE identifier.
+var cwePattern = regexp.MustCompile(`^CWE-[1-9][0-9]*$`)
+
+// CWE returns the identifiers, such as "CWE-78", of the Common Weakness
+// Enumeration entries related to the capability c by default.  Capabilities
+// with no related weaknesses return nil.
+func CWE(c cpb.Capability) []string {
+	return slices.Clone(defaultCWEs[c])
+}
+
+// functionGlob assigns a capability to the functions whose package path and
+// name match the pair of patterns.  A nil pattern matches anything.
+type functionGlob struct {
+	pkg, name               *regexp.Regexp
+	pkgPattern, namePattern string
+	capability              cpb.Capability
+}
+
+func (g *functionGlob) match(pkg, name string) bool {
+	if g.pkg != nil && !g.pkg.MatchString(pkg) {
+		return false
+	}
+	if g.name != nil && !g.name.MatchString(name) {
+		return false
+	}
+	return true
+}
+
+// compileGlob returns a regular expression matching the same strings as the
+// glob pattern, or nil if pattern is empty.  The syntax is that of
+// path.Match, except that "*" matches any sequence of characters, including
+// "/", so that "example.com/*" matches every package under example.com.
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	var b strings.Builder
+	b.WriteString(`^(?:`)
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			b.WriteString(`.*`)
+		case '?':
+			b.WriteString(`.`)
+		case '\\':
+			i++
+			if i == len(pattern) {
+				return nil, fmt.Errorf("trailing backslash in pattern %q", pattern)
+			}
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case '[':
+			// Copy the character class, escaping the characters inside it.
+			b.WriteByte('[')
+			i++
+			if i < len(pattern) && pattern[i] == '^' {
+				b.WriteByte('^')
+				i++
+			}
+			for ; i < len(pattern) && pattern[i] != ']'; i++ {
+				escaped := pattern[i] == '\\'
+				if escaped {
+					i++
+					if i == len(pattern) {
+						break
+					}
+				}
+				if pattern[i] == '-' && !escaped {
+					b.WriteByte('-')
+				} else {
+					b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+				}
+			}
+			if i == len(pattern) {
+				return nil, fmt.Errorf("unterminated character class in pattern %q", pattern)
+			}
+			b.WriteByte(']')
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString(`)$`)
+	return regexp.Compile(b.String())
 }
 
 var internalMap = parseInternalMapOrDie()
@@ -43,6 +234,8 @@ func newClassifier() *Classifier {
 		unanalyzedCategory: map[string]cpb.Capability{},
 		packageCategory:    map[string]cpb.Capability{},
 		ignoredEdges:       map[[2]string]struct{}{},
+		severities:         map[cpb.Capability]int{},
+		cwes:               map[cpb.Capability][]string{},
 	}
 }
 
@@ -92,6 +285,41 @@ func parseCapabilityMap(source string, r io.Reader) (*Classifier, error) {
 				return nil, fmt.Errorf("%v:%v: duplicate %v key", source, line, args[0])
 			}
 			ret.ignoredEdges[k] = struct{}{}
+		case "severity":
+			// Format: severity capability level
+			if len(args) < 3 {
+				return nil, fmt.Errorf("%v:%v: invalid %v format", source, line, args[0])
+			}
+			c, ok := cpb.Capability_value[args[1]]
+			if !ok {
+				return nil, fmt.Errorf("%v:%v: unsupported capability %q", source, line, args[1])
+			}
+			if _, ok := ret.severities[cpb.Capability(c)]; ok {
+				return nil, fmt.Errorf("%v:%v: duplicate %v key", source, line, args[0])
+			}
+			level, err := strconv.Atoi(args[2])
+			if err != nil || level < SeverityNone || level > SeverityCritical {
+				return nil, fmt.Errorf("%v:%v: invalid severity %q", source, line, args[2])
+			}
+			ret.severities[cpb.Capability(c)] = level
+		case "cwe":
+			// Format: cwe capability identifier...
+			if len(args) < 3 {
+				return nil, fmt.Errorf("%v:%v: invalid %v format", source, line, args[0])
+			}
+			c, ok := cpb.Capability_value[args[1]]
+			if !ok {
+				return nil, fmt.Errorf("%v:%v: unsupported capability %q", source, line, args[1])
+			}
+			if _, ok := ret.cwes[cpb.Capability(c)]; ok {
+				return nil, fmt.Errorf("%v:%v: duplicate %v key", source, line, args[0])
+			}
+			for _, id := range args[2:] {
+				if !cwePattern.MatchString(id) {
+					return nil, fmt.Errorf("%v:%v: invalid CWE identifier %q", source, line, id)
+				}
+			}
+			ret.cwes[cpb.Capability(c)] = args[2:]
 		case "package":
 			// Format: package package_name capability
 			if len(args) < 3 {
@@ -144,6 +372,19 @@ func ClassifierExcludingUnanalyzed(classifier *Classifier) *Classifier {
 	return &withoutUnanalyzed
 }
 
+// ClassifierWithCoarseCapabilities returns a copy of the supplied Classifier
+// that is modified to report combined capabilities in place of the
+// finer-grained capabilities they contain, for users who don't need to
+// distinguish between them: CAPABILITY_FILES in place of CAPABILITY_FILES_READ
+// and CAPABILITY_FILES_WRITE, and CAPABILITY_NETWORK in place of
+// CAPABILITY_NETWORK_DIAL, CAPABILITY_NETWORK_LISTEN and
+// CAPABILITY_NETWORK_DNS.
+func ClassifierWithCoarseCapabilities(classifier *Classifier) *Classifier {
+	coarse := *classifier
+	coarse.coarse = true
+	return &coarse
+}
+
 // LoadClassifier returns a capability classifier loaded from the specified
 // io.Reader. The filename argument is used only for providing context to
 // error messages. The classifier will also include the default Capslock
@@ -151,7 +392,11 @@ func ClassifierExcludingUnanalyzed(classifier *Classifier) *Classifier {
 //
 // Refer to the interesting/interesting.cm file in the source code for an
 // example of the capability map format. Classifications loaded from a
-// caller-specified file always override builtin classifications.
+// caller-specified file always override builtin classifications.  The file
+// can also override the severity of a capability, with lines of the form
+// "severity CAPABILITY_CLOCK 3", where the level is from SeverityNone to
+// SeverityCritical, and add to the CWE identifiers related to a capability,
+// with lines of the form "cwe CAPABILITY_CLOCK CWE-367 CWE-362".
 func LoadClassifier(source string, r io.Reader, excludeBuiltin bool) (*Classifier, error) {
 	userClassifier, err := parseCapabilityMap(source, r)
 	if err != nil {
@@ -167,6 +412,8 @@ func LoadClassifier(source string, r io.Reader, excludeBuiltin bool) (*Classifie
 		maps.Copy(dst.unanalyzedCategory, src.unanalyzedCategory)
 		maps.Copy(dst.packageCategory, src.packageCategory)
 		maps.Copy(dst.ignoredEdges, src.ignoredEdges)
+		maps.Copy(dst.severities, src.severities)
+		maps.Copy(dst.cwes, src.cwes)
 		dst.cgoSuffixes = append(dst.cgoSuffixes, src.cgoSuffixes...)
 	}
 	cc(ret, internalMap)
@@ -176,6 +423,78 @@ func LoadClassifier(source string, r io.Reader, excludeBuiltin bool) (*Classifie
 	return ret, nil
 }
 
+// ClassifierFromFile returns a capability classifier which uses the
+// classifications in the JSON file at the specified path, and falls back to
+// the default classifier for functions that don't match any of them.
+//
+// The file must be in JSON; other formats such as YAML are not supported.
+// It contains a list of entries, each of which has a "package" and "name"
+// glob pattern, and the name of a capability, for example:
+//
+//	[
+//	  {"package": "os", "name": "os.Getenv", "capability": "CAPABILITY_SAFE"},
+//	  {"package": "example.com/dangerous", "capability": "CAPABILITY_EXEC"}
+//	]
+//
+// Patterns use the syntax of path.Match, except that "*" also matches "/":
+// "example.com/*" matches the package "example.com/a/b" as well as
+// "example.com/a".  An omitted pattern matches anything.  Since "*" is a glob
+// metacharacter, it must be escaped, written "\\*" in JSON, to match the "*"
+// in a method name like "(*os.File).Write".  Capability names may omit the
+// "CAPABILITY_" prefix.  Entries are tried in order, and the first match
+// takes precedence over any builtin classification.
+func ClassifierFromFile(filename string) (*Classifier, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	globs, err := parseFunctionGlobs(filename, f)
+	if err != nil {
+		return nil, err
+	}
+	ret := *internalMap
+	ret.functionGlobs = globs
+	return &ret, nil
+}
+
+// parseFunctionGlobs parses the JSON format used by ClassifierFromFile.
+func parseFunctionGlobs(source string, r io.Reader) ([]functionGlob, error) {
+	var entries []struct {
+		Package    string `json:"package"`
+		Name       string `json:"name"`
+		Capability string `json:"capability"`
+	}
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&entries); err != nil {
+		return nil, fmt.Errorf("%v: %w", source, err)
+	}
+	var globs []functionGlob
+	for i, e := range entries {
+		if e.Package == "" && e.Name == "" {
+			return nil, fmt.Errorf("%v: entry %d: no package or name pattern", source, i)
+		}
+		var patterns [2]*regexp.Regexp
+		for j, pattern := range []string{e.Package, e.Name} {
+			re, err := compileGlob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%v: entry %d: invalid pattern %q", source, i, pattern)
+			}
+			patterns[j] = re
+		}
+		c, ok := cpb.Capability_value[e.Capability]
+		if !ok {
+			c, ok = cpb.Capability_value["CAPABILITY_"+e.Capability]
+		}
+		if !ok {
+			return nil, fmt.Errorf("%v: entry %d: unsupported capability %q", source, i, e.Capability)
+		}
+		globs = append(globs, functionGlob{patterns[0], patterns[1], e.Package, e.Name, cpb.Capability(c)})
+	}
+	return globs, nil
+}
+
 // IncludeCall returns true if a call from one function to another should be
 // considered when searching for transitive capabilities.  We return false for
 // some internal calls in the standard library where we know a potential
@@ -194,7 +513,22 @@ func (c *Classifier) IncludeCall(edge *callgraph.Edge) bool {
 // If the return value is Unspecified, then we have not declared it to be
 // either safe or unsafe, so its descendants will have to be considered by the
 // static analysis.
+//
+// FunctionCategory only looks pkg and name up in c's tables, so it does not
+// need an ssa.Function, does not allocate for the default classifier, and is
+// safe for concurrent use.  Any strings can be passed, including ones which
+// are not valid package paths or function names; these are categorized like
+// any other name, so it is suitable for fuzzing.
 func (c *Classifier) FunctionCategory(pkg, name string) cpb.Capability {
+	return c.combine(c.category(pkg, name))
+}
+
+func (c *Classifier) category(pkg, name string) cpb.Capability {
+	for i := range c.functionGlobs {
+		if g := &c.functionGlobs[i]; g.match(pkg, name) {
+			return g.capability
+		}
+	}
 	for _, s := range c.cgoSuffixes {
 		// Calls to C functions produce a call to a function
 		// named "_cgo_runtime_cgocall" in the current package.
@@ -217,3 +551,277 @@ func (c *Classifier) FunctionCategory(pkg, name string) cpb.Capability {
 	}
 	return c.packageCategory[pkg]
 }
+
+// CallCategory returns a Category for a particular call to a function, for
+// functions whose capability depends on the arguments they are passed.  It
+// returns the result of FunctionCategoryWithArgs for the arguments of the
+// call.
+//
+// If the return value is Unspecified, the call has the same category as its
+// callee, as returned by FunctionCategory.
+func (c *Classifier) CallCategory(edge *callgraph.Edge) cpb.Capability {
+	if edge.Site == nil || edge.Callee.Func == nil || edge.Callee.Func.Package() == nil {
+		return cpb.Capability_CAPABILITY_UNSPECIFIED
+	}
+	callee := edge.Callee.Func
+	return c.FunctionCategoryWithArgs(callee.Package().Pkg.Path(), callee.String(), edge.Site.Common().Args)
+}
+
+// FunctionCategoryWithArgs returns a Category for a call to the given function
+// with the arguments args, for functions whose capability depends on the
+// arguments they are passed, such as os.OpenFile and exec.Command.  Calls of
+// other functions are not categorized.
+//
+// If the return value is Unspecified, the call has the same category as its
+// callee, as returned by FunctionCategory.
+func (c *Classifier) FunctionCategoryWithArgs(pkg, name string, args []ssa.Value) cpb.Capability {
+	cat := c.category(pkg, name)
+	if want, ok := systemFileFunctions[name]; ok && cat == want && len(args) > 0 {
+		if want == cpb.Capability_CAPABILITY_FILES_READ && isPathUnder(args[0], certStorePaths) {
+			return cpb.Capability_CAPABILITY_CERT_STORE
+		}
+		if want == cpb.Capability_CAPABILITY_FILES_READ && isPathUnder(args[0], hostConfigPaths) {
+			return cpb.Capability_CAPABILITY_HOST_CONFIG
+		}
+		if isPathUnder(args[0], systemPathRoots) {
+			return cpb.Capability_CAPABILITY_SYSTEM_FILES
+		}
+	}
+	if i, ok := interfaceDecodeFunctions[name]; ok && cat == cpb.Capability_CAPABILITY_REFLECT && len(args) > i && pointsToInterface(args[i]) {
+		return cpb.Capability_CAPABILITY_DESERIALIZE
+	}
+	if i, ok := commandFunctions[name]; ok && cat == cpb.Capability_CAPABILITY_EXEC && len(args) > i && isGoCommand(args[i]) {
+		return cpb.Capability_CAPABILITY_GO_TOOLCHAIN
+	}
+	if i, ok := openFileFunctions[name]; ok && cat == cpb.Capability_CAPABILITY_FILES && len(args) > i && !c.coarse {
+		if fc := openFlagCategory(args[i]); fc != cpb.Capability_CAPABILITY_UNSPECIFIED {
+			return fc
+		}
+		// The call may either read or write, so it is given both
+		// capabilities.
+		return cpb.Capability_CAPABILITY_FILES
+	}
+	return cpb.Capability_CAPABILITY_UNSPECIFIED
+}
+
+// openFileFunctions lists the functions which open a file with the flag
+// argument whose index is given.  Calls whose flag is a constant are
+// categorized as CAPABILITY_FILES_WRITE if it requests write access, as
+// os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0666) does, and as
+// CAPABILITY_FILES_READ otherwise; other calls are categorized as
+// CAPABILITY_FILES, which the analyzer reports as both.  A function whose
+// classification has been overridden from CAPABILITY_FILES is not affected,
+// and neither are calls categorized by a coarse classifier.
+var openFileFunctions = map[string]int{
+	"os.OpenFile":         1,
+	"(*os.Root).OpenFile": 2,
+}
+
+// systemFileFunctions lists the functions whose first argument is a path, for
+// which calls with a constant path under one of systemPathRoots are
+// categorized as CAPABILITY_SYSTEM_FILES, as os.ReadFile("/proc/self/maps")
+// is.  Calls of those which read, with a path under one of certStorePaths,
+// are categorized as CAPABILITY_CERT_STORE, and with one of hostConfigPaths,
+// such as os.Open("/etc/resolv.conf"), as CAPABILITY_HOST_CONFIG.  The value
+// is the function's usual capability; a function whose classification has
+// been overridden is not affected.
+var systemFileFunctions = map[string]cpb.Capability{
+	"os.Create":    cpb.Capability_CAPABILITY_FILES_WRITE,
+	"os.Lstat":     cpb.Capability_CAPABILITY_FILES_READ,
+	"os.Open":      cpb.Capability_CAPABILITY_FILES_READ,
+	"os.OpenFile":  cpb.Capability_CAPABILITY_FILES,
+	"os.ReadDir":   cpb.Capability_CAPABILITY_FILES_READ,
+	"os.ReadFile":  cpb.Capability_CAPABILITY_FILES_READ,
+	"os.Readlink":  cpb.Capability_CAPABILITY_FILES_READ,
+	"os.Stat":      cpb.Capability_CAPABILITY_FILES_READ,
+	"os.WriteFile": cpb.Capability_CAPABILITY_FILES_WRITE,
+}
+
+// systemPathRoots are the directories containing files which expose the
+// state of the kernel, the process, or devices, rather than ordinary data.
+var systemPathRoots = []string{"/dev", "/proc", "/sys"}
+
+// certStorePaths are the files and directories in which common systems keep
+// the certificates of trusted certificate authorities, as read by
+// crypto/x509.SystemCertPool.
+var certStorePaths = []string{
+	"/etc/ca-certificates",
+	"/etc/openssl/certs",
+	"/etc/pki/ca-trust",
+	"/etc/pki/tls/cacert.pem",
+	"/etc/pki/tls/certs",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+	"/etc/ssl/certs",
+	"/usr/local/share/certs",
+	"/usr/share/ca-certificates",
+}
+
+// hostConfigPaths are the files which configure how the host resolves
+// names, as read by the resolver in package net.
+var hostConfigPaths = []string{
+	"/etc/hosts",
+	"/etc/resolv.conf",
+}
+
+// isPathUnder returns true if path is a constant naming one of roots or a
+// file beneath it.
+func isPathUnder(path ssa.Value, roots []string) bool {
+	k, ok := path.(*ssa.Const)
+	if !ok || k.Value == nil || k.Value.Kind() != constant.String {
+		return false
+	}
+	p := constant.StringVal(k.Value)
+	for _, root := range roots {
+		if p == root || strings.HasPrefix(p, root+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// interfaceDecodeFunctions lists the functions which decode data into the
+// value pointed to by one of their arguments, whose index is given.  Calls
+// which decode into a value of interface type, which can hold data of any
+// shape, such as json.Unmarshal(data, &v) with v of type any, are
+// categorized as CAPABILITY_DESERIALIZE.  A function whose
+// classification has been overridden from CAPABILITY_REFLECT is not affected.
+var interfaceDecodeFunctions = map[string]int{
+	"encoding/json.Unmarshal": 1,
+}
+
+// pointsToInterface returns true if v is a pointer to a value of interface
+// type, converted to an interface to be passed as an argument.
+func pointsToInterface(v ssa.Value) bool {
+	mi, ok := v.(*ssa.MakeInterface)
+	if !ok {
+		return false
+	}
+	p, ok := mi.X.Type().Underlying().(*types.Pointer)
+	return ok && types.IsInterface(p.Elem())
+}
+
+// commandFunctions lists the functions which create a command to run a
+// program, named by the argument whose index is given.  Commands which run
+// the go command, which can build and run arbitrary code, such as
+// exec.Command("go", "generate"), are categorized as CAPABILITY_GO_TOOLCHAIN.
+// A function whose classification has been overridden from CAPABILITY_EXEC
+// is not affected.
+var commandFunctions = map[string]int{
+	"os/exec.Command":        0,
+	"os/exec.CommandContext": 1,
+}
+
+// isGoCommand returns true if name is a constant naming the go command,
+// either as "go" or as a path whose last element is "go".
+func isGoCommand(name ssa.Value) bool {
+	k, ok := name.(*ssa.Const)
+	if !ok || k.Value == nil || k.Value.Kind() != constant.String {
+		return false
+	}
+	p := constant.StringVal(k.Value)
+	return p == "go" || strings.HasSuffix(p, "/go")
+}
+
+// openFlagCategory returns the capability used by opening a file with the
+// given flag value, or Unspecified if the flag is not a constant.
+func openFlagCategory(flag ssa.Value) cpb.Capability {
+	k, ok := flag.(*ssa.Const)
+	if !ok || k.Value == nil {
+		return cpb.Capability_CAPABILITY_UNSPECIFIED
+	}
+	f, ok := constant.Int64Val(constant.ToInt(k.Value))
+	if !ok {
+		return cpb.Capability_CAPABILITY_UNSPECIFIED
+	}
+	const writeFlags = os.O_WRONLY | os.O_RDWR | os.O_APPEND | os.O_CREATE | os.O_TRUNC
+	if f&int64(writeFlags) != 0 {
+		return cpb.Capability_CAPABILITY_FILES_WRITE
+	}
+	return cpb.Capability_CAPABILITY_FILES_READ
+}
+
+// Severity returns the severity of the capability cat, which is the level
+// given for it by a "severity" line in the capability map c was loaded from,
+// if any, and the default severity returned by the Severity function
+// otherwise.
+func (c *Classifier) Severity(cat cpb.Capability) int {
+	if level, ok := c.severities[cat]; ok {
+		return level
+	}
+	return Severity(cat)
+}
+
+// CWE returns the identifiers of the CWE entries related to the capability
+// cat, which are those returned by the CWE function followed by any others
+// given for it by a "cwe" line in the capability map c was loaded from.
+func (c *Classifier) CWE(cat cpb.Capability) []string {
+	ids := CWE(cat)
+	for _, id := range c.cwes[cat] {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Entries returns the patterns classified by c, grouped by capability and
+// sorted.  A pattern is a function name, such as "os.Getpid", or the path of
+// a package whose functions all have the capability.  Glob patterns from a
+// file read by ClassifierFromFile are included as written, using the name
+// pattern if there is one and the package pattern otherwise, and the
+// suffixes of cgo-generated functions are included as "*" followed by the
+// suffix, under CAPABILITY_CGO.
+//
+// Functions classified as CAPABILITY_SAFE and CAPABILITY_UNANALYZED are
+// included.  Functions that are explicitly left unclassified, so that their
+// code is analyzed as normal, are not.  If c reports combined capabilities,
+// the patterns are grouped by the combined capability.
+func (c *Classifier) Entries() map[cpb.Capability][]string {
+	out := make(map[cpb.Capability][]string)
+	add := func(cat cpb.Capability, pattern string) {
+		if cat != cpb.Capability_CAPABILITY_UNSPECIFIED {
+			cat = c.combine(cat)
+			out[cat] = append(out[cat], pattern)
+		}
+	}
+	for _, g := range c.functionGlobs {
+		if g.namePattern != "" {
+			add(g.capability, g.namePattern)
+		} else {
+			add(g.capability, g.pkgPattern)
+		}
+	}
+	for _, s := range c.cgoSuffixes {
+		add(cpb.Capability_CAPABILITY_CGO, "*"+s)
+	}
+	for name, cat := range c.functionCategory {
+		add(cat, name)
+	}
+	for name, cat := range c.unanalyzedCategory {
+		add(cat, name)
+	}
+	for pkg, cat := range c.packageCategory {
+		add(cat, pkg)
+	}
+	for cat, patterns := range out {
+		slices.Sort(patterns)
+		out[cat] = slices.Compact(patterns)
+	}
+	return out
+}
+
+// combine returns the combined capability containing cat, if c is a coarse
+// classifier, or cat otherwise.
+func (c *Classifier) combine(cat cpb.Capability) cpb.Capability {
+	if !c.coarse {
+		return cat
+	}
+	switch cat {
+	case cpb.Capability_CAPABILITY_FILES_READ, cpb.Capability_CAPABILITY_FILES_WRITE:
+		return cpb.Capability_CAPABILITY_FILES
+	case cpb.Capability_CAPABILITY_NETWORK_DIAL, cpb.Capability_CAPABILITY_NETWORK_LISTEN, cpb.Capability_CAPABILITY_NETWORK_DNS:
+		return cpb.Capability_CAPABILITY_NETWORK
+	}
+	return cat
+}
@@ -7,10 +7,16 @@
 package interesting
 
 import (
+	"go/constant"
+	"go/types"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
 	cpb "github.com/google/capslock/proto"
+	"golang.org/x/tools/go/ssa"
 )
 
 const (
@@ -26,7 +32,6 @@ func fmt.Sprintf CAPABILITY_FILES
 `
 )
 
-
 func TestInteresting(t *testing.T) {
 	classifier := DefaultClassifier()
 	for _, c := range []struct {
@@ -36,7 +41,7 @@ func TestInteresting(t *testing.T) {
 		{
 			"os",
 			"os.Open",
-			cpb.Capability_CAPABILITY_FILES,
+			cpb.Capability_CAPABILITY_FILES_READ,
 		},
 		{
 			"fmt",
@@ -85,6 +90,57 @@ func TestInteresting(t *testing.T) {
 	}
 }
 
+func TestCoarseCapabilities(t *testing.T) {
+	classifier := ClassifierWithCoarseCapabilities(DefaultClassifier())
+	for _, c := range []struct {
+		pkg, fn string
+		want    cpb.Capability
+	}{
+		{
+			"os",
+			"os.ReadFile",
+			cpb.Capability_CAPABILITY_FILES,
+		},
+		{
+			"os",
+			"os.WriteFile",
+			cpb.Capability_CAPABILITY_FILES,
+		},
+		{
+			"os",
+			"os.OpenFile",
+			cpb.Capability_CAPABILITY_FILES,
+		},
+		{
+			"net",
+			"net.Dial",
+			cpb.Capability_CAPABILITY_NETWORK,
+		},
+		{
+			"net",
+			"net.Listen",
+			cpb.Capability_CAPABILITY_NETWORK,
+		},
+		{
+			"net",
+			"(*net.Resolver).LookupHost",
+			cpb.Capability_CAPABILITY_NETWORK,
+		},
+		{
+			"os",
+			"os.Getpid",
+			cpb.Capability_CAPABILITY_READ_SYSTEM_STATE,
+		},
+	} {
+		if got := classifier.FunctionCategory(c.pkg, c.fn); got != c.want {
+			t.Errorf("FunctionCategory(%q, %q): got %q, want %q", c.pkg, c.fn, got, c.want)
+		}
+	}
+	if got, want := DefaultClassifier().FunctionCategory("os", "os.WriteFile"), cpb.Capability_CAPABILITY_FILES_WRITE; got != want {
+		t.Errorf("FunctionCategory(%q, %q): got %q, want %q", "os", "os.WriteFile", got, want)
+	}
+}
+
 func TestUserWithBuiltin(t *testing.T) {
 	classifier, err := LoadClassifier(t.Name(), strings.NewReader(userCapabilityMap), false)
 	if err != nil {
@@ -97,7 +153,7 @@ func TestUserWithBuiltin(t *testing.T) {
 		{
 			"os",
 			"os.Open",
-			cpb.Capability_CAPABILITY_FILES,
+			cpb.Capability_CAPABILITY_FILES_READ,
 		},
 		{
 			"os",
@@ -176,3 +232,343 @@ func TestUserWithoutBuiltin(t *testing.T) {
 		}
 	}
 }
+
+func TestCWE(t *testing.T) {
+	classifier, err := LoadClassifier(t.Name(), strings.NewReader(`
+cwe CAPABILITY_CLOCK CWE-367
+cwe CAPABILITY_EXEC CWE-77 CWE-78
+`), false)
+	if err != nil {
+		t.Fatalf("LoadClassifier failed: %v", err)
+	}
+	for _, c := range []struct {
+		capability         cpb.Capability
+		want, wantExtended []string
+	}{
+		{cpb.Capability_CAPABILITY_EXEC, []string{"CWE-78"}, []string{"CWE-78", "CWE-77"}},
+		{cpb.Capability_CAPABILITY_UNSAFE_POINTER, []string{"CWE-787"}, []string{"CWE-787"}},
+		{cpb.Capability_CAPABILITY_CLOCK, nil, []string{"CWE-367"}},
+		{cpb.Capability_CAPABILITY_SAFE, nil, nil},
+	} {
+		if got := CWE(c.capability); !slices.Equal(got, c.want) {
+			t.Errorf("CWE(%v): got %q, want %q", c.capability, got, c.want)
+		}
+		if got := DefaultClassifier().CWE(c.capability); !slices.Equal(got, c.want) {
+			t.Errorf("DefaultClassifier().CWE(%v): got %q, want %q", c.capability, got, c.want)
+		}
+		if got := classifier.CWE(c.capability); !slices.Equal(got, c.wantExtended) {
+			t.Errorf("CWE(%v) with extension: got %q, want %q", c.capability, got, c.wantExtended)
+		}
+	}
+	for _, m := range []string{
+		"cwe CAPABILITY_CLOCK",
+		"cwe CLOCK CWE-1",
+		"cwe CAPABILITY_CLOCK 367",
+		"cwe CAPABILITY_CLOCK CWE-0",
+		"cwe CAPABILITY_CLOCK CWE-1\ncwe CAPABILITY_CLOCK CWE-2",
+	} {
+		if _, err := LoadClassifier(t.Name(), strings.NewReader(m), false); err == nil {
+			t.Errorf("LoadClassifier(%q): got nil error, want error", m)
+		}
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	classifier, err := LoadClassifier(t.Name(), strings.NewReader(`
+severity CAPABILITY_CLOCK 3
+severity CAPABILITY_EXEC 2
+`), false)
+	if err != nil {
+		t.Fatalf("LoadClassifier failed: %v", err)
+	}
+	for _, c := range []struct {
+		capability         cpb.Capability
+		want, wantOverride int
+	}{
+		{cpb.Capability_CAPABILITY_EXEC, SeverityCritical, SeverityMedium},
+		{cpb.Capability_CAPABILITY_ARBITRARY_EXECUTION, SeverityCritical, SeverityCritical},
+		{cpb.Capability_CAPABILITY_CLOCK, SeverityLow, SeverityHigh},
+		{cpb.Capability_CAPABILITY_REFLECT, SeverityLow, SeverityLow},
+		{cpb.Capability_CAPABILITY_SAFE, SeverityNone, SeverityNone},
+	} {
+		if got := Severity(c.capability); got != c.want {
+			t.Errorf("Severity(%v): got %d, want %d", c.capability, got, c.want)
+		}
+		if got := DefaultClassifier().Severity(c.capability); got != c.want {
+			t.Errorf("DefaultClassifier().Severity(%v): got %d, want %d", c.capability, got, c.want)
+		}
+		if got := classifier.Severity(c.capability); got != c.wantOverride {
+			t.Errorf("Severity(%v) with override: got %d, want %d", c.capability, got, c.wantOverride)
+		}
+	}
+	for _, m := range []string{
+		"severity CAPABILITY_CLOCK",
+		"severity CLOCK 1",
+		"severity CAPABILITY_CLOCK high",
+		"severity CAPABILITY_CLOCK 5",
+		"severity CAPABILITY_CLOCK 1\nseverity CAPABILITY_CLOCK 2",
+	} {
+		if _, err := LoadClassifier(t.Name(), strings.NewReader(m), false); err == nil {
+			t.Errorf("LoadClassifier(%q): got nil error, want error", m)
+		}
+	}
+}
+
+func TestClassifierFromFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "classifier.json")
+	err := os.WriteFile(filename, []byte(`[
+		{"package": "os", "name": "os.Getenv", "capability": "CAPABILITY_SAFE"},
+		{"name": "(\\*os.File).Write*", "capability": "NETWORK"},
+		{"package": "example.com/some/*", "capability": "CAPABILITY_EXEC"},
+		{"name": "example.com/other.[A-C]?", "capability": "CAPABILITY_FILES_WRITE"}
+	]`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	classifier, err := ClassifierFromFile(filename)
+	if err != nil {
+		t.Fatalf("ClassifierFromFile failed: %v", err)
+	}
+	for _, c := range []struct {
+		pkg, fn string
+		want    cpb.Capability
+	}{
+		{
+			"os",
+			"os.Getenv",
+			cpb.Capability_CAPABILITY_SAFE,
+		},
+		{
+			"os",
+			"os.Open",
+			cpb.Capability_CAPABILITY_FILES_READ,
+		},
+		{
+			"os",
+			"(*os.File).WriteString",
+			cpb.Capability_CAPABILITY_NETWORK,
+		},
+		{
+			"os",
+			"(*os.File).Read",
+			cpb.Capability_CAPABILITY_FILES_READ,
+		},
+		{
+			"example.com/some/package",
+			"example.com/some/package.Foo",
+			cpb.Capability_CAPABILITY_EXEC,
+		},
+		{
+			// "*" matches "/", so nested packages match too.
+			"example.com/some/package/nested",
+			"example.com/some/package/nested.Foo",
+			cpb.Capability_CAPABILITY_EXEC,
+		},
+		{
+			"example.com/other",
+			"example.com/other.Foo",
+			cpb.Capability_CAPABILITY_UNSPECIFIED,
+		},
+		{
+			"example.com/other",
+			"example.com/other.Bz",
+			cpb.Capability_CAPABILITY_FILES_WRITE,
+		},
+	} {
+		if got := classifier.FunctionCategory(c.pkg, c.fn); got != c.want {
+			t.Errorf("FunctionCategory(%q, %q): got %q, want %q", c.pkg, c.fn, got, c.want)
+		}
+	}
+}
+
+func TestClassifierFromFileErrors(t *testing.T) {
+	for _, c := range []struct {
+		name, contents, wantErr string
+	}{
+		{"unknown capability", `[{"name": "os.Getenv", "capability": "CAPABILITY_NONSENSE"}]`, `unsupported capability "CAPABILITY_NONSENSE"`},
+		{"missing capability", `[{"name": "os.Getenv"}]`, `unsupported capability ""`},
+		{"no patterns", `[{"capability": "CAPABILITY_SAFE"}]`, "no package or name pattern"},
+		{"bad pattern", `[{"name": "os.[", "capability": "CAPABILITY_SAFE"}]`, `invalid pattern "os.["`},
+		{"unknown field", `[{"func": "os.Getenv", "capability": "CAPABILITY_SAFE"}]`, `unknown field "func"`},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "classifier.json")
+			if err := os.WriteFile(filename, []byte(c.contents), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ClassifierFromFile(filename)
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Errorf("ClassifierFromFile: got error %v, want error containing %q", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestEntries(t *testing.T) {
+	entries := DefaultClassifier().Entries()
+	for _, c := range []struct {
+		capability cpb.Capability
+		pattern    string
+	}{
+		{cpb.Capability_CAPABILITY_READ_SYSTEM_STATE, "os.Getpid"},
+		{cpb.Capability_CAPABILITY_SAFE, "(*bytes.Buffer).WriteString"},
+		{cpb.Capability_CAPABILITY_UNANALYZED, "(*bufio.Reader).Read"},
+		{cpb.Capability_CAPABILITY_CGO, "*_Cfunc_CString"},
+	} {
+		if !slices.Contains(entries[c.capability], c.pattern) {
+			t.Errorf("Entries()[%v] does not contain %q", c.capability, c.pattern)
+		}
+	}
+	if _, ok := entries[cpb.Capability_CAPABILITY_UNSPECIFIED]; ok {
+		t.Errorf("Entries() has an entry for CAPABILITY_UNSPECIFIED")
+	}
+	for c, patterns := range entries {
+		if !slices.IsSorted(patterns) {
+			t.Errorf("Entries()[%v] is not sorted", c)
+		}
+	}
+	// The unanalyzed functions are omitted by ClassifierExcludingUnanalyzed,
+	// and fine-grained capabilities are combined by a coarse classifier.
+	if slices.Contains(ClassifierExcludingUnanalyzed(DefaultClassifier()).Entries()[cpb.Capability_CAPABILITY_UNANALYZED], "(*bufio.Reader).Read") {
+		t.Errorf("ClassifierExcludingUnanalyzed: Entries()[CAPABILITY_UNANALYZED] contains (*bufio.Reader).Read")
+	}
+	coarse := ClassifierWithCoarseCapabilities(DefaultClassifier()).Entries()
+	if _, ok := coarse[cpb.Capability_CAPABILITY_FILES_READ]; ok {
+		t.Errorf("ClassifierWithCoarseCapabilities: Entries() has an entry for CAPABILITY_FILES_READ")
+	}
+	if !slices.Contains(coarse[cpb.Capability_CAPABILITY_FILES], "os.ReadFile") {
+		t.Errorf("ClassifierWithCoarseCapabilities: Entries()[CAPABILITY_FILES] does not contain os.ReadFile")
+	}
+}
+
+func TestFunctionCategoryAllocs(t *testing.T) {
+	classifier := DefaultClassifier()
+	for _, c := range [][2]string{
+		{"os", "os.Getenv"},
+		{"os", "(*os.File).Write"},
+		{"example.com/foo", "example.com/foo.Bar"},
+		{"", ""},
+	} {
+		if n := testing.AllocsPerRun(100, func() { classifier.FunctionCategory(c[0], c[1]) }); n != 0 {
+			t.Errorf("FunctionCategory(%q, %q): got %v allocations, want 0", c[0], c[1], n)
+		}
+	}
+}
+
+func FuzzFunctionCategory(f *testing.F) {
+	for _, c := range [][2]string{
+		{"os", "os.Getenv"},
+		{"sync", "(*sync.Cond).Signal"},
+		{"time", "(time.Time).Clock"},
+		{"example.com/foo", "(*example.com/foo.T[int]).M$1"},
+		{"runtime", "runtime.SetFinalizer"},
+		{"", "_cgo_runtime_cgocall"},
+		{"(", ")*."},
+	} {
+		f.Add(c[0], c[1])
+	}
+	classifiers := []*Classifier{
+		DefaultClassifier(),
+		ClassifierWithCoarseCapabilities(DefaultClassifier()),
+	}
+	f.Fuzz(func(t *testing.T, pkg, name string) {
+		for _, classifier := range classifiers {
+			got := classifier.FunctionCategory(pkg, name)
+			if _, ok := cpb.Capability_name[int32(got)]; !ok {
+				t.Errorf("FunctionCategory(%q, %q): got invalid capability %d", pkg, name, got)
+			}
+		}
+	})
+}
+
+func TestFunctionCategoryWithArgs(t *testing.T) {
+	str := func(s string) ssa.Value {
+		return ssa.NewConst(constant.MakeString(s), types.Typ[types.String])
+	}
+	readOnly := ssa.NewConst(constant.MakeInt64(int64(os.O_RDONLY)), types.Typ[types.Int])
+	create := ssa.NewConst(constant.MakeInt64(int64(os.O_RDWR|os.O_CREATE)), types.Typ[types.Int])
+	param := new(ssa.Parameter)
+	classifier := DefaultClassifier()
+	for _, c := range []struct {
+		fn   string
+		args []ssa.Value
+		want cpb.Capability
+	}{
+		{"os.ReadFile", []ssa.Value{str("/proc/self/maps")}, cpb.Capability_CAPABILITY_SYSTEM_FILES},
+		{"os.Open", []ssa.Value{str("/sys")}, cpb.Capability_CAPABILITY_SYSTEM_FILES},
+		{"os.OpenFile", []ssa.Value{str("/dev/null"), readOnly, nil}, cpb.Capability_CAPABILITY_SYSTEM_FILES},
+		{"os.OpenFile", []ssa.Value{str("/etc/hosts"), readOnly, nil}, cpb.Capability_CAPABILITY_FILES_READ},
+		{"os.OpenFile", []ssa.Value{str("a"), create, nil}, cpb.Capability_CAPABILITY_FILES_WRITE},
+		{"os.OpenFile", []ssa.Value{str("a"), param, nil}, cpb.Capability_CAPABILITY_FILES},
+		{"(*os.Root).OpenFile", []ssa.Value{param, str("a"), readOnly, nil}, cpb.Capability_CAPABILITY_FILES_READ},
+		{"(*os.Root).OpenFile", []ssa.Value{param, str("a"), param, nil}, cpb.Capability_CAPABILITY_FILES},
+		{"os.ReadFile", []ssa.Value{str("/etc/hosts")}, cpb.Capability_CAPABILITY_HOST_CONFIG},
+		{"os.Open", []ssa.Value{str("/etc/resolv.conf")}, cpb.Capability_CAPABILITY_HOST_CONFIG},
+		{"os.WriteFile", []ssa.Value{str("/etc/hosts")}, cpb.Capability_CAPABILITY_UNSPECIFIED},
+		{"os.ReadFile", []ssa.Value{str("/etc/hostname")}, cpb.Capability_CAPABILITY_UNSPECIFIED},
+		{"os.ReadFile", []ssa.Value{str("/etc/ssl/certs/ca-certificates.crt")}, cpb.Capability_CAPABILITY_CERT_STORE},
+		{"os.ReadDir", []ssa.Value{str("/etc/pki/tls/certs")}, cpb.Capability_CAPABILITY_CERT_STORE},
+		{"os.WriteFile", []ssa.Value{str("/etc/ssl/cert.pem")}, cpb.Capability_CAPABILITY_UNSPECIFIED},
+		{"os.ReadFile", []ssa.Value{str("/etc/ssl/private/key.pem")}, cpb.Capability_CAPABILITY_UNSPECIFIED},
+		{"os.ReadFile", []ssa.Value{str("/processes")}, cpb.Capability_CAPABILITY_UNSPECIFIED},
+		{"os.ReadFile", []ssa.Value{param}, cpb.Capability_CAPABILITY_UNSPECIFIED},
+		{"os.Getenv", []ssa.Value{str("/proc")}, cpb.Capability_CAPABILITY_UNSPECIFIED},
+	} {
+		if got := classifier.FunctionCategoryWithArgs("os", c.fn, c.args); got != c.want {
+			t.Errorf("FunctionCategoryWithArgs(%q, %q, %s): got %q, want %q", "os", c.fn, describeArg(c.args[0]), got, c.want)
+		}
+	}
+	// A coarse classifier gives every call of os.OpenFile the capability of
+	// the function.
+	coarse := ClassifierWithCoarseCapabilities(classifier)
+	for _, flag := range []ssa.Value{readOnly, create, param} {
+		if got := coarse.FunctionCategoryWithArgs("os", "os.OpenFile", []ssa.Value{str("a"), flag, nil}); got != cpb.Capability_CAPABILITY_UNSPECIFIED {
+			t.Errorf("FunctionCategoryWithArgs(%q, %q, %s) with coarse classifier: got %q, want %q", "os", "os.OpenFile", describeArg(flag), got, cpb.Capability_CAPABILITY_UNSPECIFIED)
+		}
+	}
+	// pointerTo returns an argument holding a pointer to a value of type t.
+	pointerTo := func(t types.Type) ssa.Value {
+		return &ssa.MakeInterface{X: ssa.NewConst(nil, types.NewPointer(t))}
+	}
+	data := ssa.NewConst(nil, types.NewSlice(types.Typ[types.Byte]))
+	for _, c := range []struct {
+		fn   string
+		args []ssa.Value
+		want cpb.Capability
+	}{
+		{"encoding/json.Unmarshal", []ssa.Value{data, pointerTo(types.Universe.Lookup("any").Type())}, cpb.Capability_CAPABILITY_DESERIALIZE},
+		{"encoding/json.Unmarshal", []ssa.Value{data, pointerTo(types.NewInterfaceType(nil, nil))}, cpb.Capability_CAPABILITY_DESERIALIZE},
+		{"encoding/json.Unmarshal", []ssa.Value{data, pointerTo(types.NewStruct(nil, nil))}, cpb.Capability_CAPABILITY_UNSPECIFIED},
+		{"encoding/json.Unmarshal", []ssa.Value{data, param}, cpb.Capability_CAPABILITY_UNSPECIFIED},
+	} {
+		if got := classifier.FunctionCategoryWithArgs("encoding/json", c.fn, c.args); got != c.want {
+			t.Errorf("FunctionCategoryWithArgs(%q, %q, %v): got %q, want %q", "encoding/json", c.fn, c.args[1].Type(), got, c.want)
+		}
+	}
+	ctx := new(ssa.Parameter)
+	for _, c := range []struct {
+		fn   string
+		args []ssa.Value
+		want cpb.Capability
+	}{
+		{"os/exec.Command", []ssa.Value{str("go"), nil}, cpb.Capability_CAPABILITY_GO_TOOLCHAIN},
+		{"os/exec.Command", []ssa.Value{str("/usr/local/go/bin/go"), nil}, cpb.Capability_CAPABILITY_GO_TOOLCHAIN},
+		{"os/exec.CommandContext", []ssa.Value{ctx, str("go"), nil}, cpb.Capability_CAPABILITY_GO_TOOLCHAIN},
+		{"os/exec.Command", []ssa.Value{str("gofmt"), nil}, cpb.Capability_CAPABILITY_UNSPECIFIED},
+		{"os/exec.Command", []ssa.Value{str("/usr/bin/cargo"), nil}, cpb.Capability_CAPABILITY_UNSPECIFIED},
+		{"os/exec.Command", []ssa.Value{param, nil}, cpb.Capability_CAPABILITY_UNSPECIFIED},
+		{"os/exec.CommandContext", []ssa.Value{ctx, param, nil}, cpb.Capability_CAPABILITY_UNSPECIFIED},
+	} {
+		if got := classifier.FunctionCategoryWithArgs("os/exec", c.fn, c.args); got != c.want {
+			t.Errorf("FunctionCategoryWithArgs(%q, %q, %s): got %q, want %q", "os/exec", c.fn, describeArg(c.args[len(c.args)-2]), got, c.want)
+		}
+	}
+}
+
+// describeArg returns the value of v if it is a constant, or "?" otherwise.
+func describeArg(v ssa.Value) string {
+	if k, ok := v.(*ssa.Const); ok {
+		return k.Value.ExactString()
+	}
+	return "?"
+}
@@ -27,7 +27,79 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
-// Next_id = 16
+// Next_id = 5
+type ClassificationSource int32
+
+const (
+	ClassificationSource_CLASSIFICATION_SOURCE_UNSPECIFIED ClassificationSource = 0
+	// The built-in capability map.
+	ClassificationSource_CLASSIFICATION_SOURCE_DEFAULT ClassificationSource = 1
+	// A classifier which differs from the built-in capability map, such as one
+	// loaded from a custom capability map.
+	ClassificationSource_CLASSIFICATION_SOURCE_OVERRIDE ClassificationSource = 2
+	// A //capslock: directive comment in the function's doc comment.
+	ClassificationSource_CLASSIFICATION_SOURCE_DIRECTIVE ClassificationSource = 3
+	// The analysis of the function's code, such as its use of unsafe.Pointer
+	// or reflect.Value, or its calls to assembly or C code.
+	ClassificationSource_CLASSIFICATION_SOURCE_BUILTIN ClassificationSource = 4
+)
+
+// Enum value maps for ClassificationSource.
+var (
+	ClassificationSource_name = map[int32]string{
+		0: "CLASSIFICATION_SOURCE_UNSPECIFIED",
+		1: "CLASSIFICATION_SOURCE_DEFAULT",
+		2: "CLASSIFICATION_SOURCE_OVERRIDE",
+		3: "CLASSIFICATION_SOURCE_DIRECTIVE",
+		4: "CLASSIFICATION_SOURCE_BUILTIN",
+	}
+	ClassificationSource_value = map[string]int32{
+		"CLASSIFICATION_SOURCE_UNSPECIFIED": 0,
+		"CLASSIFICATION_SOURCE_DEFAULT":     1,
+		"CLASSIFICATION_SOURCE_OVERRIDE":    2,
+		"CLASSIFICATION_SOURCE_DIRECTIVE":   3,
+		"CLASSIFICATION_SOURCE_BUILTIN":     4,
+	}
+)
+
+func (x ClassificationSource) Enum() *ClassificationSource {
+	p := new(ClassificationSource)
+	*p = x
+	return p
+}
+
+func (x ClassificationSource) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ClassificationSource) Descriptor() protoreflect.EnumDescriptor {
+	return file_capability_proto_enumTypes[0].Descriptor()
+}
+
+func (ClassificationSource) Type() protoreflect.EnumType {
+	return &file_capability_proto_enumTypes[0]
+}
+
+func (x ClassificationSource) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Do not use.
+func (x *ClassificationSource) UnmarshalJSON(b []byte) error {
+	num, err := protoimpl.X.UnmarshalJSONEnum(x.Descriptor(), b)
+	if err != nil {
+		return err
+	}
+	*x = ClassificationSource(num)
+	return nil
+}
+
+// Deprecated: Use ClassificationSource.Descriptor instead.
+func (ClassificationSource) EnumDescriptor() ([]byte, []int) {
+	return file_capability_proto_rawDescGZIP(), []int{0}
+}
+
+// Next_id = 39
 type Capability int32
 
 const (
@@ -47,6 +119,29 @@ const (
 	Capability_CAPABILITY_REFLECT             Capability = 13
 	Capability_CAPABILITY_EXEC                Capability = 14
 	Capability_CAPABILITY_READ_ENVIRONMENT    Capability = 15
+	Capability_CAPABILITY_MODIFY_ENVIRONMENT  Capability = 16
+	Capability_CAPABILITY_FILES_READ          Capability = 17
+	Capability_CAPABILITY_FILES_WRITE         Capability = 18
+	Capability_CAPABILITY_CLOCK               Capability = 19
+	Capability_CAPABILITY_RANDOM              Capability = 20
+	Capability_CAPABILITY_CRYPTO_RAND         Capability = 21
+	Capability_CAPABILITY_REFLECT_INVOKE      Capability = 22
+	Capability_CAPABILITY_GOROUTINE           Capability = 23
+	Capability_CAPABILITY_PROCESS_EXIT        Capability = 24
+	Capability_CAPABILITY_NETWORK_DIAL        Capability = 25
+	Capability_CAPABILITY_NETWORK_LISTEN      Capability = 26
+	Capability_CAPABILITY_NETWORK_DNS         Capability = 27
+	Capability_CAPABILITY_PLUGIN              Capability = 28
+	Capability_CAPABILITY_RAW_SYSCALL         Capability = 29
+	Capability_CAPABILITY_SIGNAL              Capability = 30
+	Capability_CAPABILITY_FS_METADATA         Capability = 31
+	Capability_CAPABILITY_SYSTEM_FILES        Capability = 32
+	Capability_CAPABILITY_TERMINAL            Capability = 33
+	Capability_CAPABILITY_CERT_STORE          Capability = 34
+	Capability_CAPABILITY_DESERIALIZE         Capability = 35
+	Capability_CAPABILITY_EMBED               Capability = 36
+	Capability_CAPABILITY_HOST_CONFIG         Capability = 37
+	Capability_CAPABILITY_GO_TOOLCHAIN        Capability = 38
 )
 
 // Enum value maps for Capability.
@@ -68,6 +163,29 @@ var (
 		13: "CAPABILITY_REFLECT",
 		14: "CAPABILITY_EXEC",
 		15: "CAPABILITY_READ_ENVIRONMENT",
+		16: "CAPABILITY_MODIFY_ENVIRONMENT",
+		17: "CAPABILITY_FILES_READ",
+		18: "CAPABILITY_FILES_WRITE",
+		19: "CAPABILITY_CLOCK",
+		20: "CAPABILITY_RANDOM",
+		21: "CAPABILITY_CRYPTO_RAND",
+		22: "CAPABILITY_REFLECT_INVOKE",
+		23: "CAPABILITY_GOROUTINE",
+		24: "CAPABILITY_PROCESS_EXIT",
+		25: "CAPABILITY_NETWORK_DIAL",
+		26: "CAPABILITY_NETWORK_LISTEN",
+		27: "CAPABILITY_NETWORK_DNS",
+		28: "CAPABILITY_PLUGIN",
+		29: "CAPABILITY_RAW_SYSCALL",
+		30: "CAPABILITY_SIGNAL",
+		31: "CAPABILITY_FS_METADATA",
+		32: "CAPABILITY_SYSTEM_FILES",
+		33: "CAPABILITY_TERMINAL",
+		34: "CAPABILITY_CERT_STORE",
+		35: "CAPABILITY_DESERIALIZE",
+		36: "CAPABILITY_EMBED",
+		37: "CAPABILITY_HOST_CONFIG",
+		38: "CAPABILITY_GO_TOOLCHAIN",
 	}
 	Capability_value = map[string]int32{
 		"CAPABILITY_UNSPECIFIED":         0,
@@ -86,6 +204,29 @@ var (
 		"CAPABILITY_REFLECT":             13,
 		"CAPABILITY_EXEC":                14,
 		"CAPABILITY_READ_ENVIRONMENT":    15,
+		"CAPABILITY_MODIFY_ENVIRONMENT":  16,
+		"CAPABILITY_FILES_READ":          17,
+		"CAPABILITY_FILES_WRITE":         18,
+		"CAPABILITY_CLOCK":               19,
+		"CAPABILITY_RANDOM":              20,
+		"CAPABILITY_CRYPTO_RAND":         21,
+		"CAPABILITY_REFLECT_INVOKE":      22,
+		"CAPABILITY_GOROUTINE":           23,
+		"CAPABILITY_PROCESS_EXIT":        24,
+		"CAPABILITY_NETWORK_DIAL":        25,
+		"CAPABILITY_NETWORK_LISTEN":      26,
+		"CAPABILITY_NETWORK_DNS":         27,
+		"CAPABILITY_PLUGIN":              28,
+		"CAPABILITY_RAW_SYSCALL":         29,
+		"CAPABILITY_SIGNAL":              30,
+		"CAPABILITY_FS_METADATA":         31,
+		"CAPABILITY_SYSTEM_FILES":        32,
+		"CAPABILITY_TERMINAL":            33,
+		"CAPABILITY_CERT_STORE":          34,
+		"CAPABILITY_DESERIALIZE":         35,
+		"CAPABILITY_EMBED":               36,
+		"CAPABILITY_HOST_CONFIG":         37,
+		"CAPABILITY_GO_TOOLCHAIN":        38,
 	}
 )
 
@@ -100,11 +241,11 @@ func (x Capability) String() string {
 }
 
 func (Capability) Descriptor() protoreflect.EnumDescriptor {
-	return file_capability_proto_enumTypes[0].Descriptor()
+	return file_capability_proto_enumTypes[1].Descriptor()
 }
 
 func (Capability) Type() protoreflect.EnumType {
-	return &file_capability_proto_enumTypes[0]
+	return &file_capability_proto_enumTypes[1]
 }
 
 func (x Capability) Number() protoreflect.EnumNumber {
@@ -123,7 +264,7 @@ func (x *Capability) UnmarshalJSON(b []byte) error {
 
 // Deprecated: Use Capability.Descriptor instead.
 func (Capability) EnumDescriptor() ([]byte, []int) {
-	return file_capability_proto_rawDescGZIP(), []int{0}
+	return file_capability_proto_rawDescGZIP(), []int{1}
 }
 
 // Next_id = 3
@@ -160,11 +301,11 @@ func (x CapabilityType) String() string {
 }
 
 func (CapabilityType) Descriptor() protoreflect.EnumDescriptor {
-	return file_capability_proto_enumTypes[1].Descriptor()
+	return file_capability_proto_enumTypes[2].Descriptor()
 }
 
 func (CapabilityType) Type() protoreflect.EnumType {
-	return &file_capability_proto_enumTypes[1]
+	return &file_capability_proto_enumTypes[2]
 }
 
 func (x CapabilityType) Number() protoreflect.EnumNumber {
@@ -183,7 +324,7 @@ func (x *CapabilityType) UnmarshalJSON(b []byte) error {
 
 // Deprecated: Use CapabilityType.Descriptor instead.
 func (CapabilityType) EnumDescriptor() ([]byte, []int) {
-	return file_capability_proto_rawDescGZIP(), []int{1}
+	return file_capability_proto_rawDescGZIP(), []int{2}
 }
 
 type CapabilityInfo struct {
@@ -201,6 +342,39 @@ type CapabilityInfo struct {
 	PackageDir *string `protobuf:"bytes,4,opt,name=package_dir,json=packageDir" json:"package_dir,omitempty"`
 	// Classification of how the capability was incurred.
 	CapabilityType *CapabilityType `protobuf:"varint,5,opt,name=capability_type,json=capabilityType,enum=capslock.proto.CapabilityType" json:"capability_type,omitempty"`
+	// Set if path and dep_path contain only the beginning of the dependency
+	// path, because it was longer than the requested maximum path length.
+	Truncated *bool `protobuf:"varint,7,opt,name=truncated" json:"truncated,omitempty"`
+	// A stable identifier for the full dependency path, computed from the names
+	// and call sites of the functions in it.  It is the same in different runs
+	// over the same code, even if path is truncated or omitted.
+	PathId *string `protobuf:"bytes,8,opt,name=path_id,json=pathId" json:"path_id,omitempty"`
+	// Set if the first function in the path is in a _test.go file, which is
+	// only possible if test files were loaded.
+	FromTest *bool `protobuf:"varint,9,opt,name=from_test,json=fromTest" json:"from_test,omitempty"`
+	// The path of the module containing the package, if the package was loaded
+	// with module information.  Unset for standard library packages.
+	ModulePath *string `protobuf:"bytes,10,opt,name=module_path,json=modulePath" json:"module_path,omitempty"`
+	// The module containing the last function in the full dependency path
+	// whose package was loaded with module information, which is the module
+	// that brings the capability into the path, and its version.  The version
+	// is unset for main and workspace modules, which are built from source.
+	// Unset if no function in the path has module information.
+	CapabilityModule *ModuleInfo `protobuf:"bytes,11,opt,name=capability_module,json=capabilityModule" json:"capability_module,omitempty"`
+	// The severity of the capability, from 0 for none to 4 for critical, as
+	// given by the classifier.  Higher values carry more risk.
+	Severity *int32 `protobuf:"varint,12,opt,name=severity" json:"severity,omitempty"`
+	// The build configurations, such as "linux/amd64", for which the entry was
+	// found, in the order they were analyzed.  Set only in the results of
+	// analyzing several configurations together.
+	Configs []string `protobuf:"bytes,13,rep,name=configs" json:"configs,omitempty"`
+	// The identifiers, such as "CWE-78", of the Common Weakness Enumeration
+	// entries related to the capability, as given by the classifier.
+	Cwe []string `protobuf:"bytes,14,rep,name=cwe" json:"cwe,omitempty"`
+	// The instantiations of generic functions in the full dependency path, in
+	// path order.  A function literal in an instantiation is represented by the
+	// instantiation.  Set only if requested.
+	Instantiations []*CapabilityInfo_Instantiation `protobuf:"bytes,15,rep,name=instantiations" json:"instantiations,omitempty"`
 	unknownFields  protoimpl.UnknownFields
 	sizeCache      protoimpl.SizeCache
 }
@@ -277,11 +451,92 @@ func (x *CapabilityInfo) GetCapabilityType() CapabilityType {
 	return CapabilityType_CAPABILITY_TYPE_UNSPECIFIED
 }
 
+func (x *CapabilityInfo) GetTruncated() bool {
+	if x != nil && x.Truncated != nil {
+		return *x.Truncated
+	}
+	return false
+}
+
+func (x *CapabilityInfo) GetPathId() string {
+	if x != nil && x.PathId != nil {
+		return *x.PathId
+	}
+	return ""
+}
+
+func (x *CapabilityInfo) GetFromTest() bool {
+	if x != nil && x.FromTest != nil {
+		return *x.FromTest
+	}
+	return false
+}
+
+func (x *CapabilityInfo) GetModulePath() string {
+	if x != nil && x.ModulePath != nil {
+		return *x.ModulePath
+	}
+	return ""
+}
+
+func (x *CapabilityInfo) GetCapabilityModule() *ModuleInfo {
+	if x != nil {
+		return x.CapabilityModule
+	}
+	return nil
+}
+
+func (x *CapabilityInfo) GetSeverity() int32 {
+	if x != nil && x.Severity != nil {
+		return *x.Severity
+	}
+	return 0
+}
+
+func (x *CapabilityInfo) GetConfigs() []string {
+	if x != nil {
+		return x.Configs
+	}
+	return nil
+}
+
+func (x *CapabilityInfo) GetCwe() []string {
+	if x != nil {
+		return x.Cwe
+	}
+	return nil
+}
+
+func (x *CapabilityInfo) GetInstantiations() []*CapabilityInfo_Instantiation {
+	if x != nil {
+		return x.Instantiations
+	}
+	return nil
+}
+
 type Function struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Name          *string                `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
-	Site          *Function_Site         `protobuf:"bytes,2,opt,name=site" json:"site,omitempty"`
-	Package       *string                `protobuf:"bytes,3,opt,name=package" json:"package,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  *string                `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	// site is the position of the call to this function from the previous
+	// function in the path.  It is unset for the first function in a path, and
+	// for calls with no position.
+	Site    *Function_Site `protobuf:"bytes,2,opt,name=site" json:"site,omitempty"`
+	Package *string        `protobuf:"bytes,3,opt,name=package" json:"package,omitempty"`
+	// declaration is the position of this function's declaration.  It is set
+	// only when site is unset, so that every function with a known position
+	// has one of the two.
+	Declaration *Function_Site `protobuf:"bytes,4,opt,name=declaration" json:"declaration,omitempty"`
+	// capability_site is the position within this function of the operation
+	// which gives it its capability, for the last function in a path whose
+	// capability was found by analyzing its body rather than by its name; for
+	// example, the first store of a reflect.Value to non-local memory.
+	CapabilitySite *Function_Site `protobuf:"bytes,5,opt,name=capability_site,json=capabilitySite" json:"capability_site,omitempty"`
+	// wrapper describes this function if it is a synthetic wrapper of a
+	// method, such as a bound method value, a method expression, or a method
+	// with a pointer receiver wrapping one declared with a value receiver.
+	// Wrappers are omitted from paths, except at the end, unless they are
+	// requested.
+	Wrapper       *string `protobuf:"bytes,6,opt,name=wrapper" json:"wrapper,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -337,10 +592,36 @@ func (x *Function) GetPackage() string {
 	return ""
 }
 
+func (x *Function) GetDeclaration() *Function_Site {
+	if x != nil {
+		return x.Declaration
+	}
+	return nil
+}
+
+func (x *Function) GetCapabilitySite() *Function_Site {
+	if x != nil {
+		return x.CapabilitySite
+	}
+	return nil
+}
+
+func (x *Function) GetWrapper() string {
+	if x != nil && x.Wrapper != nil {
+		return *x.Wrapper
+	}
+	return ""
+}
+
 type ModuleInfo struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Path          *string                `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
-	Version       *string                `protobuf:"bytes,2,opt,name=version" json:"version,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Path  *string                `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	// version is unset for main modules, which are built from source.
+	Version *string `protobuf:"bytes,2,opt,name=version" json:"version,omitempty"`
+	// replace is the module which replaces this one, if the main module's
+	// go.mod file has a replace directive for it.  For a replacement by a
+	// directory, its path is the directory and it has no version.
+	Replace       *ModuleInfo `protobuf:"bytes,3,opt,name=replace" json:"replace,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -389,6 +670,13 @@ func (x *ModuleInfo) GetVersion() string {
 	return ""
 }
 
+func (x *ModuleInfo) GetReplace() *ModuleInfo {
+	if x != nil {
+		return x.Replace
+	}
+	return nil
+}
+
 type PackageInfo struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	Path  *string                `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
@@ -451,8 +739,16 @@ type CapabilityInfoList struct {
 	CapabilityInfo []*CapabilityInfo `protobuf:"bytes,1,rep,name=capability_info,json=capabilityInfo" json:"capability_info,omitempty"`
 	ModuleInfo     []*ModuleInfo     `protobuf:"bytes,2,rep,name=module_info,json=moduleInfo" json:"module_info,omitempty"`
 	PackageInfo    []*PackageInfo    `protobuf:"bytes,3,rep,name=package_info,json=packageInfo" json:"package_info,omitempty"`
-	unknownFields  protoimpl.UnknownFields
-	sizeCache      protoimpl.SizeCache
+	// The number of entries omitted because they matched a baseline.
+	BaselineSuppressedCount *int64 `protobuf:"varint,4,opt,name=baseline_suppressed_count,json=baselineSuppressedCount" json:"baseline_suppressed_count,omitempty"`
+	// Entries in the baseline which did not match anything.
+	StaleBaselineEntry []*BaselineEntry `protobuf:"bytes,5,rep,name=stale_baseline_entry,json=staleBaselineEntry" json:"stale_baseline_entry,omitempty"`
+	// The number of packages which were analyzed, not counting their
+	// dependencies.  It is set even when no capabilities are found, so that a
+	// successful analysis with no findings can be told apart from no output.
+	AnalyzedPackages *int64 `protobuf:"varint,6,opt,name=analyzed_packages,json=analyzedPackages" json:"analyzed_packages,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
 }
 
 func (x *CapabilityInfoList) Reset() {
@@ -506,6 +802,81 @@ func (x *CapabilityInfoList) GetPackageInfo() []*PackageInfo {
 	return nil
 }
 
+func (x *CapabilityInfoList) GetBaselineSuppressedCount() int64 {
+	if x != nil && x.BaselineSuppressedCount != nil {
+		return *x.BaselineSuppressedCount
+	}
+	return 0
+}
+
+func (x *CapabilityInfoList) GetStaleBaselineEntry() []*BaselineEntry {
+	if x != nil {
+		return x.StaleBaselineEntry
+	}
+	return nil
+}
+
+func (x *CapabilityInfoList) GetAnalyzedPackages() int64 {
+	if x != nil && x.AnalyzedPackages != nil {
+		return *x.AnalyzedPackages
+	}
+	return 0
+}
+
+// BaselineEntry is an accepted (capability, package) pair which should not be
+// reported.
+type BaselineEntry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Capability    *Capability            `protobuf:"varint,1,opt,name=capability,enum=capslock.proto.Capability" json:"capability,omitempty"`
+	PackageDir    *string                `protobuf:"bytes,2,opt,name=package_dir,json=packageDir" json:"package_dir,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BaselineEntry) Reset() {
+	*x = BaselineEntry{}
+	mi := &file_capability_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BaselineEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BaselineEntry) ProtoMessage() {}
+
+func (x *BaselineEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_capability_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BaselineEntry.ProtoReflect.Descriptor instead.
+func (*BaselineEntry) Descriptor() ([]byte, []int) {
+	return file_capability_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *BaselineEntry) GetCapability() Capability {
+	if x != nil && x.Capability != nil {
+		return *x.Capability
+	}
+	return Capability_CAPABILITY_UNSPECIFIED
+}
+
+func (x *BaselineEntry) GetPackageDir() string {
+	if x != nil && x.PackageDir != nil {
+		return *x.PackageDir
+	}
+	return ""
+}
+
 type CapabilityCountList struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// A list of capability counts.
@@ -517,7 +888,7 @@ type CapabilityCountList struct {
 
 func (x *CapabilityCountList) Reset() {
 	*x = CapabilityCountList{}
-	mi := &file_capability_proto_msgTypes[5]
+	mi := &file_capability_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -529,7 +900,7 @@ func (x *CapabilityCountList) String() string {
 func (*CapabilityCountList) ProtoMessage() {}
 
 func (x *CapabilityCountList) ProtoReflect() protoreflect.Message {
-	mi := &file_capability_proto_msgTypes[5]
+	mi := &file_capability_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -542,7 +913,7 @@ func (x *CapabilityCountList) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CapabilityCountList.ProtoReflect.Descriptor instead.
 func (*CapabilityCountList) Descriptor() ([]byte, []int) {
-	return file_capability_proto_rawDescGZIP(), []int{5}
+	return file_capability_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *CapabilityCountList) GetCapabilityCounts() map[string]int64 {
@@ -567,13 +938,20 @@ type CapabilityStats struct {
 	TransitiveCount *int64                 `protobuf:"varint,4,opt,name=transitive_count,json=transitiveCount" json:"transitive_count,omitempty"`
 	ExampleCallpath []*Function            `protobuf:"bytes,5,rep,name=example_callpath,json=exampleCallpath" json:"example_callpath,omitempty"`
 	Count           *int64                 `protobuf:"varint,6,opt,name=count" json:"count,omitempty"`
-	unknownFields   protoimpl.UnknownFields
-	sizeCache       protoimpl.SizeCache
+	// The severity of the capability, as in CapabilityInfo.
+	Severity *int32 `protobuf:"varint,7,opt,name=severity" json:"severity,omitempty"`
+	// The number of distinct shortest call paths from the queried functions to
+	// the capability.  Counting stops at a limit, in which case path_count is
+	// the limit and path_count_at_least is set.
+	PathCount        *int64 `protobuf:"varint,8,opt,name=path_count,json=pathCount" json:"path_count,omitempty"`
+	PathCountAtLeast *bool  `protobuf:"varint,9,opt,name=path_count_at_least,json=pathCountAtLeast" json:"path_count_at_least,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
 }
 
 func (x *CapabilityStats) Reset() {
 	*x = CapabilityStats{}
-	mi := &file_capability_proto_msgTypes[6]
+	mi := &file_capability_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -585,7 +963,7 @@ func (x *CapabilityStats) String() string {
 func (*CapabilityStats) ProtoMessage() {}
 
 func (x *CapabilityStats) ProtoReflect() protoreflect.Message {
-	mi := &file_capability_proto_msgTypes[6]
+	mi := &file_capability_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -598,7 +976,7 @@ func (x *CapabilityStats) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CapabilityStats.ProtoReflect.Descriptor instead.
 func (*CapabilityStats) Descriptor() ([]byte, []int) {
-	return file_capability_proto_rawDescGZIP(), []int{6}
+	return file_capability_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *CapabilityStats) GetCapability() Capability {
@@ -643,6 +1021,27 @@ func (x *CapabilityStats) GetCount() int64 {
 	return 0
 }
 
+func (x *CapabilityStats) GetSeverity() int32 {
+	if x != nil && x.Severity != nil {
+		return *x.Severity
+	}
+	return 0
+}
+
+func (x *CapabilityStats) GetPathCount() int64 {
+	if x != nil && x.PathCount != nil {
+		return *x.PathCount
+	}
+	return 0
+}
+
+func (x *CapabilityStats) GetPathCountAtLeast() bool {
+	if x != nil && x.PathCountAtLeast != nil {
+		return *x.PathCountAtLeast
+	}
+	return false
+}
+
 type CapabilityStatList struct {
 	state           protoimpl.MessageState `protogen:"open.v1"`
 	CapabilityStats []*CapabilityStats     `protobuf:"bytes,1,rep,name=capability_stats,json=capabilityStats" json:"capability_stats,omitempty"`
@@ -653,7 +1052,7 @@ type CapabilityStatList struct {
 
 func (x *CapabilityStatList) Reset() {
 	*x = CapabilityStatList{}
-	mi := &file_capability_proto_msgTypes[7]
+	mi := &file_capability_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -665,7 +1064,7 @@ func (x *CapabilityStatList) String() string {
 func (*CapabilityStatList) ProtoMessage() {}
 
 func (x *CapabilityStatList) ProtoReflect() protoreflect.Message {
-	mi := &file_capability_proto_msgTypes[7]
+	mi := &file_capability_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -678,7 +1077,7 @@ func (x *CapabilityStatList) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CapabilityStatList.ProtoReflect.Descriptor instead.
 func (*CapabilityStatList) Descriptor() ([]byte, []int) {
-	return file_capability_proto_rawDescGZIP(), []int{7}
+	return file_capability_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *CapabilityStatList) GetCapabilityStats() []*CapabilityStats {
@@ -695,30 +1094,34 @@ func (x *CapabilityStatList) GetModuleInfo() []*ModuleInfo {
 	return nil
 }
 
-type Function_Site struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Filename      *string                `protobuf:"bytes,1,opt,name=filename" json:"filename,omitempty"`
-	Line          *int64                 `protobuf:"varint,2,opt,name=line" json:"line,omitempty"`
-	Column        *int64                 `protobuf:"varint,3,opt,name=column" json:"column,omitempty"`
+// ReachableEnvVars lists the environment variables which may be read by a
+// package, directly or through its dependencies.
+type ReachableEnvVars struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Package *string                `protobuf:"bytes,1,opt,name=package" json:"package,omitempty"`
+	// The names of the variables, sorted.  Reads of variables whose names are
+	// not constants, and reads of the whole environment, are represented by
+	// "=DYNAMIC=".
+	VarNames      []string `protobuf:"bytes,2,rep,name=var_names,json=varNames" json:"var_names,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *Function_Site) Reset() {
-	*x = Function_Site{}
-	mi := &file_capability_proto_msgTypes[8]
+func (x *ReachableEnvVars) Reset() {
+	*x = ReachableEnvVars{}
+	mi := &file_capability_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Function_Site) String() string {
+func (x *ReachableEnvVars) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Function_Site) ProtoMessage() {}
+func (*ReachableEnvVars) ProtoMessage() {}
 
-func (x *Function_Site) ProtoReflect() protoreflect.Message {
-	mi := &file_capability_proto_msgTypes[8]
+func (x *ReachableEnvVars) ProtoReflect() protoreflect.Message {
+	mi := &file_capability_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -729,74 +1132,618 @@ func (x *Function_Site) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Function_Site.ProtoReflect.Descriptor instead.
-func (*Function_Site) Descriptor() ([]byte, []int) {
-	return file_capability_proto_rawDescGZIP(), []int{1, 0}
+// Deprecated: Use ReachableEnvVars.ProtoReflect.Descriptor instead.
+func (*ReachableEnvVars) Descriptor() ([]byte, []int) {
+	return file_capability_proto_rawDescGZIP(), []int{9}
 }
 
-func (x *Function_Site) GetFilename() string {
-	if x != nil && x.Filename != nil {
-		return *x.Filename
+func (x *ReachableEnvVars) GetPackage() string {
+	if x != nil && x.Package != nil {
+		return *x.Package
 	}
 	return ""
 }
 
-func (x *Function_Site) GetLine() int64 {
-	if x != nil && x.Line != nil {
-		return *x.Line
+func (x *ReachableEnvVars) GetVarNames() []string {
+	if x != nil {
+		return x.VarNames
 	}
-	return 0
+	return nil
 }
 
-func (x *Function_Site) GetColumn() int64 {
-	if x != nil && x.Column != nil {
-		return *x.Column
+type ReachableEnvVarsList struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	ReachableEnvVars []*ReachableEnvVars    `protobuf:"bytes,1,rep,name=reachable_env_vars,json=reachableEnvVars" json:"reachable_env_vars,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *ReachableEnvVarsList) Reset() {
+	*x = ReachableEnvVarsList{}
+	mi := &file_capability_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReachableEnvVarsList) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReachableEnvVarsList) ProtoMessage() {}
+
+func (x *ReachableEnvVarsList) ProtoReflect() protoreflect.Message {
+	mi := &file_capability_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
 	}
-	return 0
+	return mi.MessageOf(x)
 }
 
-var File_capability_proto protoreflect.FileDescriptor
+// Deprecated: Use ReachableEnvVarsList.ProtoReflect.Descriptor instead.
+func (*ReachableEnvVarsList) Descriptor() ([]byte, []int) {
+	return file_capability_proto_rawDescGZIP(), []int{10}
+}
 
-const file_capability_proto_rawDesc = "" +
-	"\n" +
-	"\x10capability.proto\x12\x0ecapslock.proto\"\xa2\x02\n" +
-	"\x0eCapabilityInfo\x12!\n" +
-	"\fpackage_name\x18\x01 \x01(\tR\vpackageName\x12:\n" +
-	"\n" +
-	"capability\x18\x02 \x01(\x0e2\x1a.capslock.proto.CapabilityR\n" +
-	"capability\x12\x19\n" +
-	"\bdep_path\x18\x03 \x01(\tR\adepPath\x12,\n" +
+func (x *ReachableEnvVarsList) GetReachableEnvVars() []*ReachableEnvVars {
+	if x != nil {
+		return x.ReachableEnvVars
+	}
+	return nil
+}
+
+// EmbedPatterns lists the patterns in the //go:embed directives of a package,
+// which name the files whose contents are embedded in the binary at build
+// time.
+type EmbedPatterns struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Package *string                `protobuf:"bytes,1,opt,name=package" json:"package,omitempty"`
+	// The patterns, sorted, with duplicates removed.
+	Patterns      []string `protobuf:"bytes,2,rep,name=patterns" json:"patterns,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EmbedPatterns) Reset() {
+	*x = EmbedPatterns{}
+	mi := &file_capability_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EmbedPatterns) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EmbedPatterns) ProtoMessage() {}
+
+func (x *EmbedPatterns) ProtoReflect() protoreflect.Message {
+	mi := &file_capability_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EmbedPatterns.ProtoReflect.Descriptor instead.
+func (*EmbedPatterns) Descriptor() ([]byte, []int) {
+	return file_capability_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *EmbedPatterns) GetPackage() string {
+	if x != nil && x.Package != nil {
+		return *x.Package
+	}
+	return ""
+}
+
+func (x *EmbedPatterns) GetPatterns() []string {
+	if x != nil {
+		return x.Patterns
+	}
+	return nil
+}
+
+type EmbedPatternsList struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	EmbedPatterns []*EmbedPatterns       `protobuf:"bytes,1,rep,name=embed_patterns,json=embedPatterns" json:"embed_patterns,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EmbedPatternsList) Reset() {
+	*x = EmbedPatternsList{}
+	mi := &file_capability_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EmbedPatternsList) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EmbedPatternsList) ProtoMessage() {}
+
+func (x *EmbedPatternsList) ProtoReflect() protoreflect.Message {
+	mi := &file_capability_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EmbedPatternsList.ProtoReflect.Descriptor instead.
+func (*EmbedPatternsList) Descriptor() ([]byte, []int) {
+	return file_capability_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *EmbedPatternsList) GetEmbedPatterns() []*EmbedPatterns {
+	if x != nil {
+		return x.EmbedPatterns
+	}
+	return nil
+}
+
+// Classification records the capability a function in the call graph was
+// given, and where that decision came from, so that it can be audited.
+type Classification struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The function name, in the form used in CapabilityInfo paths.
+	Function      *string               `protobuf:"bytes,1,opt,name=function" json:"function,omitempty"`
+	Package       *string               `protobuf:"bytes,2,opt,name=package" json:"package,omitempty"`
+	Capability    *Capability           `protobuf:"varint,3,opt,name=capability,enum=capslock.proto.Capability" json:"capability,omitempty"`
+	Source        *ClassificationSource `protobuf:"varint,4,opt,name=source,enum=capslock.proto.ClassificationSource" json:"source,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Classification) Reset() {
+	*x = Classification{}
+	mi := &file_capability_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Classification) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Classification) ProtoMessage() {}
+
+func (x *Classification) ProtoReflect() protoreflect.Message {
+	mi := &file_capability_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Classification.ProtoReflect.Descriptor instead.
+func (*Classification) Descriptor() ([]byte, []int) {
+	return file_capability_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *Classification) GetFunction() string {
+	if x != nil && x.Function != nil {
+		return *x.Function
+	}
+	return ""
+}
+
+func (x *Classification) GetPackage() string {
+	if x != nil && x.Package != nil {
+		return *x.Package
+	}
+	return ""
+}
+
+func (x *Classification) GetCapability() Capability {
+	if x != nil && x.Capability != nil {
+		return *x.Capability
+	}
+	return Capability_CAPABILITY_UNSPECIFIED
+}
+
+func (x *Classification) GetSource() ClassificationSource {
+	if x != nil && x.Source != nil {
+		return *x.Source
+	}
+	return ClassificationSource_CLASSIFICATION_SOURCE_UNSPECIFIED
+}
+
+type ClassificationList struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Classifications []*Classification      `protobuf:"bytes,1,rep,name=classifications" json:"classifications,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *ClassificationList) Reset() {
+	*x = ClassificationList{}
+	mi := &file_capability_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClassificationList) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClassificationList) ProtoMessage() {}
+
+func (x *ClassificationList) ProtoReflect() protoreflect.Message {
+	mi := &file_capability_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClassificationList.ProtoReflect.Descriptor instead.
+func (*ClassificationList) Descriptor() ([]byte, []int) {
+	return file_capability_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ClassificationList) GetClassifications() []*Classification {
+	if x != nil {
+		return x.Classifications
+	}
+	return nil
+}
+
+// CapabilityDiff describes the differences between two CapabilityInfoLists,
+// a baseline and a current list.
+type CapabilityDiff struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Entries in the current list but not the baseline.
+	Added []*CapabilityDiff_Entry `protobuf:"bytes,1,rep,name=added" json:"added,omitempty"`
+	// Entries in the baseline but not the current list.
+	Removed []*CapabilityDiff_Entry `protobuf:"bytes,2,rep,name=removed" json:"removed,omitempty"`
+	// Entries in both lists.
+	Unchanged     []*CapabilityDiff_Entry `protobuf:"bytes,3,rep,name=unchanged" json:"unchanged,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CapabilityDiff) Reset() {
+	*x = CapabilityDiff{}
+	mi := &file_capability_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CapabilityDiff) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CapabilityDiff) ProtoMessage() {}
+
+func (x *CapabilityDiff) ProtoReflect() protoreflect.Message {
+	mi := &file_capability_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CapabilityDiff.ProtoReflect.Descriptor instead.
+func (*CapabilityDiff) Descriptor() ([]byte, []int) {
+	return file_capability_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *CapabilityDiff) GetAdded() []*CapabilityDiff_Entry {
+	if x != nil {
+		return x.Added
+	}
+	return nil
+}
+
+func (x *CapabilityDiff) GetRemoved() []*CapabilityDiff_Entry {
+	if x != nil {
+		return x.Removed
+	}
+	return nil
+}
+
+func (x *CapabilityDiff) GetUnchanged() []*CapabilityDiff_Entry {
+	if x != nil {
+		return x.Unchanged
+	}
+	return nil
+}
+
+type CapabilityInfo_Instantiation struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The name of the instantiated function, such as
+	// "example.com/list.Map[int]".
+	Function *string `protobuf:"bytes,1,opt,name=function" json:"function,omitempty"`
+	// The name of the generic function, such as "example.com/list.Map".
+	Generic *string `protobuf:"bytes,2,opt,name=generic" json:"generic,omitempty"`
+	// The type arguments of the instantiation, in order.
+	TypeArgs []string `protobuf:"bytes,3,rep,name=type_args,json=typeArgs" json:"type_args,omitempty"`
+	// Set if the instantiation is, or contains, the last function in the
+	// dependency path, which has the capability.
+	HasCapability *bool `protobuf:"varint,4,opt,name=has_capability,json=hasCapability" json:"has_capability,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CapabilityInfo_Instantiation) Reset() {
+	*x = CapabilityInfo_Instantiation{}
+	mi := &file_capability_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CapabilityInfo_Instantiation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CapabilityInfo_Instantiation) ProtoMessage() {}
+
+func (x *CapabilityInfo_Instantiation) ProtoReflect() protoreflect.Message {
+	mi := &file_capability_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CapabilityInfo_Instantiation.ProtoReflect.Descriptor instead.
+func (*CapabilityInfo_Instantiation) Descriptor() ([]byte, []int) {
+	return file_capability_proto_rawDescGZIP(), []int{0, 0}
+}
+
+func (x *CapabilityInfo_Instantiation) GetFunction() string {
+	if x != nil && x.Function != nil {
+		return *x.Function
+	}
+	return ""
+}
+
+func (x *CapabilityInfo_Instantiation) GetGeneric() string {
+	if x != nil && x.Generic != nil {
+		return *x.Generic
+	}
+	return ""
+}
+
+func (x *CapabilityInfo_Instantiation) GetTypeArgs() []string {
+	if x != nil {
+		return x.TypeArgs
+	}
+	return nil
+}
+
+func (x *CapabilityInfo_Instantiation) GetHasCapability() bool {
+	if x != nil && x.HasCapability != nil {
+		return *x.HasCapability
+	}
+	return false
+}
+
+type Function_Site struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Filename      *string                `protobuf:"bytes,1,opt,name=filename" json:"filename,omitempty"`
+	Line          *int64                 `protobuf:"varint,2,opt,name=line" json:"line,omitempty"`
+	Column        *int64                 `protobuf:"varint,3,opt,name=column" json:"column,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Function_Site) Reset() {
+	*x = Function_Site{}
+	mi := &file_capability_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Function_Site) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Function_Site) ProtoMessage() {}
+
+func (x *Function_Site) ProtoReflect() protoreflect.Message {
+	mi := &file_capability_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Function_Site.ProtoReflect.Descriptor instead.
+func (*Function_Site) Descriptor() ([]byte, []int) {
+	return file_capability_proto_rawDescGZIP(), []int{1, 0}
+}
+
+func (x *Function_Site) GetFilename() string {
+	if x != nil && x.Filename != nil {
+		return *x.Filename
+	}
+	return ""
+}
+
+func (x *Function_Site) GetLine() int64 {
+	if x != nil && x.Line != nil {
+		return *x.Line
+	}
+	return 0
+}
+
+func (x *Function_Site) GetColumn() int64 {
+	if x != nil && x.Column != nil {
+		return *x.Column
+	}
+	return 0
+}
+
+type CapabilityDiff_Entry struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The package path, function name, or module path, depending on the
+	// granularity of the comparison.
+	Key        *string     `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+	Capability *Capability `protobuf:"varint,2,opt,name=capability,enum=capslock.proto.Capability" json:"capability,omitempty"`
+	// An example from the current list, or from the baseline for removed
+	// entries.
+	CapabilityInfo *CapabilityInfo `protobuf:"bytes,3,opt,name=capability_info,json=capabilityInfo" json:"capability_info,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *CapabilityDiff_Entry) Reset() {
+	*x = CapabilityDiff_Entry{}
+	mi := &file_capability_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CapabilityDiff_Entry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CapabilityDiff_Entry) ProtoMessage() {}
+
+func (x *CapabilityDiff_Entry) ProtoReflect() protoreflect.Message {
+	mi := &file_capability_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CapabilityDiff_Entry.ProtoReflect.Descriptor instead.
+func (*CapabilityDiff_Entry) Descriptor() ([]byte, []int) {
+	return file_capability_proto_rawDescGZIP(), []int{15, 0}
+}
+
+func (x *CapabilityDiff_Entry) GetKey() string {
+	if x != nil && x.Key != nil {
+		return *x.Key
+	}
+	return ""
+}
+
+func (x *CapabilityDiff_Entry) GetCapability() Capability {
+	if x != nil && x.Capability != nil {
+		return *x.Capability
+	}
+	return Capability_CAPABILITY_UNSPECIFIED
+}
+
+func (x *CapabilityDiff_Entry) GetCapabilityInfo() *CapabilityInfo {
+	if x != nil {
+		return x.CapabilityInfo
+	}
+	return nil
+}
+
+var File_capability_proto protoreflect.FileDescriptor
+
+const file_capability_proto_rawDesc = "" +
+	"\n" +
+	"\x10capability.proto\x12\x0ecapslock.proto\"\x8a\x06\n" +
+	"\x0eCapabilityInfo\x12!\n" +
+	"\fpackage_name\x18\x01 \x01(\tR\vpackageName\x12:\n" +
+	"\n" +
+	"capability\x18\x02 \x01(\x0e2\x1a.capslock.proto.CapabilityR\n" +
+	"capability\x12\x19\n" +
+	"\bdep_path\x18\x03 \x01(\tR\adepPath\x12,\n" +
 	"\x04path\x18\x06 \x03(\v2\x18.capslock.proto.FunctionR\x04path\x12\x1f\n" +
 	"\vpackage_dir\x18\x04 \x01(\tR\n" +
 	"packageDir\x12G\n" +
-	"\x0fcapability_type\x18\x05 \x01(\x0e2\x1e.capslock.proto.CapabilityTypeR\x0ecapabilityType\"\xbb\x01\n" +
+	"\x0fcapability_type\x18\x05 \x01(\x0e2\x1e.capslock.proto.CapabilityTypeR\x0ecapabilityType\x12\x1c\n" +
+	"\ttruncated\x18\a \x01(\bR\ttruncated\x12\x17\n" +
+	"\apath_id\x18\b \x01(\tR\x06pathId\x12\x1b\n" +
+	"\tfrom_test\x18\t \x01(\bR\bfromTest\x12\x1f\n" +
+	"\vmodule_path\x18\n" +
+	" \x01(\tR\n" +
+	"modulePath\x12G\n" +
+	"\x11capability_module\x18\v \x01(\v2\x1a.capslock.proto.ModuleInfoR\x10capabilityModule\x12\x1a\n" +
+	"\bseverity\x18\f \x01(\x05R\bseverity\x12\x18\n" +
+	"\aconfigs\x18\r \x03(\tR\aconfigs\x12\x10\n" +
+	"\x03cwe\x18\x0e \x03(\tR\x03cwe\x12T\n" +
+	"\x0einstantiations\x18\x0f \x03(\v2,.capslock.proto.CapabilityInfo.InstantiationR\x0einstantiations\x1a\x89\x01\n" +
+	"\rInstantiation\x12\x1a\n" +
+	"\bfunction\x18\x01 \x01(\tR\bfunction\x12\x18\n" +
+	"\ageneric\x18\x02 \x01(\tR\ageneric\x12\x1b\n" +
+	"\ttype_args\x18\x03 \x03(\tR\btypeArgs\x12%\n" +
+	"\x0ehas_capability\x18\x04 \x01(\bR\rhasCapability\"\xde\x02\n" +
 	"\bFunction\x12\x12\n" +
 	"\x04name\x18\x01 \x01(\tR\x04name\x121\n" +
 	"\x04site\x18\x02 \x01(\v2\x1d.capslock.proto.Function.SiteR\x04site\x12\x18\n" +
-	"\apackage\x18\x03 \x01(\tR\apackage\x1aN\n" +
+	"\apackage\x18\x03 \x01(\tR\apackage\x12?\n" +
+	"\vdeclaration\x18\x04 \x01(\v2\x1d.capslock.proto.Function.SiteR\vdeclaration\x12F\n" +
+	"\x0fcapability_site\x18\x05 \x01(\v2\x1d.capslock.proto.Function.SiteR\x0ecapabilitySite\x12\x18\n" +
+	"\awrapper\x18\x06 \x01(\tR\awrapper\x1aN\n" +
 	"\x04Site\x12\x1a\n" +
 	"\bfilename\x18\x01 \x01(\tR\bfilename\x12\x12\n" +
 	"\x04line\x18\x02 \x01(\x03R\x04line\x12\x16\n" +
-	"\x06column\x18\x03 \x01(\x03R\x06column\":\n" +
+	"\x06column\x18\x03 \x01(\x03R\x06column\"p\n" +
 	"\n" +
 	"ModuleInfo\x12\x12\n" +
 	"\x04path\x18\x01 \x01(\tR\x04path\x12\x18\n" +
-	"\aversion\x18\x02 \x01(\tR\aversion\"F\n" +
+	"\aversion\x18\x02 \x01(\tR\aversion\x124\n" +
+	"\areplace\x18\x03 \x01(\v2\x1a.capslock.proto.ModuleInfoR\areplace\"F\n" +
 	"\vPackageInfo\x12\x12\n" +
 	"\x04path\x18\x01 \x01(\tR\x04path\x12#\n" +
-	"\rignored_files\x18\x02 \x03(\tR\fignoredFiles\"\xda\x01\n" +
+	"\rignored_files\x18\x02 \x03(\tR\fignoredFiles\"\x94\x03\n" +
 	"\x12CapabilityInfoList\x12G\n" +
 	"\x0fcapability_info\x18\x01 \x03(\v2\x1e.capslock.proto.CapabilityInfoR\x0ecapabilityInfo\x12;\n" +
 	"\vmodule_info\x18\x02 \x03(\v2\x1a.capslock.proto.ModuleInfoR\n" +
 	"moduleInfo\x12>\n" +
-	"\fpackage_info\x18\x03 \x03(\v2\x1b.capslock.proto.PackageInfoR\vpackageInfo\"\xff\x01\n" +
+	"\fpackage_info\x18\x03 \x03(\v2\x1b.capslock.proto.PackageInfoR\vpackageInfo\x12:\n" +
+	"\x19baseline_suppressed_count\x18\x04 \x01(\x03R\x17baselineSuppressedCount\x12O\n" +
+	"\x14stale_baseline_entry\x18\x05 \x03(\v2\x1d.capslock.proto.BaselineEntryR\x12staleBaselineEntry\x12+\n" +
+	"\x11analyzed_packages\x18\x06 \x01(\x03R\x10analyzedPackages\"l\n" +
+	"\rBaselineEntry\x12:\n" +
+	"\n" +
+	"capability\x18\x01 \x01(\x0e2\x1a.capslock.proto.CapabilityR\n" +
+	"capability\x12\x1f\n" +
+	"\vpackage_dir\x18\x02 \x01(\tR\n" +
+	"packageDir\"\xff\x01\n" +
 	"\x13CapabilityCountList\x12f\n" +
 	"\x11capability_counts\x18\x01 \x03(\v29.capslock.proto.CapabilityCountList.CapabilityCountsEntryR\x10capabilityCounts\x12;\n" +
 	"\vmodule_info\x18\x02 \x03(\v2\x1a.capslock.proto.ModuleInfoR\n" +
 	"moduleInfo\x1aC\n" +
 	"\x15CapabilityCountsEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\"\x98\x02\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\"\x82\x03\n" +
 	"\x0fCapabilityStats\x12:\n" +
 	"\n" +
 	"capability\x18\x01 \x01(\x0e2\x1a.capslock.proto.CapabilityR\n" +
@@ -805,11 +1752,50 @@ const file_capability_proto_rawDesc = "" +
 	"\fdirect_count\x18\x03 \x01(\x03R\vdirectCount\x12)\n" +
 	"\x10transitive_count\x18\x04 \x01(\x03R\x0ftransitiveCount\x12C\n" +
 	"\x10example_callpath\x18\x05 \x03(\v2\x18.capslock.proto.FunctionR\x0fexampleCallpath\x12\x14\n" +
-	"\x05count\x18\x06 \x01(\x03R\x05count\"\x9d\x01\n" +
+	"\x05count\x18\x06 \x01(\x03R\x05count\x12\x1a\n" +
+	"\bseverity\x18\a \x01(\x05R\bseverity\x12\x1d\n" +
+	"\n" +
+	"path_count\x18\b \x01(\x03R\tpathCount\x12-\n" +
+	"\x13path_count_at_least\x18\t \x01(\bR\x10pathCountAtLeast\"\x9d\x01\n" +
 	"\x12CapabilityStatList\x12J\n" +
 	"\x10capability_stats\x18\x01 \x03(\v2\x1f.capslock.proto.CapabilityStatsR\x0fcapabilityStats\x12;\n" +
 	"\vmodule_info\x18\x02 \x03(\v2\x1a.capslock.proto.ModuleInfoR\n" +
-	"moduleInfo*\xc7\x03\n" +
+	"moduleInfo\"I\n" +
+	"\x10ReachableEnvVars\x12\x18\n" +
+	"\apackage\x18\x01 \x01(\tR\apackage\x12\x1b\n" +
+	"\tvar_names\x18\x02 \x03(\tR\bvarNames\"f\n" +
+	"\x14ReachableEnvVarsList\x12N\n" +
+	"\x12reachable_env_vars\x18\x01 \x03(\v2 .capslock.proto.ReachableEnvVarsR\x10reachableEnvVars\"E\n" +
+	"\rEmbedPatterns\x12\x18\n" +
+	"\apackage\x18\x01 \x01(\tR\apackage\x12\x1a\n" +
+	"\bpatterns\x18\x02 \x03(\tR\bpatterns\"Y\n" +
+	"\x11EmbedPatternsList\x12D\n" +
+	"\x0eembed_patterns\x18\x01 \x03(\v2\x1d.capslock.proto.EmbedPatternsR\rembedPatterns\"\xc0\x01\n" +
+	"\x0eClassification\x12\x1a\n" +
+	"\bfunction\x18\x01 \x01(\tR\bfunction\x12\x18\n" +
+	"\apackage\x18\x02 \x01(\tR\apackage\x12:\n" +
+	"\n" +
+	"capability\x18\x03 \x01(\x0e2\x1a.capslock.proto.CapabilityR\n" +
+	"capability\x12<\n" +
+	"\x06source\x18\x04 \x01(\x0e2$.capslock.proto.ClassificationSourceR\x06source\"^\n" +
+	"\x12ClassificationList\x12H\n" +
+	"\x0fclassifications\x18\x01 \x03(\v2\x1e.capslock.proto.ClassificationR\x0fclassifications\"\xf1\x02\n" +
+	"\x0eCapabilityDiff\x12:\n" +
+	"\x05added\x18\x01 \x03(\v2$.capslock.proto.CapabilityDiff.EntryR\x05added\x12>\n" +
+	"\aremoved\x18\x02 \x03(\v2$.capslock.proto.CapabilityDiff.EntryR\aremoved\x12B\n" +
+	"\tunchanged\x18\x03 \x03(\v2$.capslock.proto.CapabilityDiff.EntryR\tunchanged\x1a\x9e\x01\n" +
+	"\x05Entry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12:\n" +
+	"\n" +
+	"capability\x18\x02 \x01(\x0e2\x1a.capslock.proto.CapabilityR\n" +
+	"capability\x12G\n" +
+	"\x0fcapability_info\x18\x03 \x01(\v2\x1e.capslock.proto.CapabilityInfoR\x0ecapabilityInfo*\xcc\x01\n" +
+	"\x14ClassificationSource\x12%\n" +
+	"!CLASSIFICATION_SOURCE_UNSPECIFIED\x10\x00\x12!\n" +
+	"\x1dCLASSIFICATION_SOURCE_DEFAULT\x10\x01\x12\"\n" +
+	"\x1eCLASSIFICATION_SOURCE_OVERRIDE\x10\x02\x12#\n" +
+	"\x1fCLASSIFICATION_SOURCE_DIRECTIVE\x10\x03\x12!\n" +
+	"\x1dCLASSIFICATION_SOURCE_BUILTIN\x10\x04*\xba\b\n" +
 	"\n" +
 	"Capability\x12\x1a\n" +
 	"\x16CAPABILITY_UNSPECIFIED\x10\x00\x12\x13\n" +
@@ -828,7 +1814,30 @@ const file_capability_proto_rawDesc = "" +
 	"\x19CAPABILITY_UNSAFE_POINTER\x10\f\x12\x16\n" +
 	"\x12CAPABILITY_REFLECT\x10\r\x12\x13\n" +
 	"\x0fCAPABILITY_EXEC\x10\x0e\x12\x1f\n" +
-	"\x1bCAPABILITY_READ_ENVIRONMENT\x10\x0f*m\n" +
+	"\x1bCAPABILITY_READ_ENVIRONMENT\x10\x0f\x12!\n" +
+	"\x1dCAPABILITY_MODIFY_ENVIRONMENT\x10\x10\x12\x19\n" +
+	"\x15CAPABILITY_FILES_READ\x10\x11\x12\x1a\n" +
+	"\x16CAPABILITY_FILES_WRITE\x10\x12\x12\x14\n" +
+	"\x10CAPABILITY_CLOCK\x10\x13\x12\x15\n" +
+	"\x11CAPABILITY_RANDOM\x10\x14\x12\x1a\n" +
+	"\x16CAPABILITY_CRYPTO_RAND\x10\x15\x12\x1d\n" +
+	"\x19CAPABILITY_REFLECT_INVOKE\x10\x16\x12\x18\n" +
+	"\x14CAPABILITY_GOROUTINE\x10\x17\x12\x1b\n" +
+	"\x17CAPABILITY_PROCESS_EXIT\x10\x18\x12\x1b\n" +
+	"\x17CAPABILITY_NETWORK_DIAL\x10\x19\x12\x1d\n" +
+	"\x19CAPABILITY_NETWORK_LISTEN\x10\x1a\x12\x1a\n" +
+	"\x16CAPABILITY_NETWORK_DNS\x10\x1b\x12\x15\n" +
+	"\x11CAPABILITY_PLUGIN\x10\x1c\x12\x1a\n" +
+	"\x16CAPABILITY_RAW_SYSCALL\x10\x1d\x12\x15\n" +
+	"\x11CAPABILITY_SIGNAL\x10\x1e\x12\x1a\n" +
+	"\x16CAPABILITY_FS_METADATA\x10\x1f\x12\x1b\n" +
+	"\x17CAPABILITY_SYSTEM_FILES\x10 \x12\x17\n" +
+	"\x13CAPABILITY_TERMINAL\x10!\x12\x19\n" +
+	"\x15CAPABILITY_CERT_STORE\x10\"\x12\x1a\n" +
+	"\x16CAPABILITY_DESERIALIZE\x10#\x12\x14\n" +
+	"\x10CAPABILITY_EMBED\x10$\x12\x1a\n" +
+	"\x16CAPABILITY_HOST_CONFIG\x10%\x12\x1b\n" +
+	"\x17CAPABILITY_GO_TOOLCHAIN\x10&*m\n" +
 	"\x0eCapabilityType\x12\x1f\n" +
 	"\x1bCAPABILITY_TYPE_UNSPECIFIED\x10\x00\x12\x1a\n" +
 	"\x16CAPABILITY_TYPE_DIRECT\x10\x01\x12\x1e\n" +
@@ -846,41 +1855,69 @@ func file_capability_proto_rawDescGZIP() []byte {
 	return file_capability_proto_rawDescData
 }
 
-var file_capability_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
-var file_capability_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_capability_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_capability_proto_msgTypes = make([]protoimpl.MessageInfo, 20)
 var file_capability_proto_goTypes = []any{
-	(Capability)(0),             // 0: capslock.proto.Capability
-	(CapabilityType)(0),         // 1: capslock.proto.CapabilityType
-	(*CapabilityInfo)(nil),      // 2: capslock.proto.CapabilityInfo
-	(*Function)(nil),            // 3: capslock.proto.Function
-	(*ModuleInfo)(nil),          // 4: capslock.proto.ModuleInfo
-	(*PackageInfo)(nil),         // 5: capslock.proto.PackageInfo
-	(*CapabilityInfoList)(nil),  // 6: capslock.proto.CapabilityInfoList
-	(*CapabilityCountList)(nil), // 7: capslock.proto.CapabilityCountList
-	(*CapabilityStats)(nil),     // 8: capslock.proto.CapabilityStats
-	(*CapabilityStatList)(nil),  // 9: capslock.proto.CapabilityStatList
-	(*Function_Site)(nil),       // 10: capslock.proto.Function.Site
-	nil,                         // 11: capslock.proto.CapabilityCountList.CapabilityCountsEntry
+	(ClassificationSource)(0),            // 0: capslock.proto.ClassificationSource
+	(Capability)(0),                      // 1: capslock.proto.Capability
+	(CapabilityType)(0),                  // 2: capslock.proto.CapabilityType
+	(*CapabilityInfo)(nil),               // 3: capslock.proto.CapabilityInfo
+	(*Function)(nil),                     // 4: capslock.proto.Function
+	(*ModuleInfo)(nil),                   // 5: capslock.proto.ModuleInfo
+	(*PackageInfo)(nil),                  // 6: capslock.proto.PackageInfo
+	(*CapabilityInfoList)(nil),           // 7: capslock.proto.CapabilityInfoList
+	(*BaselineEntry)(nil),                // 8: capslock.proto.BaselineEntry
+	(*CapabilityCountList)(nil),          // 9: capslock.proto.CapabilityCountList
+	(*CapabilityStats)(nil),              // 10: capslock.proto.CapabilityStats
+	(*CapabilityStatList)(nil),           // 11: capslock.proto.CapabilityStatList
+	(*ReachableEnvVars)(nil),             // 12: capslock.proto.ReachableEnvVars
+	(*ReachableEnvVarsList)(nil),         // 13: capslock.proto.ReachableEnvVarsList
+	(*EmbedPatterns)(nil),                // 14: capslock.proto.EmbedPatterns
+	(*EmbedPatternsList)(nil),            // 15: capslock.proto.EmbedPatternsList
+	(*Classification)(nil),               // 16: capslock.proto.Classification
+	(*ClassificationList)(nil),           // 17: capslock.proto.ClassificationList
+	(*CapabilityDiff)(nil),               // 18: capslock.proto.CapabilityDiff
+	(*CapabilityInfo_Instantiation)(nil), // 19: capslock.proto.CapabilityInfo.Instantiation
+	(*Function_Site)(nil),                // 20: capslock.proto.Function.Site
+	nil,                                  // 21: capslock.proto.CapabilityCountList.CapabilityCountsEntry
+	(*CapabilityDiff_Entry)(nil),         // 22: capslock.proto.CapabilityDiff.Entry
 }
 var file_capability_proto_depIdxs = []int32{
-	0,  // 0: capslock.proto.CapabilityInfo.capability:type_name -> capslock.proto.Capability
-	3,  // 1: capslock.proto.CapabilityInfo.path:type_name -> capslock.proto.Function
-	1,  // 2: capslock.proto.CapabilityInfo.capability_type:type_name -> capslock.proto.CapabilityType
-	10, // 3: capslock.proto.Function.site:type_name -> capslock.proto.Function.Site
-	2,  // 4: capslock.proto.CapabilityInfoList.capability_info:type_name -> capslock.proto.CapabilityInfo
-	4,  // 5: capslock.proto.CapabilityInfoList.module_info:type_name -> capslock.proto.ModuleInfo
-	5,  // 6: capslock.proto.CapabilityInfoList.package_info:type_name -> capslock.proto.PackageInfo
-	11, // 7: capslock.proto.CapabilityCountList.capability_counts:type_name -> capslock.proto.CapabilityCountList.CapabilityCountsEntry
-	4,  // 8: capslock.proto.CapabilityCountList.module_info:type_name -> capslock.proto.ModuleInfo
-	0,  // 9: capslock.proto.CapabilityStats.capability:type_name -> capslock.proto.Capability
-	3,  // 10: capslock.proto.CapabilityStats.example_callpath:type_name -> capslock.proto.Function
-	8,  // 11: capslock.proto.CapabilityStatList.capability_stats:type_name -> capslock.proto.CapabilityStats
-	4,  // 12: capslock.proto.CapabilityStatList.module_info:type_name -> capslock.proto.ModuleInfo
-	13, // [13:13] is the sub-list for method output_type
-	13, // [13:13] is the sub-list for method input_type
-	13, // [13:13] is the sub-list for extension type_name
-	13, // [13:13] is the sub-list for extension extendee
-	0,  // [0:13] is the sub-list for field type_name
+	1,  // 0: capslock.proto.CapabilityInfo.capability:type_name -> capslock.proto.Capability
+	4,  // 1: capslock.proto.CapabilityInfo.path:type_name -> capslock.proto.Function
+	2,  // 2: capslock.proto.CapabilityInfo.capability_type:type_name -> capslock.proto.CapabilityType
+	5,  // 3: capslock.proto.CapabilityInfo.capability_module:type_name -> capslock.proto.ModuleInfo
+	19, // 4: capslock.proto.CapabilityInfo.instantiations:type_name -> capslock.proto.CapabilityInfo.Instantiation
+	20, // 5: capslock.proto.Function.site:type_name -> capslock.proto.Function.Site
+	20, // 6: capslock.proto.Function.declaration:type_name -> capslock.proto.Function.Site
+	20, // 7: capslock.proto.Function.capability_site:type_name -> capslock.proto.Function.Site
+	5,  // 8: capslock.proto.ModuleInfo.replace:type_name -> capslock.proto.ModuleInfo
+	3,  // 9: capslock.proto.CapabilityInfoList.capability_info:type_name -> capslock.proto.CapabilityInfo
+	5,  // 10: capslock.proto.CapabilityInfoList.module_info:type_name -> capslock.proto.ModuleInfo
+	6,  // 11: capslock.proto.CapabilityInfoList.package_info:type_name -> capslock.proto.PackageInfo
+	8,  // 12: capslock.proto.CapabilityInfoList.stale_baseline_entry:type_name -> capslock.proto.BaselineEntry
+	1,  // 13: capslock.proto.BaselineEntry.capability:type_name -> capslock.proto.Capability
+	21, // 14: capslock.proto.CapabilityCountList.capability_counts:type_name -> capslock.proto.CapabilityCountList.CapabilityCountsEntry
+	5,  // 15: capslock.proto.CapabilityCountList.module_info:type_name -> capslock.proto.ModuleInfo
+	1,  // 16: capslock.proto.CapabilityStats.capability:type_name -> capslock.proto.Capability
+	4,  // 17: capslock.proto.CapabilityStats.example_callpath:type_name -> capslock.proto.Function
+	10, // 18: capslock.proto.CapabilityStatList.capability_stats:type_name -> capslock.proto.CapabilityStats
+	5,  // 19: capslock.proto.CapabilityStatList.module_info:type_name -> capslock.proto.ModuleInfo
+	12, // 20: capslock.proto.ReachableEnvVarsList.reachable_env_vars:type_name -> capslock.proto.ReachableEnvVars
+	14, // 21: capslock.proto.EmbedPatternsList.embed_patterns:type_name -> capslock.proto.EmbedPatterns
+	1,  // 22: capslock.proto.Classification.capability:type_name -> capslock.proto.Capability
+	0,  // 23: capslock.proto.Classification.source:type_name -> capslock.proto.ClassificationSource
+	16, // 24: capslock.proto.ClassificationList.classifications:type_name -> capslock.proto.Classification
+	22, // 25: capslock.proto.CapabilityDiff.added:type_name -> capslock.proto.CapabilityDiff.Entry
+	22, // 26: capslock.proto.CapabilityDiff.removed:type_name -> capslock.proto.CapabilityDiff.Entry
+	22, // 27: capslock.proto.CapabilityDiff.unchanged:type_name -> capslock.proto.CapabilityDiff.Entry
+	1,  // 28: capslock.proto.CapabilityDiff.Entry.capability:type_name -> capslock.proto.Capability
+	3,  // 29: capslock.proto.CapabilityDiff.Entry.capability_info:type_name -> capslock.proto.CapabilityInfo
+	30, // [30:30] is the sub-list for method output_type
+	30, // [30:30] is the sub-list for method input_type
+	30, // [30:30] is the sub-list for extension type_name
+	30, // [30:30] is the sub-list for extension extendee
+	0,  // [0:30] is the sub-list for field type_name
 }
 
 func init() { file_capability_proto_init() }
@@ -893,8 +1930,8 @@ func file_capability_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_capability_proto_rawDesc), len(file_capability_proto_rawDesc)),
-			NumEnums:      2,
-			NumMessages:   10,
+			NumEnums:      3,
+			NumMessages:   20,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -117,6 +117,8 @@ func TestExpectedOutput(t *testing.T) {
 		{Fn: []string{"callos.Bar", "os/exec"}},
 		{Fn: []string{"callos.Baz", "os/user.Current"}},
 		{Fn: []string{"callruntime.Interesting", "runtime.CPUProfile"}},
+		{Fn: []string{"getenv.Bar", "os.Setenv"}, Cap: "CAPABILITY_MODIFY_ENVIRONMENT"},
+		{Fn: []string{"getenv.Foo", "os.Getenv"}, Cap: "CAPABILITY_READ_ENVIRONMENT"},
 		{Fn: []string{"importname.CallTheWrongSort", "os.ReadFile"}},
 		{Fn: []string{`indirectcalls.AccessMethodViaTypeAssertion`, `\(\*os.File\).Chown`}},
 		{Fn: []string{"indirectcalls.CallOs", "os.Getuid"}},
@@ -169,6 +171,8 @@ func TestExpectedOutput(t *testing.T) {
 		{Fn: []string{"usecgo.CallGoString", ""}},
 		{Fn: []string{"usecgo.CallGoStringN", ""}},
 		{Fn: []string{"usecgo.Foo", "usecgo._cgo_runtime_cgocall"}},
+		{Fn: []string{"usecgo._Cgo_keepalive"}, Cap: "CAPABILITY_CGO"},
+		{Fn: []string{"usecgo.runtime_throw"}, Cap: "CAPABILITY_CGO"},
 		{Fn: []string{"usecgo._Cfunc_acfunction", "usecgo._cgo_runtime_cgocall"}},
 		{Fn: []string{`usegenerics.Bar`, `usegenerics.Foo\[.*/usegenerics.a\]`, `\(.*/usegenerics.a\).Baz`, `net.Interfaces`}},
 		{Fn: []string{`usegenerics.Bar`, `usegenerics.Foo\[.*/usegenerics.a\]`, `os.Rename`}},
@@ -192,6 +196,82 @@ func TestExpectedOutput(t *testing.T) {
 		{Fn: []string{`usereflect.RangeValueTwo\$1`}, Cap: `CAPABILITY_REFLECT`},
 		{Fn: []string{`usereflect.RangeValueTwo\$2`}, Cap: `CAPABILITY_REFLECT`},
 		{Fn: []string{`usereflect.RangeValueTwo`, `usereflect.RangeValueTwo\$[12]`}},
+		{Fn: []string{"usereflect.CallMethodByName", `\(reflect.Value\).(Call|MethodByName)$`}, Cap: "CAPABILITY_REFLECT_INVOKE"},
+		{Fn: []string{"usereflect.CallSlice", `\(reflect.Value\).CallSlice`}, Cap: "CAPABILITY_REFLECT_INVOKE"},
+		{Fn: []string{"usereflect.MakeFunc", "reflect.MakeFunc"}, Cap: "CAPABILITY_REFLECT_INVOKE"},
+		{Fn: []string{"usefiles.OpenForAppend", "os.OpenFile"}, Cap: "CAPABILITY_FILES_WRITE"},
+		{Fn: []string{"usefiles.OpenReadOnly", "os.OpenFile"}, Cap: "CAPABILITY_FILES_READ"},
+		{Fn: []string{"usefiles.OpenWithFlag", "os.OpenFile"}, Cap: "CAPABILITY_FILES_READ"},
+		{Fn: []string{"usefiles.OpenWithFlag", "os.OpenFile"}, Cap: "CAPABILITY_FILES_WRITE"},
+		{Fn: []string{"usefiles.Read", "os.ReadFile"}, Cap: "CAPABILITY_FILES_READ"},
+		{Fn: []string{"usefiles.Write", "os.WriteFile"}, Cap: "CAPABILITY_FILES_WRITE"},
+		{Fn: []string{"usefsmetadata.Chdir", "os.Chdir"}, Cap: "CAPABILITY_FS_METADATA"},
+		{Fn: []string{"usefsmetadata.Chmod", "os.Chmod"}, Cap: "CAPABILITY_FS_METADATA"},
+		{Fn: []string{"usefsmetadata.Chown", "os.Chown"}, Cap: "CAPABILITY_FS_METADATA"},
+		{Fn: []string{"usefsmetadata.Chtimes", "os.Chtimes"}, Cap: "CAPABILITY_FS_METADATA"},
+		{Fn: []string{"usefsmetadata.FileChdir", `\(\*os.File\).Chdir`}, Cap: "CAPABILITY_FS_METADATA"},
+		{Fn: []string{"usefsmetadata.FileChmod", `\(\*os.File\).Chmod`}, Cap: "CAPABILITY_FS_METADATA"},
+		{Fn: []string{"usefsmetadata.FileChown", `\(\*os.File\).Chown`}, Cap: "CAPABILITY_FS_METADATA"},
+		{Fn: []string{"usefsmetadata.Lchown", "os.Lchown"}, Cap: "CAPABILITY_FS_METADATA"},
+		{Fn: []string{"usefsmetadata.MkdirTemp", "os.MkdirTemp"}, Cap: "CAPABILITY_FS_METADATA"},
+		{Fn: []string{"usefsmetadata.TempDir", "os.TempDir"}, Cap: "CAPABILITY_READ_SYSTEM_STATE"},
+		{Fn: []string{"useexec.ForkExec", "syscall.ForkExec"}, Cap: "CAPABILITY_EXEC"},
+		{Fn: []string{"useexec.RunCommandContext", "os/exec.CommandContext"}, Cap: "CAPABILITY_EXEC"},
+		{Fn: []string{"usetests.Pid", "os.Getpid"}},
+		{Fn: []string{"useclock.Elapsed", "useclock.now", "time.Now"}, Cap: "CAPABILITY_CLOCK"},
+		{Fn: []string{"useclock.Wait", "time.Sleep"}, Cap: "CAPABILITY_CLOCK"},
+		{Fn: []string{"userand.MathRand", "math/rand.Intn"}, Cap: "CAPABILITY_RANDOM"},
+		{Fn: []string{"userand.MathRandV2", "math/rand/v2.IntN"}, Cap: "CAPABILITY_RANDOM"},
+		{Fn: []string{"userand.CryptoRead", "crypto/rand.Read"}, Cap: "CAPABILITY_CRYPTO_RAND"},
+		{Fn: []string{"userand.CryptoReader", `\(\*crypto/rand.reader\).Read`}, Cap: "CAPABILITY_CRYPTO_RAND"},
+		{Fn: []string{"usegoroutine.Direct$"}, Cap: "CAPABILITY_GOROUTINE"},
+		{Fn: []string{"usegoroutine.Transitive", "usegoroutine.Direct$"}, Cap: "CAPABILITY_GOROUTINE"},
+		{Fn: []string{"useexit.Exit", "os.Exit"}, Cap: "CAPABILITY_PROCESS_EXIT"},
+		{Fn: []string{"useexit.Fatal", "log.Fatalf"}, Cap: "CAPABILITY_PROCESS_EXIT"},
+		{Fn: []string{"useexit.LoggerFatal", `\(\*log.Logger\).Fatal$`}, Cap: "CAPABILITY_PROCESS_EXIT"},
+		{Fn: []string{"useexit.Goexit", "runtime.Goexit"}, Cap: "CAPABILITY_PROCESS_EXIT"},
+		{Fn: []string{"usenetwork.Dial$", "net.Dial$"}, Cap: "CAPABILITY_NETWORK_DIAL"},
+		{Fn: []string{"usenetwork.DialContext", `\(\*net.Dialer\).DialContext`}, Cap: "CAPABILITY_NETWORK_DIAL"},
+		{Fn: []string{"usenetwork.Get", "net/http.Get"}, Cap: "CAPABILITY_NETWORK_DIAL"},
+		{Fn: []string{"usenetwork.Listen$", "net.Listen$"}, Cap: "CAPABILITY_NETWORK_LISTEN"},
+		{Fn: []string{"usenetwork.ListenAndServe", "net/http.ListenAndServe$"}, Cap: "CAPABILITY_NETWORK_LISTEN"},
+		{Fn: []string{"usenetwork.LookupHost", "net.LookupHost"}, Cap: "CAPABILITY_NETWORK_DNS"},
+		{Fn: []string{"usenetwork.ResolverLookupHost", `\(\*net.Resolver\).LookupHost`}, Cap: "CAPABILITY_NETWORK_DNS"},
+		{Fn: []string{"useplugin.Load", "useplugin.open", "plugin.Open"}, Cap: "CAPABILITY_PLUGIN"},
+		{Fn: []string{"useplugin.Lookup", `\(\*plugin.Plugin\).Lookup`}, Cap: "CAPABILITY_PLUGIN"},
+		{Fn: []string{"userawsyscall.Getpid", "syscall.Syscall$"}, Cap: "CAPABILITY_RAW_SYSCALL"},
+		{Fn: []string{"userawsyscall.Getppid", "userawsyscall.rawSyscall", "syscall.RawSyscall$"}, Cap: "CAPABILITY_RAW_SYSCALL"},
+		{Fn: []string{"userawsyscall.Mmap", "syscall.Mmap"}, Cap: "CAPABILITY_RAW_SYSCALL"},
+		{Fn: []string{"useruntime.NewResource", "useruntime.setCleanup", "runtime.SetFinalizer"}, Cap: "CAPABILITY_RUNTIME"},
+		{Fn: []string{"useruntime.CollectGarbage", "runtime.GC"}, Cap: "CAPABILITY_RUNTIME"},
+		{Fn: []string{"useruntime.SetProcs", "runtime.GOMAXPROCS"}, Cap: "CAPABILITY_RUNTIME"},
+		{Fn: []string{"useruntime.SetGCPercent", "runtime/debug.SetGCPercent"}, Cap: "CAPABILITY_RUNTIME"},
+		{Fn: []string{"usesignal.init", "os/signal.Notify$"}, Cap: "CAPABILITY_SIGNAL"},
+		{Fn: []string{"usesignal.Ignore", "os/signal.Ignore$"}, Cap: "CAPABILITY_SIGNAL"},
+		{Fn: []string{"usesignal.Reset", "os/signal.Reset"}, Cap: "CAPABILITY_SIGNAL"},
+		{Fn: []string{"usesignal.WithInterrupt", "os/signal.NotifyContext"}, Cap: "CAPABILITY_SIGNAL"},
+		{Fn: []string{"usesystemfiles.OpenDevice", "os.OpenFile"}, Cap: "CAPABILITY_SYSTEM_FILES"},
+		{Fn: []string{"usesystemfiles.ReadMaps", "os.ReadFile"}, Cap: "CAPABILITY_SYSTEM_FILES"},
+		{Fn: []string{"usesystemfiles.StatSys", "os.Stat"}, Cap: "CAPABILITY_SYSTEM_FILES"},
+		{Fn: []string{"usesystemfiles.ReadOther", "os.ReadFile"}, Cap: "CAPABILITY_FILES_READ"},
+		{Fn: []string{"usesystemfiles.ReadPath", "os.ReadFile"}, Cap: "CAPABILITY_FILES_READ"},
+		{Fn: []string{"usecertstore.SystemPool", "crypto/x509.SystemCertPool"}, Cap: "CAPABILITY_CERT_STORE"},
+		{Fn: []string{"usecertstore.AddPEM", `\(\*crypto/x509.CertPool\).AppendCertsFromPEM$`}, Cap: "CAPABILITY_CERT_STORE"},
+		{Fn: []string{"usecertstore.ReadBundle", "os.ReadFile"}, Cap: "CAPABILITY_CERT_STORE"},
+		{Fn: []string{"usedeserialize.DecodeGob", "encoding/gob.NewDecoder"}, Cap: "CAPABILITY_DESERIALIZE"},
+		{Fn: []string{"usedeserialize.DecodeAny", "encoding/json.Unmarshal"}, Cap: "CAPABILITY_DESERIALIZE"},
+		{Fn: []string{"usedeserialize.DecodePoint", "encoding/json.Unmarshal"}, Cap: "CAPABILITY_REFLECT"},
+		{Fn: []string{"usehostconfig.ReadResolvConf", "os.ReadFile"}, Cap: "CAPABILITY_HOST_CONFIG"},
+		{Fn: []string{"usehostconfig.OpenHosts", "os.Open"}, Cap: "CAPABILITY_HOST_CONFIG"},
+		{Fn: []string{"usehostconfig.ReadFile", "os.ReadFile"}, Cap: "CAPABILITY_FILES_READ"},
+		{Fn: []string{"usegotoolchain.Build", "os/exec.Command"}, Cap: "CAPABILITY_GO_TOOLCHAIN"},
+		{Fn: []string{"usegotoolchain.Generate", "os/exec.CommandContext"}, Cap: "CAPABILITY_GO_TOOLCHAIN"},
+		{Fn: []string{"usegotoolchain.Run", "os/exec.Command"}, Cap: "CAPABILITY_EXEC"},
+		{Fn: []string{"useembed.ReadHello", `\(embed.FS\).ReadFile$`}, Cap: "CAPABILITY_EMBED"},
+		{Fn: []string{"useterminal.Raw", "golang.org/x/term.MakeRaw"}, Cap: "CAPABILITY_TERMINAL"},
+		{Fn: []string{"useterminal.Password", "golang.org/x/term.ReadPassword"}, Cap: "CAPABILITY_TERMINAL"},
+		{Fn: []string{"useterminal.RestoreState", "golang.org/x/term.Restore"}, Cap: "CAPABILITY_TERMINAL"},
+		{Fn: []string{"useterminal.IsTerminal", "golang.org/x/term.IsTerminal"}, Cap: "CAPABILITY_READ_SYSTEM_STATE"},
 		{Fn: []string{"useunsafe.Bar"}, Cap: "CAPABILITY_UNSAFE_POINTER"},
 		{Fn: []string{"useunsafe.Baz"}, Cap: "CAPABILITY_UNSAFE_POINTER"},
 		{Fn: []string{`useunsafe.CallNestedFunctions`, `useunsafe.NestedFunctions\$1\$1\$1`}},
@@ -221,6 +301,46 @@ func TestExpectedOutput(t *testing.T) {
 		{Fn: []string{"useunsafe.Ok"}, Cap: "CAPABILITY_UNSAFE_POINTER"},
 		{Fn: []string{"useunsafe.ReturnFunction$"}, Cap: "CAPABILITY_UNSAFE_POINTER"},
 		{Fn: []string{"usegenerics.AtomicPointer"}},
+		{Fn: []string{`usecgo\..*`}, Cap: "CAPABILITY_ARBITRARY_EXECUTION"},
+		{Fn: []string{"usefiles.OpenForAppend", "os.OpenFile"}, Cap: "CAPABILITY_FILES_READ"},
+		{Fn: []string{"usefiles.OpenReadOnly", "os.OpenFile"}, Cap: "CAPABILITY_FILES_WRITE"},
+		{Fn: []string{"usefiles.OpenWithFlag", "os.OpenFile"}, Cap: "CAPABILITY_FILES"},
+		{Fn: []string{"useexec.ForkExec"}, Cap: "CAPABILITY_SYSTEM_CALLS"},
+		{Fn: []string{"useexec.ForkExec"}, Cap: "CAPABILITY_ARBITRARY_EXECUTION"},
+		{Fn: []string{"usetests.lookup"}}, // test files are not loaded by default
+		{Fn: []string{"useclock.Hour"}},
+		{Fn: []string{"userand.SeededRand"}, Cap: "CAPABILITY_RANDOM"},
+		{Fn: []string{"userand.MathRand"}, Cap: "CAPABILITY_CRYPTO_RAND"},
+		{Fn: []string{"userand.CryptoRead"}, Cap: "CAPABILITY_RANDOM"},
+		{Fn: []string{"usereflect.CopyValueGlobal"}, Cap: "CAPABILITY_REFLECT_INVOKE"},
+		{Fn: []string{"usegoroutine.Synchronous"}, Cap: "CAPABILITY_GOROUTINE"},
+		{Fn: []string{"useexit.Panic"}},
+		{Fn: []string{"usenetwork.Dial$"}, Cap: "CAPABILITY_NETWORK"},
+		{Fn: []string{"usenetwork.Listen$"}, Cap: "CAPABILITY_NETWORK"},
+		{Fn: []string{"usenetwork.LookupHost"}, Cap: "CAPABILITY_NETWORK"},
+		{Fn: []string{"usenetwork.SplitHostPort"}},
+		{Fn: []string{"useplugin.Load"}, Cap: "CAPABILITY_EXEC"},
+		{Fn: []string{"userawsyscall.Getpid"}, Cap: "CAPABILITY_SYSTEM_CALLS"},
+		{Fn: []string{"useruntime.NumCPU"}, Cap: "CAPABILITY_RUNTIME"},
+		{Fn: []string{"usesignal.init"}, Cap: "CAPABILITY_MODIFY_SYSTEM_STATE"},
+		{Fn: []string{"usesystemfiles.OpenDevice"}, Cap: "CAPABILITY_FILES_READ"},
+		{Fn: []string{"usesystemfiles.ReadMaps"}, Cap: "CAPABILITY_FILES_READ"},
+		{Fn: []string{"usesystemfiles.ReadOther"}, Cap: "CAPABILITY_SYSTEM_FILES"},
+		{Fn: []string{"usesystemfiles.ReadPath"}, Cap: "CAPABILITY_SYSTEM_FILES"},
+		{Fn: []string{"usecertstore.NewPool"}, Cap: "CAPABILITY_CERT_STORE"},
+		{Fn: []string{"usecertstore.ReadBundle"}, Cap: "CAPABILITY_FILES_READ"},
+		{Fn: []string{"usecertstore.SystemPool"}, Cap: "CAPABILITY_FILES_READ"},
+		{Fn: []string{"usedeserialize.DecodePoint"}, Cap: "CAPABILITY_DESERIALIZE"},
+		{Fn: []string{"usehostconfig.ReadResolvConf"}, Cap: "CAPABILITY_FILES_READ"},
+		{Fn: []string{"usehostconfig.ReadFile"}, Cap: "CAPABILITY_HOST_CONFIG"},
+		{Fn: []string{"usegotoolchain.Run"}, Cap: "CAPABILITY_GO_TOOLCHAIN"},
+		{Fn: []string{"useembed.Hello"}, Cap: "CAPABILITY_EMBED"},
+		{Fn: []string{"useterminal.Raw"}, Cap: "CAPABILITY_RAW_SYSCALL"},
+		{Fn: []string{"useterminal.IsTerminal"}, Cap: "CAPABILITY_TERMINAL"},
+		{Fn: []string{"usefsmetadata.Chdir"}, Cap: "CAPABILITY_MODIFY_SYSTEM_STATE"},
+		{Fn: []string{"usefsmetadata.Chmod"}, Cap: "CAPABILITY_FILES_WRITE"},
+		{Fn: []string{"usefsmetadata.MkdirTemp"}, Cap: "CAPABILITY_FILES_WRITE"},
+		{Fn: []string{"usefsmetadata.TempDir"}, Cap: "CAPABILITY_FS_METADATA"},
 
 		// Currently we don't include functions called by these functions.
 		{Fn: []string{"^sort.Sort", ".*"}}, // need ^ to avoid matching notsort.go
@@ -273,6 +393,48 @@ func TestExpectedOutput(t *testing.T) {
 	}
 }
 
+func TestIncludeTests(t *testing.T) {
+	cmd := exec.Command(bin, "-packages=../testpkgs/usetests", "-output=json", "-include_tests")
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("running capslock: %v", err)
+	}
+	cil := new(cpb.CapabilityInfoList)
+	if err := protojson.Unmarshal(output.Bytes(), cil); err != nil {
+		t.Fatalf("Couldn't parse analyzer output: %v", err)
+	}
+	// The functions with capabilities, and whether they are in test files.
+	want := map[string]bool{
+		"usetests.Pid":        false,
+		"usetests.TestLookup": true,
+		"usetests.lookup":     true,
+	}
+	got := make(map[string]bool)
+	for _, ci := range cil.GetCapabilityInfo() {
+		name := ci.GetPath()[0].GetName()
+		name = name[strings.LastIndex(name, "/")+1:]
+		if fromTest, ok := got[name]; ok && fromTest != ci.GetFromTest() {
+			t.Errorf("TestIncludeTests: got inconsistent fromTest values for %s", name)
+		}
+		got[name] = ci.GetFromTest()
+	}
+	for name, fromTest := range want {
+		if g, ok := got[name]; !ok {
+			t.Errorf("TestIncludeTests: no capabilities reported for %s", name)
+		} else if g != fromTest {
+			t.Errorf("TestIncludeTests: got fromTest %v for %s, want %v", g, name, fromTest)
+		}
+	}
+	if len(cil.GetPackageInfo()) != 1 {
+		t.Errorf("TestIncludeTests: got %d packages, want 1", len(cil.GetPackageInfo()))
+	}
+	if t.Failed() {
+		t.Log(output.String())
+	}
+}
+
 func TestGraph(t *testing.T) {
 	for _, test := range []struct {
 		args      []string
@@ -282,6 +444,18 @@ func TestGraph(t *testing.T) {
 			[]string{"-packages=../testpkgs/useunsafe", "-output=graph"},
 			map[string]int{
 				`digraph {`: 0,
+				`"CAPABILITY_UNSAFE_POINTER" [shape=box, color=red, fontcolor=red]`:                                                                            0,
+				`"(github.com/google/capslock/testpkgs/useunsafe.T).M" [style=filled, fillcolor=lightblue]`:                                                    0,
+				`"github.com/google/capslock/testpkgs/useunsafe.Bar" [style=filled, fillcolor=lightblue]`:                                                      0,
+				`"github.com/google/capslock/testpkgs/useunsafe.Baz" [style=filled, fillcolor=lightblue]`:                                                      0,
+				`"github.com/google/capslock/testpkgs/useunsafe.CallNestedFunctions" [style=filled, fillcolor=lightblue]`:                                      0,
+				`"github.com/google/capslock/testpkgs/useunsafe.Foo" [style=filled, fillcolor=lightblue]`:                                                      0,
+				`"github.com/google/capslock/testpkgs/useunsafe.Indirect" [style=filled, fillcolor=lightblue]`:                                                 0,
+				`"github.com/google/capslock/testpkgs/useunsafe.Indirect2" [style=filled, fillcolor=lightblue]`:                                                0,
+				`"github.com/google/capslock/testpkgs/useunsafe.NestedFunctions$1$1$1" [style=filled, fillcolor=lightblue]`:                                    0,
+				`"github.com/google/capslock/testpkgs/useunsafe.ReturnFunction$1" [style=filled, fillcolor=lightblue]`:                                         0,
+				`"github.com/google/capslock/testpkgs/useunsafe.init" [style=filled, fillcolor=lightblue]`:                                                     0,
+				`"github.com/google/capslock/testpkgs/useunsafe.init$1" [style=filled, fillcolor=lightblue]`:                                                   0,
 				`"github.com/google/capslock/testpkgs/useunsafe.Bar" -> "CAPABILITY_UNSAFE_POINTER"`:                                                           0,
 				`"github.com/google/capslock/testpkgs/useunsafe.Baz" -> "CAPABILITY_UNSAFE_POINTER"`:                                                           0,
 				`"github.com/google/capslock/testpkgs/useunsafe.CallNestedFunctions" -> "github.com/google/capslock/testpkgs/useunsafe.NestedFunctions$1$1$1"`: 0,
@@ -300,10 +474,13 @@ func TestGraph(t *testing.T) {
 			[]string{"-packages=../testpkgs/callos", "-output=graph", "-capabilities=READ_SYSTEM_STATE,NETWORK"},
 			map[string]int{
 				`digraph {`: 0,
-				`"github.com/google/capslock/testpkgs/callos.Baz" -> "os/user.Current"`: 0,
-				`"github.com/google/capslock/testpkgs/callos.Foo" -> "os.Getpid"`:       0,
-				`"os/user.Current" -> "CAPABILITY_READ_SYSTEM_STATE"`:                   0,
-				`"os.Getpid" -> "CAPABILITY_READ_SYSTEM_STATE"`:                         0,
+				`"CAPABILITY_READ_SYSTEM_STATE" [shape=box, color=red, fontcolor=red]`:                 0,
+				`"github.com/google/capslock/testpkgs/callos.Baz" [style=filled, fillcolor=lightblue]`: 0,
+				`"github.com/google/capslock/testpkgs/callos.Foo" [style=filled, fillcolor=lightblue]`: 0,
+				`"github.com/google/capslock/testpkgs/callos.Baz" -> "os/user.Current"`:                0,
+				`"github.com/google/capslock/testpkgs/callos.Foo" -> "os.Getpid"`:                      0,
+				`"os/user.Current" -> "CAPABILITY_READ_SYSTEM_STATE"`:                                  0,
+				`"os.Getpid" -> "CAPABILITY_READ_SYSTEM_STATE"`:                                        0,
 				`}`: 0,
 			},
 		},
@@ -311,10 +488,12 @@ func TestGraph(t *testing.T) {
 			[]string{"-packages=../testpkgs/callos", "-output=graph", "-capabilities=-FILES,-READ_SYSTEM_STATE"},
 			map[string]int{
 				`digraph {`: 0,
-				`"github.com/google/capslock/testpkgs/callos.Bar" -> "os/exec.Command"`:    0,
-				`"github.com/google/capslock/testpkgs/callos.Bar" -> "(*os/exec.Cmd).Run"`: 0,
-				`"os/exec.Command" -> "CAPABILITY_EXEC"`:                                   0,
-				`"(*os/exec.Cmd).Run" -> "CAPABILITY_EXEC"`:                                0,
+				`"CAPABILITY_EXEC" [shape=box, color=red, fontcolor=red]`:                              0,
+				`"github.com/google/capslock/testpkgs/callos.Bar" [style=filled, fillcolor=lightblue]`: 0,
+				`"github.com/google/capslock/testpkgs/callos.Bar" -> "os/exec.Command"`:                0,
+				`"github.com/google/capslock/testpkgs/callos.Bar" -> "(*os/exec.Cmd).Run"`:             0,
+				`"os/exec.Command" -> "CAPABILITY_EXEC"`:                                               0,
+				`"(*os/exec.Cmd).Run" -> "CAPABILITY_EXEC"`:                                            0,
 				`}`: 0,
 			},
 		},
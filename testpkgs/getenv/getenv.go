@@ -8,3 +8,7 @@ import (
 func Foo() {
 	_ = os.Getenv("FOO")
 }
+
+func Bar() {
+	_ = os.Setenv("FOO", "bar")
+}
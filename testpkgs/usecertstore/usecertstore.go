@@ -0,0 +1,29 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package usecertstore is used for testing.
+package usecertstore
+
+import (
+	"crypto/x509"
+	"os"
+)
+
+func SystemPool() (*x509.CertPool, error) {
+	return x509.SystemCertPool()
+}
+
+func AddPEM(pool *x509.CertPool, pem []byte) bool {
+	return pool.AppendCertsFromPEM(pem)
+}
+
+func ReadBundle() ([]byte, error) {
+	return os.ReadFile("/etc/ssl/certs/ca-certificates.crt")
+}
+
+func NewPool() *x509.CertPool {
+	return x509.NewCertPool()
+}
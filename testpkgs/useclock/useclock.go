@@ -0,0 +1,30 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package useclock is used for testing.
+package useclock
+
+import "time"
+
+// Elapsed is a test function which reads the clock through a helper.
+func Elapsed(start time.Time) time.Duration {
+	return now().Sub(start)
+}
+
+func now() time.Time {
+	return time.Now()
+}
+
+// Wait is a test function which calls time.Sleep.
+func Wait() {
+	time.Sleep(time.Millisecond)
+}
+
+// Hour is a test function which only uses the time it is given.
+func Hour(t time.Time) int {
+	h, _, _ := t.Clock()
+	return h
+}
@@ -0,0 +1,39 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package usedeserialize is used for testing.
+package usedeserialize
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"io"
+)
+
+// DecodeGob decodes a gob-encoded value from r.
+func DecodeGob(r io.Reader) (any, error) {
+	var v any
+	err := gob.NewDecoder(r).Decode(&v)
+	return v, err
+}
+
+// DecodeAny decodes JSON data into a value of any shape.
+func DecodeAny(data []byte) (any, error) {
+	var v any
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+type point struct {
+	X, Y int
+}
+
+// DecodePoint decodes JSON data into a struct.
+func DecodePoint(data []byte) (int, error) {
+	var p point
+	err := json.Unmarshal(data, &p)
+	return p.X + p.Y, err
+}
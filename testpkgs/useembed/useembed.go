@@ -0,0 +1,27 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package useembed is used for testing.
+package useembed
+
+import "embed"
+
+//go:embed hello.txt
+var files embed.FS
+
+//go:embed hello.txt
+var hello string
+
+// ReadHello reads an embedded file.
+func ReadHello() ([]byte, error) {
+	return files.ReadFile("hello.txt")
+}
+
+// Hello returns the contents of an embedded file without calling any
+// functions.
+func Hello() string {
+	return hello
+}
@@ -0,0 +1,16 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build unix
+
+package useexec
+
+import "syscall"
+
+// ForkExec is a test function which starts a program using syscall.ForkExec.
+func ForkExec() (int, error) {
+	return syscall.ForkExec("/bin/true", []string{"true"}, nil)
+}
@@ -0,0 +1,19 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package useexec is used for testing.
+package useexec
+
+import (
+	"context"
+	"os/exec"
+)
+
+// RunCommandContext is a test function which runs a program using
+// exec.CommandContext.
+func RunCommandContext(ctx context.Context) error {
+	return exec.CommandContext(ctx, "true").Run()
+}
@@ -0,0 +1,39 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package useexit is used for testing.
+package useexit
+
+import (
+	"log"
+	"os"
+	"runtime"
+)
+
+// Exit is a test function which calls os.Exit.
+func Exit() {
+	os.Exit(1)
+}
+
+// Fatal is a test function which calls log.Fatalf.
+func Fatal(err error) {
+	log.Fatalf("failed: %v", err)
+}
+
+// LoggerFatal is a test function which calls (*log.Logger).Fatal.
+func LoggerFatal(l *log.Logger, err error) {
+	l.Fatal(err)
+}
+
+// Goexit is a test function which calls runtime.Goexit.
+func Goexit() {
+	runtime.Goexit()
+}
+
+// Panic is a test function which panics, which can be recovered from.
+func Panic() {
+	panic("recoverable")
+}
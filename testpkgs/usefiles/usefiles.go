@@ -0,0 +1,51 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package usefiles is used for testing.
+package usefiles
+
+import "os"
+
+// Read is a test function which calls os.ReadFile.
+func Read() int {
+	b, _ := os.ReadFile("a")
+	return len(b)
+}
+
+// Write is a test function which calls os.WriteFile.
+func Write() error {
+	return os.WriteFile("a", nil, 0o644)
+}
+
+// OpenReadOnly is a test function which calls os.OpenFile with a constant
+// flag that does not request write access.
+func OpenReadOnly() error {
+	f, err := os.OpenFile("a", os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// OpenForAppend is a test function which calls os.OpenFile with a constant
+// flag that requests write access.
+func OpenForAppend() error {
+	f, err := os.OpenFile("a", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// OpenWithFlag is a test function which calls os.OpenFile with a flag that
+// is not known statically.
+func OpenWithFlag(flag int) error {
+	f, err := os.OpenFile("a", flag, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,53 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package usefsmetadata is used for testing.
+package usefsmetadata
+
+import (
+	"os"
+	"time"
+)
+
+func Chdir(dir string) error {
+	return os.Chdir(dir)
+}
+
+func Chmod(name string) error {
+	return os.Chmod(name, 0o600)
+}
+
+func Chown(name string) error {
+	return os.Chown(name, 0, 0)
+}
+
+func Chtimes(name string) error {
+	return os.Chtimes(name, time.Time{}, time.Time{})
+}
+
+func FileChdir(f *os.File) error {
+	return f.Chdir()
+}
+
+func FileChmod(f *os.File) error {
+	return f.Chmod(0o600)
+}
+
+func FileChown(f *os.File) error {
+	return f.Chown(0, 0)
+}
+
+func Lchown(name string) error {
+	return os.Lchown(name, 0, 0)
+}
+
+func MkdirTemp() (string, error) {
+	return os.MkdirTemp("", "usefsmetadata")
+}
+
+func TempDir() string {
+	return os.TempDir()
+}
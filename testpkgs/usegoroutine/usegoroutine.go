@@ -0,0 +1,28 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package usegoroutine is used for testing.
+package usegoroutine
+
+// Direct is a test function which starts a goroutine.
+func Direct(ch chan<- int) {
+	go send(ch)
+}
+
+// Transitive is a test function which starts a goroutine through a helper.
+func Transitive(ch chan<- int) {
+	Direct(ch)
+}
+
+// Synchronous is a test function which calls a function without starting a
+// goroutine.
+func Synchronous(ch chan<- int) {
+	send(ch)
+}
+
+func send(ch chan<- int) {
+	ch <- 1
+}
@@ -0,0 +1,25 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package usegotoolchain is used for testing.
+package usegotoolchain
+
+import (
+	"context"
+	"os/exec"
+)
+
+func Build() error {
+	return exec.Command("go", "build", "./...").Run()
+}
+
+func Generate(ctx context.Context) error {
+	return exec.CommandContext(ctx, "/usr/local/go/bin/go", "generate").Run()
+}
+
+func Run(program string) error {
+	return exec.Command(program).Run()
+}
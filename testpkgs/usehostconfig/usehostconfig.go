@@ -0,0 +1,22 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package usehostconfig is used for testing.
+package usehostconfig
+
+import "os"
+
+func ReadResolvConf() ([]byte, error) {
+	return os.ReadFile("/etc/resolv.conf")
+}
+
+func OpenHosts() (*os.File, error) {
+	return os.Open("/etc/hosts")
+}
+
+func ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
@@ -0,0 +1,57 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package usenetwork is used for testing.
+package usenetwork
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// Dial is a test function which calls net.Dial.
+func Dial() (net.Conn, error) {
+	return net.Dial("tcp", "example.com:80")
+}
+
+// DialContext is a test function which calls (*net.Dialer).DialContext.
+func DialContext(ctx context.Context) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", "example.com:80")
+}
+
+// Get is a test function which calls http.Get.
+func Get() (*http.Response, error) {
+	return http.Get("https://example.com/")
+}
+
+// Listen is a test function which calls net.Listen.
+func Listen() (net.Listener, error) {
+	return net.Listen("tcp", ":8080")
+}
+
+// ListenAndServe is a test function which calls http.ListenAndServe.
+func ListenAndServe() error {
+	return http.ListenAndServe(":8080", nil)
+}
+
+// LookupHost is a test function which calls net.LookupHost.
+func LookupHost() ([]string, error) {
+	return net.LookupHost("example.com")
+}
+
+// ResolverLookupHost is a test function which calls
+// (*net.Resolver).LookupHost.
+func ResolverLookupHost(ctx context.Context) ([]string, error) {
+	return net.DefaultResolver.LookupHost(ctx, "example.com")
+}
+
+// SplitHostPort is a test function which calls net.SplitHostPort, which
+// does not use the network.
+func SplitHostPort() (string, string, error) {
+	return net.SplitHostPort("example.com:80")
+}
@@ -0,0 +1,24 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package useplugin is used for testing.
+package useplugin
+
+import "plugin"
+
+// Load is a test function which calls plugin.Open through a helper.
+func Load(path string) (*plugin.Plugin, error) {
+	return open(path)
+}
+
+func open(path string) (*plugin.Plugin, error) {
+	return plugin.Open(path)
+}
+
+// Lookup is a test function which calls (*plugin.Plugin).Lookup.
+func Lookup(p *plugin.Plugin) (plugin.Symbol, error) {
+	return p.Lookup("F")
+}
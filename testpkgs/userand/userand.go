@@ -0,0 +1,44 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package userand is used for testing.
+package userand
+
+import (
+	crand "crypto/rand"
+	"math/rand"
+	randv2 "math/rand/v2"
+)
+
+// MathRand is a test function which calls math/rand.Intn.
+func MathRand() int {
+	return rand.Intn(10)
+}
+
+// MathRandV2 is a test function which calls math/rand/v2.IntN.
+func MathRandV2() int {
+	return randv2.IntN(10)
+}
+
+// SeededRand is a test function which uses a math/rand generator with a
+// fixed seed, which is deterministic.
+func SeededRand() int {
+	return rand.New(rand.NewSource(1)).Intn(10)
+}
+
+// CryptoRead is a test function which calls crypto/rand.Read.
+func CryptoRead() []byte {
+	b := make([]byte, 16)
+	crand.Read(b)
+	return b
+}
+
+// CryptoReader is a test function which reads from crypto/rand.Reader.
+func CryptoReader() []byte {
+	b := make([]byte, 16)
+	crand.Reader.Read(b)
+	return b
+}
@@ -0,0 +1,33 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build linux
+
+// Package userawsyscall is used for testing.
+package userawsyscall
+
+import "syscall"
+
+// Getpid is a test function which makes a system call using syscall.Syscall.
+func Getpid() uintptr {
+	pid, _, _ := syscall.Syscall(syscall.SYS_GETPID, 0, 0, 0)
+	return pid
+}
+
+// Getppid is a test function which makes a system call through a helper.
+func Getppid() uintptr {
+	return rawSyscall(syscall.SYS_GETPPID)
+}
+
+func rawSyscall(trap uintptr) uintptr {
+	r, _, _ := syscall.RawSyscall(trap, 0, 0, 0)
+	return r
+}
+
+// Mmap is a test function which maps memory using syscall.Mmap.
+func Mmap() ([]byte, error) {
+	return syscall.Mmap(-1, 0, 4096, syscall.PROT_READ, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+}
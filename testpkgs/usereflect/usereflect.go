@@ -70,6 +70,23 @@ func MakeFunc() int {
 	return f1()
 }
 
+type t3 int
+
+func (t t3) Foo() int { return int(t) }
+
+// CallMethodByName calls a method of t3 found by name.
+func CallMethodByName() int {
+	v := reflect.ValueOf(t3(1)).MethodByName("Foo")
+	return int(v.Call(nil)[0].Int())
+}
+
+// CallSlice calls a variadic function using (reflect.Value).CallSlice.
+func CallSlice() int {
+	f := func(xs ...int) int { return len(xs) }
+	args := reflect.ValueOf([]int{1, 2, 3})
+	return int(reflect.ValueOf(f).CallSlice([]reflect.Value{args})[0].Int())
+}
+
 // TypeConfusionWithNewAt modifies a func pointer using reflect.NewAt and
 // (reflect.Value).Set.
 func TypeConfusionWithNewAt() int {
@@ -0,0 +1,43 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package useruntime is used for testing.
+package useruntime
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+type resource struct {
+	closed bool
+}
+
+func setCleanup(r *resource) {
+	runtime.SetFinalizer(r, func(r *resource) { r.closed = true })
+}
+
+func NewResource() *resource {
+	r := new(resource)
+	setCleanup(r)
+	return r
+}
+
+func CollectGarbage() {
+	runtime.GC()
+}
+
+func SetProcs(n int) int {
+	return runtime.GOMAXPROCS(n)
+}
+
+func SetGCPercent(p int) int {
+	return debug.SetGCPercent(p)
+}
+
+func NumCPU() int {
+	return runtime.NumCPU()
+}
@@ -0,0 +1,32 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package usesignal is used for testing.
+package usesignal
+
+import (
+	"context"
+	"os"
+	"os/signal"
+)
+
+var interrupts = make(chan os.Signal, 1)
+
+func init() {
+	signal.Notify(interrupts, os.Interrupt)
+}
+
+func Ignore() {
+	signal.Ignore(os.Interrupt)
+}
+
+func Reset() {
+	signal.Reset()
+}
+
+func WithInterrupt(ctx context.Context) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(ctx, os.Interrupt)
+}
@@ -0,0 +1,30 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package usesystemfiles is used for testing.
+package usesystemfiles
+
+import "os"
+
+func ReadMaps() ([]byte, error) {
+	return os.ReadFile("/proc/self/maps")
+}
+
+func OpenDevice() (*os.File, error) {
+	return os.OpenFile("/dev/null", os.O_RDONLY, 0)
+}
+
+func StatSys() (os.FileInfo, error) {
+	return os.Stat("/sys/kernel")
+}
+
+func ReadOther() ([]byte, error) {
+	return os.ReadFile("/etc/hostname")
+}
+
+func ReadPath(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
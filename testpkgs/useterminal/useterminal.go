@@ -0,0 +1,26 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package useterminal is used for testing.
+package useterminal
+
+import "golang.org/x/term"
+
+func Raw(fd int) (*term.State, error) {
+	return term.MakeRaw(fd)
+}
+
+func Password(fd int) ([]byte, error) {
+	return term.ReadPassword(fd)
+}
+
+func RestoreState(fd int, state *term.State) error {
+	return term.Restore(fd, state)
+}
+
+func IsTerminal(fd int) bool {
+	return term.IsTerminal(fd)
+}
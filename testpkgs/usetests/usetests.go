@@ -0,0 +1,15 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// Package usetests is used for testing.
+package usetests
+
+import "os"
+
+// Pid is a test function which calls os.Getpid.
+func Pid() int {
+	return os.Getpid()
+}
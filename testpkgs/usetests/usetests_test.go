@@ -0,0 +1,24 @@
+// Copyright 2026 Google LLC
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+package usetests
+
+import (
+	"net"
+	"testing"
+)
+
+// lookup is a test-only helper which calls net.LookupIP.
+func lookup() {
+	net.LookupIP("localhost")
+}
+
+func TestLookup(t *testing.T) {
+	lookup()
+	if Pid() == 0 {
+		t.Error("Pid() == 0")
+	}
+}